@@ -0,0 +1,33 @@
+package camera
+
+import (
+	"image"
+	"image/color"
+)
+
+const badgeSize = 16
+
+var badgeColors = map[CaptureSource]color.RGBA{
+	SourceFresh:     {R: 0x2e, G: 0xcc, B: 0x40},
+	SourceTimelapse: {R: 0xff, G: 0x41, B: 0x36},
+	SourceCache:     {R: 0xaa, G: 0xaa, B: 0xaa},
+}
+
+// drawBadge paints small square in the top-left corner, colored by capture source
+func drawBadge(img *image.YCbCr, source CaptureSource) {
+	c, ok := badgeColors[source]
+	if !ok {
+		return
+	}
+	y, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+
+	rect := image.Rect(0, 0, badgeSize, badgeSize).Add(img.Rect.Min).Intersect(img.Rect)
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			img.Y[img.YOffset(px, py)] = y
+			ci := img.COffset(px, py)
+			img.Cb[ci] = cb
+			img.Cr[ci] = cr
+		}
+	}
+}
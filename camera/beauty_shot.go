@@ -0,0 +1,57 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// beauty shot waits in frame dir till video is built. Its extension keeps it out of
+	// frame globs and counts
+	beautyShotFile = "final.jpeg"
+	// beauty shot is put next to video as <video w/o extension> + finalShotSuffix + ".jpg"
+	finalShotSuffix = ".final"
+)
+
+// takeBeautyShot captures photo of finished print with BeautyShot arguments to frame dir.
+// Frames are captured by rpicam only, other backends take none
+func (c *timelapseSvc) takeBeautyShot(ctx context.Context, dir string) error {
+	if len(c.camConfig.BeautyShot) == 0 || c.rpicam == nil {
+		return nil
+	}
+	args := c.camConfig.beautyShotOpts(c.rpicam, filepath.Join(dir, beautyShotFile))
+
+	c.lockCamera()
+	defer rpicamMutex.Unlock()
+
+	c.log.DebugContext(ctx, "rpicam beauty shot args", "binary", c.rpicam.Name, "args", args)
+	output, err := Runner.Run(ctx, c.rpicam.Path, args...)
+	c.log.DebugContext(ctx, "rpicam output", "output", string(output))
+	if err != nil {
+		return fmt.Errorf("fail to take beauty shot: %w", err)
+	}
+	return nil
+}
+
+// keepBeautyShot moves beauty shot of frame dir next to video stem and returns its path,
+// empty if there is none
+func keepBeautyShot(dir, stem string) (string, error) {
+	src := filepath.Join(dir, beautyShotFile)
+	if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	dst := stem + finalShotSuffix + ".jpg"
+	// frame dir is usually on other filesystem
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return "", fmt.Errorf("fail to keep beauty shot: %w", err)
+	}
+	os.Remove(src)
+	return dst, nil
+}
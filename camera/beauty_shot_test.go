@@ -0,0 +1,57 @@
+package camera
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBeautyShot(t *testing.T) {
+	runner := useFakeRunner(t)
+	out := t.TempDir()
+	dir := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{VideoLenght: 7, MinFPS: 12, OutputDir: out}, withRpicam())
+	ts.camConfig = &CameraConfig{ROI: "0.2,0,0.6,1", Width: 1280, BeautyShot: []string{"--hdr"}}
+	writeFile(t, shotFilename(dir, 0), fakeTimelapseFrame)
+
+	if err := ts.takeLastShot(t.Context(), dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 2 {
+		t.Fatalf("expected last frame and beauty shot, got %q", calls)
+	}
+	// the last frame keeps framing of video
+	if !slices.Contains(calls[0], "--roi") || slices.Contains(calls[0], "--hdr") {
+		t.Errorf("unexpected last frame args %q", calls[0])
+	}
+	want := []string{"--encoding", "jpg", "-n", "--hdr", "-o", filepath.Join(dir, beautyShotFile)}
+	if !slices.Equal(calls[1], want) {
+		t.Errorf("expected beauty shot args %q, got %q", want, calls[1])
+	}
+	if frames, err := frameFiles(dir); err != nil || len(frames) != 2 {
+		t.Errorf("beauty shot must not be a frame, got %q, %v", frames, err)
+	}
+
+	if err := ts.buildVideo(t.Context(), &BuildJob{Dir: dir, JobID: 42, JobName: "benchy.gcode", Frames: 2}); err != nil {
+		t.Fatal(err)
+	}
+	videos, err := listVideos(out)
+	if err != nil || len(videos) != 1 {
+		t.Fatalf("expected single video, got %+v, %v", videos, err)
+	}
+	final := videos[0].FinalShot
+	if final != trimVideoExt(videos[0].Path)+".final.jpg" || !exists(final) {
+		t.Errorf("expected beauty shot next to video, got %q", final)
+	}
+	if exists(filepath.Join(dir, beautyShotFile)) {
+		t.Error("beauty shot was left in frame dir")
+	}
+
+	if err := deleteVideo(out, videos[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	if exists(final) {
+		t.Error("beauty shot wasn't removed with video")
+	}
+}
@@ -0,0 +1,80 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrVideoExists is returned by BuildDir for existing output without Force
+var ErrVideoExists = errors.New("video already exists")
+
+// DirBuild is video build of frame dir left by failed or interrupted timelapse
+type DirBuild struct {
+	Dir string
+	// video file, its extension picks the format
+	Output string
+	// frames per second, picked like for timelapse if zero
+	FPS int
+	// existing Output and its sidecars are overwritten
+	Force bool
+	// ffmpeg progress, frame and percent, is printed to it if not nil
+	Progress io.Writer
+}
+
+// BuildDir builds video of frames of b.Dir the way timelapse build does, with timelapse config:
+// encoder, filters, thumbnail and metadata sidecar. Frames are left in place, nothing is uploaded
+func BuildDir(ctx context.Context, log *slog.Logger, config *TimelapseConfig, b DirBuild) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	format, ok := videoFormat(b.Output)
+	if !ok {
+		return fmt.Errorf("unknown video format of %s, expected %s extension", b.Output, strings.Join(videoFormats, ", "))
+	}
+	if _, err := os.Stat(b.Output); err == nil && !b.Force {
+		return fmt.Errorf("%w: %s", ErrVideoExists, b.Output)
+	}
+	if b.FPS < 0 {
+		return fmt.Errorf("invalid fps %d", b.FPS)
+	}
+	frames, err := frameFiles(b.Dir)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames in %s", b.Dir)
+	}
+
+	c := &timelapseSvc{log: log.With("svc", "timelapse"), camConfig: &CameraConfig{}, config: config, progress: b.Progress}
+	ffmpeg, err := c.ffmpegPath()
+	if err != nil {
+		return err
+	}
+	stem := strings.TrimSuffix(b.Output, filepath.Ext(b.Output))
+	job := &BuildJob{Dir: b.Dir, JobName: filepath.Base(stem), Frames: len(frames)}
+	job.StartedAt, job.FinishedAt = frameTimes(b.Dir, frames)
+	fps := b.FPS
+	if fps == 0 {
+		fps = config.videoFPS(job.Frames)
+	}
+
+	// ffmpeg doesn't overwrite output
+	if err := os.Remove(b.Output); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("fail to remove existing video: %w", err)
+	}
+	c.log.InfoContext(ctx, "building video", "dir", b.Dir, "frames", job.Frames, "fps", fps, "output", b.Output)
+	// single format fails as a whole, build runs till it's done or interrupted
+	meta, _, err := c.encodeVideos(ctx, ffmpeg, job, fps, stem, []string{format}, 0)
+	if err != nil {
+		return err
+	}
+	c.log.InfoContext(ctx, "video built", "output", b.Output, "bytes", meta.SizeBytes[format], "thumbnail", meta.Thumbnail)
+	return nil
+}
@@ -0,0 +1,78 @@
+package camera
+
+import (
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildDir(t *testing.T) {
+	runner := useFakeRunner(t)
+	dir := t.TempDir()
+	for i := range 3 {
+		writeFile(t, shotFilename(dir, i), fakeTimelapseFrame)
+	}
+	config := &TimelapseConfig{VideoLenght: 7, MinFPS: 12}
+	output := filepath.Join(t.TempDir(), "benchy.mp4")
+
+	if err := BuildDir(t.Context(), slog.Default(), config, DirBuild{Dir: dir, Output: output, FPS: 5}); err != nil {
+		t.Fatal(err)
+	}
+	args := runner.Calls("ffmpeg")[0]
+	if i := slices.Index(args, "-r"); i < 0 || args[i+1] != "5" || args[len(args)-1] != output {
+		t.Errorf("unexpected ffmpeg args %q", args)
+	}
+	meta, err := readVideoMeta(filepath.Join(filepath.Dir(output), "benchy"))
+	if err != nil || meta.Frames != 3 || meta.FPS != 5 || meta.JobName != "benchy" || !slices.Equal(meta.Formats, []string{VideoMP4}) {
+		t.Errorf("unexpected metadata %+v: %v", meta, err)
+	}
+	if frames, _ := frameFiles(dir); len(frames) != 3 {
+		t.Errorf("frames aren't left in place, got %q", frames)
+	}
+
+	if err := BuildDir(t.Context(), slog.Default(), config, DirBuild{Dir: dir, Output: output}); !errors.Is(err, ErrVideoExists) {
+		t.Errorf("expected ErrVideoExists, got %v", err)
+	}
+	if err := BuildDir(t.Context(), slog.Default(), config, DirBuild{Dir: dir, Output: output, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	// the last call extracts thumbnail
+	calls := runner.Calls("ffmpeg")
+	if args := calls[len(calls)-2]; args[slices.Index(args, "-r")+1] != "12" {
+		t.Errorf("expected rebuild at fps of config, got %q", args)
+	}
+
+	for _, b := range []DirBuild{
+		{Dir: dir, Output: filepath.Join(t.TempDir(), "benchy.avi")},
+		{Dir: t.TempDir(), Output: filepath.Join(t.TempDir(), "empty.mp4")},
+	} {
+		if err := BuildDir(t.Context(), slog.Default(), config, b); err == nil {
+			t.Errorf("%+v: expected error", b)
+		}
+	}
+}
+
+func TestBuildDirProgress(t *testing.T) {
+	runner := useFakeRunner(t)
+	dir := t.TempDir()
+	for i := range 3 {
+		writeFile(t, shotFilename(dir, i), fakeTimelapseFrame)
+	}
+	// 3 frames at 3 fps and a second of end hold make 2s video
+	config := &TimelapseConfig{VideoLenght: 7, MinFPS: 12, EndHoldSeconds: 1}
+	var progress strings.Builder
+	b := DirBuild{Dir: dir, Output: filepath.Join(t.TempDir(), "benchy.mp4"), FPS: 3, Progress: &progress}
+
+	if err := BuildDir(t.Context(), slog.Default(), config, b); err != nil {
+		t.Fatal(err)
+	}
+	if args := runner.Calls("ffmpeg")[0]; !slices.Equal(args[:3], ffmpegProgressArgs) {
+		t.Errorf("expected progress args, got %q", args)
+	}
+	if want := "mp4: frame 2, 0%\nmp4: frame 5, 50%\nmp4: frame 9, 100%\n"; progress.String() != want {
+		t.Errorf("expected progress %q, got %q", want, progress.String())
+	}
+}
@@ -0,0 +1,442 @@
+package camera
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	buildQueueSize = 10
+	// finished builds kept for Status, newest ones
+	buildHistorySize = 20
+
+	defaultBuildRetryDelay = 30 * time.Second
+	// kept in OutputDir, so pending builds survive restart
+	buildQueueFile = ".buildqueue.json"
+	// written to frame dir of build that failed for good, so sweep doesn't rebuild it
+	failedBuildFile = ".buildfailed.json"
+)
+
+var (
+	ErrBuildQueueFull = errors.New("build queue is full")
+	ErrBuildNotFound  = errors.New("build not found")
+	// wraps build errors retry can't fix
+	errNoRetry = errors.New("build isn't retried")
+)
+
+// BuildJob kinds, empty is video build
+const (
+	JobUpload = "upload"
+	// preview of running timelapse
+	JobPreview = "preview"
+	// poster of video built before thumbnails, Files holds its name
+	JobThumbnail = "thumbnail"
+)
+
+// BuildJob is a video build, or other encode work like upload of built one, waiting for
+// (or holding) a worker
+type BuildJob struct {
+	ID int64 `json:"id"`
+	// empty for build, upload, preview or thumbnail
+	Kind string `json:"kind,omitempty"`
+	Dir  string `json:"dir"`
+	// uploaded files of OutputDir, or video of thumbnail
+	Files    []string  `json:"files,omitempty"`
+	JobID    int       `json:"jobId"`
+	JobName  string    `json:"jobName"`
+	Frames   int       `json:"frames"`
+	QueuedAt time.Time `json:"queuedAt"`
+	// capture of the print, zero if it isn't known like for orphaned frames
+	StartedAt       time.Time   `json:"startedAt,omitzero"`
+	FinishedAt      time.Time   `json:"finishedAt,omitzero"`
+	IntervalSeconds float64     `json:"intervalSeconds,omitempty"`
+	Mode            CaptureMode `json:"mode,omitempty"`
+
+	// pending, running, succeeded, failed or cancelled
+	State          string    `json:"state,omitempty"`
+	BuildStartedAt time.Time `json:"buildStartedAt,omitzero"`
+	DoneAt         time.Time `json:"doneAt,omitzero"`
+	// why build failed, frames are kept in Dir
+	Error string `json:"error,omitempty"`
+	// failed attempts retried so far, pending build waits till RetryAt
+	Retries int       `json:"retries,omitempty"`
+	RetryAt time.Time `json:"retryAt,omitzero"`
+
+	// closed when submitted job is done, err is its result
+	done chan struct{}
+	err  error
+}
+
+// wait blocks till submitted job is done and returns its error. Job stays queued if ctx
+// is done first
+func (job *BuildJob) wait(ctx context.Context) error {
+	select {
+	case <-job.done:
+		return job.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+const (
+	BuildPending   = "pending"
+	BuildRunning   = "running"
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+	BuildCancelled = "cancelled"
+)
+
+// BuildsStatus is a snapshot of build queue. Position in queue is index in Pending,
+// Done holds recently finished builds newest first
+type BuildsStatus struct {
+	Active  []BuildJob `json:"active,omitempty"`
+	Pending []BuildJob `json:"pending"`
+	Done    []BuildJob `json:"done,omitempty"`
+}
+
+// buildQueue runs encode work on fixed number of workers, one by default,
+// so ffmpeg doesn't starve the stream
+type buildQueue struct {
+	log       *slog.Logger
+	stateFile string
+	workers   int
+	build     func(ctx context.Context, job *BuildJob) error
+	// failed build is queued again up to retries times, after retryDelay doubled every time
+	retries    int
+	retryDelay time.Duration
+
+	sync.Mutex
+	pending []*BuildJob
+	active  []*activeBuild
+	done    []BuildJob
+	lastID  int64
+	// workers don't take pending jobs after shutdown, they're built on the next start
+	stopped bool
+
+	wake chan struct{}
+}
+
+func (cfg *TimelapseConfig) buildRetryDelay() time.Duration {
+	return cmp.Or(cfg.BuildRetryDelay, defaultBuildRetryDelay)
+}
+
+type activeBuild struct {
+	job    *BuildJob
+	cancel func()
+}
+
+func newBuildQueue(log *slog.Logger, stateFile string, workers int, build func(ctx context.Context, job *BuildJob) error) *buildQueue {
+	q := &buildQueue{
+		log:       log.With("svc", "buildQueue"),
+		stateFile: stateFile,
+		workers:   max(workers, 1),
+		build:     build,
+		wake:      make(chan struct{}, 1),
+	}
+	q.restore()
+
+	return q
+}
+
+// restore loads builds pending at shutdown
+func (q *buildQueue) restore() {
+	data, err := os.ReadFile(q.stateFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			q.log.Warn("fail to read build queue state", "err", err)
+		}
+		return
+	}
+
+	var jobs []*BuildJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		q.log.Warn("fail to parse build queue state", "err", err)
+		return
+	}
+
+	for _, job := range jobs {
+		q.lastID = max(q.lastID, job.ID)
+		if _, err := os.Stat(job.Dir); err != nil && job.Kind != JobUpload {
+			q.log.Warn("skipping pending build, frames are gone", "dir", job.Dir, "err", err)
+			continue
+		}
+		q.log.Info("resuming pending build", "id", job.ID, "jobName", job.JobName, "dir", job.Dir)
+		job.State = BuildPending
+		job.BuildStartedAt = time.Time{}
+		q.pending = append(q.pending, job)
+	}
+	q.notify()
+}
+
+func (q *buildQueue) Enqueue(job *BuildJob) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.pending) >= buildQueueSize {
+		return ErrBuildQueueFull
+	}
+
+	q.lastID++
+	job.ID = q.lastID
+	job.QueuedAt = time.Now()
+	job.State = BuildPending
+	q.pending = append(q.pending, job)
+	q.save()
+	q.notify()
+
+	q.log.Info("build queued", "id", job.ID, "jobName", job.JobName, "position", len(q.pending))
+	return nil
+}
+
+// Submit queues job somebody waits for, like preview requested by user. It isn't persisted,
+// retried or kept in history
+func (q *buildQueue) Submit(job *BuildJob) error {
+	job.done = make(chan struct{})
+	return q.Enqueue(job)
+}
+
+// Cancel removes pending build or stops the active one
+func (q *buildQueue) Cancel(id int64) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if i := slices.IndexFunc(q.active, func(a *activeBuild) bool { return a.job.ID == id }); i >= 0 {
+		q.log.Info("cancelling active build", "id", id)
+		q.active[i].cancel()
+		return nil
+	}
+
+	i := slices.IndexFunc(q.pending, func(job *BuildJob) bool { return job.ID == id })
+	if i < 0 {
+		return ErrBuildNotFound
+	}
+	job := q.pending[i]
+	q.pending = slices.Delete(q.pending, i, i+1)
+	q.save()
+	if job.done != nil {
+		job.err = context.Canceled
+		close(job.done)
+	}
+
+	q.log.Info("pending build cancelled", "id", id)
+	return nil
+}
+
+func (q *buildQueue) Status() *BuildsStatus {
+	q.Lock()
+	defer q.Unlock()
+
+	st := &BuildsStatus{Pending: make([]BuildJob, 0, len(q.pending))}
+	for _, a := range q.active {
+		st.Active = append(st.Active, *a.job)
+	}
+	for _, job := range q.pending {
+		st.Pending = append(st.Pending, *job)
+	}
+	st.Done = slices.Clone(q.done)
+	return st
+}
+
+// run starts workers, it returns when the last one does after stop
+func (q *buildQueue) run() {
+	for range q.workers - 1 {
+		go q.work()
+	}
+	q.work()
+}
+
+func (q *buildQueue) work() {
+	for {
+		job, ctx := q.next()
+		if job == nil {
+			return
+		}
+
+		err := q.build(ctx, job)
+
+		q.Lock()
+		job.DoneAt = time.Now()
+		switch {
+		case err == nil:
+			job.State = BuildSucceeded
+			job.Error = ""
+		case ctx.Err() != nil:
+			job.State = BuildCancelled
+			job.Error = err.Error()
+		default:
+			job.State = BuildFailed
+			job.Error = err.Error()
+		}
+		i := slices.IndexFunc(q.active, func(a *activeBuild) bool { return a.job == job })
+		q.active[i].cancel()
+		q.active = slices.Delete(q.active, i, i+1)
+		submitted := job.done != nil
+		if !submitted {
+			q.done = slices.Insert(q.done, 0, *job)
+			q.done = q.done[:min(len(q.done), buildHistorySize)]
+		}
+		retry := !submitted && job.State == BuildFailed && job.Retries < q.retries && !errors.Is(err, errNoRetry)
+		if retry {
+			job.Retries++
+			job.State = BuildPending
+			job.RetryAt = job.DoneAt.Add(q.retryDelay << (job.Retries - 1))
+			job.BuildStartedAt, job.DoneAt = time.Time{}, time.Time{}
+			q.pending = append(q.pending, job)
+			q.notify()
+		}
+		failed := !submitted && !retry && job.State == BuildFailed && job.Kind == ""
+		if failed {
+			if err := markBuildFailed(job); err != nil {
+				q.log.Warn("fail to mark frames of failed build", "id", job.ID, "dir", job.Dir, "err", err)
+			}
+		}
+		q.save()
+		// waiter is woken after state is saved, queue doesn't write files it may remove
+		if submitted {
+			job.err = err
+			close(job.done)
+		}
+		q.Unlock()
+
+		switch {
+		case retry:
+			q.log.Warn("build failed, frames are kept for retry", "id", job.ID, "jobName", job.JobName,
+				"retry", job.Retries, "retryAt", job.RetryAt, "err", err)
+		case err != nil:
+			q.log.Error("build failed", "id", job.ID, "jobName", job.JobName, "state", job.State, "dir", job.Dir, "err", err)
+		}
+	}
+}
+
+// next blocks till there is a pending job due and makes it active, nil is returned after stop
+func (q *buildQueue) next() (*BuildJob, context.Context) {
+	for {
+		q.Lock()
+		if q.stopped {
+			q.Unlock()
+			// other workers are waiting too
+			q.notify()
+			return nil, nil
+		}
+		now := time.Now()
+		if i := slices.IndexFunc(q.pending, func(job *BuildJob) bool { return !job.RetryAt.After(now) }); i >= 0 {
+			job := q.pending[i]
+			q.pending = slices.Delete(q.pending, i, i+1)
+			job.State = BuildRunning
+			job.RetryAt = time.Time{}
+			job.BuildStartedAt = time.Now()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			q.active = append(q.active, &activeBuild{job: job, cancel: cancel})
+			q.save()
+			// other workers may be waiting for the rest
+			if len(q.pending) > 0 {
+				q.notify()
+			}
+			q.Unlock()
+			return job, ctx
+		}
+		// all pending builds wait for retry, sleep till the first one is due
+		wait := time.Duration(-1)
+		for _, job := range q.pending {
+			if d := job.RetryAt.Sub(now); wait < 0 || d < wait {
+				wait = d
+			}
+		}
+		q.Unlock()
+
+		if wait < 0 {
+			<-q.wake
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// stop makes workers exit instead of taking the next job, pending ones stay persisted.
+// Running builds aren't waited for
+func (q *buildQueue) stop() {
+	q.Lock()
+	q.stopped = true
+	q.Unlock()
+	q.notify()
+}
+
+func (q *buildQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save persists active and pending jobs but submitted ones. Should be run with locked mutex
+func (q *buildQueue) save() {
+	jobs := make([]*BuildJob, 0, len(q.pending)+len(q.active))
+	for _, a := range q.active {
+		if a.job.done == nil {
+			jobs = append(jobs, a.job)
+		}
+	}
+	for _, job := range q.pending {
+		if job.done == nil {
+			jobs = append(jobs, job)
+		}
+	}
+
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		q.log.Error("fail to marshal build queue", "err", err)
+		return
+	}
+
+	if err := writeFileAtomic(q.stateFile, data); err != nil {
+		q.log.Error("fail to save build queue", "err", err)
+	}
+}
+
+// markBuildFailed saves job to its frame dir, frames stay there till user builds or removes them
+func markBuildFailed(job *BuildJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("fail to marshal failed build: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(job.Dir, failedBuildFile), data)
+}
+
+// failedBuild returns build that failed for good with frames of dir, nil if there is none
+func failedBuild(dir string) *BuildJob {
+	data, err := os.ReadFile(filepath.Join(dir, failedBuildFile))
+	if err != nil {
+		return nil
+	}
+	job := &BuildJob{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil
+	}
+	return job
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("fail to write file: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("fail to rename file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBuildQueueRestore(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, buildQueueFile)
+	noop := func(ctx context.Context, job *BuildJob) error { return nil }
+
+	q := newBuildQueue(slog.Default(), stateFile, 1, noop)
+	for _, name := range []string{"first", "second", "third"} {
+		if err := q.Enqueue(&BuildJob{Dir: dir, JobName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Cancel(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Cancel(42); !errors.Is(err, ErrBuildNotFound) {
+		t.Fatalf("expected ErrBuildNotFound, got %v", err)
+	}
+
+	// worker was never started, so everything is still pending after "restart"
+	restored := newBuildQueue(slog.Default(), stateFile, 1, noop)
+	st := restored.Status()
+	if len(st.Pending) != 2 || st.Pending[0].JobName != "first" || st.Pending[1].JobName != "third" {
+		t.Fatalf("unexpected pending builds: %+v", st.Pending)
+	}
+
+	if err := restored.Enqueue(&BuildJob{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if id := restored.Status().Pending[2].ID; id != 4 {
+		t.Fatalf("expected ids to continue after restore, got %d", id)
+	}
+}
+
+func TestBuildQueueSerial(t *testing.T) {
+	dir := t.TempDir()
+	built := make(chan string)
+	release := make(chan struct{})
+	build := func(ctx context.Context, job *BuildJob) error {
+		built <- job.JobName
+		<-release
+		return nil
+	}
+
+	q := newBuildQueue(slog.Default(), filepath.Join(dir, buildQueueFile), 1, build)
+	for _, name := range []string{"first", "second"} {
+		if err := q.Enqueue(&BuildJob{Dir: dir, JobName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go q.run()
+
+	if name := <-built; name != "first" {
+		t.Fatalf("expected first build, got %s", name)
+	}
+	st := q.Status()
+	if len(st.Active) != 1 || st.Active[0].JobName != "first" || st.Active[0].State != BuildRunning || len(st.Pending) != 1 {
+		t.Fatalf("unexpected status while building: %+v", st)
+	}
+	// second build keeps running, so queue doesn't write state while temp dir is removed
+	release <- struct{}{}
+	if name := <-built; name != "second" {
+		t.Fatalf("expected second build, got %s", name)
+	}
+}
+
+func TestBuildQueueStop(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, buildQueueFile)
+	built := make(chan string, 1)
+	build := func(ctx context.Context, job *BuildJob) error {
+		built <- job.JobName
+		return nil
+	}
+
+	q := newBuildQueue(slog.Default(), stateFile, 2, build)
+	q.stop()
+	if err := q.Enqueue(&BuildJob{Dir: dir, JobName: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.run()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers don't exit after stop")
+	}
+	if len(built) > 0 {
+		t.Fatalf("%s is built after stop", <-built)
+	}
+	restored := newBuildQueue(slog.Default(), stateFile, 1, build)
+	if st := restored.Status(); len(st.Pending) != 1 || st.Pending[0].JobName != "first" {
+		t.Fatalf("pending build isn't kept for the next start: %+v", st)
+	}
+}
+
+func TestBuildQueueHistory(t *testing.T) {
+	dir := t.TempDir()
+	built := make(chan string)
+	release := make(chan struct{})
+	build := func(ctx context.Context, job *BuildJob) error {
+		built <- job.JobName
+		<-release
+		if job.JobName == "broken" {
+			return errors.New("ffmpeg exited")
+		}
+		return nil
+	}
+
+	q := newBuildQueue(slog.Default(), filepath.Join(dir, buildQueueFile), 2, build)
+	for _, name := range []string{"ok", "broken"} {
+		if err := q.Enqueue(&BuildJob{Dir: dir, JobName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go q.run()
+
+	// both run at once with 2 workers
+	<-built
+	<-built
+	if st := q.Status(); len(st.Active) != 2 || len(st.Pending) != 0 {
+		t.Fatalf("expected 2 active builds, got %+v", st)
+	}
+	close(release)
+
+	var st *BuildsStatus
+	for range 100 {
+		if st = q.Status(); len(st.Done) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(st.Done) != 2 || len(st.Active) != 0 {
+		t.Fatalf("expected 2 finished builds, got %+v", st)
+	}
+	for _, job := range st.Done {
+		want := BuildSucceeded
+		if job.JobName == "broken" {
+			want = BuildFailed
+		}
+		if job.State != want || job.BuildStartedAt.IsZero() || job.DoneAt.IsZero() {
+			t.Errorf("unexpected finished build %+v", job)
+		}
+		if (job.Error != "") != (want == BuildFailed) {
+			t.Errorf("unexpected error of %s: %q", job.JobName, job.Error)
+		}
+	}
+}
+
+func TestBuildQueueRetry(t *testing.T) {
+	dir := t.TempDir()
+	attempts := make(chan int, 10)
+	build := func(ctx context.Context, job *BuildJob) error {
+		attempts <- job.Retries
+		switch {
+		case job.JobName == "partial":
+			return fmt.Errorf("%w: webm failed", errNoRetry)
+		case job.Retries < 2:
+			return errors.New("disk busy")
+		}
+		return nil
+	}
+
+	q := newBuildQueue(slog.Default(), filepath.Join(dir, buildQueueFile), 1, build)
+	q.retries = 3
+	q.retryDelay = time.Millisecond
+	for _, name := range []string{"flaky", "partial"} {
+		if err := q.Enqueue(&BuildJob{Dir: dir, JobName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go q.run()
+
+	var st *BuildsStatus
+	for range 100 {
+		if st = q.Status(); len(st.Done) == 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// flaky fails twice and succeeds on the second retry, partial isn't retried
+	var states []string
+	for _, job := range slices.Backward(st.Done) {
+		states = append(states, job.JobName+":"+job.State)
+	}
+	want := []string{"flaky:failed", "partial:failed", "flaky:failed", "flaky:succeeded"}
+	if !slices.Equal(states, want) || len(st.Pending) != 0 {
+		t.Fatalf("expected builds %v, got %v, pending %+v", want, states, st.Pending)
+	}
+	if st.Done[0].Retries != 2 || st.Done[0].Error != "" {
+		t.Errorf("unexpected succeeded build %+v", st.Done[0])
+	}
+	// partial failed for good, its frames are marked so sweep doesn't queue them again
+	if job := failedBuild(dir); job == nil || job.JobName != "partial" || job.Error != "build isn't retried: webm failed" {
+		t.Errorf("unexpected failed build mark %+v", job)
+	}
+}
@@ -0,0 +1,134 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// burst is for comparing a few frames, not a timelapse
+	MaxBurstFrames   = 20
+	MaxBurstDuration = time.Minute
+)
+
+var (
+	// ErrNoBurst is returned by cameras which can't capture bursts
+	ErrNoBurst = errors.New("camera doesn't support burst capture")
+	// ErrInvalidBurst is returned for frame count or interval out of limits
+	ErrInvalidBurst = errors.New("invalid burst")
+)
+
+// Burster is camera able to capture several frames in quick succession
+type Burster interface {
+	// Burst captures n frames interval apart
+	Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error)
+}
+
+// validateBurst keeps burst within MaxBurstFrames and MaxBurstDuration
+func validateBurst(n int, interval time.Duration) error {
+	if n < 1 || n > MaxBurstFrames {
+		return fmt.Errorf("%w: %d frames, expected 1-%d", ErrInvalidBurst, n, MaxBurstFrames)
+	}
+	if interval <= 0 || time.Duration(n-1)*interval > MaxBurstDuration {
+		return fmt.Errorf("%w: interval %s, burst has to fit %s", ErrInvalidBurst, interval, MaxBurstDuration)
+	}
+	return nil
+}
+
+// snapshotBurst takes n snapshots of cam interval apart, for cameras keeping the latest frame
+func snapshotBurst(ctx context.Context, cam Camera, n int, interval time.Duration) ([]*Frame, error) {
+	if err := validateBurst(n, interval); err != nil {
+		return nil, err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	frames := make([]*Frame, 0, n)
+	for {
+		frame, err := cam.Snapshot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fail to take burst frame %d: %w", len(frames)+1, err)
+		}
+		frames = append(frames, frame)
+		if len(frames) == n {
+			return frames, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Burst runs rpicam in timelapse mode for n frames. Like autofocus, it waits for stream and
+// persistent capture to yield camera and fails while timelapse holds it
+func (c *rpiCamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	if !c.rpicam.timelapse {
+		return nil, fmt.Errorf("%w: %s has no timelapse mode", ErrNoBurst, c.rpicam.Name)
+	}
+	if err := validateBurst(n, interval); err != nil {
+		return nil, err
+	}
+	if c.Capturing() {
+		return nil, ErrCameraBusy
+	}
+
+	dir, err := os.MkdirTemp(c.tmpDir, "burst")
+	if err != nil {
+		return nil, fmt.Errorf("fail to create burst dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := append(c.camConfig.cameraOpts(c.rpicam, c.camConfig.profileAt(time.Now())),
+		"--timelapse", fmt.Sprint(interval.Milliseconds()),
+		// frame is taken at start and every interval till timeout
+		"--timeout", fmt.Sprint((time.Duration(n-1)*interval + interval/2).Milliseconds()),
+		"-o", filepath.Join(dir, "burst%04d.jpg"),
+	)
+
+	c.lockCamera()
+	c.log.DebugContext(ctx, "rpicam burst args", "binary", c.rpicam.Name, "args", args)
+	output, err := Runner.Run(ctx, c.rpicam.Path, args...)
+	rpicamMutex.Unlock()
+	c.log.DebugContext(ctx, "rpicam output", "output", string(output))
+	if err != nil {
+		return nil, fmt.Errorf("fail to run %s: %w", c.rpicam.Name, err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "burst*.jpg"))
+	if err != nil {
+		return nil, fmt.Errorf("fail to list burst frames: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s took no burst frames", c.rpicam.Name)
+	}
+	slices.Sort(names)
+
+	frames := make([]*Frame, 0, n)
+	for _, name := range names[:min(n, len(names))] {
+		frame, err := readFrame(name, SourceFresh)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// Burst samples the latest frame, device gives frames continuously
+func (c *usbcamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	return snapshotBurst(ctx, c, n, interval)
+}
+
+func (c *mockCamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	return snapshotBurst(ctx, c, n, interval)
+}
@@ -0,0 +1,101 @@
+package camera
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateBurst(t *testing.T) {
+	tests := []struct {
+		n        int
+		interval time.Duration
+		valid    bool
+	}{
+		{5, time.Second, true},
+		{1, time.Millisecond, true},
+		{MaxBurstFrames, 3 * time.Second, true},
+		{0, time.Second, false},
+		{MaxBurstFrames + 1, time.Second, false},
+		{5, 0, false},
+		{5, 20 * time.Second, false},
+	}
+	for _, tt := range tests {
+		err := validateBurst(tt.n, tt.interval)
+		if tt.valid != (err == nil) {
+			t.Errorf("%d frames %s apart: expected valid %v, got %v", tt.n, tt.interval, tt.valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidBurst) {
+			t.Errorf("expected ErrInvalidBurst, got %v", err)
+		}
+	}
+}
+
+func TestRPIBurst(t *testing.T) {
+	runner := useFakeRunner(t)
+	c := newTestRPICamera(t)
+	c.camConfig = &CameraConfig{}
+
+	frames, err := c.Burst(t.Context(), 3, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []string
+	for _, frame := range frames {
+		data = append(data, string(frame.Data))
+	}
+	if want := []string{"jpg0", "jpg1", "jpg2"}; !slices.Equal(data, want) {
+		t.Errorf("expected frames %q, got %q", want, data)
+	}
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 1 || !slices.Contains(calls[0], "--timelapse") {
+		t.Errorf("unexpected rpicam calls %q", calls)
+	}
+	if !rpicamMutex.TryLock() {
+		t.Fatal("burst doesn't release camera")
+	}
+	rpicamMutex.Unlock()
+	if entries, _ := os.ReadDir(c.tmpDir); len(entries) != 0 {
+		t.Errorf("burst files are left: %v", entries)
+	}
+
+	if _, err := c.Burst(t.Context(), MaxBurstFrames+1, time.Second); !errors.Is(err, ErrInvalidBurst) {
+		t.Errorf("expected ErrInvalidBurst, got %v", err)
+	}
+	c.tlRunning.Store(true)
+	if _, err := c.Burst(t.Context(), 3, time.Second); !errors.Is(err, ErrCameraBusy) {
+		t.Errorf("expected ErrCameraBusy during timelapse, got %v", err)
+	}
+}
+
+func TestSnapshotBurst(t *testing.T) {
+	cam, err := New(slog.Default(), nil, nil, &CameraConfig{Type: TypeMock, Exif: true}, &TimelapseConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cam.Close(t.Context())
+
+	started := time.Now()
+	burster, ok := cam.(Burster)
+	if !ok {
+		t.Fatalf("%T doesn't capture bursts", cam)
+	}
+	frames, err := burster.Burst(t.Context(), 3, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(frames))
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("expected frames interval apart, got burst in %s", elapsed)
+	}
+	for _, frame := range frames {
+		if readExif(t, frame.Data)[exifTagModel] != TypeMock {
+			t.Error("burst frame isn't tagged")
+		}
+	}
+}
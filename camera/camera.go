@@ -1,6 +1,30 @@
 package camera
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrCameraUnavailable is returned while camera is lost and being reconnected
+	ErrCameraUnavailable = errors.New("camera unavailable")
+	// ErrCameraBusy is returned when camera is committed to timelapse or held by another capture
+	ErrCameraBusy = errors.New("camera is busy")
+	// ErrNoAutofocus is returned by cameras which can't focus
+	ErrNoAutofocus = errors.New("camera doesn't support autofocus")
+	// ErrNoControls is returned by cameras without device controls
+	ErrNoControls = errors.New("camera has no controls")
+	// ErrClosed is returned by camera calls after Close
+	ErrClosed = errors.New("camera is closed")
+)
+
+// frames older than that aren't served, if not configured
+const (
+	defaultMaxFrameAge    = 10 * time.Second
+	defaultSnapshotMaxAge = 2 * time.Second
+)
 
 type CameraWithTL interface {
 	Camera
@@ -8,13 +32,249 @@ type CameraWithTL interface {
 }
 
 type Camera interface {
-	Snapshot(ctx context.Context) ([]byte, error)
+	Snapshot(ctx context.Context) (*Frame, error)
 	Stream(ctx context.Context) (chan []byte, error)
+	Info(ctx context.Context) (*Info, error)
+	// Health reports capture state without touching device
+	Health(ctx context.Context) (*Health, error)
+	// Close stops streams and background capture and releases device
+	Close(ctx context.Context) error
+}
+
+// Focuser is camera able to run autofocus cycle
+type Focuser interface {
+	// Autofocus focuses camera and returns fresh frame taken with that focus
+	Autofocus(ctx context.Context) (*Frame, error)
+}
+
+// CaptureSource tells where snapshot came from
+type CaptureSource string
+
+const (
+	// captured right now for this request
+	SourceFresh CaptureSource = "fresh"
+	// camera is busy with timelapse, latest timelapse frame is served
+	SourceTimelapse CaptureSource = "timelapse-frame"
+	// recently captured frame is reused
+	SourceCache CaptureSource = "cache"
+)
+
+// Control is device setting, Name is the key it's configured with
+type Control struct {
+	Name  string `json:"name"`
+	Value int32  `json:"value"`
+	Min   int32  `json:"min"`
+	Max   int32  `json:"max"`
+	Step  int32  `json:"step,omitempty"`
+}
+
+// Controller is camera with device controls
+type Controller interface {
+	// Controls returns current values of controls device supports
+	Controls(ctx context.Context) ([]Control, error)
+}
+
+type freshKey struct{}
+
+// WithFresh marks snapshot request which mustn't be served with reused shot
+func WithFresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+// IsFresh reports whether ctx is marked by WithFresh
+func IsFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+type Frame struct {
+	Data       []byte
+	Source     CaptureSource
+	CapturedAt time.Time
+	// FormatJPEG if empty
+	Format string
+}
+
+func (f *Frame) format() string {
+	if f.Format == "" {
+		return FormatJPEG
+	}
+	return f.Format
+}
+
+// Info describes camera backend in use
+type Info struct {
+	Backend string `json:"backend"`
+	Device  string `json:"device,omitempty"`
+	Binary  string `json:"binary,omitempty"`
+	Version string `json:"version,omitempty"`
+	// capture profile in use, empty if there are no profiles configured
+	Profile string `json:"profile,omitempty"`
+	// when usb camera gave the latest frame, omitted before the first one
+	LastFrameAt *time.Time `json:"lastFrameAt,omitempty"`
+}
+
+// TimelapseStatus is state of timelapse capture, job fields are set while it's running
+type TimelapseStatus struct {
+	Running bool        `json:"running"`
+	Mode    CaptureMode `json:"mode,omitempty"`
+	// started by StartManual rather than by print
+	Manual    bool      `json:"manual,omitempty"`
+	JobID     int       `json:"jobId,omitempty"`
+	JobName   string    `json:"jobName,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	// frames in Dir so far
+	Frames int    `json:"frames"`
+	Dir    string `json:"dir,omitempty"`
+	// interval picked for the running job, configured one otherwise
+	IntervalSeconds float64 `json:"intervalSeconds"`
+	// zero and omitted before the first frame
+	LastCaptureAt time.Time `json:"lastCaptureAt,omitzero"`
+	// free space for frames, LowSpace is set below timelapse.minFreeSpace
+	FreeSpaceBytes uint64 `json:"freeSpaceBytes"`
+	LowSpace       bool   `json:"lowSpace,omitempty"`
+	// capture of running timelapse was stopped by low space or maxFrames
+	CaptureStopped bool `json:"captureStopped,omitempty"`
+	// capture stopped at MaxFrames
+	FramesCapped bool `json:"framesCapped,omitempty"`
+	// times every other frame was deleted at MaxFrames, interval is doubled each time
+	Thinned int `json:"thinned,omitempty"`
+	// times capture was restarted after it exited on its own
+	Restarts int `json:"restarts,omitempty"`
+	// video builds queued, running and recently finished
+	Builds *BuildsStatus `json:"builds,omitempty"`
 }
 
 type Timelapse interface {
-	Status(ctx context.Context) (any, error)
-	List(ctx context.Context) ([]any, error)
+	Status(ctx context.Context) (*TimelapseStatus, error)
+	// List returns finished videos newest first
+	List(ctx context.Context) ([]TimelapseVideo, error)
+	// Delete removes video listed by List
+	Delete(ctx context.Context, name string) error
+	// Thumbnail returns path of poster image of video listed by List
+	Thumbnail(ctx context.Context, name string) (string, error)
+	// Preview returns path of mp4 built from frames of running timelapse captured so far
+	Preview(ctx context.Context) (string, error)
+	// StartManual starts timelapse which runs till StopManual, whatever printer does
+	StartManual(ctx context.Context, name string) error
+	StopManual(ctx context.Context) error
+	Builds(ctx context.Context) (*BuildsStatus, error)
+	CancelBuild(ctx context.Context, id int64) error
+	// Capturing reports whether camera is committed to timelapse capture
+	Capturing() bool
+}
+
+const (
+	FocusManual     = "manual"
+	FocusContinuous = "continuous"
+	FocusLastShot   = "last-shot"
+)
+
+const (
+	TypeRPI  = "rpi"
+	TypeUSB  = "usb"
+	TypeMock = "mock"
+	TypeHTTP = "http"
+	TypeRTSP = "rtsp"
+)
+
+type CameraConfig struct {
+	// tells cameras apart when there are several
+	Name string
+	// rpi, usb, http, rtsp or mock, rpi if empty
+	Type string
+	// usb device path, index, card name substring or USB vendor:product id, /dev/video0 if empty
+	Device string
+	// usb pixel format mjpeg, jpeg, yuyv, yu12 or nv12, the best one camera offers if empty
+	PixelFormat string
+	// usb V4L2 controls by name, e.g. brightness or power_line_frequency. Unsupported ones are skipped
+	Controls map[string]int32
+	// rpicam binary name or path, autodetected when empty
+	Binary string
+	// draw capture source badge in the corner of stream frames
+	SourceBadge bool
+	Overlay     OverlayConfig
+	Motion      MotionConfig
+	Light       LightConfig
+	// write capture time, backend and printer job into EXIF of snapshots and timelapse frames.
+	// Costs CPU on Pi Zero
+	Exif bool
+	// stream frame rate, 5 if zero, capped at 30. Frames are dropped when encoding can't keep up
+	StreamFPS float64
+	// rpi snapshot taken within that age is served to other requests instead of new shot,
+	// 2 seconds if zero, negative disables reuse
+	SnapshotMaxAge time.Duration
+	// usb camera reports itself unavailable instead of serving older frame and is reopened
+	// when it gives no frame for that long, 10 seconds if zero
+	MaxFrameAge time.Duration
+	// usb frames dropped after streaming starts or device is reopened, while auto exposure converges.
+	// Both count and time have to pass, zero disables each
+	WarmUpFrames int
+	WarmUpTime   time.Duration
+	// mock camera cycles through JPEG files of the directory, renders test pattern if empty
+	MockDir string
+	// http camera URLs, snapshot one is fetched per frame, MJPEG stream is read continuously.
+	// Either or both can be set, basic auth is used if username isn't empty
+	SnapshotURL  string
+	StreamURL    string
+	HTTPUsername string
+	HTTPPassword string
+	// rtsp camera URL read with ffmpeg, credentials may be put into it
+	RTSPURL string
+	// tcp or udp, tcp if empty
+	RTSPTransport string
+
+	// capture options, empty ones are not passed to rpicam so its defaults apply.
+	// 0, 90, 180 or 270 degrees clockwise, rpicam can do 0 and 180 only.
+	// Usb frames are rotated and flipped in software
+	Rotation int
+	HFlip    bool
+	VFlip    bool
+	// digital zoom "x,y,w,h" in sensor fractions, e.g. "0.2,0,0.6,1"
+	ROI string
+	// output size, usb camera picks the largest supported size not exceeding it
+	Width  int
+	Height int
+	// manual, continuous or last-shot, manual if LensPosition is set and rpicam default otherwise.
+	// last-shot keeps LensPosition for timelapse frames and focuses before the final shot
+	FocusMode string
+	// "x,y,w,h" frame fractions sharpness of focus assist is measured in, whole frame if empty
+	FocusRegion string
+	// manual focus in dioptres, autofocus if nil
+	LensPosition *float64
+	Exposure     ExposureConfig
+	// appended to rpicam arguments as is
+	ExtraArgs []string
+	// run rpicam per snapshot instead of keeping capture process triggered by signal
+	OneShotCapture bool
+	// rpicam arguments switched by time of day, the first matching profile applies.
+	// Day profile, with capture options only, is used outside of their windows
+	Profiles []CaptureProfile
+	// rpicam arguments of photo of finished print, e.g. "--autofocus-on-capture", "--hdr".
+	// It's taken of full sensor after the last frame and kept next to video. None if empty
+	BeautyShot []string
+}
+
+// ExposureConfig is rpicam exposure and white balance, unset values are left to rpicam
+type ExposureConfig struct {
+	// fixed shutter time, rpicam picks one if zero
+	Shutter time.Duration
+	// analogue gain, rpicam picks one if nil
+	Gain *float64
+	// white balance mode: auto, incandescent, tungsten, fluorescent, indoor, daylight or cloudy
+	AWB string
+	// exposure compensation in stops, -10..10
+	EV *float64
+}
+
+// CaptureProfile is rpicam arguments added to capture options within daily time window
+type CaptureProfile struct {
+	Name string
+	// local time "15:04", window wraps midnight if To is before From
+	From string
+	To   string
+	// e.g. "--hdr", "--shutter", "20000", "--gain", "4"
+	Args []string
 }
 
 type TimelapseConfig struct {
@@ -25,4 +285,155 @@ type TimelapseConfig struct {
 	VideoLenght int
 	OutputDir   string
 	MinFPS      int
+	// frames are captured there, created if missing. System temp dir is used if it's
+	// empty or not writable
+	WorkDir string
+
+	// pick capture interval from printer's time remaining or slicer estimate, so the video
+	// gets VideoLenght seconds at MinFPS. Interval is used if neither is known
+	AdaptiveInterval bool
+	// bounds of adaptive interval in seconds, zero MaxInterval doesn't limit it
+	MinInterval int
+	MaxInterval int
+	// printer has to stay in finished or idle state that long to finish timelapse,
+	// so connection hiccups don't end it mid-print. Zero finishes on first such state
+	StopGrace time.Duration
+	// when capture of print starts: immediately, progress (once progress moves, skipping
+	// calibration) or percent of progress like "5". progress if empty
+	StartAt string
+	// capture starts anyway if printing job doesn't meet StartAt that long, in other states
+	// it's skipped. 30m if zero
+	StartTimeout time.Duration
+
+	// ModeTime if empty, progress mode polls printer every ProgressPoll
+	Mode          CaptureMode
+	ProgressDelta float64
+	ProgressPoll  time.Duration
+
+	// what to do with leftovers of crashed runs found at startup. Frames of builds that
+	// failed for good are kept either way
+	OrphanFrames   string // rebuild | delete
+	PartialOutputs string // quarantine | delete
+	// what shutdown does with running timelapse, resume if empty
+	OnShutdown string // resume | finish
+
+	// ffmpeg binary building videos, looked up in PATH if empty
+	FFmpeg string
+	// libx264 or h264_v4l2m2m, hardware encoder of Pi. libx264 is used if it fails
+	Encoder string
+	Output  VideoOutput
+	// mp4, webm or gif, every one is built from the same frames. mp4 if empty
+	Formats []string
+	// video ends with the last frame, finished print, held that long. Zero disables it
+	EndHoldSeconds float64
+	// brightness pulsing of auto exposure is smoothed by ffmpeg deflicker
+	Deflicker bool
+
+	// capture time of frames drawn onto video
+	Timestamps TimestampsConfig
+
+	Hooks  HooksConfig
+	Upload UploadConfig
+	// videos built at once, 1 if zero
+	BuildConcurrency int
+	// every video format gets that long to encode, 10m if zero. Timed out format fails
+	// like ffmpeg error, formats built before it are kept
+	FormatTimeout time.Duration
+	// failed build is retried BuildRetries times, first after BuildRetryDelay (30s if zero)
+	// doubled for every next one. Frames are kept till it succeeds
+	BuildRetries    int
+	BuildRetryDelay time.Duration
+
+	// what is done with frames after video is built: none removes them, zip archives
+	// them next to video and dir moves them there
+	KeepFrames string
+
+	// frames limit of timelapse, zero is unlimited. MaxFramesAction stop stops capture at it,
+	// thin deletes every other frame and doubles interval
+	MaxFrames       int
+	MaxFramesAction string
+
+	// restarts in a row without a frame when capture exits mid-print, timelapse is finished after that
+	CaptureRestarts int
+
+	// low-water mark of free space for frames in MB, capture doesn't start or stops below it.
+	// Zero disables the check
+	MinFreeSpace int
+}
+
+// validate checks timelapse settings, zero values fall back to defaults
+func (cfg *TimelapseConfig) validate() error {
+	switch cfg.KeepFrames {
+	case "", KeepFramesNone, KeepFramesZip, KeepFramesDir:
+	default:
+		return fmt.Errorf("invalid timelapse.keepFrames %q, expected %s, %s or %s",
+			cfg.KeepFrames, KeepFramesNone, KeepFramesZip, KeepFramesDir)
+	}
+	switch cfg.Encoder {
+	case "", EncoderX264, EncoderV4L2M2M:
+	default:
+		return fmt.Errorf("invalid timelapse.encoder %q, expected %s or %s", cfg.Encoder, EncoderX264, EncoderV4L2M2M)
+	}
+	if cfg.MinInterval < 0 || cfg.MaxInterval < 0 || cfg.MaxInterval > 0 && cfg.MinInterval > cfg.MaxInterval {
+		return fmt.Errorf("invalid timelapse.minInterval %d and maxInterval %d, expected 0 <= min <= max", cfg.MinInterval, cfg.MaxInterval)
+	}
+	if err := validateStartAt(cfg.StartAt); err != nil {
+		return err
+	}
+	if cfg.StartTimeout < 0 {
+		return fmt.Errorf("invalid timelapse.startTimeout %s", cfg.StartTimeout)
+	}
+	switch cfg.OnShutdown {
+	case "", ShutdownResume, ShutdownFinish:
+	default:
+		return fmt.Errorf("invalid timelapse.onShutdown %q, expected %s or %s", cfg.OnShutdown, ShutdownResume, ShutdownFinish)
+	}
+	if cfg.EndHoldSeconds < 0 {
+		return fmt.Errorf("invalid timelapse.endHoldSeconds %g", cfg.EndHoldSeconds)
+	}
+	if cfg.BuildConcurrency < 0 {
+		return fmt.Errorf("invalid timelapse.buildConcurrency %d", cfg.BuildConcurrency)
+	}
+	if cfg.FormatTimeout < 0 {
+		return fmt.Errorf("invalid timelapse.formatTimeout %s", cfg.FormatTimeout)
+	}
+	if cfg.BuildRetries < 0 || cfg.BuildRetryDelay < 0 {
+		return fmt.Errorf("invalid timelapse.buildRetries %d or buildRetryDelay %s", cfg.BuildRetries, cfg.BuildRetryDelay)
+	}
+	if err := cfg.Timestamps.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Upload.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Hooks.validate(); err != nil {
+		return err
+	}
+	if err := cfg.validateMaxFrames(); err != nil {
+		return err
+	}
+	if err := cfg.validateCaptureRestarts(); err != nil {
+		return err
+	}
+	if err := cfg.validateMode(); err != nil {
+		return err
+	}
+	if err := cfg.validateFormats(); err != nil {
+		return err
+	}
+	return cfg.Output.validate()
+}
+
+func (cfg *CameraConfig) snapshotMaxAge() time.Duration {
+	if cfg.SnapshotMaxAge == 0 {
+		return defaultSnapshotMaxAge
+	}
+	return cfg.SnapshotMaxAge
+}
+
+func (cfg *CameraConfig) maxFrameAge() time.Duration {
+	if cfg.MaxFrameAge > 0 {
+		return cfg.MaxFrameAge
+	}
+	return defaultMaxFrameAge
 }
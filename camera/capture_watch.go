@@ -0,0 +1,73 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// pause before capture is restarted, so crashing camera isn't hammered
+var captureRestartDelay = 5 * time.Second
+
+func (cfg *TimelapseConfig) validateCaptureRestarts() error {
+	if cfg.CaptureRestarts < 0 {
+		return fmt.Errorf("invalid timelapse.captureRestarts %d", cfg.CaptureRestarts)
+	}
+	return nil
+}
+
+// watchCapture restarts capture of tl when cmd exits on its own, numbering continues after
+// the newest frame. When CaptureRestarts in a row don't get a frame timelapse is finished
+// with frames captured so far. Restart uses parent context, ctx is the one of running capture
+func (c *timelapseSvc) watchCapture(parent, ctx context.Context, tl *timelapse, cmd Process) {
+	err := cmd.Wait()
+	// stopped on purpose
+	if ctx.Err() != nil {
+		return
+	}
+	c.log.ErrorContext(ctx, "timelapse capture exited unexpectedly", "err", err, "jobID", tl.jobID, "jobName", tl.jobName)
+
+	select {
+	case <-time.After(captureRestartDelay):
+	case <-ctx.Done():
+		return
+	}
+
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+	// finished or interrupted meanwhile
+	if c.timelapse != tl || ctx.Err() != nil {
+		return
+	}
+	frameStart := newestShot(tl.currentDir) + 1
+	// capture which got a frame after the previous restart has recovered from it
+	if frameStart > tl.restartFrame {
+		tl.failedRestarts = 0
+	}
+	if tl.failedRestarts >= c.config.CaptureRestarts {
+		c.log.ErrorContext(ctx, "timelapse capture keeps failing, video will be built from frames captured so far",
+			"restarts", tl.failedRestarts, "jobID", tl.jobID, "jobName", tl.jobName)
+		c.giveUpCapture(parent, tl)
+		return
+	}
+	tl.failedRestarts++
+	tl.restartFrame = frameStart
+	restarts := tl.restarts.Add(1)
+	tl.timelapseStop()
+
+	if err := c.beginCapture(parent, tl, frameStart); err != nil {
+		c.log.ErrorContext(ctx, "fail to restart timelapse capture, video will be built from frames captured so far", "err", err)
+		c.giveUpCapture(parent, tl)
+		return
+	}
+	c.log.WarnContext(ctx, "timelapse capture restarted", "frameStart", frameStart, "restarts", restarts, "jobID", tl.jobID, "jobName", tl.jobName)
+}
+
+// giveUpCapture finishes tl with frames captured so far. Printer still prints its job, so
+// the job isn't captured again by the next printer event. Mutex has to be locked
+func (c *timelapseSvc) giveUpCapture(ctx context.Context, tl *timelapse) {
+	if !tl.manual {
+		c.gaveUpJob = tl.jobID
+	}
+	c.finishTimelapse(ctx)
+}
@@ -0,0 +1,96 @@
+package camera
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tuzkov/prusaCam/prusaLinkClient/prusalinktest"
+)
+
+// restart watchers outlive tests that crash capture, so delay is set once
+var shortCaptureRestart = sync.OnceFunc(func() { captureRestartDelay = time.Millisecond })
+
+// startCrashingTimelapse begins capture whose first exits rpicam processes die right after
+// writing frames, dead ones after them die without any
+func startCrashingTimelapse(t *testing.T, restarts, exits, dead int) (*timelapseSvc, *fakeRunner) {
+	shortCaptureRestart()
+	runner := useFakeRunner(t)
+	runner.startExits = exits
+	runner.deadStarts = dead
+	ts, _ := startTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir(), CaptureRestarts: restarts, StartAt: StartImmediately})
+	return ts, runner
+}
+
+// waitCalls waits till rpicam-still was run n times
+func waitCalls(runner *fakeRunner, n int) [][]string {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(runner.Calls("rpicam-still")) < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return runner.Calls("rpicam-still")
+}
+
+func TestCaptureRestart(t *testing.T) {
+	ts, runner := startCrashingTimelapse(t, 2, 1, 0)
+
+	calls := waitCalls(runner, 2)
+	if len(calls) != 2 {
+		t.Fatalf("expected capture restarted once, got %d calls", len(calls))
+	}
+	// frames 0-2 were captured before the crash
+	if i := slices.Index(calls[1], "--framestart"); i < 0 || calls[1][i+1] != "3" {
+		t.Errorf("expected capture to continue after frame 2, got %q", calls[1])
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil || !status.Running || status.Restarts != 1 || status.Frames != 6 {
+		t.Errorf("expected running timelapse with 1 restart and 6 frames, got %+v, %v", status, err)
+	}
+}
+
+func TestCaptureRestartRecovers(t *testing.T) {
+	// every crash comes after new frames, so restarts in a row never exceed one
+	ts, runner := startCrashingTimelapse(t, 1, 3, 0)
+
+	if calls := waitCalls(runner, 4); len(calls) != 4 {
+		t.Fatalf("expected capture restarted 3 times, got %d calls", len(calls))
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil || !status.Running || status.Restarts != 3 {
+		t.Errorf("expected running timelapse with 3 restarts, got %+v, %v", status, err)
+	}
+}
+
+func TestCaptureRestartGivesUp(t *testing.T) {
+	ts, runner := startCrashingTimelapse(t, 1, 1, 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ts.current.Load() != nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if ts.current.Load() != nil {
+		t.Fatal("expected timelapse finished after restarts were used up")
+	}
+	// 2 timelapse captures and the last shot
+	if calls := runner.Calls("rpicam-still"); len(calls) != 3 || slices.Contains(calls[2], "--timelapse") {
+		t.Errorf("expected capture restarted once and last shot taken, got %q", calls)
+	}
+
+	// printer still prints the job, Wi-Fi blip makes watcher report it again
+	ts.prusalink = prusalinktest.NewFakeClient()
+	status := printingAt(50)
+	ts.handleTimelapse(t.Context(), &status, nil)
+	if ts.Capturing() {
+		t.Error("given up job is captured again")
+	}
+	status.JobID = 43
+	ts.handleTimelapse(t.Context(), &status, nil)
+	if !ts.Capturing() {
+		t.Error("next job isn't captured")
+	}
+
+	if err := (&TimelapseConfig{CaptureRestarts: -1}).validate(); err == nil {
+		t.Error("expected invalid captureRestarts error")
+	}
+}
@@ -0,0 +1,95 @@
+package camera
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// CommandRunner runs external binaries (rpicam, ffmpeg, cp).
+// Tests replace Runner to record invocations instead of executing them
+type CommandRunner interface {
+	LookPath(file string) (string, error)
+	// Run runs command till completion and returns combined output
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Start runs command in background. Combined output goes to output if it's not nil
+	Start(ctx context.Context, output io.Writer, name string, args ...string) (Process, error)
+	// Pipe runs command in background and returns its stdout, stderr is dropped.
+	// Caller closes stdout before waiting for process
+	Pipe(ctx context.Context, name string, args ...string) (io.ReadCloser, Process, error)
+}
+
+// Process is a command started by CommandRunner.Start
+type Process interface {
+	// Wait waits for process to exit, safe to call several times
+	Wait() error
+	// Signal sends sig to running process
+	Signal(sig os.Signal) error
+}
+
+var Runner CommandRunner = execRunner{}
+
+type execRunner struct{}
+
+func (execRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+func (execRunner) Start(ctx context.Context, output io.Writer, name string, args ...string) (Process, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &execProcess{proc: cmd.Process, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (execRunner) Pipe(ctx context.Context, name string, args ...string) (io.ReadCloser, Process, error) {
+	// os.Pipe instead of StdoutPipe, so Wait may run before reading is done
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer w.Close()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = w
+	if err := cmd.Start(); err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+
+	p := &execProcess{proc: cmd.Process, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return stdout, p, nil
+}
+
+type execProcess struct {
+	proc *os.Process
+	done chan struct{}
+	err  error
+}
+
+func (p *execProcess) Signal(sig os.Signal) error {
+	return p.proc.Signal(sig)
+}
+
+func (p *execProcess) Wait() error {
+	<-p.done
+	return p.err
+}
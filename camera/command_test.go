@@ -0,0 +1,253 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeRunner records commands, rpicam invocations write placeholder frames
+type fakeRunner struct {
+	sync.Mutex
+	calls [][]string
+	// Pipe process exits right after writing frames instead of running till cancelled
+	pipeExits bool
+	// that many Start processes exit right after writing frames, emulating crashed rpicam.
+	// Then deadStarts of them exit without any frame, camera doesn't come back
+	startExits int
+	deadStarts int
+	// fails Run and Start of matching invocations, set before runner is used
+	fail func(name string, args []string) bool
+	// Run of matching invocations hangs till ctx is done, set before runner is used
+	hang func(name string, args []string) bool
+	// sizes of files rclone copied to remotes
+	remote map[string]int64
+}
+
+// useFakeRunner replaces Runner for the test duration
+func useFakeRunner(t *testing.T) *fakeRunner {
+	r := &fakeRunner{}
+	prev := Runner
+	Runner = r
+	t.Cleanup(func() { Runner = prev })
+	return r
+}
+
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	return "/fake/bin/" + file, nil
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	r.record(name, args)
+	if r.fail != nil && r.fail(filepath.Base(name), args) {
+		return []byte("fake failure"), errors.New("exit status 1")
+	}
+	if r.hang != nil && r.hang(filepath.Base(name), args) {
+		<-ctx.Done()
+		return nil, errors.New("signal: killed")
+	}
+
+	switch filepath.Base(name) {
+	case "rpicam-still":
+		output := args[slices.Index(args, "-o")+1]
+		// short timelapse writes frame at start and every interval till timeout
+		if i := slices.Index(args, "--timelapse"); i >= 0 {
+			interval, _ := strconv.Atoi(args[i+1])
+			timeout, _ := strconv.Atoi(args[slices.Index(args, "--timeout")+1])
+			for n := range timeout/interval + 1 {
+				if err := os.WriteFile(fmt.Sprintf(output, n), []byte(fmt.Sprintf("jpg%d", n)), 0o644); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}
+		return nil, os.WriteFile(output, []byte("jpg"), 0o644)
+	case "ffmpeg":
+		// output is the last argument
+		return nil, os.WriteFile(args[len(args)-1], []byte("ffmpeg"), 0o644)
+	case "rclone":
+		return r.rclone(args)
+	}
+	return nil, nil
+}
+
+// rclone emulates copyto and lsjson of copied files
+func (r *fakeRunner) rclone(args []string) ([]byte, error) {
+	r.Lock()
+	defer r.Unlock()
+	switch args[0] {
+	case "copyto":
+		info, err := os.Stat(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if r.remote == nil {
+			r.remote = map[string]int64{}
+		}
+		r.remote[args[2]] = info.Size()
+	case "lsjson":
+		size, ok := r.remote[args[len(args)-1]]
+		if !ok {
+			return []byte("[]"), nil
+		}
+		return fmt.Appendf(nil, `[{"Path":%q,"Size":%d,"IsDir":false}]`, filepath.Base(args[len(args)-1]), size), nil
+	}
+	return nil, nil
+}
+
+var fakeTimelapseFrame = []byte("\xff\xd8timelapse\xff\xd9")
+
+// Start emulates timelapse capture: writes 3 frames numbered from --framestart and runs till cancelled.
+// In --signal mode frame is written per signal. ffmpeg writes output and progress of half and end of it
+func (r *fakeRunner) Start(ctx context.Context, output io.Writer, name string, args ...string) (Process, error) {
+	r.record(name, args)
+	if r.fail != nil && r.fail(filepath.Base(name), args) {
+		return nil, errors.New("fake start failure")
+	}
+	if filepath.Base(name) == "ffmpeg" {
+		fmt.Fprint(output, "Input #0, image2\nframe=2\nout_time_us=N/A\nprogress=continue\n"+
+			"frame=5\nout_time_us=1000000\nprogress=continue\nframe=9\nout_time_us=1800000\nprogress=end\n")
+		return doneProcess{}, os.WriteFile(args[len(args)-1], []byte("ffmpeg"), 0o644)
+	}
+
+	pattern := args[slices.Index(args, "-o")+1]
+	if slices.Contains(args, "--signal") {
+		return &fakeSignalProcess{fakeProcess: fakeProcess{ctx}, pattern: pattern}, nil
+	}
+	r.Lock()
+	exits, dead := r.startExits > 0, r.startExits == 0 && r.deadStarts > 0
+	if exits {
+		r.startExits--
+	} else if dead {
+		r.deadStarts--
+	}
+	r.Unlock()
+	if dead {
+		return exitedProcess{}, nil
+	}
+
+	start := 0
+	if i := slices.Index(args, "--framestart"); i >= 0 {
+		start, _ = strconv.Atoi(args[i+1])
+	}
+	for i := range 3 {
+		if err := os.WriteFile(fmt.Sprintf(pattern, start+i), fakeTimelapseFrame, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	if exits {
+		return exitedProcess{}, nil
+	}
+	return fakeProcess{ctx}, nil
+}
+
+// fakeStreamFrames is what Pipe emulated rpicam-vid writes before waiting for cancel
+var fakeStreamFrames = [][]byte{
+	[]byte("\xff\xd8frame1\xff\xd9"),
+	[]byte("\xff\xd8frame2\xff\xd9"),
+	[]byte("\xff\xd8frame3\xff\xd9"),
+}
+
+// Pipe emulates rpicam-vid: writes fakeStreamFrames and runs till cancelled
+func (r *fakeRunner) Pipe(ctx context.Context, name string, args ...string) (io.ReadCloser, Process, error) {
+	r.record(name, args)
+	r.Lock()
+	exits := r.pipeExits
+	r.Unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, frame := range fakeStreamFrames {
+			if _, err := pw.Write(frame); err != nil {
+				return
+			}
+		}
+		if !exits {
+			<-ctx.Done()
+		}
+		pw.Close()
+	}()
+	if exits {
+		return pr, exitedProcess{}, nil
+	}
+	return pr, fakeProcess{ctx}, nil
+}
+
+func (r *fakeRunner) record(name string, args []string) {
+	r.Lock()
+	defer r.Unlock()
+	r.calls = append(r.calls, append([]string{filepath.Base(name)}, args...))
+}
+
+// Calls returns invocations of binary with given base name
+func (r *fakeRunner) Calls(name string) [][]string {
+	r.Lock()
+	defer r.Unlock()
+
+	var calls [][]string
+	for _, c := range r.calls {
+		if c[0] == name {
+			calls = append(calls, c[1:])
+		}
+	}
+	return calls
+}
+
+type fakeProcess struct {
+	ctx context.Context
+}
+
+func (p fakeProcess) Wait() error {
+	<-p.ctx.Done()
+	return p.ctx.Err()
+}
+
+func (p fakeProcess) Signal(sig os.Signal) error {
+	return nil
+}
+
+// fakeSignalProcess writes fakeSignalFrame on every signal
+type fakeSignalProcess struct {
+	fakeProcess
+	pattern string
+	signals atomic.Int32
+}
+
+var fakeSignalFrame = []byte("\xff\xd8signal\xff\xd9")
+
+func (p *fakeSignalProcess) Signal(sig os.Signal) error {
+	n := p.signals.Add(1)
+	return os.WriteFile(fmt.Sprintf(p.pattern, n-1), fakeSignalFrame, 0o644)
+}
+
+type exitedProcess struct{}
+
+func (exitedProcess) Signal(sig os.Signal) error {
+	return errors.New("process exited")
+}
+
+func (exitedProcess) Wait() error {
+	return errors.New("exit status 1")
+}
+
+// doneProcess exited successfully
+type doneProcess struct{}
+
+func (doneProcess) Signal(sig os.Signal) error {
+	return errors.New("process exited")
+}
+
+func (doneProcess) Wait() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"syscall"
+	"time"
+)
+
+// estimated size of rpicam frame at full resolution
+const estimatedFrameSize = 3 << 20
+
+// ErrLowDiskSpace is returned when timelapse frames don't fit disk anymore
+var ErrLowDiskSpace = errors.New("not enough disk space")
+
+// diskCheckInterval is how often free space is checked during capture
+var diskCheckInterval = time.Minute
+
+// freeSpace returns bytes available to unprivileged user on filesystem of dir
+var freeSpace = func(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("fail to stat filesystem: %w", err)
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
+
+// minFreeSpace is low-water mark in bytes, zero disables space checks
+func (cfg *TimelapseConfig) minFreeSpace() uint64 {
+	return uint64(max(cfg.MinFreeSpace, 0)) << 20
+}
+
+// checkSpace fails if free space of dir is below low-water mark, and warns if frames of
+// remaining print time are not going to fit. Unknown free space doesn't stop capture
+func (c *timelapseSvc) checkSpace(ctx context.Context, log *slog.Logger, dir string, interval, remaining time.Duration) error {
+	minFree := c.config.minFreeSpace()
+	if minFree == 0 {
+		return nil
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		log.WarnContext(ctx, "fail to check free disk space", "err", err)
+		return nil
+	}
+	if free < minFree {
+		return fmt.Errorf("%w: %d MB free in %s, %d MB required", ErrLowDiskSpace, free>>20, dir, minFree>>20)
+	}
+	if remaining <= 0 || interval <= 0 {
+		return nil
+	}
+	// last shot copies add about a tenth
+	frames := uint64(remaining/interval) * 11 / 10
+	if need := frames * estimatedFrameSize; free < minFree+need {
+		log.ErrorContext(ctx, "timelapse is not going to fit disk, capture stops when it runs out of space",
+			"freeMB", free>>20, "neededMB", need>>20, "frames", frames, "dir", dir)
+	}
+	return nil
+}
+
+// watchSpace stops capture of tl once free space drops below low-water mark, frames
+// captured so far are built into video when print finishes
+func (c *timelapseSvc) watchSpace(ctx context.Context, tl *timelapse) {
+	if c.config.minFreeSpace() == 0 {
+		return
+	}
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := c.checkSpace(ctx, c.log, tl.currentDir, 0, 0)
+		if err == nil {
+			continue
+		}
+		c.log.ErrorContext(ctx, "timelapse capture stopped, video will be built from frames captured so far",
+			"err", err, "jobID", tl.jobID, "jobName", tl.jobName)
+		tl.lowSpace.Store(true)
+		tl.timelapseStop()
+		return
+	}
+}
@@ -0,0 +1,100 @@
+package camera
+
+import (
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/prusaLinkClient/prusalinktest"
+)
+
+// useFreeSpace makes filesystems report free MB during the test
+func useFreeSpace(t *testing.T, mb uint64) *atomic.Uint64 {
+	free := &atomic.Uint64{}
+	free.Store(mb << 20)
+	prev := freeSpace
+	freeSpace = func(dir string) (uint64, error) { return free.Load(), nil }
+	t.Cleanup(func() { freeSpace = prev })
+	return free
+}
+
+func TestCheckSpace(t *testing.T) {
+	useFreeSpace(t, 1000)
+	ts := newTestTimelapse(t, &TimelapseConfig{MinFreeSpace: 500})
+
+	// 14 hours at 20 seconds don't fit 500 MB, it's only a warning
+	if err := ts.checkSpace(t.Context(), slog.Default(), t.TempDir(), 20*time.Second, 14*time.Hour); err != nil {
+		t.Errorf("expected warning only, got %v", err)
+	}
+	ts.config.MinFreeSpace = 2000
+	if err := ts.checkSpace(t.Context(), slog.Default(), t.TempDir(), 20*time.Second, 0); !errors.Is(err, ErrLowDiskSpace) {
+		t.Errorf("expected ErrLowDiskSpace below low-water mark, got %v", err)
+	}
+	ts.config.MinFreeSpace = 0
+	if err := ts.checkSpace(t.Context(), slog.Default(), t.TempDir(), 20*time.Second, 0); err != nil {
+		t.Errorf("expected no check when disabled, got %v", err)
+	}
+}
+
+func TestTimelapseLowSpace(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	prev := diskCheckInterval
+	diskCheckInterval = 10 * time.Millisecond
+	t.Cleanup(func() { diskCheckInterval = prev })
+	free := useFreeSpace(t, 100)
+	runner := useFakeRunner(t)
+	printer := prusalinktest.NewFakeClient(prusalinkclient.Status{
+		Online: true, State: prusalinkclient.StatusPrinting, JobID: 42, FileName: "benchy.gcode", Progress: 10,
+	})
+
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		Enabled: true, Interval: 20, VideoLenght: 7, MinFPS: 12, OutputDir: t.TempDir(), MinFreeSpace: 500,
+	}, withRpicam(), withPrinter(printer))
+
+	pollTimelapse(t, ts)
+	if ts.Capturing() {
+		t.Fatal("timelapse started without free space")
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil || !status.LowSpace || status.FreeSpaceBytes != 100<<20 {
+		t.Errorf("expected low space in status, got %+v, %v", status, err)
+	}
+
+	free.Store(1000 << 20)
+	pollTimelapse(t, ts)
+	if !ts.Capturing() {
+		t.Fatal("timelapse isn't running with enough space")
+	}
+
+	free.Store(100 << 20)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := ts.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.CaptureStopped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("capture isn't stopped on low space, status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// video is still built, without last shot
+	printer.Set(prusalinkclient.Status{Online: true, State: prusalinkclient.StatusFinished, JobID: 42, FileName: "benchy.gcode"})
+	pollTimelapse(t, ts)
+	if ts.Capturing() {
+		t.Fatal("timelapse is still running after print finished")
+	}
+	if n := len(runner.Calls("rpicam-still")); n != 1 {
+		t.Errorf("expected no last shot, got %d rpicam runs", n)
+	}
+	if pending := ts.builds.Status().Pending; len(pending) != 1 || pending[0].JobID != 42 {
+		t.Errorf("expected video build to be queued, got %+v", pending)
+	}
+}
@@ -0,0 +1,317 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+const (
+	exifMake = "prusaCam"
+	// job name is cut to that many bytes, segment has to fit 64k
+	exifMaxJobName = 1024
+)
+
+// tags written, see EXIF 2.3 spec
+const (
+	exifTagImageDescription = 0x010e
+	exifTagMake             = 0x010f
+	exifTagModel            = 0x0110
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+	exifTagUserComment      = 0x9286
+)
+
+const (
+	exifTypeASCII     = 2
+	exifTypeLong      = 4
+	exifTypeUndefined = 7
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+var errNotJPEG = errors.New("not a jpeg")
+
+// exifEntry is IFD entry, data longer than 4 bytes goes to the area after IFD
+type exifEntry struct {
+	tag  uint16
+	typ  uint16
+	data []byte
+}
+
+func exifASCII(tag uint16, s string) exifEntry {
+	return exifEntry{tag: tag, typ: exifTypeASCII, data: append([]byte(s), 0)}
+}
+
+func (e exifEntry) count() uint32 {
+	if e.typ == exifTypeLong {
+		return uint32(len(e.data) / 4)
+	}
+	return uint32(len(e.data))
+}
+
+// ifdSize is size of IFD with its data area, values are kept at even offsets
+func ifdSize(entries []exifEntry) int {
+	size := 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		if len(e.data) > 4 {
+			size += len(e.data) + len(e.data)%2
+		}
+	}
+	return size
+}
+
+// appendIFD appends IFD placed at offset of TIFF data, entries must be sorted by tag
+func appendIFD(b []byte, offset int, entries []exifEntry) []byte {
+	be := binary.BigEndian
+	b = be.AppendUint16(b, uint16(len(entries)))
+	dataOffset := offset + 2 + 12*len(entries) + 4
+	var data []byte
+	for _, e := range entries {
+		b = be.AppendUint16(b, e.tag)
+		b = be.AppendUint16(b, e.typ)
+		b = be.AppendUint32(b, e.count())
+		if len(e.data) <= 4 {
+			var inline [4]byte
+			copy(inline[:], e.data)
+			b = append(b, inline[:]...)
+			continue
+		}
+		b = be.AppendUint32(b, uint32(dataOffset+len(data)))
+		data = append(data, e.data...)
+		if len(e.data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	// no next IFD
+	b = be.AppendUint32(b, 0)
+	return append(b, data...)
+}
+
+// exifTags are written into captured frames
+type exifTags struct {
+	CapturedAt time.Time
+	// camera backend
+	Model string
+	// printer job, nil if printer is offline
+	Job *prusalinkclient.Status
+}
+
+// userComment carries job fields, name goes last so it may contain anything
+func (t *exifTags) userComment() string {
+	if t.Job == nil {
+		return ""
+	}
+	return fmt.Sprintf("jobID=%d;progress=%s;job=%s", t.Job.JobID,
+		strconv.FormatFloat(t.Job.Progress, 'f', 1, 64), t.jobName())
+}
+
+func (t *exifTags) jobName() string {
+	if t.Job == nil {
+		return ""
+	}
+	name := t.Job.FileName
+	if len(name) > exifMaxJobName {
+		name = name[:exifMaxJobName]
+	}
+	return name
+}
+
+// segment returns APP1 segment with big endian TIFF data
+func (t *exifTags) segment() []byte {
+	at := t.CapturedAt.Format("2006:01:02 15:04:05")
+
+	var ifd0 []exifEntry
+	if name := t.jobName(); name != "" {
+		ifd0 = append(ifd0, exifASCII(exifTagImageDescription, name))
+	}
+	ifd0 = append(ifd0,
+		exifASCII(exifTagMake, exifMake),
+		exifASCII(exifTagModel, t.Model),
+		exifASCII(exifTagDateTime, at),
+		// offset is set below when size of IFD0 is known
+		exifEntry{tag: exifTagExifIFD, typ: exifTypeLong, data: make([]byte, 4)},
+	)
+	exifIFD := []exifEntry{exifASCII(exifTagDateTimeOriginal, at)}
+	if comment := t.userComment(); comment != "" {
+		exifIFD = append(exifIFD, exifEntry{
+			tag:  exifTagUserComment,
+			typ:  exifTypeUndefined,
+			data: append([]byte("ASCII\x00\x00\x00"), comment...),
+		})
+	}
+
+	const ifd0Offset = 8
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	binary.BigEndian.PutUint32(ifd0[len(ifd0)-1].data, uint32(exifOffset))
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, ifd0Offset}
+	tiff = appendIFD(tiff, ifd0Offset, ifd0)
+	tiff = appendIFD(tiff, exifOffset, exifIFD)
+
+	seg := []byte{0xff, 0xe1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(2+len(exifHeader)+len(tiff)))
+	seg = append(seg, exifHeader...)
+	return append(seg, tiff...)
+}
+
+// addExif returns jpeg with tags put right after SOI, EXIF segments it had are dropped
+func addExif(data []byte, tags *exifTags) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errNotJPEG
+	}
+	seg := tags.segment()
+	out := make([]byte, 0, len(data)+len(seg))
+	out = append(out, data[:2]...)
+	out = append(out, seg...)
+
+	rest := data[2:]
+	// application segments go before the image ones, only they are looked through
+	for len(rest) >= 4 && rest[0] == 0xff && rest[1] >= 0xe0 && rest[1] <= 0xef {
+		size := 2 + int(binary.BigEndian.Uint16(rest[2:4]))
+		if size > len(rest) {
+			return nil, fmt.Errorf("%w: segment is cut", errNotJPEG)
+		}
+		if rest[1] != 0xe1 || !bytes.HasPrefix(rest[4:size], exifHeader) {
+			out = append(out, rest[:size]...)
+		}
+		rest = rest[size:]
+	}
+	return append(out, rest...), nil
+}
+
+// exifTagger tags frames with capture time, backend and the latest printer job
+type exifTagger struct {
+	watcher prusalinkclient.Watcher
+	model   string
+}
+
+// newExifTagger returns nil if tagging is disabled
+func newExifTagger(watcher prusalinkclient.Watcher, camConfig *CameraConfig) *exifTagger {
+	if !camConfig.Exif {
+		return nil
+	}
+	model := camConfig.Type
+	if model == "" {
+		model = TypeRPI
+	}
+	return &exifTagger{watcher: watcher, model: model}
+}
+
+func (t *exifTagger) tags(at time.Time) *exifTags {
+	tags := &exifTags{CapturedAt: at, Model: t.model}
+	if t.watcher == nil {
+		return tags
+	}
+	if st, err := t.watcher.Last(); err == nil && st.Online && st.JobID != 0 {
+		tags.Job = st
+	}
+	return tags
+}
+
+func (t *exifTagger) tag(data []byte, at time.Time) ([]byte, error) {
+	out, err := addExif(data, t.tags(at))
+	if err != nil {
+		return nil, fmt.Errorf("fail to add exif: %w", err)
+	}
+	return out, nil
+}
+
+// rpicamOpts are exif options of rpicam timelapse. rpicam writes frames on its own,
+// so they carry the job it was started for without progress
+func (t *exifTagger) rpicamOpts() []string {
+	tags := t.tags(time.Now())
+	if tags.Job == nil {
+		return nil
+	}
+	return []string{
+		"--exif", "IFD0.ImageDescription=" + tags.jobName(),
+		"--exif", fmt.Sprintf("EXIF.UserComment=jobID=%d;job=%s", tags.Job.JobID, tags.jobName()),
+	}
+}
+
+// exifCamera tags snapshots of wrapped camera, stream frames are left as is to save CPU
+type exifCamera struct {
+	CameraWithTL
+	log    *slog.Logger
+	tagger *exifTagger
+}
+
+func withExif(log *slog.Logger, cam CameraWithTL, tagger *exifTagger) *exifCamera {
+	return &exifCamera{CameraWithTL: cam, log: log.With("svc", "exif"), tagger: tagger}
+}
+
+// Snapshot returns tagged frame copy, wrapped camera may share frames between callers
+func (c *exifCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	frame, err := c.CameraWithTL.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := *frame
+	out.Data = c.tag(ctx, frame)
+	return &out, nil
+}
+
+func (c *exifCamera) Autofocus(ctx context.Context) (*Frame, error) {
+	focuser, ok := c.CameraWithTL.(Focuser)
+	if !ok {
+		return nil, ErrNoAutofocus
+	}
+	frame, err := focuser.Autofocus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	frame.Data = c.tag(ctx, frame)
+	return frame, nil
+}
+
+func (c *exifCamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	burster, ok := c.CameraWithTL.(Burster)
+	if !ok {
+		return nil, ErrNoBurst
+	}
+	frames, err := burster.Burst(ctx, n, interval)
+	if err != nil {
+		return nil, err
+	}
+	// snapshot based bursts may share frames with other callers
+	for i, frame := range frames {
+		out := *frame
+		out.Data = c.tag(ctx, frame)
+		frames[i] = &out
+	}
+	return frames, nil
+}
+
+func (c *exifCamera) Controls(ctx context.Context) ([]Control, error) {
+	controller, ok := c.CameraWithTL.(Controller)
+	if !ok {
+		return nil, ErrNoControls
+	}
+	return controller.Controls(ctx)
+}
+
+// tag returns tagged frame data, or data as is if it isn't jpeg
+func (c *exifCamera) tag(ctx context.Context, frame *Frame) []byte {
+	if frame.format() != FormatJPEG {
+		return frame.Data
+	}
+	at := frame.CapturedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	out, err := c.tagger.tag(frame.Data, at)
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to tag frame", "err", err)
+		return frame.Data
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package camera
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// readExif returns ASCII and UNDEFINED tags of IFD0 and EXIF IFD of the first EXIF segment
+func readExif(t *testing.T, data []byte) map[uint16]string {
+	t.Helper()
+	if len(data) < 12 || data[2] != 0xff || data[3] != 0xe1 || !bytes.Equal(data[6:12], exifHeader) {
+		t.Fatal("expected EXIF segment right after SOI")
+	}
+	size := int(binary.BigEndian.Uint16(data[4:6]))
+	tiff := data[12 : 4+size]
+	if string(tiff[:4]) != "MM\x00\x2a" {
+		t.Fatalf("unexpected TIFF header % x", tiff[:4])
+	}
+	be := binary.BigEndian
+
+	tags := make(map[uint16]string)
+	var readIFD func(offset uint32)
+	readIFD = func(offset uint32) {
+		n := int(be.Uint16(tiff[offset:]))
+		for e := range n {
+			entry := tiff[int(offset)+2+12*e:]
+			tag, typ, count := be.Uint16(entry), be.Uint16(entry[2:]), be.Uint32(entry[4:])
+			value := entry[8:12]
+			if typ == exifTypeLong {
+				if tag == exifTagExifIFD {
+					readIFD(be.Uint32(value))
+				}
+				continue
+			}
+			if count > 4 {
+				value = tiff[be.Uint32(value):][:count]
+			}
+			tags[tag] = strings.TrimRight(string(value[:min(count, uint32(len(value)))]), "\x00")
+		}
+	}
+	readIFD(be.Uint32(tiff[4:]))
+	return tags
+}
+
+func TestAddExif(t *testing.T) {
+	img := motionFrame(t, 0x40, 0)
+	at := time.Date(2024, 5, 1, 12, 30, 5, 0, time.UTC)
+	tags := &exifTags{
+		CapturedAt: at,
+		Model:      TypeUSB,
+		Job:        &prusalinkclient.Status{JobID: 12, FileName: "benchy.gcode", Progress: 42.4},
+	}
+
+	data, err := addExif(img, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tagging twice keeps single segment
+	if data, err = addExif(data, tags); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, exifHeader); n != 1 {
+		t.Errorf("expected single EXIF segment, got %d", n)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("tagged frame doesn't decode: %v", err)
+	}
+
+	want := map[uint16]string{
+		exifTagImageDescription: "benchy.gcode",
+		exifTagMake:             "prusaCam",
+		exifTagModel:            "usb",
+		exifTagDateTime:         "2024:05:01 12:30:05",
+		exifTagDateTimeOriginal: "2024:05:01 12:30:05",
+		exifTagUserComment:      "ASCII\x00\x00\x00jobID=12;progress=42.4;job=benchy.gcode",
+	}
+	got := readExif(t, data)
+	for tag, value := range want {
+		if got[tag] != value {
+			t.Errorf("tag %#x: expected %q, got %q", tag, value, got[tag])
+		}
+	}
+
+	// no job fields while printer is offline
+	tags.Job = nil
+	if data, err = addExif(img, tags); err != nil {
+		t.Fatal(err)
+	}
+	got = readExif(t, data)
+	if _, ok := got[exifTagUserComment]; ok {
+		t.Errorf("unexpected job comment without job: %q", got[exifTagUserComment])
+	}
+
+	if _, err := addExif([]byte("not jpeg"), tags); err == nil {
+		t.Error("expected error for broken frame")
+	}
+}
+
+func TestExifCamera(t *testing.T) {
+	watcher := &fakeWatcher{status: &prusalinkclient.Status{
+		Online: true, State: prusalinkclient.StatusPrinting, JobID: 7, FileName: "cube.gcode", Progress: 10,
+	}}
+	tagger := newExifTagger(watcher, &CameraConfig{Type: TypeMock, Exif: true})
+	cam := withExif(slog.Default(), newMockTLCamera(t), tagger)
+	defer cam.Close(t.Context())
+
+	frame, err := cam.Snapshot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readExif(t, frame.Data)
+	if got[exifTagModel] != TypeMock || got[exifTagImageDescription] != "cube.gcode" {
+		t.Errorf("unexpected tags %q", got)
+	}
+	if want := frame.CapturedAt.Format("2006:01:02 15:04:05"); got[exifTagDateTime] != want {
+		t.Errorf("expected capture time %s, got %s", want, got[exifTagDateTime])
+	}
+
+	if newExifTagger(watcher, &CameraConfig{}) != nil {
+		t.Error("expected no tagger with exif disabled")
+	}
+}
+
+func TestExifRpicamOpts(t *testing.T) {
+	watcher := &fakeWatcher{status: &prusalinkclient.Status{Online: true, JobID: 7, FileName: "cube.gcode"}}
+	tagger := newExifTagger(watcher, &CameraConfig{Exif: true})
+	want := []string{"--exif", "IFD0.ImageDescription=cube.gcode", "--exif", "EXIF.UserComment=jobID=7;job=cube.gcode"}
+	if got := tagger.rpicamOpts(); !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	watcher.err, watcher.status = prusalinkclient.ErrPrinterOffline, nil
+	if got := tagger.rpicamOpts(); got != nil {
+		t.Errorf("expected no options while printer is offline, got %q", got)
+	}
+}
@@ -0,0 +1,143 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+var ErrNoTimelapse = errors.New("camera backend doesn't support timelapse")
+
+// New creates camera backend chosen by camConfig.Type. Mock backend doesn't capture timelapse,
+// it fails to start with timelapse enabled
+func New(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, camConfig *CameraConfig, tlConfig *TimelapseConfig) (CameraWithTL, error) {
+	if tlConfig.Enabled && !capturesTimelapse(camConfig.Type) {
+		return nil, fmt.Errorf("%w: timelapse needs %s, %s, %s or %s camera, got %s. Disable timelapse or change camera type",
+			ErrNoTimelapse, TypeRPI, TypeUSB, TypeHTTP, TypeRTSP, camConfig.Type)
+	}
+	if err := tlConfig.validate(); err != nil {
+		return nil, err
+	}
+	if err := camConfig.Overlay.validate(); err != nil {
+		return nil, err
+	}
+	if err := camConfig.Light.validate(); err != nil {
+		return nil, err
+	}
+
+	cam, err := newBackend(log, prusalink, watcher, camConfig, tlConfig)
+	if err != nil {
+		return nil, err
+	}
+	if camConfig.Light.Enabled {
+		cam = withLight(log, cam, watcher, camConfig.Light)
+	}
+	if camConfig.Overlay.Enabled {
+		cam = withOverlay(log, cam, watcher, camConfig.Overlay)
+	}
+	// overlay drops exif, so tagging goes last
+	if tagger := newExifTagger(watcher, camConfig); tagger != nil {
+		cam = withExif(log, cam, tagger)
+	}
+	return cam, nil
+}
+
+func newBackend(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, camConfig *CameraConfig, tlConfig *TimelapseConfig) (CameraWithTL, error) {
+	switch camConfig.Type {
+	case "", TypeRPI:
+		return NewRPICamera(log, prusalink, watcher, camConfig, tlConfig)
+	case TypeHTTP:
+		return NewHTTPCamera(log, prusalink, watcher, camConfig, tlConfig)
+	case TypeRTSP:
+		return NewRTSPCamera(log, prusalink, watcher, camConfig, tlConfig)
+	case TypeUSB:
+		cam, err := NewUSBCamera(log, camConfig)
+		if err != nil {
+			return nil, err
+		}
+		return withSnapshotTimelapse(log, prusalink, watcher, cam, camConfig, tlConfig), nil
+	case TypeMock:
+		log.Warn("Using mock camera")
+		cam, err := NewMockCamera(camConfig)
+		if err != nil {
+			return nil, err
+		}
+		return withoutTimelapse{cam}, nil
+	default:
+		return nil, fmt.Errorf("unknown camera type %q", camConfig.Type)
+	}
+}
+
+func capturesTimelapse(cameraType string) bool {
+	switch cameraType {
+	case "", TypeRPI, TypeUSB, TypeHTTP, TypeRTSP:
+		return true
+	}
+	return false
+}
+
+// withoutTimelapse is camera which never captures timelapse
+type withoutTimelapse struct {
+	Camera
+}
+
+func (withoutTimelapse) Status(ctx context.Context) (*TimelapseStatus, error) {
+	return &TimelapseStatus{}, nil
+}
+
+func (withoutTimelapse) List(ctx context.Context) ([]TimelapseVideo, error) {
+	return nil, ErrNoTimelapse
+}
+
+func (withoutTimelapse) Delete(ctx context.Context, name string) error {
+	return ErrNoTimelapse
+}
+
+func (withoutTimelapse) Thumbnail(ctx context.Context, name string) (string, error) {
+	return "", ErrNoTimelapse
+}
+
+func (withoutTimelapse) Preview(ctx context.Context) (string, error) {
+	return "", ErrNoTimelapse
+}
+
+func (withoutTimelapse) StartManual(ctx context.Context, name string) error {
+	return ErrNoTimelapse
+}
+
+func (withoutTimelapse) StopManual(ctx context.Context) error {
+	return ErrNoTimelapse
+}
+
+func (withoutTimelapse) Builds(ctx context.Context) (*BuildsStatus, error) {
+	return &BuildsStatus{Pending: []BuildJob{}}, nil
+}
+
+func (withoutTimelapse) CancelBuild(ctx context.Context, id int64) error {
+	return ErrBuildNotFound
+}
+
+func (withoutTimelapse) Capturing() bool {
+	return false
+}
+
+// Controls forwards to wrapped camera, embedded Camera hides its other capabilities
+func (c withoutTimelapse) Controls(ctx context.Context) ([]Control, error) {
+	controller, ok := c.Camera.(Controller)
+	if !ok {
+		return nil, ErrNoControls
+	}
+	return controller.Controls(ctx)
+}
+
+func (c withoutTimelapse) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	burster, ok := c.Camera.(Burster)
+	if !ok {
+		return nil, ErrNoBurst
+	}
+	return burster.Burst(ctx, n, interval)
+}
@@ -0,0 +1,138 @@
+package camera
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMock(t *testing.T) {
+	cam, err := New(slog.Default(), nil, nil, &CameraConfig{Type: TypeMock, Width: 320, Height: 240}, &TimelapseConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := cam.Snapshot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 320 || b.Dy() != 240 {
+		t.Errorf("expected 320x240 frame, got %s", b)
+	}
+
+	info, err := cam.Info(t.Context())
+	if err != nil || info.Backend != TypeMock {
+		t.Errorf("unexpected info %+v, %v", info, err)
+	}
+	health, err := cam.Health(t.Context())
+	if err != nil || health.Backend != TypeMock || health.FramesCaptured != 1 || health.Width != 320 {
+		t.Errorf("unexpected health %+v, %v", health, err)
+	}
+	if cam.Capturing() {
+		t.Error("mock camera doesn't capture timelapse")
+	}
+	builds, err := cam.Builds(t.Context())
+	if err != nil || builds.Active != nil || len(builds.Pending) != 0 {
+		t.Errorf("unexpected builds %+v, %v", builds, err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(slog.Default(), nil, nil, &CameraConfig{Type: TypeMock}, &TimelapseConfig{Enabled: true})
+	if !errors.Is(err, ErrNoTimelapse) {
+		t.Errorf("expected ErrNoTimelapse for mock timelapse, got %v", err)
+	}
+	if _, err := New(slog.Default(), nil, nil, &CameraConfig{Type: "gopro"}, &TimelapseConfig{}); err == nil {
+		t.Error("expected error for unknown camera type")
+	}
+}
+
+func TestMockStream(t *testing.T) {
+	cam, err := NewMockCamera(&CameraConfig{SourceBadge: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := cam.Stream(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := <-stream
+	if _, err := jpeg.Decode(bytes.NewReader(frame)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockClose(t *testing.T) {
+	cam, err := NewMockCamera(&CameraConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := cam.Stream(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cam.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	for range stream {
+	}
+
+	if _, err := cam.Snapshot(t.Context()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed snapshot, got %v", err)
+	}
+	if _, err := cam.Stream(t.Context()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed stream, got %v", err)
+	}
+	if err := cam.Close(t.Context()); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+}
+
+func TestMockDir(t *testing.T) {
+	dir := t.TempDir()
+	first, second := testJPEG(t), testJPEG(t)
+	second = append(second[:len(second):len(second)], 0) // differs, still valid
+	os.WriteFile(filepath.Join(dir, "a.jpg"), first, 0o644)
+	os.WriteFile(filepath.Join(dir, "b.JPEG"), second, 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("skip"), 0o644)
+
+	cam, err := NewMockCamera(&CameraConfig{MockDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]byte{first, second, first} {
+		frame, err := cam.Snapshot(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame.Data, want) {
+			t.Errorf("frame %d isn't cycled from directory", i)
+		}
+	}
+
+	if _, err := NewMockCamera(&CameraConfig{MockDir: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected error for missing mock dir")
+	}
+}
+
+func TestMockEmptyDir(t *testing.T) {
+	cam, err := NewMockCamera(&CameraConfig{MockDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := cam.Snapshot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(frame.Data)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ffmpegProgressArgs make ffmpeg write key=value progress blocks to stdout instead of stats line
+var ffmpegProgressArgs = []string{"-progress", "pipe:1", "-nostats"}
+
+// progress keys look like frame=12 or out_time_us=480000, everything else is ffmpeg log
+var progressLine = regexp.MustCompile(`^\w+=\S*$`)
+
+// ffmpegProgress prints progress of ffmpeg run with ffmpegProgressArgs to out, a line per
+// percent. Percent is output time of duration, it counts end hold too
+type ffmpegProgress struct {
+	out      io.Writer
+	format   string
+	duration time.Duration
+
+	partial []byte
+	frame   string
+	outTime time.Duration
+	printed int
+	// ffmpeg log to report on failure
+	log bytes.Buffer
+}
+
+func newFFmpegProgress(out io.Writer, format string, duration time.Duration) *ffmpegProgress {
+	return &ffmpegProgress{out: out, format: format, duration: duration, printed: -1}
+}
+
+// run runs ffmpeg with progress reporting and returns its log like Runner.Run does
+func (p *ffmpegProgress) run(ctx context.Context, ffmpeg string, args []string) ([]byte, error) {
+	proc, err := Runner.Start(ctx, p, ffmpeg, args...)
+	if err != nil {
+		return nil, err
+	}
+	err = proc.Wait()
+	return p.log.Bytes(), err
+}
+
+// Write splits output into lines, stdout and stderr of ffmpeg come through the same pipe
+func (p *ffmpegProgress) Write(b []byte) (int, error) {
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.line(strings.TrimSpace(string(p.partial[:i])))
+		p.partial = p.partial[i+1:]
+	}
+}
+
+func (p *ffmpegProgress) line(line string) {
+	if !progressLine.MatchString(line) {
+		p.log.WriteString(line + "\n")
+		return
+	}
+	key, value, _ := strings.Cut(line, "=")
+	switch key {
+	case "frame":
+		p.frame = value
+	case "out_time_us":
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			p.outTime = time.Duration(us) * time.Microsecond
+		}
+	case "progress":
+		p.print(value == "end")
+	}
+}
+
+func (p *ffmpegProgress) print(end bool) {
+	percent := 100
+	if !end && p.duration > 0 {
+		percent = min(int(p.outTime*100/p.duration), 99)
+	}
+	if percent <= p.printed {
+		return
+	}
+	p.printed = percent
+	fmt.Fprintf(p.out, "%s: frame %s, %d%%\n", p.format, p.frame, percent)
+}
@@ -0,0 +1,93 @@
+package camera
+
+import (
+	"image"
+	"unicode"
+)
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// glyphs is 3x5 bitmap font, row per byte, 3 low bits are pixels left to right
+var glyphs = map[rune][glyphHeight]byte{
+	'0': {0b111, 0b101, 0b101, 0b101, 0b111},
+	'1': {0b010, 0b110, 0b010, 0b010, 0b111},
+	'2': {0b111, 0b001, 0b111, 0b100, 0b111},
+	'3': {0b111, 0b001, 0b111, 0b001, 0b111},
+	'4': {0b101, 0b101, 0b111, 0b001, 0b001},
+	'5': {0b111, 0b100, 0b111, 0b001, 0b111},
+	'6': {0b111, 0b100, 0b111, 0b101, 0b111},
+	'7': {0b111, 0b001, 0b010, 0b010, 0b010},
+	'8': {0b111, 0b101, 0b111, 0b101, 0b111},
+	'9': {0b111, 0b101, 0b111, 0b001, 0b111},
+	':': {0b000, 0b010, 0b000, 0b010, 0b000},
+	'-': {0b000, 0b000, 0b111, 0b000, 0b000},
+	'.': {0b000, 0b000, 0b000, 0b000, 0b010},
+	'/': {0b001, 0b001, 0b010, 0b100, 0b100},
+	' ': {},
+	'%': {0b101, 0b001, 0b010, 0b100, 0b101},
+	'_': {0b000, 0b000, 0b000, 0b000, 0b111},
+	'A': {0b010, 0b101, 0b111, 0b101, 0b101},
+	'B': {0b110, 0b101, 0b110, 0b101, 0b110},
+	'C': {0b011, 0b100, 0b100, 0b100, 0b011},
+	'D': {0b110, 0b101, 0b101, 0b101, 0b110},
+	'E': {0b111, 0b100, 0b110, 0b100, 0b111},
+	'F': {0b111, 0b100, 0b110, 0b100, 0b100},
+	'G': {0b011, 0b100, 0b101, 0b101, 0b011},
+	'H': {0b101, 0b101, 0b111, 0b101, 0b101},
+	'I': {0b111, 0b010, 0b010, 0b010, 0b111},
+	'J': {0b001, 0b001, 0b001, 0b101, 0b010},
+	'K': {0b101, 0b101, 0b110, 0b101, 0b101},
+	'L': {0b100, 0b100, 0b100, 0b100, 0b111},
+	'M': {0b101, 0b111, 0b111, 0b101, 0b101},
+	'N': {0b110, 0b101, 0b101, 0b101, 0b101},
+	'O': {0b010, 0b101, 0b101, 0b101, 0b010},
+	'P': {0b110, 0b101, 0b110, 0b100, 0b100},
+	'Q': {0b010, 0b101, 0b101, 0b110, 0b011},
+	'R': {0b110, 0b101, 0b110, 0b101, 0b101},
+	'S': {0b011, 0b100, 0b010, 0b001, 0b110},
+	'T': {0b111, 0b010, 0b010, 0b010, 0b010},
+	'U': {0b101, 0b101, 0b101, 0b101, 0b111},
+	'V': {0b101, 0b101, 0b101, 0b101, 0b010},
+	'W': {0b101, 0b101, 0b111, 0b111, 0b101},
+	'X': {0b101, 0b101, 0b010, 0b101, 0b101},
+	'Y': {0b101, 0b101, 0b010, 0b010, 0b010},
+	'Z': {0b111, 0b001, 0b010, 0b100, 0b111},
+}
+
+// textWidth is width of text drawn with scale in pixels
+func textWidth(text string, scale int) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+1) - 1) * scale
+}
+
+// drawText paints text in white luma with top-left corner at x,y. Letters are drawn uppercase,
+// unknown runes are skipped as spaces
+func drawText(img *image.YCbCr, x, y, scale int, text string) {
+	for i, r := range []rune(text) {
+		glyph := glyphs[unicode.ToUpper(r)]
+		gx := x + i*(glyphWidth+1)*scale
+		for row := range glyphHeight {
+			for col := range glyphWidth {
+				if glyph[row]&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				fillLuma(img, image.Rect(gx+col*scale, y+row*scale, gx+(col+1)*scale, y+(row+1)*scale), 0xff)
+			}
+		}
+	}
+}
+
+func fillLuma(img *image.YCbCr, rect image.Rectangle, luma uint8) {
+	rect = rect.Intersect(img.Rect)
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			img.Y[img.YOffset(px, py)] = luma
+		}
+	}
+}
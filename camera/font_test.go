@@ -0,0 +1,51 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestDrawText(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420)
+	drawText(img, 1, 1, 1, "1-")
+
+	var got string
+	for y := range 7 {
+		for x := range 9 {
+			if img.Y[img.YOffset(x, y)] == 0xff {
+				got += "#"
+			} else {
+				got += "."
+			}
+		}
+		got += "\n"
+	}
+	want := "" +
+		".........\n" +
+		"..#......\n" +
+		".##......\n" +
+		"..#..###.\n" +
+		"..#......\n" +
+		".###.....\n" +
+		".........\n"
+	if got != want {
+		t.Errorf("unexpected text pixels:\n%s", got)
+	}
+	if w := textWidth("1-", 2); w != 14 {
+		t.Errorf("expected text width 14, got %d", w)
+	}
+}
+
+func TestDrawTextLowercase(t *testing.T) {
+	lower := image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420)
+	upper := image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420)
+	drawText(lower, 0, 0, 1, "ok%")
+	drawText(upper, 0, 0, 1, "OK%")
+	if !bytes.Equal(lower.Y, upper.Y) {
+		t.Error("expected lowercase letters drawn as uppercase")
+	}
+	if bytes.Count(upper.Y, []byte{0xff}) == 0 {
+		t.Error("expected letters drawn")
+	}
+}
@@ -0,0 +1,88 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// snapshot formats, JPEG is default and the only one PrusaConnect takes
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+var ErrInvalidFormat = errors.New("invalid image format")
+
+// ParseFormat checks format asked by client, empty is JPEG
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "", FormatJPEG, "jpg":
+		return FormatJPEG, nil
+	case FormatPNG:
+		return FormatPNG, nil
+	}
+	return "", fmt.Errorf("%w %q, expected %s or %s", ErrInvalidFormat, format, FormatJPEG, FormatPNG)
+}
+
+// ContentType is MIME type of format
+func ContentType(format string) string {
+	if format == FormatPNG {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+type formatKey struct{}
+
+// WithFormat asks snapshot in format, backends able to capture it natively do so
+func WithFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, formatKey{}, format)
+}
+
+// FormatOf returns format set by WithFormat, JPEG if none
+func FormatOf(ctx context.Context) string {
+	if format, ok := ctx.Value(formatKey{}).(string); ok && format != "" {
+		return format
+	}
+	return FormatJPEG
+}
+
+// ConvertFrame returns frame in format, re-encoding it if backend captured other one
+func ConvertFrame(frame *Frame, format string) (*Frame, error) {
+	if frame.format() == format {
+		return frame, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode %s frame: %w", frame.format(), err)
+	}
+	data, err := encodeImage(img, format)
+	if err != nil {
+		return nil, err
+	}
+	out := *frame
+	out.Data, out.Format = data, format
+	return &out, nil
+}
+
+// pngEncoder favours speed, Pi Zero takes seconds on large frames otherwise
+var pngEncoder = &png.Encoder{CompressionLevel: png.BestSpeed}
+
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if format == FormatPNG {
+		if err := pngEncoder.Encode(buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode png: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package camera
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for format, want := range map[string]string{"": FormatJPEG, "jpg": FormatJPEG, "jpeg": FormatJPEG, "png": FormatPNG} {
+		got, err := ParseFormat(format)
+		if err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s, %v", format, want, got, err)
+		}
+	}
+	if _, err := ParseFormat("webp"); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("expected ErrInvalidFormat, got %v", err)
+	}
+}
+
+func TestConvertFrame(t *testing.T) {
+	frame := &Frame{Data: testJPEG(t), Source: SourceFresh}
+	if got, err := ConvertFrame(frame, FormatJPEG); err != nil || got != frame {
+		t.Errorf("expected frame as is, got %v, %v", got, err)
+	}
+
+	got, err := ConvertFrame(frame, FormatPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Format != FormatPNG || got.Source != SourceFresh {
+		t.Errorf("unexpected frame %+v", got)
+	}
+	if _, err := png.Decode(bytes.NewReader(got.Data)); err != nil {
+		t.Errorf("converted frame isn't png: %v", err)
+	}
+	if frame.Format != "" {
+		t.Error("source frame is changed")
+	}
+}
+
+func TestUSBSnapshotPNG(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.cfg.Rotation = 90
+	c.transform = newFrameTransform(c.cfg)
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
+	t.Cleanup(func() { c.Close(t.Context()) })
+	waitSnapshot(t, c, nil)
+
+	frame, err := c.Snapshot(WithFormat(t.Context(), FormatPNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		t.Fatalf("expected png, got %v", err)
+	}
+	// fake camera gives 64x48 frames, rotation applies
+	if b := img.Bounds(); frame.Format != FormatPNG || b.Dx() != 48 || b.Dy() != 64 {
+		t.Errorf("unexpected %s frame %v", frame.Format, b)
+	}
+}
+
+func TestRPISnapshotPNG(t *testing.T) {
+	runner := useFakeRunner(t)
+	c := newTestRPICamera(t)
+	c.camConfig = &CameraConfig{}
+
+	frame, err := c.Snapshot(WithFormat(t.Context(), FormatPNG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Format != FormatPNG {
+		t.Errorf("expected png frame, got %q", frame.Format)
+	}
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 1 || !slices.Contains(calls[0], "png") || slices.Contains(calls[0], "jpg") {
+		t.Errorf("unexpected rpicam calls %q", calls)
+	}
+
+	// jpeg snapshot isn't served with png shot
+	if frame, err = c.Snapshot(t.Context()); err != nil || frame.Format != "" {
+		t.Errorf("expected jpeg shot, got %+v, %v", frame, err)
+	}
+}
@@ -0,0 +1,102 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// what is done when timelapse reaches MaxFrames
+const (
+	// capture stops, video ends where it stopped
+	MaxFramesStop = "stop"
+	// every other frame is deleted and interval doubled, video covers the whole print
+	MaxFramesThin = "thin"
+)
+
+// frameCheckInterval is how often frames are counted against MaxFrames during capture
+var frameCheckInterval = time.Minute
+
+func (cfg *TimelapseConfig) validateMaxFrames() error {
+	if cfg.MaxFrames < 0 {
+		return fmt.Errorf("invalid timelapse.maxFrames %d", cfg.MaxFrames)
+	}
+	switch cfg.MaxFramesAction {
+	case "", MaxFramesStop, MaxFramesThin:
+		return nil
+	}
+	return fmt.Errorf("invalid timelapse.maxFramesAction %q, expected %s or %s", cfg.MaxFramesAction, MaxFramesStop, MaxFramesThin)
+}
+
+// watchFrames keeps frames of tl within MaxFrames. Thinning restarts capture of tl with
+// parent context, ctx is the one of running capture
+func (c *timelapseSvc) watchFrames(parent, ctx context.Context, tl *timelapse) {
+	if c.config.MaxFrames <= 0 {
+		return
+	}
+	ticker := time.NewTicker(frameCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		frames, err := frameFiles(tl.currentDir)
+		if err != nil {
+			c.log.WarnContext(ctx, "fail to count timelapse frames", "err", err)
+			continue
+		}
+		if len(frames) < c.config.MaxFrames {
+			continue
+		}
+		if c.config.MaxFramesAction == MaxFramesThin {
+			c.thinFrames(parent, ctx, tl)
+			return
+		}
+		c.log.WarnContext(ctx, "timelapse reached max frames, capture stopped, video will be built from frames captured so far",
+			"frames", frames, "jobID", tl.jobID, "jobName", tl.jobName)
+		tl.framesCapped.Store(true)
+		tl.timelapseStop()
+		return
+	}
+}
+
+// thinFrames stops capture of tl, deletes every other frame and resumes capture at double
+// interval, or double progress delta
+func (c *timelapseSvc) thinFrames(parent, ctx context.Context, tl *timelapse) {
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+	// finished or interrupted meanwhile
+	if c.timelapse != tl || ctx.Err() != nil {
+		return
+	}
+	tl.timelapseStop()
+	tl.timelapseCommand.Wait()
+
+	frames, err := frameFiles(tl.currentDir)
+	if err != nil {
+		c.log.ErrorContext(ctx, "fail to list frames for thinning", "err", err)
+	}
+	deleted := 0
+	for i := 1; i < len(frames); i += 2 {
+		if err := os.Remove(filepath.Join(tl.currentDir, frames[i])); err != nil {
+			c.log.WarnContext(ctx, "fail to delete thinned frame", "err", err)
+			continue
+		}
+		deleted++
+	}
+	tl.thinned++
+	tl.interval *= 2
+
+	frameStart := newestShot(tl.currentDir) + 1
+	if err := c.beginCapture(parent, tl, frameStart); err != nil {
+		c.log.ErrorContext(ctx, "fail to restart capture after thinning, video will be built from frames captured so far", "err", err)
+		tl.framesCapped.Store(true)
+		return
+	}
+	c.log.WarnContext(ctx, "timelapse reached max frames, every other frame deleted and interval doubled",
+		"deleted", deleted, "interval", tl.interval, "thinned", tl.thinned, "jobID", tl.jobID, "jobName", tl.jobName)
+}
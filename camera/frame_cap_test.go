@@ -0,0 +1,51 @@
+package camera
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMaxFramesStop(t *testing.T) {
+	ts, tl, _ := startCappedTimelapse(t, MaxFramesStop)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !tl.framesCapped.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil || !status.FramesCapped || !status.CaptureStopped || status.Frames != 3 {
+		t.Errorf("expected capture stopped at 3 frames, got %+v, %v", status, err)
+	}
+}
+
+func TestMaxFramesThin(t *testing.T) {
+	ts, _, runner := startCappedTimelapse(t, MaxFramesThin)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(runner.Calls("rpicam-still")) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	calls := runner.Calls("rpicam-still")
+	if len(calls) < 2 {
+		t.Fatal("capture wasn't restarted after thinning")
+	}
+	// frame 1 is deleted, capture goes on after frame 2 at double interval
+	args := calls[1]
+	if i := slices.Index(args, "--timelapse"); i < 0 || args[i+1] != "40000" {
+		t.Errorf("expected doubled interval, got %q", args)
+	}
+	if i := slices.Index(args, "--framestart"); i < 0 || args[i+1] != "3" {
+		t.Errorf("expected capture to continue after frame 2, got %q", args)
+	}
+	if exists(shotFilename(ts.current.Load().currentDir, 1)) && len(calls) == 2 {
+		t.Error("every other frame wasn't deleted")
+	}
+	if status, err := ts.Status(t.Context()); err != nil || status.Thinned == 0 || status.FramesCapped {
+		t.Errorf("expected thinned status, got %+v, %v", status, err)
+	}
+
+	if err := (&TimelapseConfig{MaxFramesAction: "drop"}).validate(); err == nil {
+		t.Error("expected invalid maxFramesAction error")
+	}
+}
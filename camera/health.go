@@ -0,0 +1,53 @@
+package camera
+
+import (
+	"sync"
+	"time"
+)
+
+// Health is camera state for status endpoint and metrics, getting it doesn't touch device
+type Health struct {
+	Backend string `json:"backend"`
+	Device  string `json:"device,omitempty"`
+	Binary  string `json:"binary,omitempty"`
+	// negotiated with device or configured, zero if unknown
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Format string `json:"format,omitempty"`
+	// zero and omitted before the first frame
+	LastFrameAt    time.Time `json:"lastFrameAt,omitzero"`
+	FramesCaptured uint64    `json:"framesCaptured"`
+	// the latest capture error, empty after successful capture
+	LastError string `json:"lastError,omitempty"`
+}
+
+// frameStats counts captured frames and remembers capture error, zero value is ready to use
+type frameStats struct {
+	mu        sync.Mutex
+	frames    uint64
+	lastFrame time.Time
+	lastErr   string
+}
+
+func (s *frameStats) frame(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames++
+	s.lastFrame = at
+	s.lastErr = ""
+}
+
+func (s *frameStats) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err.Error()
+}
+
+// fill copies stats into h
+func (s *frameStats) fill(h *Health) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.FramesCaptured = s.frames
+	h.LastFrameAt = s.lastFrame
+	h.LastError = s.lastErr
+}
@@ -0,0 +1,169 @@
+package camera
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/prusaLinkClient/prusalinktest"
+)
+
+// timelapseOption adjusts timelapse of newTestTimelapse
+type timelapseOption func(t *testing.T, ts *timelapseSvc)
+
+// withRpicam captures with rpicam-still of fake runner
+func withRpicam() timelapseOption {
+	return func(t *testing.T, ts *timelapseSvc) {
+		ts.rpicam = newRpicamBinary("rpicam-still", "/fake/bin/rpicam-still")
+		ts.source = rpicamSource{ts}
+	}
+}
+
+// withPrinter makes timelapse poll printer
+func withPrinter(printer prusalinkclient.Client) timelapseOption {
+	return func(t *testing.T, ts *timelapseSvc) {
+		ts.prusalink = printer
+	}
+}
+
+// withWorkDir puts frames into temp dir of the test
+func withWorkDir() timelapseOption {
+	return func(t *testing.T, ts *timelapseSvc) {
+		ts.workDir = t.TempDir()
+	}
+}
+
+// withJobs replaces noop worker with runJob, like the service has. Video builds don't encode,
+// they hold the worker till hold is closed, nil doesn't hold them
+func withJobs(hold <-chan struct{}) timelapseOption {
+	return func(t *testing.T, ts *timelapseSvc) {
+		ts.builds = newBuildQueue(slog.Default(), filepath.Join(ts.config.OutputDir, buildQueueFile), 1,
+			func(ctx context.Context, job *BuildJob) error {
+				if job.Kind != "" {
+					return ts.runJob(ctx, job)
+				}
+				if hold != nil {
+					<-hold
+				}
+				return nil
+			})
+		go ts.builds.run()
+	}
+}
+
+// withClose closes timelapse when test ends
+func withClose() timelapseOption {
+	return func(t *testing.T, ts *timelapseSvc) {
+		t.Cleanup(func() { ts.closeTimelapse(t.Context()) })
+	}
+}
+
+// newTestTimelapse creates timelapse without printer and camera, builds are queued to noop worker
+// unless options say otherwise
+func newTestTimelapse(t *testing.T, cfg *TimelapseConfig, opts ...timelapseOption) *timelapseSvc {
+	t.Helper()
+	ts := &timelapseSvc{
+		log:       slog.Default(),
+		camConfig: &CameraConfig{},
+		config:    cfg,
+	}
+	ts.builds = newBuildQueue(slog.Default(), filepath.Join(cfg.OutputDir, buildQueueFile), 1,
+		func(ctx context.Context, job *BuildJob) error { return nil })
+	for _, opt := range opts {
+		opt(t, ts)
+	}
+	return ts
+}
+
+// startTestTimelapse begins rpicam time capture of job 42 at 20 seconds, it's closed when test ends.
+// Fake runner has to be in place
+func startTestTimelapse(t *testing.T, cfg *TimelapseConfig, opts ...timelapseOption) (*timelapseSvc, *timelapse) {
+	t.Helper()
+	ts := newTestTimelapse(t, cfg, append([]timelapseOption{withRpicam(), withClose()}, opts...)...)
+	tl := &timelapse{currentDir: t.TempDir(), jobID: 42, interval: 20 * time.Second, mode: ModeTime}
+	ts.Lock()
+	err := ts.beginCapture(t.Context(), tl, 0)
+	ts.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, tl
+}
+
+// pollTimelapse feeds current printer state to timelapse, like watcher does on change
+func pollTimelapse(t *testing.T, ts *timelapseSvc) {
+	st, err := ts.prusalink.JobStatus(t.Context())
+	ts.handleTimelapse(t.Context(), st, err)
+}
+
+// frame watchers outlive closeTimelapse for a moment, so check interval is set once
+// and kept for the rest of tests. Only timelapses with MaxFrames count frames
+var shortFrameCheck = sync.OnceFunc(func() { frameCheckInterval = time.Millisecond })
+
+// startCappedTimelapse begins capture of 3 fake frames with MaxFrames 3
+func startCappedTimelapse(t *testing.T, action string) (*timelapseSvc, *timelapse, *fakeRunner) {
+	shortFrameCheck()
+	runner := useFakeRunner(t)
+	ts, tl := startTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir(), MaxFrames: 3, MaxFramesAction: action})
+	return ts, tl, runner
+}
+
+// newSessionTimelapse returns timelapse with session of job 42 interrupted with two frames
+func newSessionTimelapse(t *testing.T, printer prusalinkclient.Status) (*timelapseSvc, *timelapseSession) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "timelapse421234")
+	writeFile(t, filepath.Join(dir, "image000000.jpg"), testJPEG(t))
+	writeFile(t, filepath.Join(dir, "image000001.jpg"), testJPEG(t))
+
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		Enabled: true, Interval: 20, VideoLenght: 7, MinFPS: 12, OutputDir: t.TempDir(), OrphanFrames: OrphansDelete,
+	}, withRpicam(), withPrinter(prusalinktest.NewFakeClient(printer)))
+	ts.saveSession(t.Context(), &timelapse{
+		currentDir: dir,
+		startTime:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		jobID:      42,
+		jobName:    "benchy.gcode",
+	})
+
+	session := ts.loadSession(t.Context())
+	if session == nil {
+		t.Fatal("session isn't loaded")
+	}
+	// session frames aren't orphans
+	ts.sweep(t.Context(), tmpDir, session)
+	if !exists(dir) {
+		t.Fatal("sweep removed frames of session")
+	}
+	return ts, session
+}
+
+// newStartTimelapse returns timelapse of printer walking through steps, polled fast while it
+// waits for start
+func newStartTimelapse(t *testing.T, startAt string, steps ...prusalinkclient.Status) (*timelapseSvc, *prusalinktest.FakeClient) {
+	t.Helper()
+	useFakeRunner(t)
+	old := startPollInterval
+	startPollInterval = time.Millisecond
+	t.Cleanup(func() { startPollInterval = old })
+
+	printer := prusalinktest.NewFakeClient(steps...)
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		Enabled: true, Interval: 20, VideoLenght: 7, MinFPS: 12, OutputDir: t.TempDir(), StartAt: startAt,
+	}, withRpicam(), withWorkDir(), withPrinter(printer), withClose())
+	return ts, printer
+}
+
+// newMockTLCamera returns mock camera without timelapse
+func newMockTLCamera(t *testing.T) CameraWithTL {
+	t.Helper()
+	cam, err := NewMockCamera(&CameraConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return withoutTimelapse{cam}
+}
@@ -0,0 +1,151 @@
+package camera
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	HookStart         = "timelapse.start"
+	HookFinish        = "timelapse.finish"
+	HookBuildComplete = "build.complete"
+
+	defaultHookTimeout = 10 * time.Second
+)
+
+// hookRetryDelay is wait before the first retry of failed delivery, doubled for the next ones
+var hookRetryDelay = 2 * time.Second
+
+// HooksConfig is webhooks of timelapse events, empty URL disables its event
+type HooksConfig struct {
+	OnStart         string
+	OnFinish        string
+	OnBuildComplete string
+	// prefix of video download URL in build payload, e.g. http://prusacam.local:8080.
+	// URL is omitted if it's empty
+	BaseURL string
+	// of single delivery attempt, 10s if zero
+	Timeout time.Duration
+	// failed delivery is attempted again that many times
+	Retries int
+}
+
+func (cfg *HooksConfig) validate() error {
+	for key, u := range map[string]string{
+		"onStart": cfg.OnStart, "onFinish": cfg.OnFinish, "onBuildComplete": cfg.OnBuildComplete, "baseURL": cfg.BaseURL,
+	} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid timelapse.hooks.%s %q", key, u)
+		}
+	}
+	if cfg.Timeout < 0 || cfg.Retries < 0 {
+		return fmt.Errorf("invalid timelapse.hooks timeout %s or retries %d", cfg.Timeout, cfg.Retries)
+	}
+	return nil
+}
+
+// HookEvent is JSON body POSTed to webhooks. Video fields are set for build.complete only
+type HookEvent struct {
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	JobID      int       `json:"jobId"`
+	JobName    string    `json:"jobName"`
+	Manual     bool      `json:"manual,omitempty"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	Frames     int       `json:"frames"`
+	// file name of video in output dir and its download URL, without hooks.baseURL it's omitted
+	Video   string   `json:"video,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Formats []string `json:"formats,omitempty"`
+}
+
+// hooks delivers events in background, failures are only logged
+type hooks struct {
+	log    *slog.Logger
+	cfg    *HooksConfig
+	client *http.Client
+}
+
+func newHooks(log *slog.Logger, cfg *HooksConfig) *hooks {
+	return &hooks{
+		log:    log.With("svc", "hooks"),
+		cfg:    cfg,
+		client: &http.Client{Timeout: cmp.Or(cfg.Timeout, defaultHookTimeout)},
+	}
+}
+
+// fire posts ev to hook of its event, if any, without waiting for delivery
+func (h *hooks) fire(ev HookEvent) {
+	if h == nil {
+		return
+	}
+	var target string
+	switch ev.Event {
+	case HookStart:
+		target = h.cfg.OnStart
+	case HookFinish:
+		target = h.cfg.OnFinish
+	case HookBuildComplete:
+		target = h.cfg.OnBuildComplete
+		if h.cfg.BaseURL != "" && ev.Video != "" {
+			ev.URL = strings.TrimSuffix(h.cfg.BaseURL, "/") + "/list/" + url.PathEscape(ev.Video)
+		}
+	}
+	if target == "" {
+		return
+	}
+	ev.Time = time.Now()
+	body, err := json.Marshal(ev)
+	if err != nil {
+		h.log.Error("fail to marshal hook event", "event", ev.Event, "err", err)
+		return
+	}
+	go h.deliver(target, ev.Event, body)
+}
+
+func (h *hooks) deliver(target, event string, body []byte) {
+	delay := hookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := h.post(target, body)
+		if err == nil {
+			h.log.Debug("hook delivered", "event", event, "url", target)
+			return
+		}
+		if attempt >= h.cfg.Retries {
+			h.log.Warn("hook delivery failed", "event", event, "url", target, "attempts", attempt+1, "err", err)
+			return
+		}
+		h.log.Debug("hook delivery failed, retrying", "event", event, "url", target, "in", delay, "err", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (h *hooks) post(target string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("fail to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fail to post hook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("hook responded %s", resp.Status)
+	}
+	return nil
+}
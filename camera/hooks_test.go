@@ -0,0 +1,77 @@
+package camera
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	prev := hookRetryDelay
+	hookRetryDelay = time.Millisecond
+	t.Cleanup(func() { hookRetryDelay = prev })
+
+	events := make(chan HookEvent, 10)
+	var failed atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the first delivery fails, retry gets through
+		if !failed.Swap(true) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var ev HookEvent
+		if err := json.NewDecoder(req.Body).Decode(&ev); err != nil || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected hook request: %v", err)
+		}
+		events <- ev
+	}))
+	defer srv.Close()
+
+	useFakeRunner(t)
+	out := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{VideoLenght: 7, MinFPS: 12, OutputDir: out})
+	ts.hooks = newHooks(slog.Default(), &HooksConfig{
+		OnBuildComplete: srv.URL + "/video",
+		BaseURL:         "http://prusacam.local:8080/",
+		Retries:         2,
+	})
+
+	// start has no hook
+	ts.hooks.fire(HookEvent{Event: HookStart, JobID: 42})
+	if err := ts.buildVideo(t.Context(), &BuildJob{Dir: t.TempDir(), JobID: 42, JobName: "benchy.gcode", Frames: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Event != HookBuildComplete || ev.JobID != 42 || ev.Frames != 10 || !strings.HasSuffix(ev.Video, "-benchy-42.mp4") {
+			t.Errorf("unexpected event %+v", ev)
+		}
+		if ev.URL != "http://prusacam.local:8080/list/"+ev.Video {
+			t.Errorf("unexpected download URL %q", ev.URL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hook wasn't delivered")
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected extra event %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHooksConfig(t *testing.T) {
+	for _, cfg := range []HooksConfig{{OnStart: "ftp://x"}, {BaseURL: "prusacam.local"}, {Retries: -1}} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%+v: expected validation error", cfg)
+		}
+	}
+	if err := (&HooksConfig{OnFinish: "https://example.com/hook", Retries: 3}).validate(); err != nil {
+		t.Errorf("unexpected validation error %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+const (
+	httpSnapshotTimeout  = 10 * time.Second
+	httpReconnectMaxWait = 30 * time.Second
+	// single JPEG of network camera, ESP32-CAM UXGA frames are ~300KB
+	maxHTTPFrameSize = 16 << 20
+)
+
+// httpCamera pulls frames from network camera: snapshot URL is fetched per frame,
+// MJPEG stream URL is read continuously and its latest frame is served
+type httpCamera struct {
+	log *slog.Logger
+	cfg *CameraConfig
+	*timelapseSvc
+
+	client *http.Client
+	life   *lifecycle
+	stats  frameStats
+	// the latest frame of MJPEG stream
+	latest atomic.Pointer[Frame]
+	// replaced in tests
+	now func() time.Time
+}
+
+func NewHTTPCamera(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, camConfig *CameraConfig, tlConfig *TimelapseConfig) (CameraWithTL, error) {
+	if camConfig.SnapshotURL == "" && camConfig.StreamURL == "" {
+		return nil, errors.New("http camera needs camera.snapshotURL or camera.streamURL")
+	}
+	for _, u := range []string{camConfig.SnapshotURL, camConfig.StreamURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid camera URL %q", u)
+		}
+	}
+
+	c := newHTTPCamera(log, camConfig)
+	c.timelapseSvc = newSnapshotTimelapse(log, prusalink, watcher, c, camConfig, tlConfig)
+	if camConfig.StreamURL != "" {
+		c.life.goRun(func() { c.readStream(c.life.ctx) })
+	}
+	return c, nil
+}
+
+func newHTTPCamera(log *slog.Logger, cfg *CameraConfig) *httpCamera {
+	return &httpCamera{
+		log:    log.With("svc", "camera"),
+		cfg:    cfg,
+		client: &http.Client{},
+		life:   newLifecycle(),
+		now:    time.Now,
+	}
+}
+
+func (c *httpCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	if f := c.latest.Load(); f != nil && c.now().Sub(f.CapturedAt) <= c.cfg.maxFrameAge() {
+		return f, nil
+	}
+	if c.cfg.SnapshotURL == "" {
+		return nil, fmt.Errorf("%s: %w", c.cfg.StreamURL, ErrCameraUnavailable)
+	}
+
+	data, err := c.fetchSnapshot(ctx)
+	if err != nil {
+		c.stats.fail(err)
+		return nil, err
+	}
+	frame := &Frame{
+		Data:       data,
+		Source:     SourceFresh,
+		CapturedAt: c.now(),
+	}
+	c.stats.frame(frame.CapturedAt)
+	return frame, nil
+}
+
+func (c *httpCamera) Stream(ctx context.Context) (chan []byte, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	return streamSnapshots(c.life.bind(ctx), c.log, c.cfg, c.Snapshot), nil
+}
+
+// Close stops reading MJPEG stream and timelapse
+func (c *httpCamera) Close(ctx context.Context) error {
+	if err := c.life.close(ctx); err != nil {
+		return err
+	}
+	return c.closeTimelapse(ctx)
+}
+
+func (c *httpCamera) Info(ctx context.Context) (*Info, error) {
+	device := c.cfg.StreamURL
+	if device == "" {
+		device = c.cfg.SnapshotURL
+	}
+	return &Info{
+		Backend: TypeHTTP,
+		Device:  redactURL(device),
+	}, nil
+}
+
+func (c *httpCamera) Health(ctx context.Context) (*Health, error) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h := &Health{
+		Backend: info.Backend,
+		Device:  info.Device,
+		Format:  "jpeg",
+	}
+	c.stats.fill(h)
+	return h, nil
+}
+
+// fetchSnapshot gets single JPEG from snapshot URL
+func (c *httpCamera) fetchSnapshot(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, httpSnapshotTimeout)
+	defer cancel()
+
+	resp, err := c.get(ctx, c.cfg.SnapshotURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPFrameSize))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read snapshot: %w", err)
+	}
+	frame, err := passJPEG(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("camera snapshot isn't JPEG: %w", err)
+	}
+	return frame, nil
+}
+
+// readStream keeps reading MJPEG stream, reconnecting with backoff when camera goes away
+func (c *httpCamera) readStream(ctx context.Context) {
+	delay := time.Second
+	for ctx.Err() == nil {
+		started := c.now()
+		err := c.readStreamOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if c.now().Sub(started) > httpReconnectMaxWait {
+			// stream was fine for a while, it's a new outage
+			delay = time.Second
+		}
+		c.log.WarnContext(ctx, "camera stream lost, reconnecting", "err", err, "retryIn", delay)
+		c.stats.fail(err)
+		sleepCtx(ctx, delay)
+		delay = min(delay*2, httpReconnectMaxWait)
+	}
+}
+
+// readStreamOnce reads frames of single MJPEG connection till it breaks
+func (c *httpCamera) readStreamOnce(ctx context.Context) error {
+	resp, err := c.get(ctx, c.cfg.StreamURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return fmt.Errorf("camera stream isn't MJPEG: %q", resp.Header.Get("Content-Type"))
+	}
+	// some cameras put dashes into boundary parameter too
+	mr := multipart.NewReader(resp.Body, strings.TrimPrefix(params["boundary"], "--"))
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return fmt.Errorf("fail to read stream part: %w", err)
+		}
+		data, err := io.ReadAll(io.LimitReader(part, maxHTTPFrameSize))
+		if err != nil {
+			return fmt.Errorf("fail to read stream frame: %w", err)
+		}
+		frame, err := passJPEG(data, "")
+		if err != nil {
+			c.log.DebugContext(ctx, "skipping broken stream frame", "err", err)
+			continue
+		}
+		f := &Frame{
+			Data:       frame,
+			Source:     SourceFresh,
+			CapturedAt: c.now(),
+		}
+		c.latest.Store(f)
+		c.stats.frame(f.CapturedAt)
+	}
+}
+
+func (c *httpCamera) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create request: %w", err)
+	}
+	if c.cfg.HTTPUsername != "" {
+		req.SetBasicAuth(c.cfg.HTTPUsername, c.cfg.HTTPPassword)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCameraUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s answered %s", ErrCameraUnavailable, redactURL(u), resp.Status)
+	}
+	return resp, nil
+}
+
+// redactURL hides credentials put into camera URL
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Redacted()
+}
@@ -0,0 +1,175 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHTTPCameraSnapshot(t *testing.T) {
+	jpg := testJPEG(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "esp" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/capture":
+			w.Write(jpg)
+		default:
+			w.Write([]byte("<html>not a picture</html>"))
+		}
+	}))
+	defer srv.Close()
+
+	c := newHTTPCamera(slog.Default(), &CameraConfig{
+		SnapshotURL:  srv.URL + "/capture",
+		HTTPUsername: "esp",
+		HTTPPassword: "secret",
+	})
+	frame, err := c.Snapshot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame.Data, jpg) || frame.Source != SourceFresh {
+		t.Errorf("unexpected frame: source %s, %d bytes", frame.Source, len(frame.Data))
+	}
+
+	c.cfg.SnapshotURL = srv.URL + "/index.html"
+	if _, err := c.Snapshot(t.Context()); err == nil {
+		t.Error("expected error for non-JPEG snapshot")
+	}
+
+	c.cfg.SnapshotURL = srv.URL + "/capture"
+	c.cfg.HTTPPassword = "wrong"
+	if _, err := c.Snapshot(t.Context()); !errors.Is(err, ErrCameraUnavailable) {
+		t.Errorf("expected ErrCameraUnavailable for rejected credentials, got %v", err)
+	}
+
+	srv.Close()
+	c.cfg.HTTPPassword = "secret"
+	if _, err := c.Snapshot(t.Context()); !errors.Is(err, ErrCameraUnavailable) {
+		t.Errorf("expected ErrCameraUnavailable for gone camera, got %v", err)
+	}
+}
+
+func TestHTTPCameraMJPEG(t *testing.T) {
+	jpg := testJPEG(t)
+	const boundary = "123456789000000000000987654321"
+	sent := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace;boundary="+boundary)
+		fmt.Fprintf(w, "--%s\r\nContent-Type: text/plain\r\n\r\nbroken\r\n", boundary)
+		fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n%s\r\n", boundary, len(jpg), jpg)
+		// next boundary ends previous part
+		fmt.Fprintf(w, "--%s\r\n", boundary)
+		w.(http.Flusher).Flush()
+		close(sent)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := newHTTPCamera(slog.Default(), &CameraConfig{StreamURL: srv.URL})
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		c.readStream(ctx)
+		close(done)
+	}()
+
+	<-sent
+	deadline := time.Now().Add(5 * time.Second)
+	for c.latest.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no frame read from stream")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	frame, err := c.Snapshot(t.Context())
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame.Data, jpg) {
+		t.Error("snapshot isn't the latest stream frame")
+	}
+
+	cancel()
+	<-done
+	c.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := c.Snapshot(t.Context()); !errors.Is(err, ErrCameraUnavailable) {
+		t.Errorf("expected ErrCameraUnavailable for stale stream frame, got %v", err)
+	}
+}
+
+func TestNewHTTPCameraErrors(t *testing.T) {
+	for _, cfg := range []*CameraConfig{
+		{Type: TypeHTTP},
+		{Type: TypeHTTP, SnapshotURL: "ftp://cam/capture"},
+		{Type: TypeHTTP, StreamURL: "cam:81/stream"},
+	} {
+		if _, err := New(slog.Default(), nil, nil, cfg, &TimelapseConfig{}); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestSnapshotSource(t *testing.T) {
+	cam, err := NewMockCamera(&CameraConfig{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &snapshotSource{log: slog.Default(), cam: cam}
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	proc, err := source.startCapture(ctx, dir, 10*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !exists(shotFilename(dir, 2)) {
+		if time.Now().After(deadline) {
+			t.Fatal("timelapse frames aren't captured")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	proc.Wait()
+
+	if err := source.captureShot(t.Context(), shotFilename(dir, 100)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(shotFilename(dir, 100))
+	if err != nil || !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		t.Errorf("last shot isn't JPEG: %v", err)
+	}
+}
+
+func TestSnapshotTimelapseCamera(t *testing.T) {
+	mock, err := NewMockCamera(&CameraConfig{Width: 64, Height: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cam CameraWithTL = withSnapshotTimelapse(slog.Default(), nil, nil, mock, &CameraConfig{}, &TimelapseConfig{OutputDir: t.TempDir()})
+	if _, err := cam.Snapshot(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cam.(Controller).Controls(t.Context()); !errors.Is(err, ErrNoControls) {
+		t.Errorf("expected ErrNoControls of mock camera, got %v", err)
+	}
+	if err := cam.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cam.Snapshot(t.Context()); !errors.Is(err, ErrClosed) {
+		t.Errorf("camera isn't closed with timelapse, got %v", err)
+	}
+}
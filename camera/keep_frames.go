@@ -0,0 +1,153 @@
+package camera
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// what is done with frames of successfully built video
+const (
+	KeepFramesNone = "none"
+	KeepFramesZip  = "zip"
+	KeepFramesDir  = "dir"
+)
+
+// frames kept are put next to video as <video w/o extension> + framesSuffix, .zip for archive
+const framesSuffix = ".frames"
+
+// keepFrames archives or moves frames of dir next to video according to KeepFrames and
+// removes dir. Frames are left in place if that fails
+func (c *timelapseSvc) keepFrames(ctx context.Context, dir, video string) error {
+	stem := filepath.Join(c.config.OutputDir, trimVideoExt(video)+framesSuffix)
+	switch c.config.KeepFrames {
+	case KeepFramesZip:
+		if err := zipFrames(dir, stem+".zip"); err != nil {
+			return err
+		}
+		c.log.InfoContext(ctx, "frames archived", "file", stem+".zip")
+	case KeepFramesDir:
+		if err := moveFrames(dir, stem); err != nil {
+			return err
+		}
+		c.log.InfoContext(ctx, "frames moved", "dir", stem)
+		return nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("fail to remove frames: %w", err)
+	}
+	return nil
+}
+
+// zipFrames streams frames of dir into archive name, frames are stored as is since jpeg
+// doesn't compress
+func zipFrames(dir, name string) (err error) {
+	frames, err := frameFiles(dir)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("fail to create frames archive: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	zw := zip.NewWriter(f)
+	for _, frame := range frames {
+		if err := addZipFile(zw, filepath.Join(dir, frame)); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("fail to write frames archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("fail to write frames archive: %w", err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("fail to rename frames archive: %w", err)
+	}
+	return nil
+}
+
+func addZipFile(zw *zip.Writer, name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("fail to open frame: %w", err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("fail to stat frame: %w", err)
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("fail to archive frame: %w", err)
+	}
+	header.Method = zip.Store
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("fail to archive frame: %w", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("fail to archive frame: %w", err)
+	}
+	return nil
+}
+
+// moveFrames moves frames of dir to dst. Frames are in tmp dir, which is usually another
+// filesystem, so they are copied if rename fails
+func moveFrames(dir, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("fail to move frames: %s already exists", dst)
+	}
+	if err := os.Rename(dir, dst); err == nil {
+		return nil
+	}
+
+	frames, err := frameFiles(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dst, 0o755); err != nil {
+		return fmt.Errorf("fail to create frames dir: %w", err)
+	}
+	for _, frame := range frames {
+		if err := copyFile(filepath.Join(dir, frame), filepath.Join(dst, frame)); err != nil {
+			return errors.Join(err, os.RemoveAll(dst))
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("fail to remove moved frames: %w", err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("fail to open frame: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("fail to create frame copy: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("fail to copy frame: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("fail to copy frame: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package camera
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeFrames writes n frames with content "frameN" into new frame dir
+func writeFrames(t *testing.T, n int) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "timelapse42")
+	for i := range n {
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("image%06d.jpg", i)), fmt.Appendf(nil, "frame%d", i))
+	}
+	return dir
+}
+
+func TestKeepFrames(t *testing.T) {
+	const video = "t1700000000-benchy.gcode-42.mp4"
+	for _, mode := range []string{"", KeepFramesNone, KeepFramesZip, KeepFramesDir} {
+		out := t.TempDir()
+		dir := writeFrames(t, 3)
+		ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: out, KeepFrames: mode})
+		if err := ts.keepFrames(t.Context(), dir, video); err != nil {
+			t.Fatalf("%q: %v", mode, err)
+		}
+		if exists(dir) {
+			t.Errorf("%q: frame dir is left", mode)
+		}
+
+		var kept []string
+		switch mode {
+		case KeepFramesZip:
+			zr, err := zip.OpenReader(filepath.Join(out, "t1700000000-benchy.gcode-42.frames.zip"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range zr.File {
+				r, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, _ := io.ReadAll(r)
+				r.Close()
+				kept = append(kept, f.Name+"="+string(data))
+			}
+			zr.Close()
+		case KeepFramesDir:
+			framesDir := filepath.Join(out, "t1700000000-benchy.gcode-42.frames")
+			names, err := frameFiles(framesDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range names {
+				data, _ := os.ReadFile(filepath.Join(framesDir, name))
+				kept = append(kept, name+"="+string(data))
+			}
+		}
+		var want []string
+		if mode == KeepFramesZip || mode == KeepFramesDir {
+			want = []string{"image000000.jpg=frame0", "image000001.jpg=frame1", "image000002.jpg=frame2"}
+		}
+		if !slices.Equal(kept, want) {
+			t.Errorf("%q: expected frames %v, got %v", mode, want, kept)
+		}
+	}
+}
+
+func TestKeepFramesFailure(t *testing.T) {
+	for _, mode := range []string{KeepFramesZip, KeepFramesDir} {
+		dir := writeFrames(t, 2)
+		ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: filepath.Join(t.TempDir(), "missing"), KeepFrames: mode})
+		if err := ts.keepFrames(t.Context(), dir, "t1-a-1.mp4"); err == nil {
+			t.Errorf("%s: expected error without output dir", mode)
+		}
+		if frames, err := frameFiles(dir); err != nil || len(frames) != 2 {
+			t.Errorf("%s: expected frames to be kept on failure, got %q, %v", mode, frames, err)
+		}
+	}
+}
+
+func TestValidateKeepFrames(t *testing.T) {
+	if err := (&TimelapseConfig{KeepFrames: "tar"}).validate(); err == nil {
+		t.Error("expected error for unknown keepFrames")
+	}
+}
@@ -0,0 +1,74 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// lifecycle is background work of camera: Close cancels it and waits till it's done
+type lifecycle struct {
+	ctx    context.Context
+	cancel func()
+
+	mu      sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// goRun runs f in background, f must return once l.ctx is done.
+// ErrClosed is returned and f isn't run if camera is closed already
+func (l *lifecycle) goRun(f func()) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return ErrClosed
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		f()
+	}()
+	return nil
+}
+
+// bind returns ctx which is done when camera is closed as well
+func (l *lifecycle) bind(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(l.ctx, cancel)
+	context.AfterFunc(ctx, func() { stop() })
+	return ctx
+}
+
+// check returns ErrClosed if camera is closed
+func (l *lifecycle) check() error {
+	if l.ctx.Err() != nil {
+		return ErrClosed
+	}
+	return nil
+}
+
+// close cancels background work and waits for it till ctx is done, it's safe to call several times
+func (l *lifecycle) close(ctx context.Context) error {
+	l.mu.Lock()
+	l.closing = true
+	l.mu.Unlock()
+	l.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("fail to stop camera: %w", ctx.Err())
+	}
+}
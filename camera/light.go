@@ -0,0 +1,267 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// how often light checks whether timelapse or print holds it on
+var lightPollInterval = time.Second
+
+// LightConfig is enclosure light switched by GPIO relay around captures
+type LightConfig struct {
+	Enabled bool
+	// BCM GPIO pin number
+	Pin int
+	// relay is switched on by low level
+	ActiveLow bool
+	// light is turned on that long before snapshot is taken
+	WarmUp time.Duration
+	// light is kept on while printer is printing, not only around captures
+	WhilePrinting bool
+}
+
+func (cfg *LightConfig) validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Pin < 0 {
+		return fmt.Errorf("invalid light GPIO pin %d", cfg.Pin)
+	}
+	if cfg.WarmUp < 0 {
+		return fmt.Errorf("invalid light warm-up %s", cfg.WarmUp)
+	}
+	return nil
+}
+
+// gpioPin is output pin light relay is wired to, replaced in tests
+type gpioPin interface {
+	Set(ctx context.Context, on bool) error
+}
+
+// pinctrlPin switches pin with Raspberry Pi pinctrl tool
+type pinctrlPin struct {
+	path      string
+	pin       int
+	activeLow bool
+}
+
+// newGPIOPin fails on hosts without Raspberry Pi GPIO tools
+var newGPIOPin = func(cfg *LightConfig) (gpioPin, error) {
+	path, err := Runner.LookPath("pinctrl")
+	if err != nil {
+		return nil, fmt.Errorf("pinctrl not found, light needs Raspberry Pi GPIO: %w", err)
+	}
+	return &pinctrlPin{path: path, pin: cfg.Pin, activeLow: cfg.ActiveLow}, nil
+}
+
+func (p *pinctrlPin) Set(ctx context.Context, on bool) error {
+	level := "dl"
+	if on != p.activeLow {
+		level = "dh"
+	}
+	output, err := Runner.Run(ctx, p.path, "set", strconv.Itoa(p.pin), "op", level)
+	if err != nil {
+		return fmt.Errorf("fail to set GPIO %d: %w: %s", p.pin, err, output)
+	}
+	return nil
+}
+
+// light is on while any capture uses it, running timelapse or print holds it on as well
+type light struct {
+	log    *slog.Logger
+	pin    gpioPin
+	warmUp time.Duration
+
+	mu      sync.Mutex
+	users   int
+	held    bool
+	on      bool
+	onSince time.Time
+	now     func() time.Time
+}
+
+// acquire turns light on and waits till it warms up
+func (l *light) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	l.users++
+	wait := l.switchLocked(ctx)
+	l.mu.Unlock()
+
+	if wait > 0 {
+		sleepCtx(ctx, wait)
+	}
+	return ctx.Err()
+}
+
+func (l *light) release(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.users--
+	l.switchLocked(ctx)
+}
+
+func (l *light) hold(ctx context.Context, held bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = held
+	l.switchLocked(ctx)
+}
+
+// off turns light off for good, releases after it change nothing
+func (l *light) off(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.users, l.held = math.MinInt/2, false
+	l.switchLocked(ctx)
+}
+
+// switchLocked sets pin as users want it and returns how long light still warms up.
+// Failing relay doesn't fail captures, they are taken in the dark
+func (l *light) switchLocked(ctx context.Context) time.Duration {
+	want := l.users > 0 || l.held
+	if want != l.on {
+		if err := l.pin.Set(ctx, want); err != nil {
+			l.log.WarnContext(ctx, "fail to switch light", "on", want, "err", err)
+			return 0
+		}
+		l.on = want
+		if want {
+			l.onSince = l.now()
+		}
+	}
+	if !l.on {
+		return 0
+	}
+	return l.warmUp - l.now().Sub(l.onSince)
+}
+
+// lightCamera turns light on around snapshots and streams of wrapped camera
+type lightCamera struct {
+	CameraWithTL
+	light   *light
+	cfg     LightConfig
+	watcher prusalinkclient.Watcher
+	life    *lifecycle
+}
+
+// withLight wraps cam if GPIO is available, cam is returned as is otherwise
+func withLight(log *slog.Logger, cam CameraWithTL, watcher prusalinkclient.Watcher, cfg LightConfig) CameraWithTL {
+	log = log.With("svc", "light")
+	pin, err := newGPIOPin(&cfg)
+	if err == nil {
+		err = pin.Set(context.Background(), false)
+	}
+	if err != nil {
+		log.Warn("Light disabled", "pin", cfg.Pin, "err", err)
+		return cam
+	}
+
+	c := &lightCamera{
+		CameraWithTL: cam,
+		light:        &light{log: log, pin: pin, warmUp: cfg.WarmUp, now: time.Now},
+		cfg:          cfg,
+		watcher:      watcher,
+		life:         newLifecycle(),
+	}
+	c.life.goRun(func() { c.holdLoop(c.life.ctx) })
+	return c
+}
+
+// holdLoop keeps light on while timelapse is captured, rpicam timelapse takes frames on its own
+// so light can't be switched per frame. Print holds it too if configured
+func (c *lightCamera) holdLoop(ctx context.Context) {
+	ticker := time.NewTicker(lightPollInterval)
+	defer ticker.Stop()
+	for {
+		c.light.hold(ctx, c.Capturing() || (c.cfg.WhilePrinting && c.printing()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *lightCamera) printing() bool {
+	if c.watcher == nil {
+		return false
+	}
+	st, err := c.watcher.Last()
+	return err == nil && st.Online && st.State == prusalinkclient.StatusPrinting
+}
+
+func (c *lightCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	if err := c.light.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.light.release(ctx)
+	return c.CameraWithTL.Snapshot(ctx)
+}
+
+func (c *lightCamera) Autofocus(ctx context.Context) (*Frame, error) {
+	focuser, ok := c.CameraWithTL.(Focuser)
+	if !ok {
+		return nil, ErrNoAutofocus
+	}
+	if err := c.light.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.light.release(ctx)
+	return focuser.Autofocus(ctx)
+}
+
+func (c *lightCamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	burster, ok := c.CameraWithTL.(Burster)
+	if !ok {
+		return nil, ErrNoBurst
+	}
+	if err := c.light.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.light.release(ctx)
+	return burster.Burst(ctx, n, interval)
+}
+
+func (c *lightCamera) Controls(ctx context.Context) ([]Control, error) {
+	controller, ok := c.CameraWithTL.(Controller)
+	if !ok {
+		return nil, ErrNoControls
+	}
+	return controller.Controls(ctx)
+}
+
+// Stream keeps light on till stream is closed
+func (c *lightCamera) Stream(ctx context.Context) (chan []byte, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	if err := c.light.acquire(ctx); err != nil {
+		return nil, err
+	}
+	stream, err := c.CameraWithTL.Stream(ctx)
+	if err != nil {
+		c.light.release(ctx)
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { c.light.release(context.Background()) })
+	return stream, nil
+}
+
+// Close closes wrapped camera and turns light off even if streams haven't released it yet
+func (c *lightCamera) Close(ctx context.Context) error {
+	err := errors.Join(c.life.close(ctx), c.CameraWithTL.Close(ctx))
+	c.light.off(ctx)
+	return err
+}
@@ -0,0 +1,160 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// fakePin records states light is switched to
+type fakePin struct {
+	sync.Mutex
+	states []bool
+	err    error
+}
+
+func (p *fakePin) Set(ctx context.Context, on bool) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.states = append(p.states, on)
+	return nil
+}
+
+func (p *fakePin) States() []bool {
+	p.Lock()
+	defer p.Unlock()
+	return slices.Clone(p.states)
+}
+
+// useFakePin replaces GPIO pin of lights created during the test
+func useFakePin(t *testing.T, pin *fakePin, err error) {
+	prev := newGPIOPin
+	newGPIOPin = func(cfg *LightConfig) (gpioPin, error) {
+		if err != nil {
+			return nil, err
+		}
+		return pin, nil
+	}
+	t.Cleanup(func() { newGPIOPin = prev })
+}
+
+func TestLightAroundSnapshot(t *testing.T) {
+	pin := &fakePin{}
+	useFakePin(t, pin, nil)
+
+	cam := withLight(slog.Default(), newMockTLCamera(t), nil, LightConfig{Enabled: true, WarmUp: 50 * time.Millisecond})
+	started := time.Now()
+	if _, err := cam.Snapshot(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("expected snapshot after warm-up, got it in %s", elapsed)
+	}
+	if err := cam.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []bool{false, true, false}, pin.States(); !slices.Equal(got, want) {
+		t.Errorf("expected light states %v, got %v", want, got)
+	}
+	if _, err := cam.Snapshot(t.Context()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+}
+
+func TestLightStream(t *testing.T) {
+	pin := &fakePin{}
+	useFakePin(t, pin, nil)
+
+	cam := withLight(slog.Default(), newMockTLCamera(t), nil, LightConfig{Enabled: true})
+	defer cam.Close(context.Background())
+	ctx, cancel := context.WithCancel(t.Context())
+	if _, err := cam.Stream(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []bool{false, true}, pin.States(); !slices.Equal(got, want) {
+		t.Errorf("expected light on while streaming, got %v", got)
+	}
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(pin.States(), []bool{false, true, false}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("light isn't off after stream, states %v", pin.States())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLightWhilePrinting(t *testing.T) {
+	prev := lightPollInterval
+	lightPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { lightPollInterval = prev })
+
+	pin := &fakePin{}
+	useFakePin(t, pin, nil)
+	watcher := &fakeWatcher{status: &prusalinkclient.Status{Online: true, State: prusalinkclient.StatusPrinting}}
+
+	cam := withLight(slog.Default(), newMockTLCamera(t), watcher, LightConfig{Enabled: true, WhilePrinting: true})
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(pin.States(), []bool{false, true}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("light isn't held while printing, states %v", pin.States())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// snapshot while held doesn't switch light
+	if _, err := cam.Snapshot(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cam.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []bool{false, true, false}, pin.States(); !slices.Equal(got, want) {
+		t.Errorf("expected light states %v, got %v", want, got)
+	}
+}
+
+func TestLightUnavailable(t *testing.T) {
+	useFakePin(t, nil, errors.New("no gpio"))
+	inner := newMockTLCamera(t)
+	if cam := withLight(slog.Default(), inner, nil, LightConfig{Enabled: true}); cam != inner {
+		t.Errorf("expected camera without light if GPIO is unavailable, got %T", cam)
+	}
+
+	// relay failing later doesn't fail captures
+	pin := &fakePin{}
+	useFakePin(t, pin, nil)
+	cam := withLight(slog.Default(), inner, nil, LightConfig{Enabled: true})
+	defer cam.Close(context.Background())
+	pin.Lock()
+	pin.err = errors.New("relay is gone")
+	pin.Unlock()
+	if _, err := cam.Snapshot(t.Context()); err != nil {
+		t.Errorf("expected snapshot in the dark, got %v", err)
+	}
+}
+
+func TestPinctrlPin(t *testing.T) {
+	runner := useFakeRunner(t)
+	for _, activeLow := range []bool{false, true} {
+		pin, err := newGPIOPin(&LightConfig{Pin: 17, ActiveLow: activeLow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pin.Set(t.Context(), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := [][]string{{"set", "17", "op", "dh"}, {"set", "17", "op", "dl"}}
+	if got := runner.Calls("pinctrl"); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("expected pinctrl calls %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,197 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	mockWidth  = 640
+	mockHeight = 480
+	mockScale  = 4
+)
+
+// mockCamera cycles through JPEG files of MockDir, or renders moving gradient with
+// timestamp if there are none, to run service without camera
+type mockCamera struct {
+	cfg    *CameraConfig
+	width  int
+	height int
+	files  []string
+	next   atomic.Int64
+	life   *lifecycle
+	stats  frameStats
+	// replaced in tests
+	now func() time.Time
+}
+
+func NewMockCamera(cfg *CameraConfig) (Camera, error) {
+	cam := &mockCamera{
+		cfg:    cfg,
+		width:  mockWidth,
+		height: mockHeight,
+		life:   newLifecycle(),
+		now:    time.Now,
+	}
+	if cfg.Width > 0 && cfg.Height > 0 {
+		cam.width, cam.height = cfg.Width, cfg.Height
+	}
+	if cfg.MockDir != "" {
+		files, err := listJPEGs(cfg.MockDir)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read mock frames: %w", err)
+		}
+		cam.files = files
+	}
+	return cam, nil
+}
+
+// listJPEGs returns sorted JPEG files of dir
+func listJPEGs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.IsDir() && (ext == ".jpg" || ext == ".jpeg") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+func (c *mockCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	now := c.now()
+	data, err := c.frame(now, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Frame{
+		Data:       data,
+		Source:     SourceFresh,
+		CapturedAt: now,
+	}, nil
+}
+
+func (c *mockCamera) Stream(ctx context.Context) (chan []byte, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	ctx = c.life.bind(ctx)
+	stream := make(chan []byte, 10)
+
+	var badge CaptureSource
+	if c.cfg.SourceBadge {
+		badge = SourceFresh
+	}
+
+	go func() {
+		defer close(stream)
+		ticker := time.NewTicker(c.cfg.streamInterval())
+		defer ticker.Stop()
+		for {
+			data, err := c.frame(c.now(), badge)
+			if err != nil {
+				return
+			}
+			select {
+			case stream <- data:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+func (c *mockCamera) Health(ctx context.Context) (*Health, error) {
+	h := &Health{
+		Backend: TypeMock,
+		Width:   c.width,
+		Height:  c.height,
+		Format:  "jpeg",
+	}
+	c.stats.fill(h)
+	return h, nil
+}
+
+func (c *mockCamera) Close(ctx context.Context) error {
+	return c.life.close(ctx)
+}
+
+func (c *mockCamera) Info(ctx context.Context) (*Info, error) {
+	return &Info{
+		Backend: TypeMock,
+	}, nil
+}
+
+func (c *mockCamera) frame(now time.Time, badge CaptureSource) ([]byte, error) {
+	data, err := c.nextFrame(now, badge)
+	if err != nil {
+		c.stats.fail(err)
+		return nil, err
+	}
+	c.stats.frame(now)
+	return data, nil
+}
+
+// nextFrame returns the next file frame, or renders one if there are no files
+func (c *mockCamera) nextFrame(now time.Time, badge CaptureSource) ([]byte, error) {
+	if len(c.files) == 0 {
+		return c.render(now, badge)
+	}
+	name := c.files[int(c.next.Add(1)-1)%len(c.files)]
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read mock frame: %w", err)
+	}
+	if badge == "" {
+		return data, nil
+	}
+	return passJPEG(data, badge)
+}
+
+// render draws gradient shifted by current second, so consecutive frames differ
+func (c *mockCamera) render(now time.Time, badge CaptureSource) ([]byte, error) {
+	img := image.NewYCbCr(image.Rect(0, 0, c.width, c.height), image.YCbCrSubsampleRatio420)
+	shift := now.Second() * c.width / 60
+	for y := range c.height {
+		for x := range c.width {
+			img.Y[img.YOffset(x, y)] = uint8((x + shift) * 255 / (2 * c.width))
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i] = 128
+		img.Cr[i] = 128
+	}
+	stamp := now.Format(time.DateTime)
+	drawText(img, c.width-textWidth(stamp, mockScale)-mockScale*2, c.height-(glyphHeight+2)*mockScale, mockScale, stamp)
+	if badge != "" {
+		drawBadge(img, badge)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
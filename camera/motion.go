@@ -0,0 +1,231 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log/slog"
+	"time"
+)
+
+// frames are compared at that size, so detection is cheap on Pi Zero
+const (
+	motionWidth  = 160
+	motionHeight = 120
+)
+
+const (
+	defaultMotionThreshold = 25
+	defaultMotionMinRatio  = 0.01
+	defaultMotionInterval  = time.Second
+	defaultMotionStopAfter = 10 * time.Second
+	motionRetryDelay       = 5 * time.Second
+)
+
+// MotionConfig is frame differencing on stream frames, disabled by default
+type MotionConfig struct {
+	Enabled bool
+	// luma difference of pixel counted as changed, 25 if zero
+	Threshold int
+	// share of changed pixels which is motion, 0.01 if zero
+	MinRatio float64
+	// how often stream frame is compared with previous one, 1 second if zero
+	Interval time.Duration
+	// motion is stopped after no changes for that long, 10 seconds if zero
+	StopAfter time.Duration
+}
+
+func (cfg *MotionConfig) validate() error {
+	if cfg.Threshold < 0 || cfg.Threshold > 255 {
+		return fmt.Errorf("invalid motion threshold %d, expected 0-255", cfg.Threshold)
+	}
+	if cfg.MinRatio < 0 || cfg.MinRatio > 1 {
+		return fmt.Errorf("invalid motion min ratio %v, expected 0-1", cfg.MinRatio)
+	}
+	if cfg.Interval < 0 || cfg.StopAfter < 0 {
+		return fmt.Errorf("invalid motion interval %s or stop after %s", cfg.Interval, cfg.StopAfter)
+	}
+	return nil
+}
+
+func (cfg *MotionConfig) threshold() int {
+	if cfg.Threshold > 0 {
+		return cfg.Threshold
+	}
+	return defaultMotionThreshold
+}
+
+func (cfg *MotionConfig) minRatio() float64 {
+	if cfg.MinRatio > 0 {
+		return cfg.MinRatio
+	}
+	return defaultMotionMinRatio
+}
+
+func (cfg *MotionConfig) interval() time.Duration {
+	if cfg.Interval > 0 {
+		return cfg.Interval
+	}
+	return defaultMotionInterval
+}
+
+func (cfg *MotionConfig) stopAfter() time.Duration {
+	if cfg.StopAfter > 0 {
+		return cfg.StopAfter
+	}
+	return defaultMotionStopAfter
+}
+
+type MotionEventType string
+
+const (
+	MotionStarted MotionEventType = "motion-started"
+	MotionStopped MotionEventType = "motion-stopped"
+)
+
+type MotionEvent struct {
+	Type MotionEventType `json:"type"`
+	At   time.Time       `json:"at"`
+	// share of changed pixels of the frame event is emitted for
+	Ratio float64 `json:"ratio"`
+}
+
+// motionDetector compares downscaled luma of consecutive frames
+type motionDetector struct {
+	cfg  *MotionConfig
+	prev []byte
+	cur  []byte
+}
+
+// feed returns share of pixels changed since previous frame, zero for the first one
+func (d *motionDetector) feed(data []byte) (float64, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("fail to decode jpeg frame: %w", err)
+	}
+	d.cur = motionLuma(img, d.cur)
+	if d.prev == nil {
+		d.prev, d.cur = d.cur, nil
+		return 0, nil
+	}
+
+	threshold := d.cfg.threshold()
+	changed := 0
+	for i, l := range d.cur {
+		if diff := int(l) - int(d.prev[i]); diff > threshold || diff < -threshold {
+			changed++
+		}
+	}
+	d.prev, d.cur = d.cur, d.prev
+	return float64(changed) / float64(len(d.prev)), nil
+}
+
+// motionLuma samples img luma at motionWidth x motionHeight into buf
+func motionLuma(img image.Image, buf []byte) []byte {
+	if cap(buf) < motionWidth*motionHeight {
+		buf = make([]byte, motionWidth*motionHeight)
+	}
+	buf = buf[:motionWidth*motionHeight]
+
+	b := img.Bounds()
+	for y := range motionHeight {
+		sy := b.Min.Y + y*b.Dy()/motionHeight
+		for x := range motionWidth {
+			sx := b.Min.X + x*b.Dx()/motionWidth
+			var l byte
+			switch img := img.(type) {
+			case *image.YCbCr:
+				l = img.Y[img.YOffset(sx, sy)]
+			case *image.Gray:
+				l = img.Pix[img.PixOffset(sx, sy)]
+			default:
+				l = color.GrayModel.Convert(img.At(sx, sy)).(color.Gray).Y
+			}
+			buf[y*motionWidth+x] = l
+		}
+	}
+	return buf
+}
+
+// WatchMotion compares stream frames of cam and emits events till ctx is done or camera is closed.
+// Stream is reopened if it breaks
+func WatchMotion(ctx context.Context, log *slog.Logger, cam Camera, cfg MotionConfig) <-chan MotionEvent {
+	w := &motionWatcher{
+		log:    log.With("svc", "motion"),
+		cam:    cam,
+		cfg:    cfg,
+		events: make(chan MotionEvent),
+		now:    time.Now,
+	}
+	go w.run(ctx)
+	return w.events
+}
+
+type motionWatcher struct {
+	log    *slog.Logger
+	cam    Camera
+	cfg    MotionConfig
+	events chan MotionEvent
+	now    func() time.Time
+
+	moving     bool
+	lastMotion time.Time
+}
+
+func (w *motionWatcher) run(ctx context.Context) {
+	defer close(w.events)
+	for ctx.Err() == nil {
+		stream, err := w.cam.Stream(ctx)
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+		if err != nil {
+			w.log.WarnContext(ctx, "fail to open stream for motion detection", "err", err, "retryIn", motionRetryDelay)
+			sleepCtx(ctx, motionRetryDelay)
+			continue
+		}
+		w.watch(ctx, stream)
+	}
+}
+
+// watch compares frames of single stream till it's closed
+func (w *motionWatcher) watch(ctx context.Context, stream chan []byte) {
+	d := &motionDetector{cfg: &w.cfg}
+	var lastCheck time.Time
+	// frames between checks are drained, so stream never blocks
+	for data := range stream {
+		now := w.now()
+		if now.Sub(lastCheck) < w.cfg.interval() {
+			continue
+		}
+		lastCheck = now
+
+		ratio, err := d.feed(data)
+		if err != nil {
+			w.log.DebugContext(ctx, "skipping frame", "err", err)
+			continue
+		}
+		switch {
+		case ratio >= w.cfg.minRatio():
+			w.lastMotion = now
+			if !w.moving {
+				w.moving = true
+				w.emit(ctx, MotionEvent{Type: MotionStarted, At: now, Ratio: ratio})
+			}
+		case w.moving && now.Sub(w.lastMotion) >= w.cfg.stopAfter():
+			w.moving = false
+			w.emit(ctx, MotionEvent{Type: MotionStopped, At: now, Ratio: ratio})
+		}
+	}
+}
+
+func (w *motionWatcher) emit(ctx context.Context, ev MotionEvent) {
+	select {
+	case w.events <- ev:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,106 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// motionFrame is gray 320x240 frame with optional white square of side size
+func motionFrame(t *testing.T, luma byte, side int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 320, 240))
+	for i := range img.Pix {
+		img.Pix[i] = luma
+	}
+	for y := range side {
+		for x := range side {
+			img.Pix[img.PixOffset(x, y)] = 0xff
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMotionDetector(t *testing.T) {
+	d := &motionDetector{cfg: &MotionConfig{}}
+	tests := []struct {
+		name  string
+		frame []byte
+		want  float64
+	}{
+		{"first frame", motionFrame(t, 0x40, 0), 0},
+		{"same frame", motionFrame(t, 0x40, 0), 0},
+		{"third changed", motionFrame(t, 0x40, 160), 1.0 / 3},
+		{"lighting shift under threshold", motionFrame(t, 0x50, 160), 0},
+	}
+	for _, tt := range tests {
+		got, err := d.feed(tt.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%s: expected ratio %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	if _, err := d.feed([]byte("not jpeg")); err == nil {
+		t.Error("expected error for broken frame")
+	}
+}
+
+func TestMotionEvents(t *testing.T) {
+	still, moved := motionFrame(t, 0x40, 0), motionFrame(t, 0x40, 160)
+	stream := make(chan []byte, 10)
+	for _, frame := range [][]byte{still, still, moved, moved, moved, moved, moved, moved, moved} {
+		stream <- frame
+	}
+	close(stream)
+
+	now := time.Now()
+	w := &motionWatcher{
+		log:    slog.Default(),
+		cfg:    MotionConfig{Interval: time.Second, StopAfter: 5 * time.Second},
+		events: make(chan MotionEvent, 10),
+		// every frame is a second later
+		now: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+	}
+	w.watch(t.Context(), stream)
+	close(w.events)
+
+	var types []MotionEventType
+	for ev := range w.events {
+		types = append(types, ev.Type)
+	}
+	if want := []MotionEventType{MotionStarted, MotionStopped}; !slices.Equal(types, want) {
+		t.Errorf("expected events %v, got %v", want, types)
+	}
+}
+
+func TestWatchMotionClosed(t *testing.T) {
+	cam, err := NewMockCamera(&CameraConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cam.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-WatchMotion(t.Context(), slog.Default(), cam, MotionConfig{Enabled: true}):
+		if ok {
+			t.Error("unexpected event of closed camera")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("motion watch of closed camera doesn't stop")
+	}
+}
@@ -0,0 +1,244 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"log/slog"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+const (
+	OverlayTopLeft     = "top-left"
+	OverlayTopRight    = "top-right"
+	OverlayBottomLeft  = "bottom-left"
+	OverlayBottomRight = "bottom-right"
+
+	defaultOverlayScale = 2
+)
+
+// OverlayConfig is text with time and printer job burned into snapshots and stream frames
+type OverlayConfig struct {
+	Enabled bool
+	// top-left, top-right, bottom-left or bottom-right, bottom-left if empty
+	Corner string
+	// font pixel size, 2 if zero
+	Scale int
+}
+
+func (cfg *OverlayConfig) validate() error {
+	switch cfg.Corner {
+	case "", OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight:
+	default:
+		return fmt.Errorf("invalid overlay corner %q, expected %s, %s, %s or %s", cfg.Corner,
+			OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight)
+	}
+	if cfg.Scale < 0 {
+		return fmt.Errorf("invalid overlay scale %d", cfg.Scale)
+	}
+	return nil
+}
+
+func (cfg *OverlayConfig) scale() int {
+	if cfg.Scale > 0 {
+		return cfg.Scale
+	}
+	return defaultOverlayScale
+}
+
+// overlayCamera draws overlay onto frames of wrapped camera. Job info comes from the latest
+// printer poll, only time is drawn while printer is offline
+type overlayCamera struct {
+	CameraWithTL
+	log     *slog.Logger
+	cfg     OverlayConfig
+	watcher prusalinkclient.Watcher
+	now     func() time.Time
+}
+
+func withOverlay(log *slog.Logger, cam CameraWithTL, watcher prusalinkclient.Watcher, cfg OverlayConfig) *overlayCamera {
+	return &overlayCamera{
+		CameraWithTL: cam,
+		log:          log.With("svc", "overlay"),
+		cfg:          cfg,
+		watcher:      watcher,
+		now:          time.Now,
+	}
+}
+
+// Unwrap returns camera without overlay, light and exif, frames of which are as device gives them
+func Unwrap(cam Camera) Camera {
+	for {
+		switch c := cam.(type) {
+		case *overlayCamera:
+			cam = c.CameraWithTL
+		case *lightCamera:
+			cam = c.CameraWithTL
+		case *exifCamera:
+			cam = c.CameraWithTL
+		default:
+			return cam
+		}
+	}
+}
+
+// Snapshot returns frame copy with overlay, wrapped camera may share frames between callers
+func (c *overlayCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	frame, err := c.CameraWithTL.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := *frame
+	out.Data = c.draw(ctx, frame.Data)
+	return &out, nil
+}
+
+func (c *overlayCamera) Autofocus(ctx context.Context) (*Frame, error) {
+	focuser, ok := c.CameraWithTL.(Focuser)
+	if !ok {
+		return nil, ErrNoAutofocus
+	}
+	frame, err := focuser.Autofocus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	frame.Data = c.draw(ctx, frame.Data)
+	return frame, nil
+}
+
+func (c *overlayCamera) Controls(ctx context.Context) ([]Control, error) {
+	controller, ok := c.CameraWithTL.(Controller)
+	if !ok {
+		return nil, ErrNoControls
+	}
+	return controller.Controls(ctx)
+}
+
+func (c *overlayCamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	burster, ok := c.CameraWithTL.(Burster)
+	if !ok {
+		return nil, ErrNoBurst
+	}
+	frames, err := burster.Burst(ctx, n, interval)
+	if err != nil {
+		return nil, err
+	}
+	// snapshot based bursts may share frames with other callers
+	for i, frame := range frames {
+		out := *frame
+		out.Data = c.draw(ctx, frame.Data)
+		frames[i] = &out
+	}
+	return frames, nil
+}
+
+func (c *overlayCamera) Stream(ctx context.Context) (chan []byte, error) {
+	in, err := c.CameraWithTL.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := make(chan []byte, 1)
+	go func() {
+		defer close(stream)
+		// wrapped stream is read till it's closed, so its goroutine never blocks
+		for data := range in {
+			if ctx.Err() != nil {
+				continue
+			}
+			select {
+			case stream <- c.draw(ctx, data):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return stream, nil
+}
+
+// draw returns frame with overlay, or frame as is if it can't be decoded
+func (c *overlayCamera) draw(ctx context.Context, data []byte) []byte {
+	out, err := drawOverlay(data, &c.cfg, c.lines())
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to draw overlay", "err", err)
+		return data
+	}
+	return out
+}
+
+// lines are overlay text: time, then job name and progress if there is a job
+func (c *overlayCamera) lines() []string {
+	lines := []string{c.now().Format(time.DateTime)}
+	if c.watcher == nil {
+		return lines
+	}
+	st, err := c.watcher.Last()
+	if err != nil || !st.Online || st.FileName == "" {
+		return lines
+	}
+	return append(lines, st.FileName, fmt.Sprintf("%s %.0f%%", st.State, st.Progress))
+}
+
+func drawOverlay(data []byte, cfg *OverlayConfig, lines []string) ([]byte, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode frame: %w", err)
+	}
+	ycbcr := frameTransform{}.apply(img)
+	drawLines(ycbcr, cfg, lines)
+	return encodeImage(ycbcr, format)
+}
+
+// drawLines paints lines on dark box in configured corner, lines too long for frame are cut
+func drawLines(img *image.YCbCr, cfg *OverlayConfig, lines []string) {
+	scale := cfg.scale()
+	pad := 2 * scale
+	step := (glyphHeight + 2) * scale
+	maxRunes := (img.Rect.Dx() - 2*pad + scale) / ((glyphWidth + 1) * scale)
+	if maxRunes <= 0 || len(lines) == 0 {
+		return
+	}
+
+	width := 0
+	cut := make([]string, len(lines))
+	for i, line := range lines {
+		if runes := []rune(line); len(runes) > maxRunes {
+			line = string(runes[:maxRunes])
+		}
+		cut[i] = line
+		width = max(width, textWidth(line, scale))
+	}
+	box := image.Rect(0, 0, width+2*pad, len(cut)*step-2*scale+2*pad)
+
+	at := img.Rect.Min
+	switch cfg.Corner {
+	case OverlayTopRight:
+		at.X = img.Rect.Max.X - box.Dx()
+	case OverlayBottomRight:
+		at = img.Rect.Max.Sub(box.Size())
+	case OverlayTopLeft:
+	default:
+		at.Y = img.Rect.Max.Y - box.Dy()
+	}
+	box = box.Add(at)
+
+	fillBox(img, box)
+	for i, line := range cut {
+		drawText(img, box.Min.X+pad, box.Min.Y+pad+i*step, scale, line)
+	}
+}
+
+// fillBox paints rect dark gray, so white text is readable on any frame
+func fillBox(img *image.YCbCr, rect image.Rectangle) {
+	rect = rect.Intersect(img.Rect)
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		for px := rect.Min.X; px < rect.Max.X; px++ {
+			img.Y[img.YOffset(px, py)] = 0x20
+			ci := img.COffset(px, py)
+			img.Cb[ci] = 0x80
+			img.Cr[ci] = 0x80
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+type fakeWatcher struct {
+	prusalinkclient.Watcher
+	status *prusalinkclient.Status
+	err    error
+}
+
+func (w *fakeWatcher) Last() (*prusalinkclient.Status, error) {
+	return w.status, w.err
+}
+
+func TestOverlayLines(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		watcher prusalinkclient.Watcher
+		want    []string
+	}{
+		{"no watcher", nil, []string{"2024-05-01 12:30:05"}},
+		{"offline", &fakeWatcher{err: prusalinkclient.ErrPrinterOffline}, []string{"2024-05-01 12:30:05"}},
+		{"idle", &fakeWatcher{status: &prusalinkclient.Status{Online: true, State: prusalinkclient.StatusIdle}},
+			[]string{"2024-05-01 12:30:05"}},
+		{"printing", &fakeWatcher{status: &prusalinkclient.Status{
+			Online: true, State: prusalinkclient.StatusPrinting, FileName: "benchy.gcode", Progress: 42.4,
+		}}, []string{"2024-05-01 12:30:05", "benchy.gcode", "PRINTING 42%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := withOverlay(slog.Default(), nil, tt.watcher, OverlayConfig{Enabled: true})
+			c.now = func() time.Time { return now }
+			if got := c.lines(); !slices.Equal(got, tt.want) {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrawOverlay(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 160, 120))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		corner      string
+		dark, light image.Point
+	}{
+		{"", image.Pt(1, 118), image.Pt(158, 1)},
+		{OverlayTopLeft, image.Pt(1, 1), image.Pt(158, 118)},
+		{OverlayTopRight, image.Pt(158, 1), image.Pt(1, 118)},
+		{OverlayBottomRight, image.Pt(158, 118), image.Pt(1, 1)},
+	} {
+		t.Run(tt.corner, func(t *testing.T) {
+			out, err := drawOverlay(buf.Bytes(), &OverlayConfig{Corner: tt.corner}, []string{"a very long job name which is cut", "50%"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l := luma(img, tt.dark); l > 0x40 {
+				t.Errorf("expected overlay box at %v, luma %#x", tt.dark, l)
+			}
+			if l := luma(img, tt.light); l < 0xe0 {
+				t.Errorf("expected frame untouched at %v, luma %#x", tt.light, l)
+			}
+		})
+	}
+
+	if _, err := drawOverlay([]byte("not a jpeg"), &OverlayConfig{}, []string{"x"}); err == nil {
+		t.Error("expected error for invalid frame")
+	}
+}
+
+func luma(img image.Image, p image.Point) uint8 {
+	return color.GrayModel.Convert(img.At(p.X, p.Y)).(color.Gray).Y
+}
+
+func TestNewOverlay(t *testing.T) {
+	_, err := New(slog.Default(), nil, nil, &CameraConfig{Type: TypeMock, Overlay: OverlayConfig{Corner: "middle"}}, &TimelapseConfig{})
+	if err == nil {
+		t.Error("expected error for invalid overlay corner")
+	}
+
+	cam, err := New(slog.Default(), nil, &fakeWatcher{err: prusalinkclient.ErrPrinterOffline},
+		&CameraConfig{Type: TypeMock, Width: 320, Height: 240, Overlay: OverlayConfig{Enabled: true}}, &TimelapseConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cam.(*overlayCamera); !ok {
+		t.Fatalf("expected overlay camera, got %T", cam)
+	}
+
+	frame, err := cam.Snapshot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Source != SourceFresh {
+		t.Errorf("expected fresh frame, got %s", frame.Source)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(frame.Data)); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := cam.Stream(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(<-stream)); err != nil {
+		t.Fatal(err)
+	}
+}
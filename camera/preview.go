@@ -0,0 +1,183 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNoPreview is returned for preview while no timelapse runs or it has no frames yet
+var ErrNoPreview = errors.New("no running timelapse with frames to preview")
+
+const (
+	// preview and its frame links are kept in frame root, the next preview replaces them
+	previewName  = "prusacam-preview"
+	previewWidth = 640
+	previewCRF   = 35
+	// preview plays at most previewMaxSeconds, frames are dropped above previewMaxFPS
+	previewMaxSeconds = 10
+	previewMaxFPS     = 30
+	previewTimeout    = 2 * time.Minute
+)
+
+// preview is the last built preview video. Build is queued like video builds, concurrent
+// requests wait for the same one
+type preview struct {
+	sync.Mutex
+	dir    string
+	frames int
+	path   string
+	// the latest build, it may be still queued or running
+	build *BuildJob
+}
+
+// Preview returns path of quick low resolution mp4 of frames of running timelapse captured so far.
+// It's rebuilt only when new frames arrived
+func (c *timelapseSvc) Preview(ctx context.Context) (string, error) {
+	tl := c.current.Load()
+	if tl == nil {
+		return "", ErrNoPreview
+	}
+	p := &c.preview
+	p.Lock()
+	frames, err := previewFrames(tl.currentDir)
+	if err != nil {
+		p.Unlock()
+		return "", err
+	}
+	if len(frames) == 0 {
+		p.Unlock()
+		return "", ErrNoPreview
+	}
+	if p.dir == tl.currentDir && p.frames == len(frames) {
+		if _, err := os.Stat(p.path); err == nil {
+			p.Unlock()
+			return p.path, nil
+		}
+	}
+	job := p.build
+	if job != nil {
+		select {
+		case <-job.done:
+			// failed or cancelled one is submitted again
+			job = nil
+		default:
+		}
+	}
+	if job == nil {
+		job = &BuildJob{Kind: JobPreview, Dir: tl.currentDir, JobID: tl.jobID, JobName: tl.jobName, Frames: len(frames)}
+		if err := c.builds.Submit(job); err != nil {
+			p.Unlock()
+			return "", fmt.Errorf("fail to queue preview: %w", err)
+		}
+		p.build = job
+	}
+	p.Unlock()
+
+	if err := job.wait(ctx); err != nil {
+		return "", err
+	}
+	p.Lock()
+	defer p.Unlock()
+	return p.path, nil
+}
+
+// runPreview is worker of preview job, it builds frames of job dir captured by now
+func (c *timelapseSvc) runPreview(ctx context.Context, job *BuildJob) error {
+	frames, err := previewFrames(job.Dir)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return ErrNoPreview
+	}
+	path, err := c.buildPreview(ctx, job.Dir, frames)
+	if err != nil {
+		return err
+	}
+	c.preview.Lock()
+	c.preview.dir, c.preview.frames, c.preview.path = job.Dir, len(frames), path
+	c.preview.Unlock()
+	return nil
+}
+
+// previewFrames lists frames of dir but the newest one, rpicam may be writing it
+func previewFrames(dir string) ([]string, error) {
+	frames, err := frameFiles(dir)
+	if err != nil || len(frames) == 0 {
+		return nil, err
+	}
+	return frames[:len(frames)-1], nil
+}
+
+// buildPreview encodes frames of dir linked to separate dir, so ffmpeg only reads
+// what capture has finished and frame dir is left as is
+func (c *timelapseSvc) buildPreview(ctx context.Context, dir string, frames []string) (string, error) {
+	ffmpeg, err := c.ffmpegPath()
+	if err != nil {
+		return "", err
+	}
+	root := c.frameRoot()
+	linkDir := filepath.Join(root, previewName+"-frames")
+	if err := os.RemoveAll(linkDir); err != nil {
+		return "", fmt.Errorf("fail to clean preview frames: %w", err)
+	}
+	if err := os.Mkdir(linkDir, 0o755); err != nil {
+		return "", fmt.Errorf("fail to create preview frames dir: %w", err)
+	}
+	defer os.RemoveAll(linkDir)
+	for _, frame := range frames {
+		if err := os.Link(filepath.Join(dir, frame), filepath.Join(linkDir, frame)); err != nil {
+			return "", fmt.Errorf("fail to link preview frame: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	output := filepath.Join(root, previewName+".mp4")
+	tmp := output + ".tmp"
+	args := previewArgs(len(frames), linkDir, tmp)
+	c.log.DebugContext(ctx, "ffmpeg args", "binary", ffmpeg, "args", args)
+	if out, err := Runner.Run(ctx, ffmpeg, args...); err != nil {
+		c.log.DebugContext(ctx, "ffmpeg output", "out", string(out))
+		os.Remove(tmp)
+		return "", fmt.Errorf("fail to build preview: %w", err)
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		return "", fmt.Errorf("fail to move preview: %w", err)
+	}
+	c.log.InfoContext(ctx, "timelapse preview built", "frames", len(frames), "dir", dir)
+	return output, nil
+}
+
+// previewArgs encodes frames of dir fast and small. They are played at the rate fitting
+// previewMaxSeconds, output rate drops the rest above previewMaxFPS
+func previewArgs(frames int, dir, output string) []string {
+	fps := max((frames+previewMaxSeconds-1)/previewMaxSeconds, 1)
+	args := []string{
+		"-y",
+		"-r", strconv.Itoa(fps),
+		"-f", "image2",
+		"-pattern_type", "glob",
+		"-i", filepath.Join(globEscape(dir), "*"+shotSuffix),
+	}
+	if fps > previewMaxFPS {
+		args = append(args, "-r", strconv.Itoa(previewMaxFPS))
+	}
+	return append(args,
+		"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", previewWidth),
+		"-vcodec", EncoderX264,
+		"-preset", "ultrafast",
+		"-crf", strconv.Itoa(previewCRF),
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		output,
+	)
+}
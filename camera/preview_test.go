@@ -0,0 +1,114 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPreview(t *testing.T) {
+	runner := useFakeRunner(t)
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withWorkDir(), withJobs(nil))
+
+	if _, err := ts.Preview(t.Context()); !errors.Is(err, ErrNoPreview) {
+		t.Fatalf("expected ErrNoPreview without timelapse, got %v", err)
+	}
+
+	dir := filepath.Join(ts.workDir, "timelapse1")
+	writeFile(t, shotFilename(dir, 0), fakeTimelapseFrame)
+	ts.current.Store(&timelapse{currentDir: dir})
+	// the only frame may be still written
+	if _, err := ts.Preview(t.Context()); !errors.Is(err, ErrNoPreview) {
+		t.Fatalf("expected ErrNoPreview without finished frames, got %v", err)
+	}
+
+	writeFile(t, shotFilename(dir, 1), fakeTimelapseFrame)
+	writeFile(t, shotFilename(dir, 2), fakeTimelapseFrame)
+	path, err := ts.Preview(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(ts.workDir, previewName+".mp4"); path != want || !exists(path) {
+		t.Errorf("expected preview %s, got %s", want, path)
+	}
+	args := runner.Calls("ffmpeg")[0]
+	if i := slices.Index(args, "-i"); i < 0 || filepath.Dir(args[i+1]) == dir {
+		t.Errorf("preview must be built from links of frames, got %q", args)
+	}
+	if exists(filepath.Join(ts.workDir, previewName+"-frames")) {
+		t.Error("preview frame links were left")
+	}
+
+	// cached till more frames arrive, concurrent requests share one build
+	if _, err := ts.Preview(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, shotFilename(dir, 3), fakeTimelapseFrame)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Preview(t.Context()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(runner.Calls("ffmpeg")); n != 2 {
+		t.Errorf("expected 2 preview builds, got %d", n)
+	}
+	if st := ts.builds.Status(); len(st.Done) != 0 || len(st.Pending) != 0 {
+		t.Errorf("previews mustn't stay in build queue, got %+v", st)
+	}
+}
+
+func TestPreviewWaitsForBuild(t *testing.T) {
+	runner := useFakeRunner(t)
+	release := make(chan struct{})
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withWorkDir(), withJobs(release))
+
+	dir := filepath.Join(ts.workDir, "timelapse1")
+	for id := range 3 {
+		writeFile(t, shotFilename(dir, id), fakeTimelapseFrame)
+	}
+	ts.current.Store(&timelapse{currentDir: dir})
+	if err := ts.builds.Enqueue(&BuildJob{Dir: t.TempDir(), JobName: "benchy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the only worker builds video, preview waits for it
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ts.Preview(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected preview to wait for video build, got %v", err)
+	}
+	if calls := runner.Calls("ffmpeg"); len(calls) != 0 {
+		t.Fatalf("preview was encoded next to video build: %q", calls)
+	}
+
+	close(release)
+	if _, err := ts.Preview(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runner.Calls("ffmpeg")); n != 1 {
+		t.Errorf("expected the queued preview to be reused, got %d builds", n)
+	}
+}
+
+func TestPreviewArgs(t *testing.T) {
+	for frames, want := range map[int][]string{
+		5:    {"-r", "1"},
+		250:  {"-r", "25"},
+		3000: {"-r", "300", "-f", "image2", "-pattern_type", "glob", "-i", "/f/*.jpg", "-r", "30"},
+	} {
+		args := previewArgs(frames, "/f", "/out.mp4")
+		if !slices.Equal(args[1:1+len(want)], want) {
+			t.Errorf("%d frames: expected %q, got %q", frames, want, args)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package camera
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// CaptureMode is when timelapse takes frames: time captures every interval, progress every
+// time print progress advances by ProgressDelta percent
+type CaptureMode string
+
+const (
+	ModeTime     CaptureMode = "time"
+	ModeProgress CaptureMode = "progress"
+)
+
+const (
+	// percent of print progress between frames
+	defaultProgressDelta = 0.2
+	defaultProgressPoll  = 2 * time.Second
+)
+
+func (cfg *TimelapseConfig) mode() CaptureMode {
+	return cmp.Or(cfg.Mode, ModeTime)
+}
+
+func (cfg *TimelapseConfig) validateMode() error {
+	switch cfg.Mode {
+	case "", ModeTime, ModeProgress:
+	default:
+		return fmt.Errorf("invalid timelapse.mode %q, expected %s or %s", cfg.Mode, ModeTime, ModeProgress)
+	}
+	if cfg.ProgressDelta < 0 || cfg.ProgressDelta >= 100 {
+		return fmt.Errorf("invalid timelapse.progressDelta %v, expected percent between 0 and 100", cfg.ProgressDelta)
+	}
+	if cfg.ProgressPoll < 0 {
+		return fmt.Errorf("invalid timelapse.progressPoll %s", cfg.ProgressPoll)
+	}
+	return nil
+}
+
+// startProgressCapture takes a frame every time print progress advances by delta percent,
+// printer is polled every ProgressPoll. Frames are numbered from frameStart
+func (c *timelapseSvc) startProgressCapture(ctx context.Context, dir string, delta float64, frameStart int) Process {
+	p := &snapshotProcess{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(cmp.Or(c.config.ProgressPoll, defaultProgressPoll))
+		defer ticker.Stop()
+
+		id := frameStart
+		// progress of the last frame, the first poll takes one
+		last := -delta
+		for {
+			// cached status lags behind progress by up to its TTL
+			status, err := c.prusalink.JobStatus(prusalinkclient.WithFresh(ctx))
+			switch {
+			case err != nil:
+				if ctx.Err() == nil {
+					c.log.DebugContext(ctx, "fail to get progress", "err", err)
+				}
+			case status.Progress-last >= delta:
+				// failed frame is retried on next poll
+				if err := c.source.captureShot(ctx, shotFilename(dir, id)); err != nil {
+					if ctx.Err() == nil {
+						c.log.WarnContext(ctx, "fail to capture timelapse frame", "err", err, "progress", status.Progress)
+					}
+					break
+				}
+				id++
+				last = status.Progress
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return p
+}
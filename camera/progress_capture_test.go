@@ -0,0 +1,63 @@
+package camera
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/prusaLinkClient/prusalinktest"
+)
+
+// freshOnlyClient counts JobStatus calls which may be served from cache
+type freshOnlyClient struct {
+	*prusalinktest.FakeClient
+	cached atomic.Int32
+}
+
+func (c *freshOnlyClient) JobStatus(ctx context.Context) (*prusalinkclient.Status, error) {
+	if !prusalinkclient.IsFresh(ctx) {
+		c.cached.Add(1)
+	}
+	return c.FakeClient.JobStatus(ctx)
+}
+
+func TestProgressCapture(t *testing.T) {
+	runner := useFakeRunner(t)
+	var steps []prusalinkclient.Status
+	for _, progress := range []float64{1, 1.1, 1.2, 1.5, 1.5, 2} {
+		steps = append(steps, prusalinkclient.Status{Online: true, JobID: 42, State: prusalinkclient.StatusPrinting, Progress: progress})
+	}
+	printer := &freshOnlyClient{FakeClient: prusalinktest.NewFakeClient(steps...)}
+	ts := newTestTimelapse(t, &TimelapseConfig{Mode: ModeProgress, ProgressDelta: 0.3, ProgressPoll: time.Millisecond}, withRpicam(), withPrinter(printer))
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(t.Context())
+	p := ts.startProgressCapture(ctx, dir, 0.3, 5)
+	deadline := time.Now().Add(5 * time.Second)
+	for printer.Calls() < len(steps)+2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	p.Wait()
+
+	// a frame per 0.3% and no free-running timelapse
+	if calls := runner.Calls("rpicam-still"); slices.ContainsFunc(calls, func(args []string) bool {
+		return slices.Contains(args, "--timelapse")
+	}) {
+		t.Errorf("expected single shots, got %v", calls)
+	}
+	name, count, err := ts.lastTLShotInternal(dir)
+	if err != nil || count != 3 || name != shotFilename(dir, 7) {
+		t.Errorf("expected frames 5-7 at 1%%, 1.5%% and 2%%, got %d up to %s, %v", count, name, err)
+	}
+	if n := printer.cached.Load(); n > 0 {
+		t.Errorf("expected progress polls to bypass status cache, %d didn't", n)
+	}
+
+	if err := (&TimelapseConfig{Mode: "layer"}).validate(); err == nil {
+		t.Error("expected invalid mode error")
+	}
+}
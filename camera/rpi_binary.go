@@ -0,0 +1,106 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// known rpicam binaries in probe order.
+// Bookworm ships rpicam-*, Bullseye ships libcamera-*, minimal images may have only rpicam-jpeg
+var rpicamBinaries = []string{"rpicam-still", "libcamera-still", "rpicam-jpeg"}
+
+// rpicamBinary describes detected camera binary and options it supports
+type rpicamBinary struct {
+	Name    string
+	Path    string
+	Version string
+
+	// still-specific options, rpicam-jpeg doesn't have them
+	encoding  bool
+	immediate bool
+	timelapse bool
+	// added in rpicam-apps, older libcamera-still doesn't know it
+	autofocusOnCapture bool
+}
+
+// detectRpicam probes for rpicam binary. If override is set, only it is checked
+func detectRpicam(ctx context.Context, override string) (*rpicamBinary, error) {
+	candidates := rpicamBinaries
+	if override != "" {
+		candidates = []string{override}
+	}
+
+	for _, name := range candidates {
+		path, err := Runner.LookPath(name)
+		if err != nil {
+			continue
+		}
+
+		bin := newRpicamBinary(name, path)
+		bin.Version = rpicamVersion(ctx, path)
+		return bin, nil
+	}
+
+	if override != "" {
+		return nil, fmt.Errorf("configured camera binary %q not found", override)
+	}
+	return nil, fmt.Errorf("no camera binary found, tried %s", strings.Join(rpicamBinaries, ", "))
+}
+
+func newRpicamBinary(name, path string) *rpicamBinary {
+	bin := &rpicamBinary{
+		Name:               name,
+		Path:               path,
+		encoding:           true,
+		immediate:          true,
+		timelapse:          true,
+		autofocusOnCapture: true,
+	}
+
+	// override may be full path
+	base := filepath.Base(name)
+	switch {
+	case strings.HasPrefix(base, "libcamera-"):
+		bin.autofocusOnCapture = false
+	case strings.HasSuffix(base, "-jpeg"):
+		bin.encoding = false
+		bin.immediate = false
+		bin.timelapse = false
+		bin.autofocusOnCapture = false
+	}
+
+	return bin
+}
+
+// rpicamVersion returns first line of "--version" output, e.g. "rpicam-apps build: v1.4.2"
+func rpicamVersion(ctx context.Context, path string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	output, err := Runner.Run(ctx, path, "--version")
+	if err != nil && !errors.As(err, new(*exec.ExitError)) {
+		return ""
+	}
+
+	version, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return version
+}
+
+// DetectRPICamera reports rpicam binary which would be used by rpi backend
+func DetectRPICamera(ctx context.Context, cfg *CameraConfig) (*Info, error) {
+	bin, err := detectRpicam(ctx, cfg.Binary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		Backend: "rpi",
+		Binary:  bin.Path,
+		Version: bin.Version,
+	}, nil
+}
@@ -6,25 +6,51 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
 )
 
-const (
-	RpiCamBinary = "rpicam-still"
-)
-
 type rpiCamera struct {
 	log *slog.Logger
 	*timelapseSvc
 
 	tmpDir string
+	// streams, they are stopped on Close
+	life  *lifecycle
+	stats frameStats
+	// the latest frame of running stream, shared with snapshots and other streams
+	streamFrame atomic.Pointer[Frame]
+	// long-lived capture process for snapshots, nil if it's disabled or not supported
+	still *persistentStill
+
+	// serializes shots, so concurrent snapshots share one
+	shotMu sync.Mutex
+	// the latest fresh shot, reused within snapshotMaxAge
+	lastShot *Frame
 }
 
-func NewRPICamera(log *slog.Logger, prusalink prusalinkclient.Client, tlConfig *TimelapseConfig) (CameraWithTL, error) {
+func NewRPICamera(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, camConfig *CameraConfig, tlConfig *TimelapseConfig) (CameraWithTL, error) {
+	if err := camConfig.Validate(); err != nil {
+		return nil, err
+	}
+	if err := camConfig.validateRpicam(); err != nil {
+		return nil, err
+	}
+
+	bin, err := detectRpicam(context.Background(), camConfig.Binary)
+	if err != nil {
+		return nil, fmt.Errorf("fail to detect camera binary: %w", err)
+	}
+	log.Info("Detected camera binary", "name", bin.Name, "path", bin.Path, "version", bin.Version)
+
+	if tlConfig.Enabled && !bin.timelapse {
+		return nil, fmt.Errorf("%s doesn't support timelapse mode, install rpicam-still or disable timelapse", bin.Name)
+	}
+
 	tmpDir, err := os.MkdirTemp("", "")
 	if err != nil {
 		return nil, fmt.Errorf("fail to create tmp dir: %w", err)
@@ -32,76 +58,209 @@ func NewRPICamera(log *slog.Logger, prusalink prusalinkclient.Client, tlConfig *
 
 	cam := &rpiCamera{
 		log:          log.With("svc", "camera"),
-		timelapseSvc: newTimelapse(log, prusalink, tlConfig),
+		timelapseSvc: newTimelapse(log, prusalink, watcher, bin, camConfig, tlConfig),
 
 		tmpDir: tmpDir,
+		life:   newLifecycle(),
+	}
+	if bin.timelapse && !camConfig.OneShotCapture {
+		cam.still = newPersistentStill(cam.log, bin, camConfig, &cam.cameraWanted, filepath.Join(tmpDir, "persistent"))
 	}
 
 	return cam, nil
 }
 
-func (c *rpiCamera) Snapshot(ctx context.Context) ([]byte, error) {
-	var (
-		name string
-		err  error
-	)
+func (c *rpiCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	if f := c.recentStreamFrame(); f != nil {
+		// stream owns camera
+		frame := *f
+		frame.Source = SourceCache
+		return &frame, nil
+	}
 
-	if !c.isTimelapseRunning() {
-		name, err = c.takeShot(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("fail to take shot: %w", err)
+	if !c.Capturing() {
+		if FormatOf(ctx) == FormatPNG && c.rpicam.encoding {
+			return c.pngShot(ctx)
 		}
-	} else {
-		name, err = c.LastTLShot()
-		if err != nil {
-			return nil, fmt.Errorf("fail to get last TL shot name: %w", err)
+		return c.freshShot(ctx)
+	}
+	name, err := c.LastTLShot()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get last TL shot name: %w", err)
+	}
+	return readFrame(name, SourceTimelapse)
+}
+
+// freshShot takes shot unless one taken within snapshotMaxAge can be reused
+func (c *rpiCamera) freshShot(ctx context.Context) (*Frame, error) {
+	c.shotMu.Lock()
+	defer c.shotMu.Unlock()
+
+	if last := c.lastShot; last != nil && !IsFresh(ctx) && time.Since(last.CapturedAt) <= c.camConfig.snapshotMaxAge() {
+		frame := *last
+		frame.Source = SourceCache
+		return &frame, nil
+	}
+
+	name, err := c.takeShot(ctx)
+	if errors.Is(err, ErrCameraBusy) {
+		// timelapse frame is better than nothing while it holds camera
+		if tlName, tlErr := c.LastTLShot(); tlErr == nil {
+			return readFrame(tlName, SourceTimelapse)
 		}
 	}
+	if err != nil {
+		c.stats.fail(err)
+		return nil, fmt.Errorf("fail to take shot: %w", err)
+	}
+	defer os.Remove(name)
+	frame, err := readFrame(name, SourceFresh)
+	if err != nil {
+		c.stats.fail(err)
+		return nil, err
+	}
+	c.lastShot = frame
+	c.stats.frame(frame.CapturedAt)
+	return frame, nil
+}
 
+func readFrame(name string, source CaptureSource) (*Frame, error) {
 	shot, err := os.ReadFile(name)
 	if err != nil {
 		return nil, fmt.Errorf("fail to read shot: %w", err)
 	}
-	return shot, nil
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("fail to stat shot: %w", err)
+	}
+
+	return &Frame{
+		Data:       shot,
+		Source:     source,
+		CapturedAt: info.ModTime(),
+	}, nil
+}
+
+// Close stops streams, persistent capture and timelapse, then removes tmp dir
+func (c *rpiCamera) Close(ctx context.Context) error {
+	if err := c.life.close(ctx); err != nil {
+		return err
+	}
+	if c.still != nil {
+		c.still.stop()
+	}
+	if err := c.closeTimelapse(ctx); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(c.tmpDir); err != nil {
+		return fmt.Errorf("fail to remove tmp dir: %w", err)
+	}
+	return nil
 }
 
-func (c *rpiCamera) Stream(ctx context.Context) (chan []byte, error) {
-	panic("not implemented")
+func (c *rpiCamera) Info(ctx context.Context) (*Info, error) {
+	info := &Info{
+		Backend: "rpi",
+		Binary:  c.rpicam.Path,
+		Version: c.rpicam.Version,
+	}
+	if len(c.camConfig.Profiles) > 0 {
+		info.Profile = profileName(c.camConfig.profileAt(time.Now()))
+	}
+	return info, nil
 }
 
-func cameraOpts() []string {
-	return []string{
-		"--encoding", "jpg",
-		"--rotation", "180", // rotate upside-down
-		"-n",                   // no preview
-		"--roi", "0.2,0,0.6,1", // digital zoom
-		"--width", "2764", // X is cropped, so cropping image too
-		"--lens-position", "1.01", // best for my setup
+func (c *rpiCamera) Health(ctx context.Context) (*Health, error) {
+	h := &Health{
+		Backend: TypeRPI,
+		Binary:  c.rpicam.Path,
+		Width:   c.camConfig.Width,
+		Height:  c.camConfig.Height,
+		Format:  "jpeg",
 	}
+	c.stats.fill(h)
+	return h, nil
 }
 
 // runs CLI commant to take shot from camera and returns path to it
-// rpicam-still --encoding jpg --rotation 180 -n --roi 0.2,0,0.6,1 --lens-position 1.01 --immediate --width 2764
+// rpicam-still --encoding jpg --rotation 180 -n --roi 0.2,0,0.6,1 --width 2764 --lens-position 1.01 --immediate
 func (c *rpiCamera) takeShot(ctx context.Context) (string, error) {
 	name := filepath.Join(c.tmpDir, fmt.Sprintf("%d.jpg", time.Now().UnixMicro()))
-	args := append(cameraOpts(),
-		"--immediate",
-		"-o", name,
-	)
+	if c.still != nil {
+		err := c.still.capture(ctx, name)
+		if err == nil {
+			return name, nil
+		}
+		c.log.DebugContext(ctx, "persistent capture failed, taking one-shot", "err", err)
+	}
+
+	args := c.camConfig.captureOpts(c.rpicam, c.camConfig.profileAt(time.Now()), name)
 
 	if !rpicamMutex.TryLock() {
 		// blocked, most likely by timelapse
-		return "", errors.New("mutex is locked")
+		return "", ErrCameraBusy
 	}
 	defer rpicamMutex.Unlock()
 
-	c.log.DebugContext(ctx, "rpicam-still args", "args", args)
-	cmd := exec.CommandContext(ctx, RpiCamBinary, args...)
-	output, err := cmd.CombinedOutput()
-	c.log.DebugContext(ctx, "rpicam-still output", "output", string(output))
+	c.log.DebugContext(ctx, "rpicam args", "binary", c.rpicam.Name, "args", args)
+	output, err := Runner.Run(ctx, c.rpicam.Path, args...)
+	c.log.DebugContext(ctx, "rpicam output", "output", string(output))
 	if err != nil {
-		return "", fmt.Errorf("fail to run rpicam-still: %w", err)
+		return "", fmt.Errorf("fail to run %s: %w", c.rpicam.Name, err)
 	}
 
 	return name, nil
 }
+
+// pngShot takes lossless shot, it's never shared with other requests. Like autofocus,
+// running stream and persistent capture yield camera to it
+func (c *rpiCamera) pngShot(ctx context.Context) (*Frame, error) {
+	name := filepath.Join(c.tmpDir, fmt.Sprintf("%d.png", time.Now().UnixMicro()))
+	args := c.camConfig.pngCaptureOpts(c.rpicam, c.camConfig.profileAt(time.Now()), name)
+
+	c.lockCamera()
+	c.log.DebugContext(ctx, "rpicam png args", "binary", c.rpicam.Name, "args", args)
+	output, err := Runner.Run(ctx, c.rpicam.Path, args...)
+	rpicamMutex.Unlock()
+	c.log.DebugContext(ctx, "rpicam output", "output", string(output))
+	if err != nil {
+		c.stats.fail(err)
+		return nil, fmt.Errorf("fail to run %s: %w", c.rpicam.Name, err)
+	}
+	defer os.Remove(name)
+
+	frame, err := readFrame(name, SourceFresh)
+	if err != nil {
+		return nil, err
+	}
+	frame.Format = FormatPNG
+	c.stats.frame(frame.CapturedAt)
+	return frame, nil
+}
+
+// Autofocus takes shot with autofocus cycle, running stream and persistent capture yield camera to it
+func (c *rpiCamera) Autofocus(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	if c.Capturing() {
+		return nil, ErrCameraBusy
+	}
+	name := filepath.Join(c.tmpDir, fmt.Sprintf("focus%d.jpg", time.Now().UnixMicro()))
+	args := c.camConfig.focusCaptureOpts(c.rpicam, c.camConfig.profileAt(time.Now()), name)
+
+	c.lockCamera()
+	c.log.DebugContext(ctx, "rpicam autofocus args", "binary", c.rpicam.Name, "args", args)
+	output, err := Runner.Run(ctx, c.rpicam.Path, args...)
+	rpicamMutex.Unlock()
+	c.log.DebugContext(ctx, "rpicam output", "output", string(output))
+	if err != nil {
+		return nil, fmt.Errorf("fail to run %s: %w", c.rpicam.Name, err)
+	}
+	defer os.Remove(name)
+
+	return readFrame(name, SourceFresh)
+}
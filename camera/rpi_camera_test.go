@@ -0,0 +1,117 @@
+package camera
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRPIAutofocus(t *testing.T) {
+	runner := useFakeRunner(t)
+	c := newTestRPICamera(t)
+	lens := 1.01
+	c.camConfig = &CameraConfig{FocusMode: FocusManual, LensPosition: &lens}
+
+	frame, err := c.Autofocus(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Source != SourceFresh || string(frame.Data) != "jpg" {
+		t.Errorf("unexpected frame %+v", frame)
+	}
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 1 || !slices.Contains(calls[0], "--autofocus-on-capture") || slices.Contains(calls[0], "--lens-position") {
+		t.Errorf("unexpected rpicam calls %q", calls)
+	}
+	if !rpicamMutex.TryLock() {
+		t.Fatal("autofocus doesn't release camera")
+	}
+	rpicamMutex.Unlock()
+
+	c.tlRunning.Store(true)
+	if _, err := c.Autofocus(t.Context()); !errors.Is(err, ErrCameraBusy) {
+		t.Errorf("expected ErrCameraBusy during timelapse, got %v", err)
+	}
+}
+
+func TestRPISnapshotCache(t *testing.T) {
+	runner := useFakeRunner(t)
+	c := newTestRPICamera(t)
+	c.camConfig = &CameraConfig{SnapshotMaxAge: time.Minute}
+
+	var wg sync.WaitGroup
+	sources := make(chan CaptureSource, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			frame, err := c.Snapshot(t.Context())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			sources <- frame.Source
+		}()
+	}
+	wg.Wait()
+	close(sources)
+
+	if calls := runner.Calls("rpicam-still"); len(calls) != 1 {
+		t.Fatalf("expected single capture for concurrent snapshots, got %d", len(calls))
+	}
+	fresh := 0
+	for source := range sources {
+		if source == SourceFresh {
+			fresh++
+		}
+	}
+	if fresh != 1 {
+		t.Errorf("expected one fresh frame and the rest cached, got %d fresh", fresh)
+	}
+
+	frame, err := c.Snapshot(WithFresh(t.Context()))
+	if err != nil || frame.Source != SourceFresh {
+		t.Fatalf("expected fresh frame, got %+v, %v", frame, err)
+	}
+	if calls := runner.Calls("rpicam-still"); len(calls) != 2 {
+		t.Errorf("fresh snapshot doesn't bypass cache, %d captures", len(calls))
+	}
+	if entries, _ := os.ReadDir(c.tmpDir); len(entries) != 0 {
+		t.Errorf("shots are left in tmp dir: %v", entries)
+	}
+
+	c.camConfig.SnapshotMaxAge = -1
+	if _, err := c.Snapshot(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := runner.Calls("rpicam-still"); len(calls) != 3 {
+		t.Errorf("disabled cache is used, %d captures", len(calls))
+	}
+}
+
+func TestRPISnapshotBusy(t *testing.T) {
+	useFakeRunner(t)
+	c := newTestRPICamera(t)
+	c.camConfig = &CameraConfig{}
+
+	rpicamMutex.Lock()
+	defer rpicamMutex.Unlock()
+	if _, err := c.Snapshot(t.Context()); !errors.Is(err, ErrCameraBusy) {
+		t.Fatalf("expected ErrCameraBusy, got %v", err)
+	}
+
+	// timelapse holds camera and has frame already
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "000001.jpg"), fakeTimelapseFrame, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.timelapse = &timelapse{currentDir: dir}
+	frame, err := c.Snapshot(t.Context())
+	if err != nil || frame.Source != SourceTimelapse {
+		t.Fatalf("expected timelapse frame, got %+v, %v", frame, err)
+	}
+}
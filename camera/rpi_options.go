@@ -0,0 +1,224 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks capture options, so mistakes show at startup rather than on every shot
+func (cfg *CameraConfig) Validate() error {
+	switch cfg.Rotation {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("invalid camera rotation %d, expected 0, 90, 180 or 270", cfg.Rotation)
+	}
+	if cfg.ROI != "" {
+		if err := validateROI(cfg.ROI); err != nil {
+			return err
+		}
+	}
+	if cfg.FocusRegion != "" {
+		if _, err := parseRegion("focus region", cfg.FocusRegion); err != nil {
+			return err
+		}
+	}
+	if cfg.Width < 0 || cfg.Height < 0 {
+		return fmt.Errorf("invalid camera size %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.StreamFPS < 0 {
+		return fmt.Errorf("invalid camera stream fps %v", cfg.StreamFPS)
+	}
+	if cfg.WarmUpFrames < 0 || cfg.WarmUpTime < 0 {
+		return fmt.Errorf("invalid camera warm-up %d frames or %s", cfg.WarmUpFrames, cfg.WarmUpTime)
+	}
+	if cfg.LensPosition != nil && *cfg.LensPosition < 0 {
+		return fmt.Errorf("invalid camera lens position %v, expected dioptres >= 0", *cfg.LensPosition)
+	}
+	switch cfg.FocusMode {
+	case "", FocusContinuous, FocusLastShot:
+	case FocusManual:
+		if cfg.LensPosition == nil {
+			return errors.New("manual camera focus needs lens position")
+		}
+	default:
+		return fmt.Errorf("invalid camera focus mode %q, expected %s, %s or %s", cfg.FocusMode,
+			FocusManual, FocusContinuous, FocusLastShot)
+	}
+	if err := cfg.Exposure.validate(); err != nil {
+		return err
+	}
+	if err := cfg.Motion.validate(); err != nil {
+		return err
+	}
+	return validateProfiles(cfg.Profiles)
+}
+
+// awbModes are white balance modes rpicam knows
+var awbModes = []string{"auto", "incandescent", "tungsten", "fluorescent", "indoor", "daylight", "cloudy"}
+
+func (cfg *ExposureConfig) validate() error {
+	if cfg.Shutter < 0 || (cfg.Shutter > 0 && cfg.Shutter < time.Microsecond) {
+		return fmt.Errorf("invalid camera shutter %s, expected 1us or longer", cfg.Shutter)
+	}
+	if cfg.Gain != nil && *cfg.Gain < 1 {
+		return fmt.Errorf("invalid camera gain %v, expected 1 or more", *cfg.Gain)
+	}
+	if cfg.AWB != "" && !slices.Contains(awbModes, cfg.AWB) {
+		return fmt.Errorf("invalid camera awb %q, expected one of %s", cfg.AWB, strings.Join(awbModes, ", "))
+	}
+	if cfg.EV != nil && (*cfg.EV < -10 || *cfg.EV > 10) {
+		return fmt.Errorf("invalid camera ev %v, expected -10..10", *cfg.EV)
+	}
+	return nil
+}
+
+// opts are rpicam exposure arguments, unset values are omitted
+func (cfg *ExposureConfig) opts() []string {
+	var opts []string
+	if cfg.Shutter > 0 {
+		opts = append(opts, "--shutter", strconv.FormatInt(cfg.Shutter.Microseconds(), 10))
+	}
+	if cfg.Gain != nil {
+		opts = append(opts, "--gain", strconv.FormatFloat(*cfg.Gain, 'f', -1, 64))
+	}
+	if cfg.AWB != "" {
+		opts = append(opts, "--awb", cfg.AWB)
+	}
+	if cfg.EV != nil {
+		opts = append(opts, "--ev", strconv.FormatFloat(*cfg.EV, 'f', -1, 64))
+	}
+	return opts
+}
+
+// validateROI checks "x,y,w,h" in sensor fractions, the region must fit the sensor
+func validateROI(roi string) error {
+	_, err := parseRegion("roi", roi)
+	return err
+}
+
+// parseRegion parses "x,y,w,h" region in fractions of sensor or frame, key names it in errors
+func parseRegion(key, region string) ([4]float64, error) {
+	var v [4]float64
+	parts := strings.Split(region, ",")
+	if len(parts) != 4 {
+		return v, fmt.Errorf("invalid camera %s %q, expected x,y,w,h", key, region)
+	}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || f < 0 || f > 1 {
+			return v, fmt.Errorf("invalid camera %s %q, values must be within 0..1", key, region)
+		}
+		v[i] = f
+	}
+	if v[2] == 0 || v[3] == 0 || v[0]+v[2] > 1 || v[1]+v[3] > 1 {
+		return v, fmt.Errorf("invalid camera %s %q, region is empty or exceeds sensor", key, region)
+	}
+	return v, nil
+}
+
+// validateRpicam checks options rpicam can't do, it flips image only
+func (cfg *CameraConfig) validateRpicam() error {
+	if cfg.Rotation == 90 || cfg.Rotation == 270 {
+		return errors.New("rpicam supports camera rotation 0 or 180 only")
+	}
+	return nil
+}
+
+// cameraOpts builds rpicam arguments, options left empty in config are omitted.
+// Profile arguments go last, profile is nil for day one
+func (cfg *CameraConfig) cameraOpts(bin *rpicamBinary, profile *CaptureProfile) []string {
+	var opts []string
+	if bin.encoding {
+		opts = append(opts, "--encoding", "jpg")
+	}
+	return append(opts, cfg.imageOpts(profile)...)
+}
+
+// imageOpts are options shared by rpicam still and video binaries
+func (cfg *CameraConfig) imageOpts(profile *CaptureProfile) []string {
+	var opts []string
+	if cfg.Rotation != 0 {
+		opts = append(opts, "--rotation", strconv.Itoa(cfg.Rotation))
+	}
+	if cfg.HFlip {
+		opts = append(opts, "--hflip")
+	}
+	if cfg.VFlip {
+		opts = append(opts, "--vflip")
+	}
+	opts = append(opts, "-n") // no preview
+	if cfg.ROI != "" {
+		opts = append(opts, "--roi", strings.ReplaceAll(cfg.ROI, " ", ""))
+	}
+	if cfg.Width > 0 {
+		opts = append(opts, "--width", strconv.Itoa(cfg.Width))
+	}
+	if cfg.Height > 0 {
+		opts = append(opts, "--height", strconv.Itoa(cfg.Height))
+	}
+	if cfg.FocusMode == FocusContinuous {
+		opts = append(opts, "--autofocus-mode", "continuous")
+	} else if cfg.LensPosition != nil {
+		opts = append(opts, "--lens-position", strconv.FormatFloat(*cfg.LensPosition, 'f', -1, 64))
+	}
+	opts = append(opts, cfg.Exposure.opts()...)
+	opts = append(opts, cfg.ExtraArgs...)
+	if profile != nil {
+		opts = append(opts, profile.Args...)
+	}
+	return opts
+}
+
+// beautyShotOpts capture full sensor view to name with BeautyShot arguments,
+// crop and size of timelapse frames aren't applied
+func (cfg *CameraConfig) beautyShotOpts(bin *rpicamBinary, name string) []string {
+	var opts []string
+	if bin.encoding {
+		opts = append(opts, "--encoding", "jpg")
+	}
+	if cfg.Rotation != 0 {
+		opts = append(opts, "--rotation", strconv.Itoa(cfg.Rotation))
+	}
+	if cfg.HFlip {
+		opts = append(opts, "--hflip")
+	}
+	if cfg.VFlip {
+		opts = append(opts, "--vflip")
+	}
+	opts = append(opts, "-n")
+	opts = append(opts, cfg.BeautyShot...)
+	return append(opts, "-o", name)
+}
+
+// captureOpts is cameraOpts for single immediate capture to name
+func (cfg *CameraConfig) captureOpts(bin *rpicamBinary, profile *CaptureProfile, name string) []string {
+	args := cfg.cameraOpts(bin, profile)
+	if bin.immediate {
+		args = append(args, "--immediate")
+	}
+	return append(args, "-o", name)
+}
+
+// pngCaptureOpts is captureOpts writing lossless png
+func (cfg *CameraConfig) pngCaptureOpts(bin *rpicamBinary, profile *CaptureProfile, name string) []string {
+	args := cfg.captureOpts(bin, profile, name)
+	if i := slices.Index(args, "--encoding"); i >= 0 {
+		args[i+1] = "png"
+	}
+	return args
+}
+
+// focusCaptureOpts is captureOpts running autofocus cycle before capture, lens position is ignored
+func (cfg *CameraConfig) focusCaptureOpts(bin *rpicamBinary, profile *CaptureProfile, name string) []string {
+	focus := *cfg
+	focus.FocusMode = ""
+	focus.LensPosition = nil
+	// no --immediate, focus cycle runs on preview frames
+	return append(focus.cameraOpts(bin, profile),
+		"--autofocus-mode", "auto", "--autofocus-on-capture",
+		"-o", name)
+}
@@ -0,0 +1,154 @@
+package camera
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCameraOpts(t *testing.T) {
+	lens := 1.01
+	zero := 0.0
+	gain := 2.5
+	ev := -0.5
+	still := newRpicamBinary("rpicam-still", "/usr/bin/rpicam-still")
+	jpeg := newRpicamBinary("rpicam-jpeg", "/usr/bin/rpicam-jpeg")
+
+	tests := []struct {
+		name string
+		cfg  CameraConfig
+		bin  *rpicamBinary
+		want []string
+	}{
+		{"defaults", CameraConfig{}, still, []string{"--encoding", "jpg", "-n"}},
+		{"rpicam-jpeg", CameraConfig{}, jpeg, []string{"-n"}},
+		{
+			"all options",
+			CameraConfig{Rotation: 180, ROI: "0.2, 0, 0.6, 1", Width: 2764, Height: 1944, LensPosition: &lens,
+				ExtraArgs: []string{"--sharpness", "1.5"}},
+			still,
+			[]string{"--encoding", "jpg", "--rotation", "180", "-n", "--roi", "0.2,0,0.6,1",
+				"--width", "2764", "--height", "1944", "--lens-position", "1.01", "--sharpness", "1.5"},
+		},
+		{"focus at infinity", CameraConfig{LensPosition: &zero}, jpeg, []string{"-n", "--lens-position", "0"}},
+		{"exposure", CameraConfig{Exposure: ExposureConfig{Shutter: 20 * time.Millisecond, Gain: &gain, AWB: "daylight", EV: &ev}}, jpeg,
+			[]string{"-n", "--shutter", "20000", "--gain", "2.5", "--awb", "daylight", "--ev", "-0.5"}},
+		{"exposure gain only", CameraConfig{Exposure: ExposureConfig{Gain: &gain}}, jpeg, []string{"-n", "--gain", "2.5"}},
+		{"continuous focus", CameraConfig{FocusMode: FocusContinuous, LensPosition: &lens}, jpeg,
+			[]string{"-n", "--autofocus-mode", "continuous"}},
+		{"last shot focus", CameraConfig{FocusMode: FocusLastShot, LensPosition: &lens}, jpeg,
+			[]string{"-n", "--lens-position", "1.01"}},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.cameraOpts(tt.bin, nil); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestProfileOpts(t *testing.T) {
+	cfg := &CameraConfig{ExtraArgs: []string{"--sharpness", "1.5"}}
+	night := &CaptureProfile{Name: "night", Args: []string{"--hdr", "--gain", "4"}}
+	got := cfg.captureOpts(newRpicamBinary("rpicam-jpeg", "/usr/bin/rpicam-jpeg"), night, "/tmp/1.jpg")
+	want := []string{"-n", "--sharpness", "1.5", "--hdr", "--gain", "4", "-o", "/tmp/1.jpg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestFocusCaptureOpts(t *testing.T) {
+	lens := 1.01
+	cfg := &CameraConfig{FocusMode: FocusManual, LensPosition: &lens, Width: 1280}
+	got := cfg.focusCaptureOpts(newRpicamBinary("rpicam-still", "/usr/bin/rpicam-still"), nil, "/tmp/1.jpg")
+	want := []string{"--encoding", "jpg", "-n", "--width", "1280", "--autofocus-mode", "auto", "--autofocus-on-capture", "-o", "/tmp/1.jpg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if cfg.LensPosition == nil || cfg.FocusMode != FocusManual {
+		t.Error("config is modified")
+	}
+}
+
+func TestCaptureOpts(t *testing.T) {
+	cfg := &CameraConfig{Width: 1280}
+	got := cfg.captureOpts(newRpicamBinary("rpicam-still", "/usr/bin/rpicam-still"), nil, "/tmp/1.jpg")
+	want := []string{"--encoding", "jpg", "-n", "--width", "1280", "--immediate", "-o", "/tmp/1.jpg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCameraConfigValidate(t *testing.T) {
+	negative := -1.0
+	zero := 0.0
+	one, ten, eleven := 1.0, 10.0, 11.0
+	valid := []CameraConfig{
+		{},
+		{Rotation: 90},
+		{Rotation: 270, ROI: "0,0,1,1"},
+		{ROI: "0.25,0.25,0.5,0.5"},
+		{FocusMode: FocusContinuous},
+		{FocusMode: FocusManual, LensPosition: &zero},
+		{Exposure: ExposureConfig{Shutter: time.Second, Gain: &one, AWB: "cloudy", EV: &ten}},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%+v: %v", cfg, err)
+		}
+	}
+
+	invalid := []CameraConfig{
+		{Rotation: 45},
+		{Rotation: -90},
+		{ROI: "0.2,0,0.6"},
+		{ROI: "a,b,c,d"},
+		{ROI: "0.5,0,0.6,1"},
+		{ROI: "0,0,0,1"},
+		{ROI: "-0.1,0,0.5,1"},
+		{Width: -1},
+		{LensPosition: &negative},
+		{FocusMode: FocusManual},
+		{FocusMode: "macro"},
+		{Exposure: ExposureConfig{Shutter: -time.Second}},
+		{Exposure: ExposureConfig{Shutter: time.Nanosecond}},
+		{Exposure: ExposureConfig{Gain: &zero}},
+		{Exposure: ExposureConfig{AWB: "sunny"}},
+		{Exposure: ExposureConfig{EV: &eleven}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+
+	if err := (&CameraConfig{Rotation: 90}).validateRpicam(); err == nil {
+		t.Error("expected rpicam to reject 90 degrees rotation")
+	}
+}
+
+func TestTimelapseExposureOpts(t *testing.T) {
+	runner := useFakeRunner(t)
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withRpicam())
+	ts.camConfig = &CameraConfig{Exposure: ExposureConfig{Shutter: time.Second, AWB: "indoor"}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	if _, err := ts.source.startCapture(ctx, t.TempDir(), time.Minute, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.source.captureShot(ctx, filepath.Join(t.TempDir(), "last.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 2 {
+		t.Fatalf("expected timelapse and last shot, got %q", calls)
+	}
+	for _, args := range calls {
+		if !containsSeq(args, []string{"--shutter", "1000000", "--awb", "indoor"}) {
+			t.Errorf("no exposure options in %q", args)
+		}
+	}
+}
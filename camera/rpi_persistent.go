@@ -0,0 +1,261 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// process is stopped after that long without snapshots, so sensor isn't kept running for nothing
+	persistentIdleTimeout = 2 * time.Minute
+	// the first capture waits for sensor init and AE settle
+	persistentCaptureTimeout  = 5 * time.Second
+	persistentPollInterval    = 20 * time.Millisecond
+	persistentRestartMaxDelay = time.Minute
+)
+
+// persistentStill keeps rpicam-still running in --signal mode, so snapshot is SIGUSR1 away
+// instead of sensor init. Running process holds rpicamMutex and yields it to timelapse and stream
+type persistentStill struct {
+	log       *slog.Logger
+	rpicam    *rpicamBinary
+	camConfig *CameraConfig
+	// process stops when timelapse waits for camera
+	wanted *atomic.Int32
+	dir    string
+
+	// serializes captures
+	captureMu sync.Mutex
+
+	sync.Mutex
+	running Process
+	cancel  func()
+	// closed when process is gone and rpicamMutex is released
+	exited   chan struct{}
+	lastUsed time.Time
+	// capture profile process was started with
+	profile string
+	// restart backoff after process died
+	retryAt    time.Time
+	retryDelay time.Duration
+}
+
+func newPersistentStill(log *slog.Logger, rpicam *rpicamBinary, camConfig *CameraConfig, wanted *atomic.Int32, dir string) *persistentStill {
+	return &persistentStill{
+		log:        log,
+		rpicam:     rpicam,
+		camConfig:  camConfig,
+		wanted:     wanted,
+		dir:        dir,
+		retryDelay: time.Second,
+	}
+}
+
+// capture triggers frame of running process, starting it if needed, and moves it to name.
+// Process is stopped on failure, so caller can fall back to one-shot capture
+func (p *persistentStill) capture(ctx context.Context, name string) error {
+	p.captureMu.Lock()
+	defer p.captureMu.Unlock()
+
+	if p.profileChanged() {
+		// process keeps arguments it was started with
+		p.stop()
+	}
+	exited, proc, err := p.ensureRunning()
+	if err != nil {
+		return err
+	}
+	err = p.trigger(ctx, exited, proc, name)
+	if err != nil {
+		if ctx.Err() == nil {
+			// wedged process, next snapshots fall back to one-shot for a while
+			p.stop()
+			p.Lock()
+			p.backoff()
+			p.Unlock()
+		}
+		return err
+	}
+
+	p.Lock()
+	p.retryDelay = time.Second
+	p.Unlock()
+	return nil
+}
+
+func (p *persistentStill) trigger(ctx context.Context, exited <-chan struct{}, proc Process, name string) error {
+	if err := proc.Signal(syscall.SIGUSR1); err != nil {
+		return fmt.Errorf("fail to trigger capture: %w", err)
+	}
+
+	timeout := time.NewTimer(persistentCaptureTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(persistentPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return errors.New("capture process exited")
+		case <-timeout.C:
+			return errors.New("capture process gave no frame in time")
+		case <-ticker.C:
+		}
+
+		shot, err := p.completeShot()
+		if err != nil {
+			return err
+		}
+		if shot != "" {
+			return os.Rename(shot, name)
+		}
+	}
+}
+
+// completeShot returns frame file fully written by process, empty if there is none yet
+func (p *persistentStill) completeShot() (string, error) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return "", fmt.Errorf("fail to read capture dir: %w", err)
+	}
+	for _, e := range entries {
+		name := filepath.Join(p.dir, e.Name())
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		if bytes.HasPrefix(data, jpegSOI) && bytes.HasSuffix(bytes.TrimRight(data, "\x00"), jpegEOI) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// profileChanged reports whether running process was started with other capture profile
+func (p *persistentStill) profileChanged() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.cancel != nil && p.profile != profileName(p.camConfig.profileAt(time.Now()))
+}
+
+// ensureRunning starts process unless it's running already
+func (p *persistentStill) ensureRunning() (<-chan struct{}, Process, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.lastUsed = time.Now()
+	if p.cancel != nil {
+		return p.exited, p.running, nil
+	}
+	if time.Now().Before(p.retryAt) {
+		return nil, nil, errors.New("capture process is restarting")
+	}
+	if !rpicamMutex.TryLock() {
+		return nil, nil, ErrCameraBusy
+	}
+
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		rpicamMutex.Unlock()
+		return nil, nil, fmt.Errorf("fail to create capture dir: %w", err)
+	}
+	profile := p.camConfig.profileAt(time.Now())
+	args := append(p.camConfig.cameraOpts(p.rpicam, profile),
+		"--signal",
+		"--timeout", "0", // runs till stopped
+		"-o", filepath.Join(p.dir, "snap%06d.jpg"),
+	)
+	p.log.Debug("rpicam persistent args", "binary", p.rpicam.Name, "args", args)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := Runner.Start(ctx, nil, p.rpicam.Path, args...)
+	if err != nil {
+		cancel()
+		rpicamMutex.Unlock()
+		p.backoff()
+		return nil, nil, fmt.Errorf("fail to start %s: %w", p.rpicam.Name, err)
+	}
+
+	exited := make(chan struct{})
+	p.cancel = cancel
+	p.exited = exited
+	p.running = proc
+	p.profile = profileName(profile)
+	go p.watch(ctx, cancel, proc, exited)
+	return exited, proc, nil
+}
+
+// watch stops process when it's idle or camera is wanted, and releases camera when it's gone
+func (p *persistentStill) watch(ctx context.Context, cancel func(), proc Process, exited chan struct{}) {
+	done := make(chan struct{})
+	go func() {
+		proc.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(streamShareInterval)
+	defer ticker.Stop()
+	died := false
+loop:
+	for {
+		select {
+		case <-done:
+			died = true
+			break loop
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+			p.Lock()
+			idle := time.Since(p.lastUsed) > persistentIdleTimeout
+			p.Unlock()
+			if idle || p.wanted.Load() > 0 {
+				break loop
+			}
+		}
+	}
+	cancel()
+	<-done
+
+	p.Lock()
+	p.cancel = nil
+	p.running = nil
+	if died {
+		p.log.Warn("persistent capture process died", "retryIn", p.retryDelay)
+		p.backoff()
+	}
+	p.Unlock()
+
+	entries, _ := os.ReadDir(p.dir)
+	for _, e := range entries {
+		os.Remove(filepath.Join(p.dir, e.Name()))
+	}
+	rpicamMutex.Unlock()
+	close(exited)
+}
+
+// backoff delays next start, p is locked
+func (p *persistentStill) backoff() {
+	p.retryAt = time.Now().Add(p.retryDelay)
+	p.retryDelay = min(p.retryDelay*2, persistentRestartMaxDelay)
+}
+
+// stop terminates process if it's running and waits till camera is released
+func (p *persistentStill) stop() {
+	p.Lock()
+	cancel, exited := p.cancel, p.exited
+	p.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-exited
+}
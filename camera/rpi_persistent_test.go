@@ -0,0 +1,64 @@
+package camera
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPersistentStill(t *testing.T) {
+	runner := useFakeRunner(t)
+	wanted := &atomic.Int32{}
+	dir := t.TempDir()
+	p := newPersistentStill(slog.Default(), newRpicamBinary("rpicam-still", "/fake/bin/rpicam-still"),
+		&CameraConfig{Rotation: 180}, wanted, filepath.Join(dir, "persistent"))
+
+	for i := range 2 {
+		name := filepath.Join(dir, "shot.jpg")
+		if err := p.capture(t.Context(), name); err != nil {
+			t.Fatalf("capture %d: %v", i, err)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil || !bytes.Equal(data, fakeSignalFrame) {
+			t.Fatalf("capture %d: unexpected shot %q, %v", i, data, err)
+		}
+	}
+
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 1 || !slices.Contains(calls[0], "--signal") || !slices.Contains(calls[0], "--rotation") {
+		t.Fatalf("expected single persistent process, got %v", calls)
+	}
+	if rpicamMutex.TryLock() {
+		rpicamMutex.Unlock()
+		t.Fatal("running process doesn't hold camera")
+	}
+
+	// timelapse wants camera
+	wanted.Add(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for !rpicamMutex.TryLock() {
+		if time.Now().After(deadline) {
+			t.Fatal("process doesn't yield camera")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rpicamMutex.Unlock()
+	wanted.Add(-1)
+
+	if err := p.capture(t.Context(), filepath.Join(dir, "again.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runner.Calls("rpicam-still")); n != 2 {
+		t.Errorf("expected process restart, got %d starts", n)
+	}
+	p.stop()
+	if !rpicamMutex.TryLock() {
+		t.Fatal("stopped process doesn't release camera")
+	}
+	rpicamMutex.Unlock()
+}
@@ -0,0 +1,228 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dayProfile is name of capture options used outside of profile windows
+const dayProfile = "day"
+
+var (
+	// how often timelapse checks whether profile window is switched
+	profileCheckInterval = time.Minute
+	// how often timelapse dir is checked for the frame profile switch waits for
+	profilePollInterval = time.Second
+)
+
+func validateProfiles(profiles []CaptureProfile) error {
+	names := map[string]bool{dayProfile: true}
+	for _, p := range profiles {
+		if p.Name == "" || names[p.Name] {
+			return fmt.Errorf("invalid capture profile name %q, it must be unique and not %s", p.Name, dayProfile)
+		}
+		names[p.Name] = true
+
+		from, err := parseClock(p.From)
+		if err != nil {
+			return fmt.Errorf("capture profile %s: %w", p.Name, err)
+		}
+		to, err := parseClock(p.To)
+		if err != nil {
+			return fmt.Errorf("capture profile %s: %w", p.Name, err)
+		}
+		if from == to {
+			return fmt.Errorf("capture profile %s has empty window %s-%s", p.Name, p.From, p.To)
+		}
+	}
+	return nil
+}
+
+// parseClock returns time of day "15:04" as duration since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether t is within profile window, From is inclusive and To is not
+func (p *CaptureProfile) contains(t time.Time) bool {
+	from, err := parseClock(p.From)
+	if err != nil {
+		return false
+	}
+	to, err := parseClock(p.To)
+	if err != nil {
+		return false
+	}
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if from < to {
+		return clock >= from && clock < to
+	}
+	return clock >= from || clock < to
+}
+
+// profileAt returns the first profile active at t, nil for day profile
+func (cfg *CameraConfig) profileAt(t time.Time) *CaptureProfile {
+	for i := range cfg.Profiles {
+		if cfg.Profiles[i].contains(t) {
+			return &cfg.Profiles[i]
+		}
+	}
+	return nil
+}
+
+func profileName(p *CaptureProfile) string {
+	if p == nil {
+		return dayProfile
+	}
+	return p.Name
+}
+
+// profileCapture is rpicam timelapse restarted with other arguments when profile window switches.
+// Restart waits for the next frame, so numbering goes on and no interval is skipped
+type profileCapture struct {
+	src      rpicamSource
+	dir      string
+	interval time.Duration
+	now      func() time.Time
+
+	done chan struct{}
+	err  error
+
+	mu      sync.Mutex
+	proc    Process
+	cancel  func()
+	profile *CaptureProfile
+}
+
+func (c rpicamSource) startProfileCapture(ctx context.Context, dir string, interval time.Duration, frameStart int) (Process, error) {
+	pc := &profileCapture{
+		src:      c,
+		dir:      dir,
+		interval: interval,
+		now:      time.Now,
+		done:     make(chan struct{}),
+	}
+	if err := pc.start(ctx, c.camConfig.profileAt(pc.now()), frameStart); err != nil {
+		return nil, err
+	}
+	go pc.run(ctx)
+	return pc, nil
+}
+
+func (pc *profileCapture) start(ctx context.Context, profile *CaptureProfile, frameStart int) error {
+	procCtx, cancel := context.WithCancel(ctx)
+	proc, err := pc.src.startTimelapseProcess(procCtx, pc.dir, pc.interval, profile, frameStart)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	pc.mu.Lock()
+	pc.proc, pc.cancel, pc.profile = proc, cancel, profile
+	pc.mu.Unlock()
+	pc.src.log.InfoContext(ctx, "timelapse capture profile", "profile", profileName(profile), "frameStart", frameStart)
+	return nil
+}
+
+func (pc *profileCapture) run(ctx context.Context) {
+	defer close(pc.done)
+
+	ticker := time.NewTicker(profileCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			pc.mu.Lock()
+			proc, cancel := pc.proc, pc.cancel
+			pc.mu.Unlock()
+			cancel()
+			pc.err = proc.Wait()
+			return
+		case <-ticker.C:
+		}
+
+		profile := pc.src.camConfig.profileAt(pc.now())
+		pc.mu.Lock()
+		same := profileName(profile) == profileName(pc.profile)
+		pc.mu.Unlock()
+		if same {
+			continue
+		}
+		if err := pc.restart(ctx, profile); err != nil && ctx.Err() == nil {
+			pc.src.log.ErrorContext(ctx, "fail to switch timelapse capture profile", "profile", profileName(profile), "err", err)
+		}
+	}
+}
+
+// restart stops process right after its next frame and starts it with profile
+func (pc *profileCapture) restart(ctx context.Context, profile *CaptureProfile) error {
+	last := newestShot(pc.dir)
+	deadline := time.NewTimer(pc.interval + persistentCaptureTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(profilePollInterval)
+	defer ticker.Stop()
+wait:
+	for newestShot(pc.dir) <= last {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			// process gives no frames, switching anyway
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	pc.mu.Lock()
+	proc, cancel := pc.proc, pc.cancel
+	pc.mu.Unlock()
+	cancel()
+	proc.Wait()
+
+	return pc.start(ctx, profile, newestShot(pc.dir)+1)
+}
+
+// newestShot returns id of the newest fully written frame in dir, -1 if there is none
+func newestShot(dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return -1
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		id, err := getShotID(entries[i].Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entries[i].Name()))
+		if err == nil && bytes.HasPrefix(data, jpegSOI) && bytes.HasSuffix(bytes.TrimRight(data, "\x00"), jpegEOI) {
+			return id
+		}
+	}
+	return -1
+}
+
+// Wait waits till ctx capture was started with is done and the last process exits
+func (pc *profileCapture) Wait() error {
+	<-pc.done
+	return pc.err
+}
+
+func (pc *profileCapture) Signal(sig os.Signal) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.proc == nil {
+		return errors.New("capture process isn't running")
+	}
+	return pc.proc.Signal(sig)
+}
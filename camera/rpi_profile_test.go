@@ -0,0 +1,124 @@
+package camera
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProfileAt(t *testing.T) {
+	cfg := &CameraConfig{Profiles: []CaptureProfile{
+		{Name: "night", From: "22:00", To: "06:30"},
+		{Name: "evening", From: "18:00", To: "23:00"},
+	}}
+	tests := []struct {
+		clock string
+		want  string
+	}{
+		{"12:00", dayProfile},
+		{"18:00", "evening"},
+		{"21:59", "evening"},
+		{"22:00", "night"},
+		{"03:00", "night"},
+		{"06:29", "night"},
+		{"06:30", dayProfile},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse("15:04", tt.clock)
+		if got := profileName(cfg.profileAt(at)); got != tt.want {
+			t.Errorf("%s: expected %s profile, got %s", tt.clock, tt.want, got)
+		}
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	valid := []CaptureProfile{{Name: "night", From: "22:00", To: "6:00", Args: []string{"--hdr"}}}
+	if err := validateProfiles(valid); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	invalid := [][]CaptureProfile{
+		{{From: "22:00", To: "06:00"}},
+		{{Name: "day", From: "22:00", To: "06:00"}},
+		{{Name: "night", From: "22:00", To: "06:00"}, {Name: "night", From: "01:00", To: "02:00"}},
+		{{Name: "night", From: "25:00", To: "06:00"}},
+		{{Name: "night", From: "22:00", To: "late"}},
+		{{Name: "night", From: "22:00", To: "22:00"}},
+	}
+	for _, profiles := range invalid {
+		if err := validateProfiles(profiles); err == nil {
+			t.Errorf("%+v: expected error", profiles)
+		}
+	}
+}
+
+func TestProfileCapture(t *testing.T) {
+	runner := useFakeRunner(t)
+	prevCheck, prevPoll := profileCheckInterval, profilePollInterval
+	profileCheckInterval, profilePollInterval = 5*time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { profileCheckInterval, profilePollInterval = prevCheck, prevPoll })
+
+	ts := &timelapseSvc{
+		log:    slog.Default(),
+		rpicam: newRpicamBinary("rpicam-still", "/fake/bin/rpicam-still"),
+		camConfig: &CameraConfig{Profiles: []CaptureProfile{
+			{Name: "night", From: "22:00", To: "06:00", Args: []string{"--gain", "4"}},
+		}},
+		config: &TimelapseConfig{},
+	}
+	var clock atomic.Pointer[time.Time]
+	evening := time.Date(2024, 5, 1, 21, 59, 0, 0, time.Local)
+	clock.Store(&evening)
+
+	dir := t.TempDir()
+	pc := &profileCapture{
+		src:      rpicamSource{ts},
+		dir:      dir,
+		interval: time.Minute,
+		now:      func() time.Time { return *clock.Load() },
+		done:     make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	if err := pc.start(ctx, ts.camConfig.profileAt(pc.now()), 0); err != nil {
+		t.Fatal(err)
+	}
+	go pc.run(ctx)
+
+	night := evening.Add(time.Minute)
+	clock.Store(&night)
+	// restart waits for frame in progress
+	time.Sleep(50 * time.Millisecond)
+	if n := len(runner.Calls("rpicam-still")); n != 1 {
+		t.Fatalf("expected restart after the next frame, got %d starts", n)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "image000003.jpg"), fakeTimelapseFrame, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(runner.Calls("rpicam-still")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("capture isn't restarted with night profile")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	calls := runner.Calls("rpicam-still")
+	if slices.Contains(calls[0], "--gain") || slices.Contains(calls[0], "--framestart") {
+		t.Errorf("unexpected day args %q", calls[0])
+	}
+	if !containsSeq(calls[1], []string{"--gain", "4"}) || !containsSeq(calls[1], []string{"--framestart", "4"}) {
+		t.Errorf("unexpected night args %q", calls[1])
+	}
+	if id := newestShot(dir); id != 6 {
+		t.Errorf("expected frames numbering to go on, newest is %d", id)
+	}
+
+	cancel()
+	pc.Wait()
+}
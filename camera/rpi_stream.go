@@ -0,0 +1,250 @@
+package camera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// how often timelapse frame is checked while timelapse owns camera
+	streamTimelapseInterval = 2 * time.Second
+	// how often other stream's frames are checked while it owns camera
+	streamShareInterval = 200 * time.Millisecond
+	// stream frame younger than that is served as snapshot
+	streamFrameMaxAge  = time.Second
+	maxStreamFrameSize = 16 << 20
+)
+
+// videoBinary finds rpicam-vid (libcamera-vid on Bullseye) next to detected still binary
+func (c *rpiCamera) videoBinary() (string, error) {
+	base := filepath.Base(c.rpicam.Name)
+	prefix, _, _ := strings.Cut(base, "-")
+	name := prefix + "-vid"
+
+	if filepath.IsAbs(c.rpicam.Path) {
+		if path, err := Runner.LookPath(filepath.Join(filepath.Dir(c.rpicam.Path), name)); err == nil {
+			return path, nil
+		}
+	}
+	path, err := Runner.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("stream needs %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// Stream runs rpicam-vid in MJPEG mode. Camera is shared, so while timelapse
+// captures the latest timelapse frame is streamed, and while another stream
+// owns camera its frames are shared
+func (c *rpiCamera) Stream(ctx context.Context) (chan []byte, error) {
+	vid, err := c.videoBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = c.life.bind(ctx)
+	stream := make(chan []byte, 10)
+	err = c.life.goRun(func() {
+		defer close(stream)
+		c.streamLoop(ctx, vid, stream)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (c *rpiCamera) streamLoop(ctx context.Context, vid string, stream chan<- []byte) {
+	var (
+		lastShot   string
+		lastShared *Frame
+	)
+	for ctx.Err() == nil {
+		if c.Capturing() {
+			if name, err := c.LastTLShot(); err == nil && name != lastShot {
+				lastShot = name
+				c.sendFile(ctx, stream, name)
+			}
+			sleepCtx(ctx, streamTimelapseInterval)
+			continue
+		}
+
+		if c.still != nil {
+			// stream frames serve snapshots as well
+			c.still.stop()
+		}
+		if !rpicamMutex.TryLock() {
+			// snapshot, last shot or another stream has camera
+			if f := c.recentStreamFrame(); f != nil && f != lastShared {
+				lastShared = f
+				c.send(stream, c.badged(f.Data, SourceFresh))
+			}
+			sleepCtx(ctx, streamShareInterval)
+			continue
+		}
+		// timelapse could start while lock was awaited
+		if c.Capturing() {
+			rpicamMutex.Unlock()
+			continue
+		}
+
+		err := c.runVideo(ctx, vid, stream)
+		rpicamMutex.Unlock()
+		if err != nil {
+			c.log.WarnContext(ctx, "stream capture failed", "err", err)
+			c.stats.fail(err)
+			sleepCtx(ctx, time.Second)
+		}
+	}
+}
+
+// runVideo streams rpicam-vid frames till ctx is done or timelapse wants camera.
+// Caller holds rpicamMutex
+func (c *rpiCamera) runVideo(ctx context.Context, vid string, stream chan<- []byte) error {
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := append(c.camConfig.imageOpts(c.camConfig.profileAt(time.Now())),
+		"--codec", "mjpeg",
+		"--framerate", fmt.Sprint(c.camConfig.streamFPS()),
+		"-t", "0", // runs infinitely
+		"-o", "-",
+	)
+	c.log.DebugContext(ctx, "rpicam-vid args", "binary", vid, "args", args)
+	out, proc, err := Runner.Pipe(cmdCtx, vid, args...)
+	if err != nil {
+		return fmt.Errorf("fail to start %s: %w", vid, err)
+	}
+
+	// timelapse has priority over stream
+	go func() {
+		ticker := time.NewTicker(streamShareInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cmdCtx.Done():
+				return
+			case <-ticker.C:
+				if c.cameraWanted.Load() > 0 {
+					c.log.DebugContext(ctx, "camera is wanted for timelapse, stopping stream capture")
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 0, 1<<20), maxStreamFrameSize)
+	scanner.Split(splitJPEG)
+	for scanner.Scan() {
+		frame := &Frame{
+			Data:       bytes.Clone(scanner.Bytes()),
+			Source:     SourceFresh,
+			CapturedAt: time.Now(),
+		}
+		c.streamFrame.Store(frame)
+		c.stats.frame(frame.CapturedAt)
+		c.send(stream, c.badged(frame.Data, SourceFresh))
+	}
+	scanErr := scanner.Err()
+
+	cancel()
+	out.Close()
+	proc.Wait()
+	c.streamFrame.Store(nil)
+
+	if cmdCtx.Err() != nil {
+		// cancelled by client or preempted by timelapse
+		return nil
+	}
+	if scanErr != nil {
+		return fmt.Errorf("fail to read %s output: %w", vid, scanErr)
+	}
+	return fmt.Errorf("%s exited", vid)
+}
+
+// recentStreamFrame returns frame captured by running stream, nil if there is none
+func (c *rpiCamera) recentStreamFrame() *Frame {
+	f := c.streamFrame.Load()
+	if f == nil || time.Since(f.CapturedAt) >= streamFrameMaxAge {
+		return nil
+	}
+	return f
+}
+
+func (c *rpiCamera) sendFile(ctx context.Context, stream chan<- []byte, name string) {
+	frame, err := readFrame(name, SourceTimelapse)
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to read timelapse frame", "err", err)
+		return
+	}
+	c.send(stream, c.badged(frame.Data, SourceTimelapse))
+}
+
+// send drops frame if client doesn't keep up, capture must not stall
+func (c *rpiCamera) send(stream chan<- []byte, data []byte) {
+	if data == nil {
+		return
+	}
+	select {
+	case stream <- data:
+	default:
+		c.log.Debug("stream buffer overflow, frame dropped")
+	}
+}
+
+// badged draws capture source badge if it's enabled, nil if frame is broken
+func (c *rpiCamera) badged(data []byte, source CaptureSource) []byte {
+	if !c.camConfig.SourceBadge {
+		return data
+	}
+	out, err := passJPEG(data, source)
+	if err != nil {
+		c.log.Debug("fail to draw badge", "err", err)
+		return nil
+	}
+	return out
+}
+
+var (
+	jpegSOI = []byte{0xff, 0xd8}
+	jpegEOI = []byte{0xff, 0xd9}
+)
+
+// splitJPEG is bufio.SplitFunc cutting MJPEG stream into JPEG frames.
+// rpicam-vid frames have no embedded thumbnails, so first EOI ends the frame
+func splitJPEG(data []byte, atEOF bool) (int, []byte, error) {
+	start := bytes.Index(data, jpegSOI)
+	if start < 0 {
+		// keep trailing 0xff, it may be the first half of SOI
+		if !atEOF && len(data) > 0 && data[len(data)-1] == jpegSOI[0] {
+			return len(data) - 1, nil, nil
+		}
+		return len(data), nil, nil
+	}
+	end := bytes.Index(data[start+len(jpegSOI):], jpegEOI)
+	if end < 0 {
+		if atEOF {
+			// truncated frame of killed process
+			return len(data), nil, nil
+		}
+		// skip garbage before frame and wait for more data
+		return start, nil, nil
+	}
+	end += start + len(jpegSOI) + len(jpegEOI)
+	return end, data[start:end], nil
+}
+
+// sleepCtx waits d or till ctx is done
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,165 @@
+package camera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestSplitJPEG(t *testing.T) {
+	input := []byte("garbage\xff\xd8one\xff\xd9\xff\xd8two\xff\x00\xff\xd9noise\xff\xd8truncated")
+	scanner := bufio.NewScanner(iotest.OneByteReader(bytes.NewReader(input)))
+	scanner.Split(splitJPEG)
+
+	var frames []string
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"\xff\xd8one\xff\xd9", "\xff\xd8two\xff\x00\xff\xd9"}
+	if !slices.Equal(frames, want) {
+		t.Errorf("expected %q, got %q", want, frames)
+	}
+}
+
+func newTestRPICamera(t *testing.T) *rpiCamera {
+	t.Helper()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withRpicam())
+	return &rpiCamera{
+		log:          slog.Default(),
+		timelapseSvc: ts,
+		tmpDir:       t.TempDir(),
+		life:         newLifecycle(),
+	}
+}
+
+// receive reads next frame from stream or fails the test
+func receive(t *testing.T, stream chan []byte) []byte {
+	t.Helper()
+	select {
+	case frame, ok := <-stream:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for stream frame")
+	}
+	return nil
+}
+
+// waitClosed drains stream till it's closed
+func waitClosed(t *testing.T, stream chan []byte) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-stream:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stream isn't closed after cancel")
+		}
+	}
+}
+
+func TestRPIStream(t *testing.T) {
+	runner := useFakeRunner(t)
+	cam := newTestRPICamera(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	stream, err := cam.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range fakeStreamFrames {
+		if got := receive(t, stream); !bytes.Equal(got, want) {
+			t.Errorf("expected frame %q, got %q", want, got)
+		}
+	}
+
+	// camera is busy with stream, snapshot reuses its frame
+	snap, err := cam.Snapshot(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Source != SourceCache || !bytes.Equal(snap.Data, fakeStreamFrames[2]) {
+		t.Errorf("unexpected snapshot %s %q", snap.Source, snap.Data)
+	}
+
+	cancel()
+	waitClosed(t, stream)
+
+	calls := runner.Calls("rpicam-vid")
+	if len(calls) != 1 {
+		t.Fatalf("expected single rpicam-vid run, got %q", calls)
+	}
+	if !slices.Contains(calls[0], "mjpeg") || calls[0][len(calls[0])-1] != "-" {
+		t.Errorf("unexpected rpicam-vid args %q", calls[0])
+	}
+	if !rpicamMutex.TryLock() {
+		t.Fatal("camera isn't released after stream")
+	}
+	rpicamMutex.Unlock()
+}
+
+func TestRPIStreamYieldsToTimelapse(t *testing.T) {
+	useFakeRunner(t)
+	cam := newTestRPICamera(t)
+
+	stream, err := cam.Stream(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, stream)
+
+	locked := make(chan struct{})
+	go func() {
+		cam.lockCamera()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		rpicamMutex.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream didn't release camera for timelapse")
+	}
+}
+
+func TestRPIStreamTimelapse(t *testing.T) {
+	runner := useFakeRunner(t)
+	cam := newTestRPICamera(t)
+
+	dir := t.TempDir()
+	shot := []byte("\xff\xd8timelapse\xff\xd9")
+	if err := os.WriteFile(filepath.Join(dir, "image000001.jpg"), shot, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cam.timelapse = &timelapse{currentDir: dir}
+	cam.tlRunning.Store(true)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	stream, err := cam.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, stream); !bytes.Equal(got, shot) {
+		t.Errorf("expected timelapse frame, got %q", got)
+	}
+	cancel()
+	waitClosed(t, stream)
+
+	if calls := runner.Calls("rpicam-vid"); len(calls) != 0 {
+		t.Errorf("rpicam-vid must not run during timelapse, got %q", calls)
+	}
+}
@@ -2,16 +2,20 @@ package camera
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
@@ -20,67 +24,272 @@ import (
 // rpicam can be run only from one place, so locking it with mutex
 var rpicamMutex = &sync.Mutex{}
 
+var (
+	// ErrTimelapseRunning is returned for manual start while other timelapse runs or starts
+	ErrTimelapseRunning = errors.New("timelapse is already running")
+	// ErrTimelapseNotRunning is returned for manual stop without running manual timelapse
+	ErrTimelapseNotRunning = errors.New("manual timelapse isn't running")
+)
+
+// job and manual timelapse names go to video file name, runs of anything else
+// and underscores become single underscore
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+const (
+	defaultManualName = "manual"
+	defaultJobName    = "job"
+	maxNameLen        = 64
+	// how often manual start checks mutex held by printer poll
+	manualLockPoll = 10 * time.Millisecond
+
+	defaultFormatTimeout = 10 * time.Minute
+)
+
+// printed file extensions, dropped from video names
+var gcodeExts = []string{".gcode", ".bgcode"}
+
 type timelapseSvc struct {
 	log       *slog.Logger
 	prusalink prusalinkclient.Client
+	watcher   prusalinkclient.Watcher
+	rpicam    *rpicamBinary
+	camConfig *CameraConfig
 	config    *TimelapseConfig
+	// captures frames, rpicam or snapshots of camera without timelapse mode
+	source frameSource
+	// checked WorkDir, empty for system temp dir
+	workDir string
+
+	builds *buildQueue
+	// webhooks of timelapse events, nil without them
+	hooks *hooks
+	// names of videos ffmpeg is writing
+	encoding sync.Map
+	// ffmpeg progress of encodes is printed to it if not nil
+	progress io.Writer
+	// queued lazy thumbnails by video name, concurrent requests wait for the same job
+	thumbnailMu   sync.Mutex
+	thumbnailJobs map[string]*BuildJob
+	// last preview of running timelapse
+	preview preview
+
+	// read without mutex, handleTimelapse holds it while waiting for print to start
+	tlRunning atomic.Bool
+	// automatic timelapse waits for print to start, handleTimelapse holds mutex meanwhile
+	starting atomic.Bool
+	// credentials error is already reported
+	authFailed atomic.Bool
+	// refused start because of low space is already reported
+	spaceRefused atomic.Bool
+	// number of waiters for rpicamMutex with priority over stream, stream yields camera to them
+	cameraWanted atomic.Int32
+	// printer watching, nil if timelapse is disabled. watching is closed when it's stopped
+	stopWatching func()
+	watching     chan struct{}
 
 	sync.RWMutex
-	tlRunning bool
 	timelapse *timelapse
+	// polls printer when stop grace of timelapse is over
+	stopCheck *time.Timer
+	// job whose capture was given up after failed restarts, it isn't captured again. Zero if none
+	gaveUpJob int
+	// running timelapse for Status, mutex is held while waiting for print to start
+	current atomic.Pointer[timelapse]
 }
 
 type timelapse struct {
-	currentDir       string
-	startTime        time.Time
-	jobID            int
-	jobName          string
+	currentDir string
+	startTime  time.Time
+	jobID      int
+	jobName    string
+	interval   time.Duration
+	// manual timelapse is always time one
+	mode CaptureMode
+	// started by StartManual, printer state doesn't finish it
+	manual bool
+	// printer reports stop state since, zero while it prints
+	stopSince time.Time
+	// capture was stopped by watchSpace
+	lowSpace atomic.Bool
+	// capture was stopped by watchFrames
+	framesCapped atomic.Bool
+	// times frames were thinned, interval is doubled every time
+	thinned int
+	// capture was restarted that many times after it exited on its own
+	restarts atomic.Int32
+	// restarts in a row which got no frame and the first frame number of the latest one,
+	// mutex has to be locked
+	failedRestarts int
+	restartFrame   int
+
 	timelapseStop    func()
-	timelapseCommand *exec.Cmd
+	timelapseCommand Process
+}
+
+// frameSource captures timelapse frames
+type frameSource interface {
+	// startCapture writes frames to dir as shotFilename every interval till ctx is done,
+	// ids start with frameStart
+	startCapture(ctx context.Context, dir string, interval time.Duration, frameStart int) (Process, error)
+	// captureShot writes single fresh frame to name
+	captureShot(ctx context.Context, name string) error
 }
 
-func newTimelapse(log *slog.Logger, prusalink prusalinkclient.Client, config *TimelapseConfig) *timelapseSvc {
+func newTimelapse(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, rpicam *rpicamBinary, camConfig *CameraConfig, config *TimelapseConfig) *timelapseSvc {
 	ts := &timelapseSvc{
 		log:       log.With("svc", "timelapse"),
 		prusalink: prusalink,
+		watcher:   watcher,
+		rpicam:    rpicam,
+		camConfig: camConfig,
 		config:    config,
 	}
+	ts.source = rpicamSource{ts}
+	ts.start(log)
+	return ts
+}
 
+// start sweeps leftovers and starts build queue and printer watching
+func (ts *timelapseSvc) start(log *slog.Logger) {
+	ts.prepareOutputDir(context.Background())
+	ts.builds = newBuildQueue(log, filepath.Join(ts.config.OutputDir, buildQueueFile), ts.config.BuildConcurrency, ts.runJob)
+	ts.builds.retries = ts.config.BuildRetries
+	ts.hooks = newHooks(log, &ts.config.Hooks)
+	ts.builds.retryDelay = ts.config.buildRetryDelay()
+	var session *timelapseSession
 	if ts.config.Enabled {
-		go ts.initTimelapse()
+		ts.prepareWorkDir(context.Background())
+		session = ts.loadSession(context.Background())
+		ts.sweep(context.Background(), ts.frameRoot(), session)
 	}
+	go ts.builds.run()
 
-	return ts
+	if ts.config.Enabled {
+		ctx, cancel := context.WithCancel(context.Background())
+		ts.stopWatching = cancel
+		ts.watching = make(chan struct{})
+		go func() {
+			defer close(ts.watching)
+			if session != nil {
+				ts.resumeSession(ctx, session)
+			}
+			ts.initTimelapse(ctx)
+		}()
+	}
+}
+
+// closeTimelapse stops printer watching and running capture. Frames of interrupted timelapse
+// stay in tmp dir, it's resumed or built on the next start. With OnShutdown finish it's
+// finished instead, its queued build runs on the next start
+func (c *timelapseSvc) closeTimelapse(ctx context.Context) error {
+	if c.stopWatching != nil {
+		c.stopWatching()
+		select {
+		case <-c.watching:
+		case <-ctx.Done():
+			return fmt.Errorf("fail to stop timelapse: %w", ctx.Err())
+		}
+	}
+
+	// build of finished timelapse waits for the next start instead of being cut by exit
+	c.builds.stop()
+
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+	if c.stopCheck != nil {
+		c.stopCheck.Stop()
+	}
+	switch {
+	case c.timelapse == nil:
+	case c.config.OnShutdown == ShutdownFinish:
+		c.finishTimelapse(ctx)
+	default:
+		c.log.InfoContext(ctx, "timelapse interrupted", "jobID", c.timelapse.jobID, "dir", c.timelapse.currentDir)
+		c.timelapse.timelapseStop()
+		c.timelapse.timelapseCommand.Wait()
+		c.timelapse = nil
+		c.current.Store(nil)
+		c.tlRunning.Store(false)
+	}
+	return nil
+}
+
+func (c *timelapseSvc) initTimelapse(ctx context.Context) {
+	events, err := c.watcher.Watch(ctx)
+	if err != nil {
+		c.log.ErrorContext(ctx, "fail to watch printer", "err", err)
+		return
+	}
+	for ev := range events {
+		c.handleTimelapse(ctx, ev.Status, ev.Err)
+	}
 }
 
-func (c *timelapseSvc) initTimelapse() {
-	for {
-		// TODO graceful shutdown
-		after := time.After(time.Minute)
+// captureInterval returns configured interval, or with AdaptiveInterval one
+// spreading VideoLenght*MinFPS frames over remaining print time, kept within
+// MinInterval and MaxInterval. Remaining time reported by printer is preferred over
+// slicer estimate, meta may be nil
+func (c *timelapseSvc) captureInterval(status *prusalinkclient.Status, meta *prusalinkclient.JobMeta) time.Duration {
+	interval := time.Duration(c.config.Interval) * time.Second
+	frames := c.config.VideoLenght * c.config.MinFPS
+	if !c.config.AdaptiveInterval || frames <= 0 {
+		return interval
+	}
 
-		c.handleTimelapse()
-		<-after
+	remaining := status.TimeRemaining
+	if remaining <= 0 && meta != nil {
+		remaining = meta.EstimatedTime - status.TimePrinting
+	}
+	if remaining <= 0 {
+		return interval
 	}
+	adaptive := max(remaining/time.Duration(frames), time.Duration(max(c.config.MinInterval, 1))*time.Second)
+	if c.config.MaxInterval > 0 {
+		adaptive = min(adaptive, time.Duration(c.config.MaxInterval)*time.Second)
+	}
+	return adaptive
 }
 
-func (c *timelapseSvc) handleTimelapse() {
-	ctx := context.Background()
-	status, err := c.prusalink.JobStatus(ctx)
+// jobMeta returns slicer metadata for adaptive interval, nil if it's not needed or not available
+func (c *timelapseSvc) jobMeta(ctx context.Context) *prusalinkclient.JobMeta {
+	if !c.config.AdaptiveInterval {
+		return nil
+	}
+	meta, err := c.prusalink.JobMeta(ctx)
 	if err != nil {
+		c.log.DebugContext(ctx, "no job metadata, using printer estimate", "err", err)
+		return nil
+	}
+	return meta
+}
+
+// handleTimelapse starts or finishes timelapse on printer state change
+func (c *timelapseSvc) handleTimelapse(ctx context.Context, status *prusalinkclient.Status, err error) {
+	switch {
+	case errors.Is(err, prusalinkclient.ErrPrinterOffline):
+		c.log.DebugContext(ctx, "printer is offline")
+		return
+	case errors.Is(err, prusalinkclient.ErrUnauthorized):
+		// wrong key doesn't fix itself, no need to repeat it every poll
+		if !c.authFailed.Swap(true) {
+			c.log.ErrorContext(ctx, "printer rejected credentials, check printer.username and printer.apikey in config", "err", err)
+		}
+		return
+	case err != nil:
 		c.log.WarnContext(ctx, "fail to get current job status", "err", err)
 		return
 	}
+	c.authFailed.Store(false)
 
 	c.RWMutex.Lock()
 	defer c.RWMutex.Unlock()
 
-	if !c.tlRunning {
-		if !status.Online {
-			c.log.DebugContext(ctx, "printer is offline")
-			return
-		}
-
+	if !c.tlRunning.Load() {
 		if timelapseShouldStart(status.State) {
+			if c.gaveUpJob != 0 && status.JobID == c.gaveUpJob {
+				c.log.DebugContext(ctx, "capture of job was given up", "jobID", status.JobID)
+				return
+			}
 			c.startTimelapse(ctx, status)
 		}
 
@@ -89,14 +298,70 @@ func (c *timelapseSvc) handleTimelapse() {
 	}
 
 	// timelapse running
+	if c.timelapse.manual {
+		c.log.DebugContext(ctx, "manual timelapse continues")
+		return
+	}
 	if timelapseShouldStop(status.State) {
-		c.finishTimelapse(ctx)
+		if c.confirmStop(ctx, status.State) {
+			c.finishTimelapse(ctx)
+		}
 		return
 	}
 
+	if !c.timelapse.stopSince.IsZero() {
+		c.log.InfoContext(ctx, "printer is back to printing, timelapse continues", "state", status.State)
+		c.timelapse.stopSince = time.Time{}
+		if c.stopCheck != nil {
+			c.stopCheck.Stop()
+		}
+	}
 	c.log.DebugContext(ctx, "timelapse continues")
 }
 
+// confirmStop reports whether printer has been in stop state for StopGrace, so flaky Wi-Fi
+// doesn't finish timelapse mid-print. Watcher reports changes only, so printer is polled
+// again when grace is over. Mutex has to be locked
+func (c *timelapseSvc) confirmStop(ctx context.Context, state string) bool {
+	grace := c.config.StopGrace
+	if grace <= 0 {
+		return true
+	}
+	if c.timelapse.stopSince.IsZero() {
+		c.timelapse.stopSince = time.Now()
+		c.log.InfoContext(ctx, "printer reports stop, waiting before finishing timelapse", "state", state, "grace", grace)
+	}
+	left := grace - time.Since(c.timelapse.stopSince)
+	if left <= 0 {
+		return true
+	}
+	c.recheckStop(ctx, left)
+	return false
+}
+
+// recheckStop feeds printer state to handleTimelapse after d, mutex has to be locked
+func (c *timelapseSvc) recheckStop(ctx context.Context, d time.Duration) {
+	if c.stopCheck != nil {
+		c.stopCheck.Stop()
+	}
+	c.stopCheck = time.AfterFunc(d, func() {
+		if ctx.Err() != nil {
+			return
+		}
+		status, err := c.prusalink.JobStatus(ctx)
+		if err != nil {
+			// errors never finish timelapse, stop is confirmed by the next good answer
+			c.RWMutex.Lock()
+			defer c.RWMutex.Unlock()
+			if c.timelapse != nil && !c.timelapse.stopSince.IsZero() && ctx.Err() == nil {
+				c.recheckStop(ctx, c.config.StopGrace)
+			}
+			return
+		}
+		c.handleTimelapse(ctx, status, nil)
+	})
+}
+
 // timelapse should start only if printer is attention or printing state
 func timelapseShouldStart(state string) bool {
 	return state == prusalinkclient.StatusPrinting || state == prusalinkclient.StatusAttention
@@ -115,82 +380,210 @@ func timelapseShouldStop(state string) bool {
 		state == prusalinkclient.StatusReady
 }
 
+// lockCamera locks rpicamMutex, running stream is asked to release it
+func (c *timelapseSvc) lockCamera() {
+	c.cameraWanted.Add(1)
+	defer c.cameraWanted.Add(-1)
+	rpicamMutex.Lock()
+}
+
 func (c *timelapseSvc) startTimelapse(ctx context.Context, status *prusalinkclient.Status) {
 	// this function should be run with already locked mutex
-	tmpDir, err := os.MkdirTemp("", fmt.Sprintf("timelapse%d", status.JobID))
+	log := c.log.With("jobID", status.JobID, "jobName", status.FileName)
+
+	log.InfoContext(ctx, "timelapse start initiated, waiting for job", "startAt", cmp.Or(c.config.StartAt, StartProgress))
+	c.starting.Store(true)
+	status, ok := c.waitForStart(ctx, log, status)
+	c.starting.Store(false)
+	if !ok {
+		return
+	}
+	tmpDir, err := os.MkdirTemp(c.frameRoot(), fmt.Sprintf("%s%d", frameDirPrefix, status.JobID))
 	if err != nil {
-		c.log.ErrorContext(ctx, "fail to create tmp dir", "err", err)
+		log.ErrorContext(ctx, "fail to create tmp dir", "err", err)
 		return
 	}
-	log := c.log.With("jobID", status.JobID, "jobName", status.FileName)
+	interval := c.captureInterval(status, c.jobMeta(ctx))
+	if c.config.AdaptiveInterval {
+		log.InfoContext(ctx, "adaptive capture interval", "interval", interval, "configured", time.Duration(c.config.Interval)*time.Second)
+	}
+	if status.TimeRemaining > 0 {
+		log.InfoContext(ctx, "progress noted, timelapse stared", "interval", interval,
+			"remaining", status.TimeRemaining, "eta", time.Now().Add(status.TimeRemaining).Format(time.DateTime))
+	} else {
+		log.InfoContext(ctx, "progress noted, timelapse stared", "interval", interval)
+	}
 
-	log.InfoContext(ctx, "timelapse start initiated, waiting for job", "dir", tmpDir)
-	// waiting till progress started (skipping calibration)
-	for {
-		if status.Progress > 0 {
-			break
-		}
-		after := time.After(time.Second * 15)
-		select {
-		case <-after:
-		case <-ctx.Done():
-			log.WarnContext(ctx, "context cancelled")
-			return
+	if err := c.checkSpace(ctx, log, tmpDir, interval, status.TimeRemaining); err != nil {
+		// printer state repeats every poll, so it's reported once
+		if !c.spaceRefused.Swap(true) {
+			log.ErrorContext(ctx, "timelapse not started, disk space is low", "err", err)
 		}
-		status, err = c.prusalink.JobStatus(ctx)
+		os.Remove(tmpDir)
+		return
+	}
+	c.spaceRefused.Store(false)
+
+	tl := &timelapse{
+		currentDir: tmpDir,
+		jobID:      status.JobID,
+		jobName:    jobName(status),
+		interval:   interval,
+		mode:       c.config.mode(),
+	}
+	if err := c.beginCapture(ctx, tl, 0); err != nil {
+		log.ErrorContext(ctx, "timelapse process start failed", "err", err)
+		os.Remove(tmpDir)
+		return
+	}
+	c.hooks.fire(HookEvent{Event: HookStart, JobID: tl.jobID, JobName: tl.jobName, StartedAt: tl.startTime})
+
+	log.InfoContext(ctx, "timelapse started", "dir", tl.currentDir)
+}
+
+// beginCapture starts capture of tl and makes it current, mutex has to be locked.
+// Resumed timelapse keeps its start time
+func (c *timelapseSvc) beginCapture(ctx context.Context, tl *timelapse, frameStart int) error {
+	cmdCtx, cancel := context.WithCancel(ctx)
+	var cmd Process
+	if tl.mode == ModeProgress {
+		delta := cmp.Or(c.config.ProgressDelta, defaultProgressDelta) * float64(int(1)<<tl.thinned)
+		cmd = c.startProgressCapture(cmdCtx, tl.currentDir, delta, frameStart)
+	} else {
+		var err error
+		cmd, err = c.source.startCapture(cmdCtx, tl.currentDir, tl.interval, frameStart)
 		if err != nil {
-			log.WarnContext(ctx, "fail to get status", "err", err)
-			// avoiding panic
-			status = &prusalinkclient.Status{}
+			cancel()
+			return err
 		}
 	}
-	log.InfoContext(ctx, "progress noted, timelapse stared")
 
-	cmdCtx, cancel := context.WithCancel(ctx)
+	if tl.startTime.IsZero() {
+		tl.startTime = time.Now()
+	}
+	tl.timelapseStop = cancel
+	tl.timelapseCommand = cmd
+	c.tlRunning.Store(true)
+	c.timelapse = tl
+	c.current.Store(tl)
+	c.saveSession(ctx, tl)
+	go c.watchSpace(cmdCtx, tl)
+	go c.watchFrames(ctx, cmdCtx, tl)
+	go c.watchCapture(ctx, cmdCtx, tl, cmd)
+	return nil
+}
 
-	args := append(cameraOpts(),
-		"--timelapse", fmt.Sprint(c.config.Interval*1000),
-		"--timeout", "0", // runs infinetly
-		"-o", filepath.Join(tmpDir, "/image%06d.jpg"), // filepath to tmp image dir
-	)
+// StartManual starts timelapse regardless of printer state, it runs till StopManual.
+// Name is used instead of job name, it's sanitized to fit video file name
+func (c *timelapseSvc) StartManual(ctx context.Context, name string) error {
+	if !c.config.Enabled {
+		return fmt.Errorf("%w: timelapse is disabled in config", ErrNoTimelapse)
+	}
+	if tl := c.current.Load(); tl != nil {
+		return fmt.Errorf("%w: job %s", ErrTimelapseRunning, tl.jobName)
+	}
+	if err := c.lockManual(ctx); err != nil {
+		return err
+	}
+	defer c.RWMutex.Unlock()
+	if c.timelapse != nil {
+		return fmt.Errorf("%w: job %s", ErrTimelapseRunning, c.timelapse.jobName)
+	}
 
-	rpicamMutex.Lock()
-	defer rpicamMutex.Unlock()
+	name = manualName(name)
+	tmpDir, err := os.MkdirTemp(c.frameRoot(), frameDirPrefix+"0")
+	if err != nil {
+		return fmt.Errorf("fail to create tmp dir: %w", err)
+	}
+	tl := &timelapse{
+		currentDir: tmpDir,
+		jobName:    name,
+		interval:   c.captureInterval(&prusalinkclient.Status{}, nil),
+		mode:       ModeTime,
+		manual:     true,
+	}
+	if err := c.checkSpace(ctx, c.log, tmpDir, tl.interval, 0); err != nil {
+		os.Remove(tmpDir)
+		return err
+	}
+	// capture outlives request which started it
+	if err := c.beginCapture(context.WithoutCancel(ctx), tl, 0); err != nil {
+		os.Remove(tmpDir)
+		return fmt.Errorf("fail to start timelapse: %w", err)
+	}
+	c.log.InfoContext(ctx, "manual timelapse started", "name", name, "interval", tl.interval, "dir", tmpDir)
+	c.hooks.fire(HookEvent{Event: HookStart, JobName: name, Manual: true, StartedAt: tl.startTime})
+	return nil
+}
 
-	log.DebugContext(ctx, "rpicam-still timelapse args", "args", args)
-	cmd := exec.CommandContext(cmdCtx, RpiCamBinary, args...)
-	// for debug we want to save output, for other levels - dropping
-	if strings.ToLower(c.config.Loglevel) == "debug" {
-		buffer := &bytes.Buffer{}
-		cmd.Stdout = buffer
-		cmd.Stderr = buffer
-		go func() {
-			cmd.Wait()
-			log.DebugContext(ctx, "timelapse command output", "output", buffer.String())
-		}()
+// lockManual locks mutex for manual start. Printer poll holds it for a moment, so it's waited
+// for, but automatic timelapse waiting for print to start holds it long and refuses the start
+func (c *timelapseSvc) lockManual(ctx context.Context) error {
+	for !c.RWMutex.TryLock() {
+		if c.starting.Load() {
+			return fmt.Errorf("%w: automatic timelapse is starting", ErrTimelapseRunning)
+		}
+		select {
+		case <-time.After(manualLockPoll):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+	return nil
+}
 
-	err = cmd.Start()
-	if err != nil {
-		log.ErrorContext(ctx, "timelapse process start failed", "err", err)
-		cancel()
-		return
+// StopManual finishes manual timelapse and queues its video, automatic one is left to printer
+func (c *timelapseSvc) StopManual(ctx context.Context) error {
+	// mutex may be held for long only while manual timelapse isn't running
+	if tl := c.current.Load(); tl == nil || !tl.manual {
+		return ErrTimelapseNotRunning
 	}
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+	if c.timelapse == nil || !c.timelapse.manual {
+		return ErrTimelapseNotRunning
+	}
+	c.finishTimelapse(ctx)
+	return nil
+}
+
+// manualName keeps name safe for file name and shell
+func manualName(name string) string {
+	return safeName(name, defaultManualName)
+}
 
-	c.tlRunning = true
-	c.timelapse = &timelapse{
-		startTime:        time.Now(),
-		currentDir:       tmpDir,
-		jobID:            status.JobID,
-		jobName:          jobName(status),
-		timelapseStop:    cancel,
-		timelapseCommand: cmd,
+// fileJobName is job name for video file name, printed file name without gcode extension
+func fileJobName(name string) string {
+	for _, ext := range gcodeExts {
+		if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
 	}
+	return safeName(name, defaultJobName)
+}
 
-	log.InfoContext(ctx, "timelapse finished")
+// safeName keeps [A-Za-z0-9._-] of name and cuts it to maxNameLen, fallback is used
+// if nothing is left
+func safeName(name, fallback string) string {
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "_"), "._")
+	if len(name) > maxNameLen {
+		name = strings.TrimRight(name[:maxNameLen], "._")
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
 }
 
 func (c *timelapseSvc) finishTimelapse(ctx context.Context) {
+	// capture is stopped, so timelapse is over even if video can't be built
+	defer func() {
+		c.tlRunning.Store(false)
+		c.timelapse = nil
+		c.current.Store(nil)
+		c.removeSession(ctx)
+	}()
 	c.log.InfoContext(ctx, "finishing timelapse", "jobid", c.timelapse.jobID, "jobName", c.timelapse.jobName, "printTook", time.Since(c.timelapse.startTime).String())
 
 	c.timelapse.timelapseStop()
@@ -213,74 +606,373 @@ func (c *timelapseSvc) finishTimelapse(ctx context.Context) {
 		return
 	}
 
-	err = c.takeLastShot(ctx, c.timelapse.currentDir, id, count/10)
-	if err != nil {
+	if c.timelapse.lowSpace.Load() {
+		c.log.WarnContext(ctx, "last shot skipped, disk space is low")
+	} else if err := c.takeLastShot(ctx, c.timelapse.currentDir, id); err != nil {
 		c.log.WarnContext(ctx, "fail to take last shot", "err", err)
 		// we still can do a timelapse
+	} else {
+		count++
 	}
 
-	go c.buildVideo(c.timelapse, count)
-
-	c.tlRunning = false
-	c.timelapse = nil
+	job := &BuildJob{
+		Dir:             c.timelapse.currentDir,
+		JobID:           jobID,
+		JobName:         jobName,
+		Frames:          count,
+		StartedAt:       c.timelapse.startTime,
+		FinishedAt:      time.Now(),
+		IntervalSeconds: c.timelapse.interval.Seconds(),
+		Mode:            c.timelapse.mode,
+	}
+	if err := c.builds.Enqueue(job); err != nil {
+		c.log.ErrorContext(ctx, "fail to queue video build", "err", err, "dir", c.timelapse.currentDir)
+	}
+	c.hooks.fire(HookEvent{Event: HookFinish, JobID: jobID, JobName: jobName, Manual: c.timelapse.manual,
+		StartedAt: job.StartedAt, FinishedAt: job.FinishedAt, Frames: count})
 
 	c.log.InfoContext(ctx, "timelapse finished", "jobID", jobID, "jobName", jobName)
 }
 
+// getShotID parses id of shot named by shotFilename
 func getShotID(name string) (int, error) {
-	filename := filepath.Base(name)
-	var id int
-	_, err := fmt.Sscanf(filename, "image%6d.jpg", &id)
-	return id, err
+	digits, ok := strings.CutPrefix(filepath.Base(name), shotPrefix)
+	if ok {
+		digits, ok = strings.CutSuffix(digits, shotSuffix)
+	}
+	if !ok || len(digits) < shotDigits || strings.ContainsFunc(digits, func(r rune) bool { return r < '0' || r > '9' }) {
+		return 0, fmt.Errorf("not a shot name: %s", name)
+	}
+	return strconv.Atoi(digits)
+}
+
+func (c *timelapseSvc) buildVideo(ctx context.Context, job *BuildJob) error {
+	ffmpeg, err := c.ffmpegPath()
+	if err != nil {
+		return err
+	}
+	fps := c.config.videoFPS(job.Frames)
+
+	video := videoName(time.Now(), job)
+	c.encoding.Store(video, true)
+	defer c.encoding.Delete(video)
+
+	stem := filepath.Join(c.config.OutputDir, video)
+	meta, errs, err := c.encodeVideos(ctx, ffmpeg, job, fps, stem, c.config.formats(), c.config.formatTimeout())
+	if err != nil {
+		return err
+	}
+	c.hooks.fire(HookEvent{Event: HookBuildComplete, JobID: job.JobID, JobName: job.JobName,
+		StartedAt: job.StartedAt, FinishedAt: job.FinishedAt, Frames: job.Frames,
+		Video: video + "." + meta.Formats[0], Formats: meta.Formats})
+	if len(errs) > 0 {
+		// frames are needed to build the rest
+		c.log.ErrorContext(ctx, "some video formats failed, frames are left in place", "built", meta.Formats, "dir", job.Dir)
+		// rebuilding would duplicate formats already built
+		return fmt.Errorf("%w: %w", errNoRetry, errors.Join(errs...))
+	}
+
+	// video is there, so failing to keep frames doesn't fail the build
+	if err := c.keepFrames(ctx, job.Dir, video); err != nil {
+		c.log.ErrorContext(ctx, "fail to keep frames, they are left in place", "err", err, "dir", job.Dir)
+	}
+
+	files := []string{filepath.Base(videoMetaFile(stem))}
+	for _, format := range meta.Formats {
+		files = append(files, video+"."+format)
+	}
+	for _, sidecar := range []string{meta.Thumbnail, meta.FinalShot} {
+		if sidecar != "" {
+			files = append(files, filepath.Base(sidecar))
+		}
+	}
+	c.queueUpload(ctx, job, files)
+	return nil
+}
+
+func (cfg *TimelapseConfig) formatTimeout() time.Duration {
+	return cmp.Or(cfg.FormatTimeout, defaultFormatTimeout)
+}
+
+// videoFPS plays frames for VideoLenght, at least at MinFPS and at most at FPSCap
+func (cfg *TimelapseConfig) videoFPS(frames int) int {
+	fps := max(frames/cfg.VideoLenght, cfg.MinFPS)
+	if cfg.Output.FPSCap > 0 {
+		fps = min(fps, cfg.Output.FPSCap)
+	}
+	return fps
 }
 
-func (c *timelapseSvc) buildVideo(timelapse *timelapse, count int) {
-	fps := count / c.config.VideoLenght
-	fps = max(fps, c.config.MinFPS)
+// encodeVideos encodes frames of job into stem with extension of every format, then writes
+// thumbnail, beauty shot and metadata sidecar of those built. Every format is given timeout,
+// none if zero. Failed and timed out formats are returned in errs, err is returned if none
+// is built or ctx is done
+func (c *timelapseSvc) encodeVideos(ctx context.Context, ffmpeg string, job *BuildJob, fps int, stem string, formats []string, timeout time.Duration) (meta *videoMeta, errs []error, err error) {
+	meta = &videoMeta{
+		JobID:           job.JobID,
+		JobName:         job.JobName,
+		StartedAt:       job.StartedAt,
+		FinishedAt:      job.FinishedAt,
+		Frames:          job.Frames,
+		FPS:             fps,
+		IntervalSeconds: job.IntervalSeconds,
+		Mode:            job.Mode,
+		SizeBytes:       map[string]int64{},
+	}
+	if !job.StartedAt.IsZero() && !job.FinishedAt.IsZero() {
+		meta.PrintSeconds = job.FinishedAt.Sub(job.StartedAt).Seconds()
+	}
+	filters := videoFilters{
+		deflicker:  c.config.Deflicker,
+		hold:       c.config.endHold(),
+		timestamps: c.timestampsFilter(ctx, job.Dir, fps),
+	}
+	for _, format := range formats {
+		encoder, err := c.encodeFormat(ctx, ffmpeg, format, fps, job, filters, stem+"."+format, timeout)
+		if err != nil && ctx.Err() != nil {
+			return nil, nil, err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fail to build %s: %w", format, err))
+			continue
+		}
+		if format == VideoMP4 {
+			meta.Encoder = encoder
+		}
+		meta.Formats = append(meta.Formats, format)
+		if info, err := os.Stat(stem + "." + format); err == nil {
+			meta.SizeBytes[format] = info.Size()
+		}
+	}
+	if len(meta.Formats) == 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	// poster is nice to have, video is there without it
+	thumb, err := c.writeThumbnail(ctx, stem+"."+meta.Formats[0], videoDuration(job.Frames, fps))
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to create thumbnail", "err", err)
+	}
+	meta.Thumbnail = thumb
+	final, err := keepBeautyShot(job.Dir, stem)
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to keep beauty shot", "err", err)
+	}
+	meta.FinalShot = final
+	meta.BuiltAt = time.Now()
+	if err := writeVideoMeta(stem, meta); err != nil {
+		c.log.WarnContext(ctx, "fail to write video metadata", "err", err)
+	}
+	return meta, errs, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+// encodeFormat runs encodeVideo for timeout, none if zero. Partial output of timed out
+// encode is removed
+func (c *timelapseSvc) encodeFormat(ctx context.Context, ffmpeg, format string, fps int, job *BuildJob, filters videoFilters, output string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return c.encodeVideo(ctx, ffmpeg, format, fps, job, filters, output)
+	}
+	formatCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	encoder, err := c.encodeVideo(formatCtx, ffmpeg, format, fps, job, filters, output)
+	if err != nil && ctx.Err() == nil && errors.Is(formatCtx.Err(), context.DeadlineExceeded) {
+		os.Remove(output)
+		return "", fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return encoder, err
+}
+
+// encodeVideo encodes frames of job into output of format and returns encoder used.
+// Hardware encoding of mp4 falls back to libx264 if it fails
+func (c *timelapseSvc) encodeVideo(ctx context.Context, ffmpeg, format string, fps int, job *BuildJob, filters videoFilters, output string) (string, error) {
+	var encoder string
+	switch format {
+	case VideoWebM:
+		encoder = encoderVP9
+	case VideoGIF:
+		encoder = encoderGIF
+	default:
+		encoder = c.config.encoder()
+	}
+	duration := videoDuration(job.Frames, fps) + filters.hold
+	err := c.runFFmpeg(ctx, ffmpeg, ffmpegArgs(format, fps, job.Dir, output, encoder, filters, &c.config.Output), job, format, duration)
+	if err != nil && format == VideoMP4 && encoder != EncoderX264 && ctx.Err() == nil {
+		c.log.WarnContext(ctx, "hardware encoding failed, falling back to software", "encoder", encoder, "err", err)
+		os.Remove(output)
+		encoder = EncoderX264
+		err = c.runFFmpeg(ctx, ffmpeg, ffmpegArgs(format, fps, job.Dir, output, encoder, filters, &c.config.Output), job, format, duration)
+	}
+	if err != nil {
+		return "", err
+	}
+	return encoder, nil
+}
+
+// runFFmpeg runs ffmpeg writing video of format and duration, the latter is for progress only
+func (c *timelapseSvc) runFFmpeg(ctx context.Context, ffmpeg string, args []string, job *BuildJob, format string, duration time.Duration) error {
+	if c.progress != nil {
+		args = append(slices.Clone(ffmpegProgressArgs), args...)
+	}
+	c.log.DebugContext(ctx, "ffmpeg args", "binary", ffmpeg, "args", args)
+	c.log.InfoContext(ctx, "ffmpeg started", "jobname", job.JobName, "jobid", job.JobID)
+	var output []byte
+	var err error
+	if c.progress != nil {
+		output, err = newFFmpegProgress(c.progress, format, duration).run(ctx, ffmpeg, args)
+	} else {
+		output, err = Runner.Run(ctx, ffmpeg, args...)
+	}
+	if err != nil {
+		c.log.ErrorContext(ctx, "ffmpeg failed", "err", err, "output", string(output))
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	c.log.DebugContext(ctx, "ffmpeg output", "out", string(output))
+	c.log.InfoContext(ctx, "ffmpeg finished", "jobname", job.JobName, "jobid", job.JobID)
+	return nil
+}
+
+// ffmpegPath resolves ffmpeg of c.config
+func (c *timelapseSvc) ffmpegPath() (string, error) {
+	return FFmpegPath(c.config)
+}
 
-	// https://www.raspberrypi.com/documentation/computers/camera_software.html
+// FFmpegPath returns ffmpeg configured by timelapse.ffmpeg or one found in PATH
+func FFmpegPath(cfg *TimelapseConfig) (string, error) {
+	if cfg.FFmpeg != "" {
+		return cfg.FFmpeg, nil
+	}
+	ffmpeg, err := Runner.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("timelapse video needs ffmpeg, install it with 'sudo apt install ffmpeg' or set timelapse.ffmpeg: %w", err)
+	}
+	return ffmpeg, nil
+}
+
+// videoName puts timestamp to file name to sort it. Job name comes from gcode file name,
+// it's sanitized, sidecar keeps the original. Extension of format is added to it
+func videoName(at time.Time, job *BuildJob) string {
+	return fmt.Sprintf("t%d-%s-%d", at.Unix(), fileJobName(job.JobName), job.JobID)
+}
+
+// ffmpegArgs encodes frames of dir into output of format. ffmpeg is run without shell, only the
+// input pattern is interpreted, by ffmpeg glob
+// https://www.raspberrypi.com/documentation/computers/camera_software.html
+func ffmpegArgs(format string, fps int, dir, output, encoder string, filters videoFilters, out *VideoOutput) []string {
 	args := []string{
 		"-r", strconv.Itoa(fps),
 		"-f", "image2",
 		"-pattern_type", "glob",
-		"-i", fmt.Sprintf("'%s'", filepath.Join(timelapse.currentDir, "*.jpg")),
-		"-s", "'768x720'",
-		"-vcodec", "'libx264'",
-		fmt.Sprintf("'%s'",
-			filepath.Join(c.config.OutputDir,
-				// put timestamp to file name to sort it.
-				// I'm too lazy to reimplement http.FileServer
-				fmt.Sprintf("t%d-%s-%d.mp4",
-					time.Now().Unix(), timelapse.jobName, timelapse.jobID))),
-	}
-	c.log.DebugContext(ctx, "ffmpeg args", "args", args)
-	c.log.InfoContext(ctx, "ffmpeg started", "jobname", timelapse.jobName, "jobid", timelapse.jobID)
-	output, err := exec.CommandContext(ctx, "/bin/sh", "-c",
-		fmt.Sprintf("/usr/bin/ffmpeg %s", strings.Join(args, " "))).CombinedOutput()
+		"-i", filepath.Join(globEscape(dir), "*"+shotSuffix),
+	}
+	if format == VideoGIF {
+		return append(args, "-vf", filters.chain(format, fps, out), "-loop", "0", output)
+	}
+
+	args = append(args, "-vf", filters.chain(format, fps, out), "-vcodec", encoder)
+	switch {
+	case encoder == EncoderV4L2M2M:
+		// hardware encoder has no CRF
+		args = append(args, "-b:v", cmp.Or(out.Bitrate, hwBitrate))
+	case out.CRF == 0 && out.Bitrate != "":
+		args = append(args, "-b:v", out.Bitrate)
+	case encoder == encoderVP9:
+		// vp9 is constant quality only with zero bitrate
+		args = append(args, "-crf", strconv.Itoa(cmp.Or(out.CRF, vp9CRF)), "-b:v", "0", "-row-mt", "1")
+	default:
+		args = append(args, "-crf", strconv.Itoa(cmp.Or(out.CRF, x264CRF)))
+	}
+	// browsers and phones play only 4:2:0
+	return append(args, "-pix_fmt", "yuv420p", output)
+}
+
+// globEscape escapes glob(3) metacharacters of s
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (c *timelapseSvc) Status(ctx context.Context) (*TimelapseStatus, error) {
+	tl := c.current.Load()
+	if tl == nil {
+		status := &TimelapseStatus{IntervalSeconds: float64(c.config.Interval), Builds: c.builds.Status()}
+		c.spaceStatus(status, c.frameRoot())
+		return status, nil
+	}
+	status := &TimelapseStatus{
+		Running:         true,
+		Manual:          tl.manual,
+		Mode:            cmp.Or(tl.mode, ModeTime),
+		JobID:           tl.jobID,
+		JobName:         tl.jobName,
+		StartedAt:       tl.startTime,
+		Dir:             tl.currentDir,
+		IntervalSeconds: tl.interval.Seconds(),
+		CaptureStopped:  tl.lowSpace.Load() || tl.framesCapped.Load(),
+		FramesCapped:    tl.framesCapped.Load(),
+		Thinned:         tl.thinned,
+		Restarts:        int(tl.restarts.Load()),
+		Builds:          c.builds.Status(),
+	}
+	c.spaceStatus(status, tl.currentDir)
+
+	frames, err := frameFiles(tl.currentDir)
+	if err != nil {
+		return nil, err
+	}
+	status.Frames = len(frames)
+	// frame may be gone with finished timelapse
+	_, status.LastCaptureAt = frameTimes(tl.currentDir, frames)
+	return status, nil
+}
+
+// spaceStatus sets free space of dir, it's left zero if unknown
+func (c *timelapseSvc) spaceStatus(status *TimelapseStatus, dir string) {
+	free, err := freeSpace(dir)
 	if err != nil {
-		c.log.ErrorContext(ctx, "ffmpeg failed", "err", err, "output", string(output))
 		return
 	}
-	c.log.DebugContext(ctx, "ffmpeg output", "out", string(output))
-	c.log.InfoContext(ctx, "ffmpeg finished", "jobname", timelapse.jobName, "jobid", timelapse.jobID)
+	status.FreeSpaceBytes = free
+	status.LowSpace = free < c.config.minFreeSpace()
 }
 
-func (c *timelapseSvc) Status(ctx context.Context) (any, error) {
-	panic("not implemented")
+func (c *timelapseSvc) List(ctx context.Context) ([]TimelapseVideo, error) {
+	return listVideos(c.config.OutputDir)
 }
-func (c *timelapseSvc) List(ctx context.Context) ([]any, error) {
-	panic("not implemented")
+
+// isEncoding reports whether video name is being written by ffmpeg
+func (c *timelapseSvc) isEncoding(name string) bool {
+	_, ok := c.encoding.Load(trimVideoExt(name))
+	return ok
 }
 
-func (c *timelapseSvc) isTimelapseRunning() bool {
-	c.RWMutex.RLock()
-	defer c.RWMutex.RUnlock()
+// Delete removes finished video of OutputDir, video being built can't be deleted
+func (c *timelapseSvc) Delete(ctx context.Context, name string) error {
+	if c.isEncoding(name) {
+		return fmt.Errorf("%w: %s", ErrVideoBusy, name)
+	}
+	if err := deleteVideo(c.config.OutputDir, name); err != nil {
+		return err
+	}
+	c.log.InfoContext(ctx, "video deleted", "name", name)
+	return nil
+}
+
+func (c *timelapseSvc) Builds(ctx context.Context) (*BuildsStatus, error) {
+	return c.builds.Status(), nil
+}
+
+func (c *timelapseSvc) CancelBuild(ctx context.Context, id int64) error {
+	return c.builds.Cancel(id)
+}
 
-	running := c.tlRunning
-	return running
+func (c *timelapseSvc) Capturing() bool {
+	return c.tlRunning.Load()
 }
 
 func (c *timelapseSvc) LastTLShot() (string, error) {
@@ -295,20 +987,16 @@ func (c *timelapseSvc) LastTLShot() (string, error) {
 	return name, err
 }
 
+// lastTLShotInternal returns the newest shot of dir and number of shots
 func (c *timelapseSvc) lastTLShotInternal(dir string) (string, int, error) {
-	files, err := os.ReadDir(dir)
+	frames, err := frameFiles(dir)
 	if err != nil {
-		return "", 0, fmt.Errorf("fail to read timelapse dir: %w", err)
+		return "", 0, err
 	}
-
-	// searching from latest
-	for i := len(files) - 1; i >= 0; i++ {
-		if !files[i].Type().IsDir() && strings.HasSuffix(files[i].Name(), ".jpg") {
-			return filepath.Join(dir, files[i].Name()), len(files), nil
-		}
+	if len(frames) == 0 {
+		return "", 0, errors.New("no timelapse shots found")
 	}
-
-	return "", 0, errors.New("no timelapse shots found")
+	return filepath.Join(dir, frames[len(frames)-1]), len(frames), nil
 }
 
 func jobName(f *prusalinkclient.Status) string {
@@ -318,40 +1006,118 @@ func jobName(f *prusalinkclient.Status) string {
 	return strconv.Itoa(f.JobID)
 }
 
+// shots are named image<id>.jpg with id zero padded to shotDigits, like rpicam writes them
+// with shotPattern. Padding keeps name order equal to capture order for ffmpeg glob
+const (
+	shotPrefix  = "image"
+	shotSuffix  = ".jpg"
+	shotDigits  = 6
+	shotPattern = shotPrefix + "%06d" + shotSuffix
+)
+
 func shotFilename(dir string, id int) string {
-	return fmt.Sprintf("%s/image%6d.jpg", dir, id)
+	return filepath.Join(dir, fmt.Sprintf(shotPattern, id))
 }
 
-// makes last shot (with printed thing) and make several copies to keep focus at it in the end
-func (c *timelapseSvc) takeLastShot(ctx context.Context, dir string, lastID, count int) error {
+// frameFiles returns shots of dir in capture order. Names are zero padded, so ReadDir
+// order is capture order; logs, beauty shot and subdirs are skipped
+func frameFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read frame dir: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), shotSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// takeLastShot captures finished print after the last frame. Video holds it for
+// EndHoldSeconds by ffmpeg tpad, so no copies of it are needed
+func (c *timelapseSvc) takeLastShot(ctx context.Context, dir string, lastID int) error {
 	c.log.DebugContext(ctx, "lastShot started")
-	name := shotFilename(dir, lastID)
-	args := append(cameraOpts(),
-		"--immediate",
-		"-o", name,
+	if err := c.source.captureShot(ctx, shotFilename(dir, lastID+1)); err != nil {
+		return err
+	}
+	// hold is the regular frame, so video framing doesn't jump
+	if err := c.takeBeautyShot(ctx, dir); err != nil {
+		c.log.WarnContext(ctx, "beauty shot failed", "err", err)
+	}
+	c.log.DebugContext(ctx, "lastShot complete")
+	return nil
+}
+
+// rpicamSource captures with rpicam in timelapse mode, stream yields camera to it
+type rpicamSource struct {
+	*timelapseSvc
+}
+
+func (c rpicamSource) startCapture(ctx context.Context, dir string, interval time.Duration, frameStart int) (Process, error) {
+	if len(c.camConfig.Profiles) > 0 {
+		return c.startProfileCapture(ctx, dir, interval, frameStart)
+	}
+	return c.startTimelapseProcess(ctx, dir, interval, nil, frameStart)
+}
+
+// startTimelapseProcess runs rpicam in timelapse mode, frames are numbered from frameStart
+func (c rpicamSource) startTimelapseProcess(ctx context.Context, dir string, interval time.Duration, profile *CaptureProfile, frameStart int) (Process, error) {
+	args := append(c.camConfig.cameraOpts(c.rpicam, profile),
+		"--timelapse", fmt.Sprint(interval.Milliseconds()),
+		"--timeout", "0", // runs infinetly
+		"-o", filepath.Join(dir, shotPattern), // filepath to tmp image dir
 	)
+	if frameStart > 0 {
+		args = append(args, "--framestart", strconv.Itoa(frameStart))
+	}
+	if tagger := newExifTagger(c.watcher, c.camConfig); tagger != nil {
+		args = append(args, tagger.rpicamOpts()...)
+	}
 
-	rpicamMutex.Lock()
+	c.lockCamera()
 	defer rpicamMutex.Unlock()
 
-	c.log.DebugContext(ctx, "rpicam-still args", "args", args)
-	cmd := exec.CommandContext(ctx, RpiCamBinary, args...)
-	output, err := cmd.CombinedOutput()
-	c.log.DebugContext(ctx, "rpicam-still output", "output", string(output))
+	c.log.DebugContext(ctx, "rpicam timelapse args", "binary", c.rpicam.Name, "args", args)
+	// for debug we want to save output, for other levels - dropping
+	var (
+		output *bytes.Buffer
+		w      io.Writer
+	)
+	if strings.ToLower(c.config.Loglevel) == "debug" {
+		output = &bytes.Buffer{}
+		w = output
+	}
+
+	cmd, err := Runner.Start(ctx, w, c.rpicam.Path, args...)
 	if err != nil {
-		return fmt.Errorf("fail to run rpicam-still: %w", err)
+		return nil, err
+	}
+	if output != nil {
+		go func() {
+			cmd.Wait()
+			c.log.DebugContext(ctx, "timelapse command output", "output", output.String())
+		}()
 	}
+	return cmd, nil
+}
 
-	for i := lastID; i < lastID+count+1; i++ {
-		args := []string{name, shotFilename(dir, i)}
-		c.log.DebugContext(ctx, "cp args", "args", args)
-		output, err := exec.CommandContext(ctx, "cp", args...).CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("fail to cp shot: %w", err)
-		}
-		c.log.DebugContext(ctx, "cp output", "output", output)
+func (c rpicamSource) captureShot(ctx context.Context, name string) error {
+	profile := c.camConfig.profileAt(time.Now())
+	args := c.camConfig.captureOpts(c.rpicam, profile, name)
+	if c.camConfig.FocusMode == FocusLastShot {
+		args = c.camConfig.focusCaptureOpts(c.rpicam, profile, name)
 	}
 
-	c.log.DebugContext(ctx, "lastShot complete")
+	c.lockCamera()
+	defer rpicamMutex.Unlock()
+
+	c.log.DebugContext(ctx, "rpicam args", "binary", c.rpicam.Name, "args", args)
+	output, err := Runner.Run(ctx, c.rpicam.Path, args...)
+	c.log.DebugContext(ctx, "rpicam output", "output", string(output))
+	if err != nil {
+		return fmt.Errorf("fail to run %s: %w", c.rpicam.Name, err)
+	}
 	return nil
 }
@@ -0,0 +1,702 @@
+package camera
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/prusaLinkClient/prusalinktest"
+)
+
+func TestCaptureInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		adaptive  bool
+		remaining time.Duration
+		meta      *prusalinkclient.JobMeta
+		want      time.Duration
+	}{
+		{"fixed", false, time.Hour, nil, 20 * time.Second},
+		{"adaptive", true, time.Hour, nil, 30 * time.Second},
+		{"no estimate", true, 0, nil, 20 * time.Second},
+		{"almost done", true, 10 * time.Second, nil, time.Second},
+		{"gcode estimate", true, 0, &prusalinkclient.JobMeta{EstimatedTime: 2*time.Hour + time.Minute}, time.Minute},
+		{"printer estimate wins", true, time.Hour, &prusalinkclient.JobMeta{EstimatedTime: 2 * time.Hour}, 30 * time.Second},
+		{"empty meta", true, 0, &prusalinkclient.JobMeta{}, 20 * time.Second},
+		{"fixed with meta", false, 0, &prusalinkclient.JobMeta{EstimatedTime: time.Hour}, 20 * time.Second},
+	}
+	for _, tt := range tests {
+		ts := &timelapseSvc{config: &TimelapseConfig{
+			Interval:         20,
+			VideoLenght:      10,
+			MinFPS:           12,
+			AdaptiveInterval: tt.adaptive,
+		}}
+		got := ts.captureInterval(&prusalinkclient.Status{TimeRemaining: tt.remaining, TimePrinting: time.Minute}, tt.meta)
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	// 30h print would get 15m, 5m one 2.5s
+	ts := &timelapseSvc{config: &TimelapseConfig{
+		Interval: 20, VideoLenght: 10, MinFPS: 12, AdaptiveInterval: true, MinInterval: 5, MaxInterval: 300,
+	}}
+	for remaining, want := range map[time.Duration]time.Duration{30 * time.Hour: 5 * time.Minute, 5 * time.Minute: 5 * time.Second} {
+		if got := ts.captureInterval(&prusalinkclient.Status{TimeRemaining: remaining}, nil); got != want {
+			t.Errorf("%s print: expected interval clamped to %s, got %s", remaining, want, got)
+		}
+	}
+	if err := (&TimelapseConfig{MinInterval: 60, MaxInterval: 30}).validate(); err == nil {
+		t.Error("expected error for min interval above max")
+	}
+}
+
+func TestHandleTimelapse(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	runner := useFakeRunner(t)
+	printer := prusalinktest.NewFakeClient(prusalinktest.PrintScript(42, "benchy.gcode", 3)...)
+
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		Enabled:     true,
+		Interval:    20,
+		VideoLenght: 7,
+		MinFPS:      12,
+		OutputDir:   t.TempDir(),
+	}, withRpicam(), withPrinter(printer))
+
+	// idle
+	pollTimelapse(t, ts)
+	if ts.Capturing() {
+		t.Fatal("timelapse started on idle printer")
+	}
+
+	// printing
+	for i := range 3 {
+		pollTimelapse(t, ts)
+		if !ts.Capturing() {
+			t.Fatalf("poll %d: timelapse isn't running while printing", i)
+		}
+	}
+	if n := len(runner.Calls("rpicam-still")); n != 1 {
+		t.Fatalf("expected single timelapse capture, got %d rpicam runs", n)
+	}
+	shot, err := ts.LastTLShot()
+	if err != nil || filepath.Base(shot) != "image000002.jpg" {
+		t.Errorf("unexpected last shot %q: %v", shot, err)
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.JobID != 42 || status.JobName != "benchy.gcode" ||
+		status.Frames != 3 || status.IntervalSeconds != 20 || status.LastCaptureAt.IsZero() {
+		t.Errorf("unexpected running status %+v", status)
+	}
+
+	// finished
+	pollTimelapse(t, ts)
+	if ts.Capturing() {
+		t.Fatal("timelapse is still running after print finished")
+	}
+	if status, err := ts.Status(t.Context()); err != nil || status.Running || status.Frames != 0 {
+		t.Errorf("unexpected status after finish %+v, %v", status, err)
+	}
+	pending := ts.builds.Status().Pending
+	if len(pending) != 1 {
+		t.Fatalf("expected video build to be queued, got %+v", pending)
+	}
+	// 3 frames of capture and the last shot
+	if job := pending[0]; job.JobID != 42 || job.JobName != "benchy.gcode" || job.Frames != 4 {
+		t.Errorf("unexpected build job %+v", job)
+	}
+}
+
+func TestTimelapseStopGrace(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	useFakeRunner(t)
+	printing := prusalinkclient.Status{Online: true, JobID: 42, FileName: "benchy.gcode", State: prusalinkclient.StatusPrinting, Progress: 10}
+	finished := printing
+	finished.State = prusalinkclient.StatusFinished
+	printer := prusalinktest.NewFakeClient(printing)
+
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		Enabled: true, Interval: 20, VideoLenght: 7, MinFPS: 12, OutputDir: t.TempDir(), StopGrace: 100 * time.Millisecond,
+	}, withRpicam(), withPrinter(printer))
+	defer ts.closeTimelapse(t.Context())
+
+	pollTimelapse(t, ts)
+	if !ts.Capturing() {
+		t.Fatal("timelapse didn't start")
+	}
+
+	// Wi-Fi drop: errors, offline and a stray finished state between printing ones
+	for _, ev := range []struct {
+		status *prusalinkclient.Status
+		err    error
+	}{
+		{nil, errors.New("connection reset")},
+		{nil, prusalinkclient.ErrPrinterOffline},
+		{&finished, nil},
+		{nil, prusalinkclient.ErrPrinterOffline},
+		{&printing, nil},
+	} {
+		ts.handleTimelapse(t.Context(), ev.status, ev.err)
+		if !ts.Capturing() {
+			t.Fatalf("timelapse finished on %+v, %v", ev.status, ev.err)
+		}
+	}
+	// re-check of cancelled stop finds printer printing
+	time.Sleep(200 * time.Millisecond)
+	if !ts.Capturing() {
+		t.Fatal("timelapse finished after printer came back")
+	}
+
+	// print really finished, watcher sends it once and grace re-check confirms it
+	printer.Set(finished)
+	pollTimelapse(t, ts)
+	if !ts.Capturing() {
+		t.Fatal("timelapse finished before grace is over")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for ts.Capturing() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ts.Capturing() {
+		t.Fatal("timelapse didn't finish after grace")
+	}
+	if pending := ts.builds.Status().Pending; len(pending) != 1 {
+		t.Errorf("expected video build to be queued, got %+v", pending)
+	}
+}
+
+func TestManualTimelapse(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	runner := useFakeRunner(t)
+	printer := prusalinktest.NewFakeClient(prusalinktest.PrintScript(42, "benchy.gcode", 1)...)
+
+	ts := newTestTimelapse(t, &TimelapseConfig{Enabled: true, Interval: 20, VideoLenght: 7, MinFPS: 12, OutputDir: t.TempDir()}, withRpicam(), withPrinter(printer))
+
+	if err := ts.StopManual(t.Context()); !errors.Is(err, ErrTimelapseNotRunning) {
+		t.Errorf("expected ErrTimelapseNotRunning before start, got %v", err)
+	}
+	if err := ts.StartManual(t.Context(), "belt change/2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.StartManual(t.Context(), "again"); !errors.Is(err, ErrTimelapseRunning) {
+		t.Errorf("expected ErrTimelapseRunning for second start, got %v", err)
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil || !status.Running || !status.Manual || status.JobName != "belt_change_2" {
+		t.Errorf("unexpected status %+v, %v", status, err)
+	}
+
+	// idle, printing and finished printer neither restarts nor finishes it
+	for range 3 {
+		pollTimelapse(t, ts)
+		if !ts.Capturing() {
+			t.Fatal("manual timelapse finished by printer state")
+		}
+	}
+	if n := len(runner.Calls("rpicam-still")); n != 1 {
+		t.Fatalf("expected single timelapse capture, got %d rpicam runs", n)
+	}
+
+	if err := ts.StopManual(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if ts.Capturing() {
+		t.Fatal("timelapse is still running after stop")
+	}
+	pending := ts.builds.Status().Pending
+	if len(pending) != 1 || pending[0].JobName != "belt_change_2" || pending[0].JobID != 0 {
+		t.Errorf("expected manual video build to be queued, got %+v", pending)
+	}
+
+	ts.config.Enabled = false
+	if err := ts.StartManual(t.Context(), ""); !errors.Is(err, ErrNoTimelapse) {
+		t.Errorf("expected ErrNoTimelapse with timelapse disabled, got %v", err)
+	}
+}
+
+func TestManualStartDuringPoll(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	useFakeRunner(t)
+	ts := newTestTimelapse(t, &TimelapseConfig{Enabled: true, Interval: 20, OutputDir: t.TempDir()}, withRpicam(), withClose())
+
+	// printer poll holds mutex for a moment, start waits for it
+	ts.Lock()
+	time.AfterFunc(50*time.Millisecond, ts.Unlock)
+	if err := ts.StartManual(t.Context(), "poll"); err != nil {
+		t.Fatalf("start during printer poll failed: %v", err)
+	}
+	if err := ts.StopManual(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// automatic timelapse waiting for print holds it long, start is refused
+	ts.Lock()
+	ts.starting.Store(true)
+	defer ts.Unlock()
+	if err := ts.StartManual(t.Context(), "starting"); !errors.Is(err, ErrTimelapseRunning) {
+		t.Errorf("expected ErrTimelapseRunning while automatic timelapse starts, got %v", err)
+	}
+}
+
+func TestManualName(t *testing.T) {
+	tests := map[string]string{
+		"":                       "manual",
+		"first layer":            "first_layer",
+		"../../etc/passwd":       "etc_passwd",
+		"it's; rm -rf":           "it_s_rm_-rf",
+		strings.Repeat("a", 100): strings.Repeat("a", 64),
+	}
+	for name, want := range tests {
+		if got := manualName(name); got != want {
+			t.Errorf("%q: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestFileJobName(t *testing.T) {
+	tests := map[string]string{
+		"Benchy v2 (0.2mm, PLA).bgcode": "Benchy_v2_0.2mm_PLA",
+		"benchy.gcode":                  "benchy",
+		"CUBE.GCODE":                    "CUBE",
+		"a  __ b.gco":                   "a_b.gco",
+		"Ünïcode: part/2.gcode":         "n_code_part_2",
+		"../..":                         "job",
+		".gcode":                        "gcode",
+		strings.Repeat("ab ", 40):       strings.Repeat("ab_", 21) + "a",
+	}
+	for name, want := range tests {
+		if got := fileJobName(name); got != want {
+			t.Errorf("%q: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestLastTLShot(t *testing.T) {
+	dir := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()})
+	if _, _, err := ts.lastTLShotInternal(dir); err == nil {
+		t.Error("expected error for dir without shots")
+	}
+
+	for i := range 3 {
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("image%06d.jpg", i)), []byte("jpg"))
+	}
+	writeFile(t, filepath.Join(dir, "ffmpeg.log"), []byte("log"))
+	writeFile(t, filepath.Join(dir, "zz", "image000009.jpg"), []byte("jpg"))
+	if err := os.Mkdir(filepath.Join(dir, "zz.jpg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	name, count, err := ts.lastTLShotInternal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != filepath.Join(dir, "image000002.jpg") || count != 3 {
+		t.Errorf("expected newest shot image000002.jpg of 3, got %s of %d", name, count)
+	}
+}
+
+func TestShotFilename(t *testing.T) {
+	for _, id := range []int{0, 7, 999999} {
+		name := shotFilename("/tmp/timelapse42", id)
+		got, err := getShotID(name)
+		if err != nil || got != id {
+			t.Errorf("%s: expected id %d, got %d, %v", name, id, got, err)
+		}
+	}
+	if name := shotFilename("/tmp/timelapse42", 7); name != "/tmp/timelapse42/image000007.jpg" {
+		t.Errorf("unexpected shot name %s", name)
+	}
+	for _, name := range []string{"image     7.jpg", "image7.jpg", "image00000x.jpg", "ffmpeg.log", "burst0001.jpg"} {
+		if _, err := getShotID(name); err == nil {
+			t.Errorf("%s: expected parse error", name)
+		}
+	}
+}
+
+func TestTakeLastShotOrder(t *testing.T) {
+	runner := useFakeRunner(t)
+	dir := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withRpicam())
+	// rpicam names frames on its own
+	for i := range 12 {
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("image%06d.jpg", i)), []byte("captured"))
+	}
+
+	if err := ts.takeLastShot(t.Context(), dir, 11); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runner.Calls("rpicam-still")); n != 1 {
+		t.Errorf("expected single last shot, got %d", n)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 13 {
+		t.Fatalf("expected 12 captured and the final frame, got %d", len(entries))
+	}
+	// ffmpeg glob takes frames in name order
+	for i, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if captured := string(data) == "captured"; captured != (i < 12) {
+			t.Errorf("frame %d %s is out of order", i, e.Name())
+		}
+	}
+}
+
+func TestBuildVideoArgs(t *testing.T) {
+	runner := useFakeRunner(t)
+	out := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "frames [1]")
+	ts := newTestTimelapse(t, &TimelapseConfig{VideoLenght: 7, MinFPS: 12, OutputDir: out, FFmpeg: "/opt/ffmpeg/bin/ffmpeg"})
+
+	job := &BuildJob{Dir: dir, JobID: 42, JobName: "foo bar's $(reboot)/x.gcode", Frames: 10}
+	if err := ts.buildVideo(t.Context(), job); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runner.Calls("sh")); n != 0 {
+		t.Errorf("expected no shell, got %d runs", n)
+	}
+	calls := encodeCalls(runner)
+	if len(calls) != 1 {
+		t.Fatalf("expected single ffmpeg run, got %v", calls)
+	}
+	args := calls[0]
+	if i := slices.Index(args, "-i"); i < 0 || args[i+1] != filepath.Dir(dir)+`/frames \[1\]/*.jpg` {
+		t.Errorf("unexpected input pattern in %q", args)
+	}
+	output := args[len(args)-1]
+	if filepath.Dir(output) != out || !strings.HasSuffix(output, "-foo_bar_s_reboot_x-42.mp4") {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	// binary is looked up when not configured
+	ts.config.FFmpeg = ""
+	if ffmpeg, err := ts.ffmpegPath(); err != nil || ffmpeg != "/fake/bin/ffmpeg" {
+		t.Errorf("expected ffmpeg from PATH, got %q, %v", ffmpeg, err)
+	}
+}
+
+func TestBuildVideoEncoder(t *testing.T) {
+	runner := useFakeRunner(t)
+	// hardware encoder isn't there
+	runner.fail = func(name string, args []string) bool {
+		return name == "ffmpeg" && slices.Contains(args, EncoderV4L2M2M)
+	}
+	out := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{VideoLenght: 7, MinFPS: 12, OutputDir: out, Encoder: EncoderV4L2M2M})
+
+	job := &BuildJob{Dir: t.TempDir(), JobID: 42, JobName: "benchy.gcode", Frames: 10}
+	if err := ts.buildVideo(t.Context(), job); err != nil {
+		t.Fatal(err)
+	}
+	calls := encodeCalls(runner)
+	if len(calls) != 2 {
+		t.Fatalf("expected hardware and software runs, got %v", calls)
+	}
+	hw, sw := strings.Join(calls[0], " "), strings.Join(calls[1], " ")
+	if !strings.Contains(hw, "-vcodec h264_v4l2m2m -b:v 4M") || strings.Contains(hw, "-crf") {
+		t.Errorf("unexpected hardware args %q", hw)
+	}
+	if !strings.Contains(sw, "-vcodec libx264 -crf 23") {
+		t.Errorf("unexpected software args %q", sw)
+	}
+
+	metas, err := filepath.Glob(filepath.Join(out, "*.json"))
+	if err != nil || len(metas) != 1 {
+		t.Fatalf("expected single sidecar, got %v, %v", metas, err)
+	}
+	data, err := os.ReadFile(metas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta videoMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Encoder != EncoderX264 || meta.JobID != 42 || meta.FPS != 12 {
+		t.Errorf("unexpected video metadata %+v", meta)
+	}
+
+	if err := (&TimelapseConfig{Encoder: "h265"}).validate(); err == nil {
+		t.Error("expected error for unknown encoder")
+	}
+}
+
+func TestHandleTimelapseOffline(t *testing.T) {
+	useFakeRunner(t)
+	printer := prusalinktest.NewFakeClient(prusalinkclient.Status{State: prusalinkclient.StatusPrinting, Progress: 50})
+
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withPrinter(printer))
+
+	pollTimelapse(t, ts)
+	if ts.Capturing() {
+		t.Error("timelapse started for offline printer")
+	}
+}
+
+func TestStartTimelapseCaptureFails(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	useFakeRunner(t).fail = func(name string, args []string) bool { return name == "rpicam-still" }
+	printer := prusalinktest.NewFakeClient(prusalinktest.PrintScript(42, "benchy.gcode", 1)[1])
+
+	ts := newTestTimelapse(t, &TimelapseConfig{Enabled: true, Interval: 20, OutputDir: t.TempDir()}, withRpicam(), withPrinter(printer))
+
+	pollTimelapse(t, ts)
+	if ts.Capturing() {
+		t.Fatal("timelapse is running without capture process")
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) > 0 {
+		t.Errorf("frame dir is left: %v", entries)
+	}
+}
+
+func TestHandleTimelapseErrors(t *testing.T) {
+	logs := &bytes.Buffer{}
+	printer := prusalinktest.NewFakeClient()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir()}, withPrinter(printer))
+	ts.log = slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	printer.Err = fmt.Errorf("fail to get status: %w", prusalinkclient.ErrUnauthorized)
+	for range 3 {
+		pollTimelapse(t, ts)
+	}
+	if n := strings.Count(logs.String(), "level=ERROR"); n != 1 {
+		t.Errorf("auth error should be logged once, got %d times:\n%s", n, logs)
+	}
+
+	logs.Reset()
+	printer.Err = prusalinkclient.ErrPrinterOffline
+	pollTimelapse(t, ts)
+	if !strings.Contains(logs.String(), "level=DEBUG") || strings.Contains(logs.String(), "level=ERROR") {
+		t.Errorf("offline printer should be logged at debug:\n%s", logs)
+	}
+
+	// credentials fixed and broken again, reported again
+	logs.Reset()
+	printer.Err = nil
+	pollTimelapse(t, ts)
+	printer.Err = prusalinkclient.ErrUnauthorized
+	pollTimelapse(t, ts)
+	if n := strings.Count(logs.String(), "level=ERROR"); n != 1 {
+		t.Errorf("auth error should be reported after recovery, got %d times:\n%s", n, logs)
+	}
+}
+
+func TestFFmpegOutputArgs(t *testing.T) {
+	tests := []struct {
+		out  VideoOutput
+		want string
+	}{
+		{VideoOutput{}, "-vf scale='trunc(min(1920,iw)/2)*2':-2 -vcodec libx264 -crf 23 -pix_fmt yuv420p"},
+		{VideoOutput{Width: 1280}, "-vf scale=1280:-2 -vcodec libx264 -crf 23 -pix_fmt yuv420p"},
+		{VideoOutput{Height: 720, CRF: 18}, "-vf scale=-2:720 -vcodec libx264 -crf 18 -pix_fmt yuv420p"},
+		{VideoOutput{Width: 1280, Height: 720, Bitrate: "2M"}, "-vf scale=1280:720 -vcodec libx264 -b:v 2M -pix_fmt yuv420p"},
+	}
+	for _, tt := range tests {
+		args := ffmpegArgs(VideoMP4, 12, "/tmp/frames", "/out/v.mp4", EncoderX264, videoFilters{}, &tt.out)
+		if got := strings.Join(args, " "); !strings.Contains(got, tt.want+" /out/v.mp4") {
+			t.Errorf("%+v: expected %q in %q", tt.out, tt.want, got)
+		}
+	}
+	hw := strings.Join(ffmpegArgs(VideoMP4, 12, "/tmp/frames", "/out/v.mp4", EncoderV4L2M2M, videoFilters{}, &VideoOutput{CRF: 18}), " ")
+	if !strings.Contains(hw, "-vcodec h264_v4l2m2m -b:v 4M -pix_fmt yuv420p") {
+		t.Errorf("unexpected hardware args %q", hw)
+	}
+	hold := strings.Join(ffmpegArgs(VideoMP4, 12, "/tmp/frames", "/out/v.mp4", EncoderX264, videoFilters{hold: 1500 * time.Millisecond}, &VideoOutput{}), " ")
+	if !strings.Contains(hold, "-vf tpad=stop_mode=clone:stop_duration=1.5,scale='trunc(min(1920,iw)/2)*2':-2 ") {
+		t.Errorf("expected last frame held 1.5s, got %q", hold)
+	}
+	gif := strings.Join(ffmpegArgs(VideoGIF, 12, "/tmp/frames", "/out/v.gif", encoderGIF, videoFilters{hold: 2 * time.Second}, &VideoOutput{}), " ")
+	if !strings.Contains(gif, "-vf tpad=stop_mode=clone:stop_duration=2,fps=12,") {
+		t.Errorf("expected last frame held in gif, got %q", gif)
+	}
+
+	for _, out := range []VideoOutput{{Width: 1281}, {Height: -2}, {CRF: 52}, {Bitrate: "fast"}, {FPSCap: -1}} {
+		if err := out.validate(); err == nil {
+			t.Errorf("%+v: expected validation error", out)
+		}
+	}
+	if err := (&VideoOutput{Width: 2764, Height: 1552, CRF: 20, Bitrate: "800k", FPSCap: 30}).validate(); err != nil {
+		t.Errorf("unexpected validation error %v", err)
+	}
+}
+
+func TestVideoFiltersChain(t *testing.T) {
+	const draw = "sendcmd=f='/tmp/frames/timestamps.cmd',drawtext=text=' '"
+	tests := []struct {
+		name    string
+		format  string
+		filters videoFilters
+		out     VideoOutput
+		want    string
+	}{
+		{"none", VideoMP4, videoFilters{}, VideoOutput{}, "scale='trunc(min(1920,iw)/2)*2':-2"},
+		{"scale", VideoMP4, videoFilters{}, VideoOutput{Width: 1280}, "scale=1280:-2"},
+		{"scale deflicker", VideoMP4, videoFilters{deflicker: true}, VideoOutput{Width: 1280},
+			"deflicker=mode=pm:size=10,scale=1280:-2"},
+		{"all", VideoMP4, videoFilters{deflicker: true, hold: time.Second, timestamps: draw}, VideoOutput{Width: 1280},
+			"deflicker=mode=pm:size=10,tpad=stop_mode=clone:stop_duration=1,scale=1280:-2," + draw},
+		{"gif", VideoGIF, videoFilters{}, VideoOutput{},
+			"fps=12,scale='min(480,iw)':-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse"},
+		{"gif all", VideoGIF, videoFilters{deflicker: true, hold: time.Second, timestamps: draw}, VideoOutput{},
+			"deflicker=mode=pm:size=10,tpad=stop_mode=clone:stop_duration=1,fps=12,scale='min(480,iw)':-2:flags=lanczos," +
+				draw + ",split[a][b];[a]palettegen[p];[b][p]paletteuse"},
+	}
+	for _, tt := range tests {
+		if got := tt.filters.chain(tt.format, 12, &tt.out); got != tt.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestBuildVideoFPSCap(t *testing.T) {
+	runner := useFakeRunner(t)
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		VideoLenght: 7, MinFPS: 12, OutputDir: t.TempDir(), Output: VideoOutput{FPSCap: 30},
+	})
+	if err := ts.buildVideo(t.Context(), &BuildJob{Dir: t.TempDir(), JobID: 1, Frames: 7 * 60}); err != nil {
+		t.Fatal(err)
+	}
+	if args := runner.Calls("ffmpeg")[0]; args[1] != "30" {
+		t.Errorf("expected frame rate capped at 30, got %s", args[1])
+	}
+}
+
+func TestBuildVideoFormats(t *testing.T) {
+	runner := useFakeRunner(t)
+	// no vp9 in this ffmpeg
+	runner.fail = func(name string, args []string) bool {
+		return name == "ffmpeg" && slices.Contains(args, encoderVP9)
+	}
+	out := t.TempDir()
+	dir := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		VideoLenght: 7, MinFPS: 24, OutputDir: out, Formats: []string{VideoMP4, VideoWebM, VideoGIF},
+		Output: VideoOutput{Width: 1280},
+	})
+
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	job := &BuildJob{
+		Dir: dir, JobID: 42, JobName: "benchy.gcode", Frames: 10,
+		StartedAt: started, FinishedAt: started.Add(90 * time.Minute), IntervalSeconds: 20,
+	}
+	if err := ts.buildVideo(t.Context(), job); err == nil {
+		t.Fatal("expected webm failure")
+	}
+	calls := encodeCalls(runner)
+	if len(calls) != 3 {
+		t.Fatalf("expected run per format, got %v", calls)
+	}
+	var outputs []string
+	for _, args := range calls {
+		outputs = append(outputs, filepath.Ext(args[len(args)-1]))
+	}
+	if !slices.Equal(outputs, []string{".mp4", ".webm", ".gif"}) {
+		t.Errorf("unexpected outputs %v", outputs)
+	}
+	if webm := strings.Join(calls[1], " "); !strings.Contains(webm, "-vcodec libvpx-vp9 -crf 32 -b:v 0") {
+		t.Errorf("unexpected webm args %q", webm)
+	}
+	gif := strings.Join(calls[2], " ")
+	if !strings.Contains(gif, "-vf fps=15,scale='min(480,iw)':-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse -loop 0") {
+		t.Errorf("unexpected gif args %q", gif)
+	}
+	// frames are kept to build the failed format
+	if !exists(dir) {
+		t.Error("expected frames left after partial build")
+	}
+
+	metas, err := filepath.Glob(filepath.Join(out, "*.json"))
+	if err != nil || len(metas) != 1 {
+		t.Fatalf("expected single sidecar, got %v, %v", metas, err)
+	}
+	data, err := os.ReadFile(metas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta videoMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(meta.Formats, []string{VideoMP4, VideoGIF}) || meta.Encoder != EncoderX264 {
+		t.Errorf("unexpected video metadata %+v", meta)
+	}
+	if !meta.StartedAt.Equal(started) || meta.PrintSeconds != 5400 || meta.IntervalSeconds != 20 ||
+		!maps.Equal(meta.SizeBytes, map[string]int64{VideoMP4: 6, VideoGIF: 6}) {
+		t.Errorf("unexpected print details in metadata %+v", meta)
+	}
+
+	for _, formats := range [][]string{{"avi"}, {VideoGIF, VideoGIF}} {
+		if err := (&TimelapseConfig{Formats: formats}).validate(); err == nil {
+			t.Errorf("%v: expected validation error", formats)
+		}
+	}
+}
+
+func TestBuildVideoFormatTimeout(t *testing.T) {
+	runner := useFakeRunner(t)
+	// gif is the slow one
+	runner.hang = func(name string, args []string) bool {
+		return name == "ffmpeg" && strings.HasSuffix(args[len(args)-1], ".gif")
+	}
+	out := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		VideoLenght: 7, MinFPS: 12, OutputDir: out, Formats: []string{VideoMP4, VideoGIF}, FormatTimeout: 20 * time.Millisecond,
+	})
+
+	err := ts.buildVideo(t.Context(), &BuildJob{Dir: t.TempDir(), JobID: 42, JobName: "benchy.gcode", Frames: 10})
+	if !errors.Is(err, errNoRetry) || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timed out gif to fail without retry, got %v", err)
+	}
+	metas, _ := filepath.Glob(filepath.Join(out, "*.json"))
+	if len(metas) != 1 {
+		t.Fatalf("expected sidecar of mp4 built before gif timed out, got %v", metas)
+	}
+	data, err := os.ReadFile(metas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta videoMeta
+	if err := json.Unmarshal(data, &meta); err != nil || !slices.Equal(meta.Formats, []string{VideoMP4}) {
+		t.Errorf("expected mp4 built before gif timed out, got %+v, %v", meta, err)
+	}
+
+	// nothing is built, so build is retried
+	runner.hang = func(name string, args []string) bool { return name == "ffmpeg" }
+	err = ts.buildVideo(t.Context(), &BuildJob{Dir: t.TempDir(), JobID: 43, JobName: "cube.gcode", Frames: 10})
+	if err == nil || errors.Is(err, errNoRetry) {
+		t.Errorf("expected retryable timeout, got %v", err)
+	}
+}
+
+// encodeCalls returns ffmpeg runs encoding frames, thumbnails are extracted from video
+func encodeCalls(runner *fakeRunner) [][]string {
+	var calls [][]string
+	for _, args := range runner.Calls("ffmpeg") {
+		if slices.Contains(args, "-pattern_type") {
+			calls = append(calls, args)
+		}
+	}
+	return calls
+}
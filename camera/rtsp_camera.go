@@ -0,0 +1,197 @@
+package camera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+const rtspRestartMaxDelay = 30 * time.Second
+
+// rtspCamera reads RTSP camera with ffmpeg converting it to MJPEG, ffmpeg is restarted when it exits
+type rtspCamera struct {
+	log *slog.Logger
+	cfg *CameraConfig
+	*timelapseSvc
+
+	ffmpeg string
+	life   *lifecycle
+	stats  frameStats
+	// the latest frame ffmpeg gave
+	latest atomic.Pointer[Frame]
+	// replaced in tests
+	now        func() time.Time
+	retryDelay time.Duration
+}
+
+func NewRTSPCamera(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, camConfig *CameraConfig, tlConfig *TimelapseConfig) (CameraWithTL, error) {
+	if err := camConfig.validateRTSP(); err != nil {
+		return nil, err
+	}
+	ffmpeg, err := Runner.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("rtsp camera needs ffmpeg, install it with 'sudo apt install ffmpeg': %w", err)
+	}
+
+	c := &rtspCamera{
+		log:        log.With("svc", "camera"),
+		cfg:        camConfig,
+		ffmpeg:     ffmpeg,
+		life:       newLifecycle(),
+		now:        time.Now,
+		retryDelay: time.Second,
+	}
+	c.timelapseSvc = newSnapshotTimelapse(log, prusalink, watcher, c, camConfig, tlConfig)
+	c.life.goRun(func() { c.supervise(c.life.ctx) })
+	return c, nil
+}
+
+func (cfg *CameraConfig) validateRTSP() error {
+	u, err := url.Parse(cfg.RTSPURL)
+	if err != nil || (u.Scheme != "rtsp" && u.Scheme != "rtsps") {
+		return fmt.Errorf("invalid camera.rtspURL %q", cfg.RTSPURL)
+	}
+	switch cfg.RTSPTransport {
+	case "", "tcp", "udp":
+	default:
+		return fmt.Errorf("invalid camera.rtspTransport %q, tcp or udp expected", cfg.RTSPTransport)
+	}
+	return nil
+}
+
+func (c *rtspCamera) Snapshot(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	f := c.latest.Load()
+	if f == nil || c.now().Sub(f.CapturedAt) > c.cfg.maxFrameAge() {
+		return nil, fmt.Errorf("%s: %w", redactURL(c.cfg.RTSPURL), ErrCameraUnavailable)
+	}
+	return f, nil
+}
+
+func (c *rtspCamera) Stream(ctx context.Context) (chan []byte, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	return streamSnapshots(c.life.bind(ctx), c.log, c.cfg, c.Snapshot), nil
+}
+
+// Close stops ffmpeg and timelapse
+func (c *rtspCamera) Close(ctx context.Context) error {
+	if err := c.life.close(ctx); err != nil {
+		return err
+	}
+	return c.closeTimelapse(ctx)
+}
+
+func (c *rtspCamera) Info(ctx context.Context) (*Info, error) {
+	return &Info{
+		Backend: TypeRTSP,
+		Device:  redactURL(c.cfg.RTSPURL),
+		Binary:  c.ffmpeg,
+	}, nil
+}
+
+func (c *rtspCamera) Health(ctx context.Context) (*Health, error) {
+	h := &Health{
+		Backend: TypeRTSP,
+		Device:  redactURL(c.cfg.RTSPURL),
+		Binary:  c.ffmpeg,
+		Format:  "mjpeg",
+	}
+	c.stats.fill(h)
+	return h, nil
+}
+
+// ffmpegArgs converts RTSP to MJPEG frames on stdout at stream frame rate
+func (c *rtspCamera) ffmpegArgs() []string {
+	transport := c.cfg.RTSPTransport
+	if transport == "" {
+		transport = "tcp"
+	}
+	return []string{
+		"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-rtsp_transport", transport,
+		"-i", c.cfg.RTSPURL,
+		"-an",
+		"-r", fmt.Sprint(c.cfg.streamFPS()),
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"-",
+	}
+}
+
+// supervise keeps ffmpeg running, restarting it with backoff
+func (c *rtspCamera) supervise(ctx context.Context) {
+	delay := c.retryDelay
+	for ctx.Err() == nil {
+		started := c.now()
+		err := c.runFFmpeg(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if c.now().Sub(started) > rtspRestartMaxDelay {
+			// ran fine for a while, it's a new outage
+			delay = c.retryDelay
+		}
+		c.log.WarnContext(ctx, "ffmpeg stopped, restarting", "err", err, "retryIn", delay)
+		c.stats.fail(err)
+		sleepCtx(ctx, delay)
+		delay = min(delay*2, rtspRestartMaxDelay)
+	}
+}
+
+// runFFmpeg reads frames till ffmpeg exits
+func (c *rtspCamera) runFFmpeg(ctx context.Context) error {
+	args := c.ffmpegArgs()
+	c.log.DebugContext(ctx, "ffmpeg args", "args", redactArgs(args, c.cfg.RTSPURL))
+	out, proc, err := Runner.Pipe(ctx, c.ffmpeg, args...)
+	if err != nil {
+		return fmt.Errorf("fail to start ffmpeg: %w", err)
+	}
+
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 0, 1<<20), maxStreamFrameSize)
+	scanner.Split(splitJPEG)
+	for scanner.Scan() {
+		f := &Frame{
+			Data:       bytes.Clone(scanner.Bytes()),
+			Source:     SourceFresh,
+			CapturedAt: c.now(),
+		}
+		c.latest.Store(f)
+		c.stats.frame(f.CapturedAt)
+	}
+	scanErr := scanner.Err()
+	out.Close()
+	waitErr := proc.Wait()
+
+	if scanErr != nil {
+		return fmt.Errorf("fail to read ffmpeg output: %w", scanErr)
+	}
+	if waitErr != nil {
+		return fmt.Errorf("ffmpeg failed: %w", waitErr)
+	}
+	return errors.New("ffmpeg exited")
+}
+
+// redactArgs hides credentials of camera URL in logged arguments
+func redactArgs(args []string, u string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == u {
+			arg = redactURL(u)
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
@@ -0,0 +1,81 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Uploader puts objects with AWS SDK. Single PUT takes objects up to 5GB, far more
+// than timelapse video is
+type s3Uploader struct {
+	client *s3.Client
+	bucket string
+}
+
+// newS3Uploader loads AWS config, credentials come from default chain (env, shared config
+// and profile, instance role) unless AccessKey is set. Endpoint switches to path style
+// so S3 compatible storage like MinIO works
+func newS3Uploader(ctx context.Context, cfg *UploadConfig) (*s3Uploader, error) {
+	var opts []func(*config.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, config.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")))
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fail to load aws config: %w", err)
+	}
+	if awsCfg.Region == "" {
+		return nil, errors.New("s3 upload needs timelapse.upload.region or AWS_REGION")
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &s3Uploader{client: client, bucket: cfg.Bucket}, nil
+}
+
+// upload puts file to key and checks stored object has its size
+func (u *s3Uploader) upload(ctx context.Context, file, key string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("fail to open upload: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("fail to stat upload: %w", err)
+	}
+
+	_, err = u.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(u.bucket),
+		Key:           aws.String(key),
+		Body:          f,
+		ContentLength: aws.Int64(info.Size()),
+		ContentType:   aws.String("application/octet-stream"),
+	})
+	if err != nil {
+		return fmt.Errorf("fail to put %s: %w", key, err)
+	}
+
+	head, err := u.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(u.bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("fail to check %s: %w", key, err)
+	}
+	if size := aws.ToInt64(head.ContentLength); size != info.Size() {
+		return fmt.Errorf("uploaded %s has %d bytes, expected %d", key, size, info.Size())
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package camera
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// kept in OutputDir next to build queue, running timelapse survives restart
+const sessionFile = ".timelapse.json"
+
+const (
+	// running timelapse is resumed on the next start, or built then if print is over
+	ShutdownResume = "resume"
+	// running timelapse is finished and its build queued before exit
+	ShutdownFinish = "finish"
+)
+
+// timelapseSession is persisted state of running timelapse
+type timelapseSession struct {
+	JobID     int       `json:"jobId"`
+	JobName   string    `json:"jobName"`
+	Dir       string    `json:"dir"`
+	StartedAt time.Time `json:"startedAt"`
+	Manual    bool      `json:"manual,omitempty"`
+	// frames were thinned that many times
+	Thinned int `json:"thinned,omitempty"`
+	// capture was restarted that many times
+	Restarts int `json:"restarts,omitempty"`
+}
+
+func (c *timelapseSvc) sessionFile() string {
+	return filepath.Join(c.config.OutputDir, sessionFile)
+}
+
+// saveSession persists tl, failure only costs resume after restart
+func (c *timelapseSvc) saveSession(ctx context.Context, tl *timelapse) {
+	data, err := json.Marshal(&timelapseSession{
+		JobID:     tl.jobID,
+		JobName:   tl.jobName,
+		Dir:       tl.currentDir,
+		StartedAt: tl.startTime,
+		Manual:    tl.manual,
+		Thinned:   tl.thinned,
+		Restarts:  int(tl.restarts.Load()),
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, "fail to marshal timelapse session", "err", err)
+		return
+	}
+	if err := writeFileAtomic(c.sessionFile(), data); err != nil {
+		c.log.ErrorContext(ctx, "fail to save timelapse session", "err", err)
+	}
+}
+
+func (c *timelapseSvc) removeSession(ctx context.Context) {
+	if err := os.Remove(c.sessionFile()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.log.WarnContext(ctx, "fail to remove timelapse session", "err", err)
+	}
+}
+
+// loadSession returns session running at shutdown, nil if there was none or its frames are gone
+func (c *timelapseSvc) loadSession(ctx context.Context) *timelapseSession {
+	data, err := os.ReadFile(c.sessionFile())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.log.WarnContext(ctx, "fail to read timelapse session", "err", err)
+		}
+		return nil
+	}
+	var session timelapseSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		c.log.WarnContext(ctx, "fail to parse timelapse session", "err", err)
+		c.removeSession(ctx)
+		return nil
+	}
+	if _, err := os.Stat(session.Dir); err != nil {
+		c.log.WarnContext(ctx, "skipping timelapse session, frames are gone", "dir", session.Dir, "err", err)
+		c.removeSession(ctx)
+		return nil
+	}
+	return &session
+}
+
+// resumeSession continues capture of session if printer still prints its job, manual one is
+// always continued. Otherwise video is built from frames captured before restart
+func (c *timelapseSvc) resumeSession(ctx context.Context, session *timelapseSession) {
+	log := c.log.With("jobID", session.JobID, "jobName", session.JobName, "dir", session.Dir)
+	status, err := c.prusalink.JobStatus(ctx)
+	if err != nil && !session.Manual {
+		log.WarnContext(ctx, "fail to get printer status for timelapse resume", "err", err)
+	}
+
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+
+	if session.Manual || (err == nil && status.JobID == session.JobID && timelapseShouldBeRunning(status.State)) {
+		tl := &timelapse{
+			currentDir: session.Dir,
+			startTime:  session.StartedAt,
+			jobID:      session.JobID,
+			jobName:    session.JobName,
+			interval:   c.captureInterval(&prusalinkclient.Status{}, nil),
+			mode:       ModeTime,
+			manual:     session.Manual,
+			thinned:    session.Thinned,
+		}
+		if !session.Manual {
+			tl.interval = c.captureInterval(status, c.jobMeta(ctx))
+			tl.mode = c.config.mode()
+		}
+		tl.restarts.Store(int32(session.Restarts))
+		tl.interval <<= tl.thinned
+		// the last frame may be cut by restart, it's overwritten
+		frameStart := newestShot(session.Dir) + 1
+		err := c.beginCapture(ctx, tl, frameStart)
+		if err == nil {
+			log.InfoContext(ctx, "timelapse resumed", "frameStart", frameStart, "interval", tl.interval)
+			return
+		}
+		log.ErrorContext(ctx, "fail to resume timelapse", "err", err)
+	}
+
+	c.removeSession(ctx)
+	frames, err := frameFiles(session.Dir)
+	if err != nil {
+		log.WarnContext(ctx, "fail to count frames of interrupted timelapse", "err", err)
+		return
+	}
+	if len(frames) == 0 {
+		if err := os.RemoveAll(session.Dir); err != nil {
+			log.WarnContext(ctx, "fail to delete empty frame dir", "err", err)
+		}
+		return
+	}
+	err = c.builds.Enqueue(&BuildJob{
+		Dir:       session.Dir,
+		JobID:     session.JobID,
+		JobName:   session.JobName,
+		Frames:    len(frames),
+		StartedAt: session.StartedAt,
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "fail to queue video build", "err", fmt.Errorf("interrupted timelapse: %w", err))
+		return
+	}
+	log.InfoContext(ctx, "interrupted timelapse queued for build", "frames", len(frames))
+}
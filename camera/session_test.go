@@ -0,0 +1,101 @@
+package camera
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+func TestResumeSession(t *testing.T) {
+	runner := useFakeRunner(t)
+	ts, session := newSessionTimelapse(t, prusalinkclient.Status{
+		Online: true, State: prusalinkclient.StatusPrinting, JobID: 42, FileName: "benchy.gcode", Progress: 50,
+	})
+
+	ts.resumeSession(t.Context(), session)
+	if !ts.Capturing() {
+		t.Fatal("timelapse isn't resumed for the same job")
+	}
+	status, err := ts.Status(t.Context())
+	if err != nil || status.JobID != 42 || !status.StartedAt.Equal(session.StartedAt) || status.Dir != session.Dir {
+		t.Errorf("unexpected resumed status %+v, %v", status, err)
+	}
+	calls := runner.Calls("rpicam-still")
+	if len(calls) != 1 || !strings.Contains(strings.Join(calls[0], " "), "--framestart 2") {
+		t.Errorf("expected capture to continue from frame 2, got %v", calls)
+	}
+
+	// shutdown keeps session for the next start
+	if err := ts.closeTimelapse(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(ts.sessionFile()) {
+		t.Error("session removed on shutdown")
+	}
+}
+
+func TestResumeSessionFinished(t *testing.T) {
+	for _, printer := range []prusalinkclient.Status{
+		{Online: true, State: prusalinkclient.StatusFinished, JobID: 42, FileName: "benchy.gcode", Progress: 100},
+		{Online: true, State: prusalinkclient.StatusPrinting, JobID: 43, FileName: "cube.gcode", Progress: 10},
+	} {
+		useFakeRunner(t)
+		ts, session := newSessionTimelapse(t, printer)
+
+		ts.resumeSession(t.Context(), session)
+		if ts.Capturing() {
+			t.Fatalf("%s job %d: timelapse resumed", printer.State, printer.JobID)
+		}
+		pending := ts.builds.Status().Pending
+		want := []BuildJob{{ID: 1, Dir: session.Dir, JobID: 42, JobName: "benchy.gcode", Frames: 2, StartedAt: session.StartedAt, State: BuildPending}}
+		if !slices.EqualFunc(pending, want, func(a, b BuildJob) bool {
+			a.QueuedAt = time.Time{}
+			return reflect.DeepEqual(a, b)
+		}) {
+			t.Errorf("%s job %d: expected build of interrupted frames, got %+v", printer.State, printer.JobID, pending)
+		}
+		if exists(ts.sessionFile()) {
+			t.Errorf("%s job %d: session isn't removed", printer.State, printer.JobID)
+		}
+	}
+}
+
+func TestShutdownFinish(t *testing.T) {
+	useFakeRunner(t)
+	ts, session := newSessionTimelapse(t, prusalinkclient.Status{
+		Online: true, State: prusalinkclient.StatusPrinting, JobID: 42, FileName: "benchy.gcode", Progress: 50,
+	})
+	ts.config.OnShutdown = ShutdownFinish
+	ts.resumeSession(t.Context(), session)
+	if !ts.Capturing() {
+		t.Fatal("timelapse isn't resumed")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if err := ts.closeTimelapse(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ts.Capturing() {
+		t.Error("capture isn't stopped on shutdown")
+	}
+	pending := ts.builds.Status().Pending
+	if len(pending) != 1 || pending[0].Dir != session.Dir || pending[0].JobID != 42 || pending[0].FinishedAt.IsZero() {
+		t.Errorf("expected build of finished timelapse, got %+v", pending)
+	}
+	if exists(ts.sessionFile()) {
+		t.Error("session of finished timelapse is kept")
+	}
+	// queued build is done on the next start
+	restored := newBuildQueue(slog.Default(), filepath.Join(ts.config.OutputDir, buildQueueFile), 1, nil)
+	if st := restored.Status(); len(st.Pending) != 1 || st.Pending[0].Dir != session.Dir {
+		t.Errorf("build isn't persisted for the next start, got %+v", st)
+	}
+}
@@ -0,0 +1,68 @@
+package camera
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// Sharpness is variance of Laplacian of frame luma, the higher the sharper. Region "x,y,w,h"
+// in frame fractions limits it, e.g. to the center where the print is, whole frame if empty
+func Sharpness(data []byte, region string) (float64, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("fail to decode jpeg frame: %w", err)
+	}
+	rect := img.Bounds()
+	if region != "" {
+		r, err := parseRegion("focus region", region)
+		if err != nil {
+			return 0, err
+		}
+		w, h := float64(rect.Dx()), float64(rect.Dy())
+		rect = image.Rect(
+			rect.Min.X+int(r[0]*w), rect.Min.Y+int(r[1]*h),
+			rect.Min.X+int((r[0]+r[2])*w), rect.Min.Y+int((r[1]+r[3])*h),
+		)
+	}
+	return laplacianVariance(img, rect), nil
+}
+
+// laplacianVariance runs 4-neighbour Laplacian over rect, border pixels have no neighbours
+func laplacianVariance(img image.Image, rect image.Rectangle) float64 {
+	w, h := rect.Dx(), rect.Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+	luma := make([]int32, w*h)
+	for y := range h {
+		for x := range w {
+			luma[y*w+x] = int32(lumaAt(img, rect.Min.X+x, rect.Min.Y+y))
+		}
+	}
+
+	var sum, sumSq float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			l := float64(4*luma[i] - luma[i-1] - luma[i+1] - luma[i-w] - luma[i+w])
+			sum += l
+			sumSq += l * l
+		}
+	}
+	n := float64((w - 2) * (h - 2))
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
+
+func lumaAt(img image.Image, x, y int) uint8 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return img.Y[img.YOffset(x, y)]
+	case *image.Gray:
+		return img.Pix[img.PixOffset(x, y)]
+	}
+	return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+}
@@ -0,0 +1,89 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// checkerFrame is 256x192 jpeg with 8px checkerboard in columns below width, gray elsewhere.
+// Board is box blurred with given radius
+func checkerFrame(t *testing.T, width, blur int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 256, 192))
+	for y := range 192 {
+		for x := range 256 {
+			l := byte(0x80)
+			if x < width {
+				l = 0x20
+				if (x/8+y/8)%2 == 0 {
+					l = 0xe0
+				}
+			}
+			img.Pix[img.PixOffset(x, y)] = l
+		}
+	}
+	if blur > 0 {
+		src := image.NewGray(img.Rect)
+		copy(src.Pix, img.Pix)
+		for y := range 192 {
+			for x := range 256 {
+				sum, n := 0, 0
+				for dy := -blur; dy <= blur; dy++ {
+					for dx := -blur; dx <= blur; dx++ {
+						if p := (image.Point{x + dx, y + dy}); p.In(src.Rect) {
+							sum += int(src.Pix[src.PixOffset(p.X, p.Y)])
+							n++
+						}
+					}
+				}
+				img.Pix[img.PixOffset(x, y)] = byte(sum / n)
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sharpness(t *testing.T, data []byte, region string) float64 {
+	t.Helper()
+	s, err := Sharpness(data, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSharpness(t *testing.T) {
+	sharp := sharpness(t, checkerFrame(t, 256, 0), "")
+	blurred := sharpness(t, checkerFrame(t, 256, 2), "")
+	flat := sharpness(t, checkerFrame(t, 0, 0), "")
+	if sharp <= 2*blurred {
+		t.Errorf("expected sharp frame scored well above blurred one, got %v and %v", sharp, blurred)
+	}
+	if blurred <= flat || flat > 1 {
+		t.Errorf("expected blurred frame scored above flat one, got %v and %v", blurred, flat)
+	}
+
+	if _, err := Sharpness([]byte("not jpeg"), ""); err == nil {
+		t.Error("expected error for broken frame")
+	}
+}
+
+func TestSharpnessRegion(t *testing.T) {
+	// board is in the left half only
+	frame := checkerFrame(t, 128, 0)
+	left := sharpness(t, frame, "0,0,0.5,1")
+	right := sharpness(t, frame, "0.5,0,0.5,1")
+	if right > 1 || left <= 100*right {
+		t.Errorf("expected sharpness of left half only, got left %v and right %v", left, right)
+	}
+
+	if _, err := Sharpness(frame, "0.5,0,0.6,1"); err == nil {
+		t.Error("expected error for region out of frame")
+	}
+}
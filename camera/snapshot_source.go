@@ -0,0 +1,125 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// snapshotSource captures timelapse frames with snapshots of camera that has no timelapse mode
+type snapshotSource struct {
+	log *slog.Logger
+	cam Camera
+	// nil if frames aren't tagged
+	exif *exifTagger
+}
+
+// newSnapshotTimelapse creates timelapse capturing cam snapshots
+func newSnapshotTimelapse(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, cam Camera, camConfig *CameraConfig, config *TimelapseConfig) *timelapseSvc {
+	ts := &timelapseSvc{
+		log:       log.With("svc", "timelapse"),
+		prusalink: prusalink,
+		watcher:   watcher,
+		camConfig: camConfig,
+		config:    config,
+	}
+	ts.source = &snapshotSource{log: ts.log, cam: cam, exif: newExifTagger(watcher, camConfig)}
+	ts.start(log)
+	return ts
+}
+
+// snapshotTimelapseCamera adds timelapse of snapshots to camera which doesn't capture it itself
+type snapshotTimelapseCamera struct {
+	Camera
+	*timelapseSvc
+}
+
+func withSnapshotTimelapse(log *slog.Logger, prusalink prusalinkclient.Client, watcher prusalinkclient.Watcher, cam Camera, camConfig *CameraConfig, config *TimelapseConfig) *snapshotTimelapseCamera {
+	return &snapshotTimelapseCamera{
+		Camera:       cam,
+		timelapseSvc: newSnapshotTimelapse(log, prusalink, watcher, cam, camConfig, config),
+	}
+}
+
+// Close stops timelapse before camera, capture loop takes its snapshots
+func (c *snapshotTimelapseCamera) Close(ctx context.Context) error {
+	if err := c.closeTimelapse(ctx); err != nil {
+		return err
+	}
+	return c.Camera.Close(ctx)
+}
+
+// Controls forwards to wrapped camera, embedded Camera hides its other capabilities
+func (c *snapshotTimelapseCamera) Controls(ctx context.Context) ([]Control, error) {
+	controller, ok := c.Camera.(Controller)
+	if !ok {
+		return nil, ErrNoControls
+	}
+	return controller.Controls(ctx)
+}
+
+func (c *snapshotTimelapseCamera) Burst(ctx context.Context, n int, interval time.Duration) ([]*Frame, error) {
+	burster, ok := c.Camera.(Burster)
+	if !ok {
+		return nil, ErrNoBurst
+	}
+	return burster.Burst(ctx, n, interval)
+}
+
+func (s *snapshotSource) startCapture(ctx context.Context, dir string, interval time.Duration, frameStart int) (Process, error) {
+	p := &snapshotProcess{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for id := frameStart; ; id++ {
+			// camera going away skips frames, timelapse goes on
+			if err := s.captureShot(ctx, shotFilename(dir, id)); err != nil && ctx.Err() == nil {
+				s.log.WarnContext(ctx, "fail to capture timelapse frame", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return p, nil
+}
+
+func (s *snapshotSource) captureShot(ctx context.Context, name string) error {
+	frame, err := s.cam.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("fail to take snapshot: %w", err)
+	}
+	data := frame.Data
+	if s.exif != nil {
+		if data, err = s.exif.tag(frame.Data, frame.CapturedAt); err != nil {
+			s.log.WarnContext(ctx, "fail to tag timelapse frame", "err", err)
+			data = frame.Data
+		}
+	}
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		return fmt.Errorf("fail to write shot: %w", err)
+	}
+	return nil
+}
+
+// snapshotProcess is capture loop of snapshotSource
+type snapshotProcess struct {
+	done chan struct{}
+}
+
+func (p *snapshotProcess) Wait() error {
+	<-p.done
+	return nil
+}
+
+func (p *snapshotProcess) Signal(sig os.Signal) error {
+	return errors.New("capture loop doesn't take signals")
+}
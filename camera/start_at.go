@@ -0,0 +1,83 @@
+package camera
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+const (
+	// capture starts as soon as printer prints, calibration moves are recorded
+	StartImmediately = "immediately"
+	// capture starts once print progress moves, calibration is skipped
+	StartProgress = "progress"
+
+	defaultStartTimeout = 30 * time.Minute
+)
+
+// startPollInterval is how often printer is asked while timelapse waits for StartAt
+var startPollInterval = 15 * time.Second
+
+func validateStartAt(startAt string) error {
+	switch startAt {
+	case "", StartImmediately, StartProgress:
+		return nil
+	}
+	if percent, err := strconv.ParseFloat(startAt, 64); err != nil || percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid timelapse.startAt %q, expected %s, %s or percent of progress",
+			startAt, StartImmediately, StartProgress)
+	}
+	return nil
+}
+
+// startReached reports whether print at progress meets StartAt, it's expected to be valid
+func (cfg *TimelapseConfig) startReached(progress float64) bool {
+	switch cfg.StartAt {
+	case StartImmediately:
+		return true
+	case "", StartProgress:
+		return progress > 0
+	}
+	percent, _ := strconv.ParseFloat(cfg.StartAt, 64)
+	return progress >= percent
+}
+
+// waitForStart polls printer till its job meets StartAt and returns the last status.
+// It gives up if job is stopped or replaced meanwhile, or ctx is done. After StartTimeout
+// printing job is captured anyway, while other states, like ATTENTION waiting for user, give up
+func (c *timelapseSvc) waitForStart(ctx context.Context, log *slog.Logger, status *prusalinkclient.Status) (*prusalinkclient.Status, bool) {
+	timeout := time.NewTimer(cmp.Or(c.config.StartTimeout, defaultStartTimeout))
+	defer timeout.Stop()
+	for !c.config.startReached(status.Progress) {
+		select {
+		case <-time.After(startPollInterval):
+		case <-timeout.C:
+			if status.State == prusalinkclient.StatusPrinting {
+				log.WarnContext(ctx, "start condition isn't met in time, timelapse starts anyway",
+					"startAt", c.config.StartAt, "progress", status.Progress)
+				return status, true
+			}
+			log.WarnContext(ctx, "job didn't start in time, timelapse skipped", "state", status.State)
+			return nil, false
+		case <-ctx.Done():
+			log.WarnContext(ctx, "context cancelled")
+			return nil, false
+		}
+		st, err := c.prusalink.JobStatus(ctx)
+		if err != nil {
+			log.WarnContext(ctx, "fail to get status", "err", err)
+			continue
+		}
+		if timelapseShouldStop(st.State) || st.JobID != status.JobID {
+			log.InfoContext(ctx, "job ended before timelapse start", "state", st.State, "jobID", st.JobID)
+			return nil, false
+		}
+		status = st
+	}
+	return status, true
+}
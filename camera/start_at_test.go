@@ -0,0 +1,85 @@
+package camera
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+func printingAt(progress float64) prusalinkclient.Status {
+	return prusalinkclient.Status{Online: true, State: prusalinkclient.StatusPrinting, JobID: 42, FileName: "benchy.gcode", Progress: progress}
+}
+
+func TestStartAt(t *testing.T) {
+	tests := []struct {
+		startAt string
+		polls   int
+	}{
+		{StartImmediately, 0},
+		{"", 1},
+		{StartProgress, 1},
+		{"5", 3},
+	}
+	for _, tt := range tests {
+		ts, printer := newStartTimelapse(t, tt.startAt, printingAt(1), printingAt(3), printingAt(6))
+		status := printingAt(0)
+		ts.handleTimelapse(t.Context(), &status, nil)
+		if !ts.Capturing() {
+			t.Fatalf("%q: timelapse isn't started", tt.startAt)
+		}
+		if n := printer.Calls(); n != tt.polls {
+			t.Errorf("%q: expected start after %d polls, got %d", tt.startAt, tt.polls, n)
+		}
+	}
+
+	for _, startAt := range []string{"x", "-1", "101"} {
+		if err := validateStartAt(startAt); err == nil {
+			t.Errorf("%q: expected validation error", startAt)
+		}
+	}
+}
+
+func TestStartAtGivesUp(t *testing.T) {
+	attention := printingAt(0)
+	attention.State = prusalinkclient.StatusAttention
+	stopped := printingAt(0)
+	stopped.State = prusalinkclient.StatusStopped
+	next := printingAt(0)
+	next.JobID = 43
+
+	tests := []struct {
+		name  string
+		steps []prusalinkclient.Status
+		start bool
+	}{
+		{"stopped", []prusalinkclient.Status{printingAt(0), stopped}, false},
+		{"replaced", []prusalinkclient.Status{printingAt(0), next}, false},
+		{"stuck attention", []prusalinkclient.Status{attention}, false},
+		{"slow print", []prusalinkclient.Status{printingAt(0)}, true},
+	}
+	for _, tt := range tests {
+		ts, _ := newStartTimelapse(t, StartProgress, tt.steps...)
+		ts.config.StartTimeout = 20 * time.Millisecond
+		status := tt.steps[0]
+		ts.handleTimelapse(t.Context(), &status, nil)
+		if ts.Capturing() != tt.start {
+			t.Errorf("%s: expected capturing %t", tt.name, tt.start)
+		}
+		if entries, _ := os.ReadDir(ts.workDir); !tt.start && len(entries) > 0 {
+			t.Errorf("%s: frame dir is left", tt.name)
+		}
+	}
+
+	// shutdown while waiting
+	ts, _ := newStartTimelapse(t, StartProgress, printingAt(0))
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	status := printingAt(0)
+	ts.handleTimelapse(ctx, &status, nil)
+	if ts.Capturing() {
+		t.Error("timelapse started after shutdown")
+	}
+}
@@ -0,0 +1,125 @@
+package camera
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultStreamFPS = 5
+	// more than software jpeg encoding on Pi sustains anyway
+	maxStreamFPS = 30
+	// how often effective frame rate is logged
+	fpsLogInterval = time.Minute
+)
+
+// streamFPS is configured stream frame rate within sane bounds
+func (cfg *CameraConfig) streamFPS() float64 {
+	if cfg.StreamFPS <= 0 {
+		return defaultStreamFPS
+	}
+	return min(cfg.StreamFPS, maxStreamFPS)
+}
+
+// streamInterval is delay between stream frames
+func (cfg *CameraConfig) streamInterval() time.Duration {
+	return time.Duration(float64(time.Second) / cfg.streamFPS())
+}
+
+// fpsMeter counts sent and dropped stream frames and logs effective rate periodically
+type fpsMeter struct {
+	log     *slog.Logger
+	target  float64
+	start   time.Time
+	sent    int
+	dropped int
+	// replaced in tests
+	now func() time.Time
+}
+
+func newFPSMeter(log *slog.Logger, target float64) *fpsMeter {
+	return &fpsMeter{
+		log:    log,
+		target: target,
+		start:  time.Now(),
+		now:    time.Now,
+	}
+}
+
+// frame notes frame sent to client or dropped because client or encoder is behind
+func (m *fpsMeter) frame(ctx context.Context, sent bool) {
+	if sent {
+		m.sent++
+	} else {
+		m.dropped++
+	}
+
+	elapsed := m.now().Sub(m.start)
+	if elapsed < fpsLogInterval {
+		return
+	}
+	m.log.DebugContext(ctx, "stream rate", "fps", float64(m.sent)/elapsed.Seconds(), "target", m.target, "dropped", m.dropped)
+	m.start = m.now()
+	m.sent, m.dropped = 0, 0
+}
+
+// streamSnapshots sends snapshot frames at configured rate for backends with frame
+// source of their own. Repeated frame isn't sent twice, frames are dropped if client doesn't keep up
+func streamSnapshots(ctx context.Context, log *slog.Logger, cfg *CameraConfig, snapshot func(context.Context) (*Frame, error)) chan []byte {
+	stream := make(chan []byte, 1)
+
+	var badge CaptureSource
+	if cfg.SourceBadge {
+		badge = SourceFresh
+	}
+
+	go func() {
+		defer close(stream)
+		ticker := time.NewTicker(cfg.streamInterval())
+		defer ticker.Stop()
+		meter := newFPSMeter(log, cfg.streamFPS())
+
+		var last *Frame
+		for {
+			frame, err := snapshot(ctx)
+			switch {
+			case err != nil:
+				if ctx.Err() == nil {
+					log.DebugContext(ctx, "fail to get stream frame", "err", err)
+				}
+			case frame == last:
+				// source gave no new frame yet
+			default:
+				last = frame
+				sendBadged(ctx, log, stream, frame.Data, badge, meter)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return stream
+}
+
+// sendBadged draws badge unless it's empty and drops frame if client doesn't keep up
+func sendBadged(ctx context.Context, log *slog.Logger, stream chan<- []byte, data []byte, badge CaptureSource, meter *fpsMeter) {
+	if badge != "" {
+		badged, err := passJPEG(data, badge)
+		if err != nil {
+			log.WarnContext(ctx, "fail to draw badge", "err", err)
+			return
+		}
+		data = badged
+	}
+	select {
+	case stream <- data:
+		meter.frame(ctx, true)
+	default:
+		meter.frame(ctx, false)
+	}
+}
@@ -0,0 +1,63 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamFPS(t *testing.T) {
+	tests := []struct {
+		fps      float64
+		want     float64
+		interval time.Duration
+	}{
+		{0, defaultStreamFPS, 200 * time.Millisecond},
+		{0.5, 0.5, 2 * time.Second},
+		{10, 10, 100 * time.Millisecond},
+		{120, maxStreamFPS, time.Second / maxStreamFPS},
+	}
+	for _, tt := range tests {
+		cfg := &CameraConfig{StreamFPS: tt.fps}
+		if got := cfg.streamFPS(); got != tt.want {
+			t.Errorf("streamFPS(%v) = %v, want %v", tt.fps, got, tt.want)
+		}
+		if got := cfg.streamInterval(); got != tt.interval {
+			t.Errorf("streamInterval(%v) = %v, want %v", tt.fps, got, tt.interval)
+		}
+	}
+
+	if err := (&CameraConfig{StreamFPS: -1}).Validate(); err == nil {
+		t.Error("negative fps is accepted")
+	}
+}
+
+func TestFPSMeter(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := newFPSMeter(log, 5)
+	m.start = now
+	m.now = func() time.Time { return now }
+
+	for range 119 {
+		m.frame(context.Background(), true)
+	}
+	m.frame(context.Background(), false)
+	if buf.Len() != 0 {
+		t.Fatalf("logged before interval: %s", buf.String())
+	}
+
+	now = now.Add(fpsLogInterval)
+	m.frame(context.Background(), true)
+	if !strings.Contains(buf.String(), "fps=2 ") || !strings.Contains(buf.String(), "dropped=1") {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+	if m.sent != 0 || m.dropped != 0 {
+		t.Errorf("counters aren't reset: sent %d, dropped %d", m.sent, m.dropped)
+	}
+}
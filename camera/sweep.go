@@ -0,0 +1,273 @@
+package camera
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// frame directories are created with os.MkdirTemp(frameRoot(), "timelapse<jobID>")
+	frameDirPrefix = "timelapse"
+	quarantineDir  = ".quarantine"
+
+	OrphansRebuild = "rebuild"
+	OrphansDelete  = "delete"
+
+	PartialQuarantine = "quarantine"
+	PartialDelete     = "delete"
+)
+
+// sweep handles leftovers of crashed runs: orphaned frame dirs and partial videos.
+// Frames of session are left to resume, frames of failed builds are left to user.
+// Should be run before build worker is started
+func (c *timelapseSvc) sweep(ctx context.Context, tmpDir string, session *timelapseSession) {
+	referenced := map[string]bool{}
+	st := c.builds.Status()
+	for _, job := range st.Pending {
+		referenced[filepath.Clean(job.Dir)] = true
+	}
+	if session != nil {
+		referenced[filepath.Clean(session.Dir)] = true
+	}
+
+	dirs, err := orphanFrameDirs(tmpDir, referenced)
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to search orphaned frame dirs", "err", err)
+	}
+	handled := map[string]int{}
+	var size int64
+	for _, dir := range dirs {
+		if job := failedBuild(dir); job != nil {
+			c.log.WarnContext(ctx, "frames of failed build are kept, build them with prusacam timelapse build or remove them",
+				"dir", dir, "jobID", job.JobID, "jobName", job.JobName, "err", job.Error)
+			handled[BuildFailed]++
+			continue
+		}
+		dirSize := frameDirSize(dir)
+		if action := c.handleOrphanDir(ctx, dir); action != "" {
+			handled[action]++
+			size += dirSize
+		}
+	}
+	if len(dirs) > 0 {
+		c.log.InfoContext(ctx, "orphaned frame dirs handled", "found", len(dirs), "queued", handled[OrphansRebuild],
+			"deleted", handled[OrphansDelete], "mb", size>>20, "failed", handled[BuildFailed])
+	}
+
+	videos, err := partialVideos(c.config.OutputDir)
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to search partial videos", "err", err)
+	}
+	for _, video := range videos {
+		c.handlePartialVideo(ctx, video)
+	}
+}
+
+// handleOrphanDir deletes dir or queues its salvage build, which removes it once video is built.
+// It returns OrphansDelete or OrphansRebuild for what is done, empty if it failed
+func (c *timelapseSvc) handleOrphanDir(ctx context.Context, dir string) string {
+	if c.config.OrphanFrames == OrphansDelete {
+		if err := os.RemoveAll(dir); err != nil {
+			c.log.WarnContext(ctx, "fail to delete orphaned frame dir", "dir", dir, "err", err)
+			return ""
+		}
+		c.log.InfoContext(ctx, "orphaned frame dir deleted", "dir", dir)
+		return OrphansDelete
+	}
+
+	frames, err := frameFiles(dir)
+	if err != nil {
+		c.log.WarnContext(ctx, "fail to count orphaned frames", "dir", dir, "err", err)
+		return ""
+	}
+	if len(frames) == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			c.log.WarnContext(ctx, "fail to delete empty frame dir", "dir", dir, "err", err)
+			return ""
+		}
+		c.log.InfoContext(ctx, "empty frame dir deleted", "dir", dir)
+		return OrphansDelete
+	}
+
+	job := &BuildJob{
+		Dir:     dir,
+		JobName: filepath.Base(dir),
+		Frames:  len(frames),
+	}
+	// session with real times is gone
+	job.StartedAt, job.FinishedAt = frameTimes(dir, frames)
+	if err := c.builds.Enqueue(job); err != nil {
+		c.log.WarnContext(ctx, "fail to queue orphaned frame dir", "dir", dir, "err", err)
+		return ""
+	}
+	c.log.InfoContext(ctx, "orphaned frame dir queued for rebuild", "dir", dir, "frames", len(frames))
+	return OrphansRebuild
+}
+
+// frameDirSize sums sizes of files in dir, frame dirs are flat
+func frameDirSize(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !e.IsDir() {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func (c *timelapseSvc) handlePartialVideo(ctx context.Context, video string) {
+	if c.config.PartialOutputs == PartialDelete {
+		if err := os.Remove(video); err != nil {
+			c.log.WarnContext(ctx, "fail to delete partial video", "file", video, "err", err)
+			return
+		}
+		c.log.InfoContext(ctx, "partial video deleted", "file", video)
+		return
+	}
+
+	dir := filepath.Join(c.config.OutputDir, quarantineDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		c.log.WarnContext(ctx, "fail to create quarantine dir", "dir", dir, "err", err)
+		return
+	}
+	dst := filepath.Join(dir, filepath.Base(video))
+	if err := os.Rename(video, dst); err != nil {
+		c.log.WarnContext(ctx, "fail to quarantine partial video", "file", video, "err", err)
+		return
+	}
+	c.log.InfoContext(ctx, "partial video quarantined", "file", video, "to", dst)
+}
+
+// orphanFrameDirs returns frame dirs in tmpDir which are not referenced by build queue
+func orphanFrameDirs(tmpDir string, referenced map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read tmp dir: %w", err)
+	}
+
+	var dirs []string
+	for _, e := range entries {
+		if !e.IsDir() || !isFrameDirName(e.Name()) {
+			continue
+		}
+		dir := filepath.Join(tmpDir, e.Name())
+		if referenced[dir] {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// "timelapse" + job id + MkdirTemp random digits
+func isFrameDirName(name string) bool {
+	suffix, ok := strings.CutPrefix(name, frameDirPrefix)
+	if !ok || suffix == "" {
+		return false
+	}
+	for _, r := range suffix {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// frameTimes returns modification times of the first and the last of frames of dir,
+// they are written when captured. Times are zero if frames can't be read
+func frameTimes(dir string, frames []string) (first, last time.Time) {
+	if len(frames) == 0 {
+		return first, last
+	}
+	if info, err := os.Stat(filepath.Join(dir, frames[0])); err == nil {
+		first = info.ModTime()
+	}
+	if info, err := os.Stat(filepath.Join(dir, frames[len(frames)-1])); err == nil {
+		last = info.ModTime()
+	}
+	return first, last
+}
+
+// partialVideos returns interrupted ffmpeg outputs: *.tmp files, moov-less mp4s and empty videos
+func partialVideos(outputDir string) ([]string, error) {
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read output dir: %w", err)
+	}
+
+	var videos []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := filepath.Join(outputDir, e.Name())
+		format, ok := videoFormat(e.Name())
+		switch {
+		case strings.HasSuffix(e.Name(), ".tmp") && isVideo(strings.TrimSuffix(e.Name(), ".tmp")):
+			videos = append(videos, name)
+		case format == VideoMP4:
+			ok, err := hasMoovAtom(name)
+			if err != nil || !ok {
+				videos = append(videos, name)
+			}
+		case ok:
+			// webm and gif have no index to check, but interrupted ones may be empty
+			if info, err := e.Info(); err == nil && info.Size() == 0 {
+				videos = append(videos, name)
+			}
+		}
+	}
+	return videos, nil
+}
+
+// hasMoovAtom walks top level mp4 boxes. ffmpeg writes moov at the end, so
+// interrupted runs leave files without it
+func hasMoovAtom(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	var offset int64
+	for {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		if string(header[4:8]) == "moov" {
+			return true, nil
+		}
+
+		switch size {
+		case 0:
+			// box extends to the end of file
+			return false, nil
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return false, nil
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 {
+			return false, nil
+		}
+		offset += size
+	}
+}
@@ -0,0 +1,183 @@
+package camera
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mp4Box builds top level mp4 box with zero payload
+func mp4Box(typ string, payload int) []byte {
+	box := make([]byte, 8+payload)
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	copy(box[4:], typ)
+	return box
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func TestSweep(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	complete := append(mp4Box("ftyp", 16), mp4Box("mdat", 64)...)
+	complete = append(complete, mp4Box("moov", 32)...)
+	truncated := append(mp4Box("ftyp", 16), mp4Box("mdat", 64)...)
+
+	writeFile(t, filepath.Join(tmpDir, "timelapse421234567", "image000000.jpg"), []byte("jpg"))
+	writeFile(t, filepath.Join(tmpDir, "timelapse421234567", "image000001.jpg"), []byte("jpg"))
+	writeFile(t, filepath.Join(tmpDir, "timelapse43999", "ffmpeg.log"), []byte("log"))
+	writeFile(t, filepath.Join(tmpDir, "timelapse44111", "image000000.jpg"), []byte("jpg"))
+	writeFile(t, filepath.Join(tmpDir, "timelapsefoo", "image000000.jpg"), []byte("jpg"))
+	writeFile(t, filepath.Join(outputDir, "t1-complete-1.mp4"), complete)
+	writeFile(t, filepath.Join(outputDir, "t2-truncated-2.mp4"), truncated)
+	writeFile(t, filepath.Join(outputDir, "t3-empty-3.mp4"), nil)
+	writeFile(t, filepath.Join(outputDir, "t4-tmp-4.mp4.tmp"), complete)
+
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: outputDir})
+	// referenced by resumed queue, must be left alone
+	referenced := filepath.Join(tmpDir, "timelapse44111")
+	if err := ts.builds.Enqueue(&BuildJob{Dir: referenced}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.sweep(t.Context(), tmpDir, nil)
+
+	st := ts.builds.Status()
+	if len(st.Pending) != 2 {
+		t.Fatalf("expected orphan to be queued, got %+v", st.Pending)
+	}
+	rebuild := st.Pending[1]
+	if rebuild.Dir != filepath.Join(tmpDir, "timelapse421234567") || rebuild.Frames != 2 {
+		t.Errorf("unexpected rebuild job %+v", rebuild)
+	}
+	if exists(filepath.Join(tmpDir, "timelapse43999")) {
+		t.Error("empty frame dir should be deleted")
+	}
+	if !exists(referenced) || !exists(filepath.Join(tmpDir, "timelapsefoo")) {
+		t.Error("foreign and referenced dirs should be kept")
+	}
+
+	if !exists(filepath.Join(outputDir, "t1-complete-1.mp4")) {
+		t.Error("complete video should be kept")
+	}
+	for _, name := range []string{"t2-truncated-2.mp4", "t3-empty-3.mp4", "t4-tmp-4.mp4.tmp"} {
+		if exists(filepath.Join(outputDir, name)) {
+			t.Errorf("%s should be moved", name)
+		}
+		if !exists(filepath.Join(outputDir, quarantineDir, name)) {
+			t.Errorf("%s should be quarantined", name)
+		}
+	}
+}
+
+func TestSweepDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	writeFile(t, filepath.Join(tmpDir, "timelapse421234567", "image000000.jpg"), []byte("jpg"))
+	writeFile(t, filepath.Join(outputDir, "t3-empty-3.mp4"), nil)
+
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		OutputDir:      outputDir,
+		OrphanFrames:   OrphansDelete,
+		PartialOutputs: PartialDelete,
+	})
+	ts.sweep(t.Context(), tmpDir, nil)
+
+	if len(ts.builds.Status().Pending) != 0 {
+		t.Error("nothing should be queued")
+	}
+	if exists(filepath.Join(tmpDir, "timelapse421234567")) {
+		t.Error("orphan dir should be deleted")
+	}
+	if exists(filepath.Join(outputDir, "t3-empty-3.mp4")) || exists(filepath.Join(outputDir, quarantineDir)) {
+		t.Error("partial video should be deleted")
+	}
+}
+
+func TestSweepFailedBuild(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "timelapse421234567")
+	writeFile(t, filepath.Join(dir, "image000000.jpg"), []byte("jpg"))
+	if err := markBuildFailed(&BuildJob{Dir: dir, JobID: 42, JobName: "benchy.gcode", Error: "ffmpeg exited"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{OrphansRebuild, OrphansDelete} {
+		var logs bytes.Buffer
+		ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: t.TempDir(), OrphanFrames: mode})
+		ts.log = slog.New(slog.NewTextHandler(&logs, nil))
+		ts.sweep(t.Context(), tmpDir, nil)
+
+		if pending := ts.builds.Status().Pending; len(pending) != 0 {
+			t.Errorf("%s: failed build is queued again: %+v", mode, pending)
+		}
+		if !exists(filepath.Join(dir, "image000000.jpg")) {
+			t.Errorf("%s: frames of failed build are removed", mode)
+		}
+		if !strings.Contains(logs.String(), "jobID=42 jobName=benchy.gcode") || !strings.Contains(logs.String(), "failed=1") {
+			t.Errorf("%s: failed build isn't reported:\n%s", mode, logs.String())
+		}
+	}
+}
+
+func TestSweepSalvage(t *testing.T) {
+	useFakeRunner(t)
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "timelapse421234567")
+	frame := testJPEG(t)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		writeFile(t, shotFilename(dir, i), frame)
+		os.Chtimes(shotFilename(dir, i), at, at.Add(time.Duration(i)*time.Minute))
+	}
+
+	var logs bytes.Buffer
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: outputDir, VideoLenght: 7, MinFPS: 12})
+	ts.log = slog.New(slog.NewTextHandler(&logs, nil))
+	ts.sweep(t.Context(), tmpDir, nil)
+
+	if want := fmt.Sprintf("found=1 queued=1 deleted=0 mb=%d", 3*len(frame)>>20); !strings.Contains(logs.String(), want) {
+		t.Errorf("expected summary %q in log:\n%s", want, logs.String())
+	}
+	pending := ts.builds.Status().Pending
+	if len(pending) != 1 {
+		t.Fatalf("expected salvage build, got %+v", pending)
+	}
+	job := pending[0]
+	if job.Dir != dir || job.Frames != 3 || !job.StartedAt.Equal(at) || !job.FinishedAt.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("unexpected salvage job %+v", job)
+	}
+
+	if err := ts.runJob(t.Context(), &job); err != nil {
+		t.Fatal(err)
+	}
+	videos, err := ts.List(t.Context())
+	if err != nil || len(videos) != 1 || videos[0].Frames != 3 {
+		t.Errorf("expected salvaged video, got %+v: %v", videos, err)
+	}
+	if exists(dir) {
+		t.Error("frames of salvaged video are kept")
+	}
+}
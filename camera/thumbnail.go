@@ -0,0 +1,138 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// poster image is put next to video as <video w/o extension> + thumbnailSuffix
+const thumbnailSuffix = ".jpg"
+
+const (
+	thumbnailWidth = 640
+	// poster is taken that far into video, the print is mostly there
+	thumbnailPosition = 0.8
+)
+
+// writeThumbnail extracts poster image of video at thumbnailPosition of its duration,
+// a second before the end if duration isn't known
+func (c *timelapseSvc) writeThumbnail(ctx context.Context, video string, duration time.Duration) (string, error) {
+	ffmpeg, err := c.ffmpegPath()
+	if err != nil {
+		return "", err
+	}
+	thumb := trimVideoExt(video) + thumbnailSuffix
+	args := []string{"-y"}
+	if duration > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", duration.Seconds()*thumbnailPosition))
+	} else {
+		args = append(args, "-sseof", "-1")
+	}
+	args = append(args,
+		"-i", video,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", thumbnailWidth),
+		"-q:v", "3",
+		thumb,
+	)
+	if output, err := Runner.Run(ctx, ffmpeg, args...); err != nil {
+		c.log.DebugContext(ctx, "ffmpeg output", "out", string(output))
+		return "", fmt.Errorf("fail to extract thumbnail: %w", err)
+	}
+	return thumb, nil
+}
+
+// videoDuration is length of video of frames played at fps
+func videoDuration(frames, fps int) time.Duration {
+	if fps <= 0 {
+		return 0
+	}
+	return time.Duration(frames) * time.Second / time.Duration(fps)
+}
+
+// Thumbnail returns path of poster image of video name. Videos built before thumbnails
+// get it on first request, it's created by build queue worker
+func (c *timelapseSvc) Thumbnail(ctx context.Context, name string) (string, error) {
+	if c.isEncoding(name) {
+		return "", fmt.Errorf("%w: %s", ErrVideoBusy, name)
+	}
+	video, err := videoPath(c.config.OutputDir, name)
+	if err != nil {
+		return "", err
+	}
+	thumb := trimVideoExt(video) + thumbnailSuffix
+
+	c.thumbnailMu.Lock()
+	if _, err := os.Stat(thumb); err == nil {
+		c.thumbnailMu.Unlock()
+		return thumb, nil
+	}
+	job := c.thumbnailJobs[name]
+	if job != nil {
+		select {
+		case <-job.done:
+			// cancelled while pending, it's submitted again
+			job = nil
+		default:
+		}
+	}
+	if job == nil {
+		job = &BuildJob{Kind: JobThumbnail, Files: []string{name}, JobName: name}
+		if err := c.builds.Submit(job); err != nil {
+			c.thumbnailMu.Unlock()
+			return "", fmt.Errorf("fail to queue thumbnail: %w", err)
+		}
+		if c.thumbnailJobs == nil {
+			c.thumbnailJobs = make(map[string]*BuildJob)
+		}
+		c.thumbnailJobs[name] = job
+	}
+	c.thumbnailMu.Unlock()
+
+	if err := job.wait(ctx); err != nil {
+		return "", err
+	}
+	return thumb, nil
+}
+
+// runThumbnail is worker of thumbnail job, metadata of video gets the thumbnail too
+func (c *timelapseSvc) runThumbnail(ctx context.Context, job *BuildJob) error {
+	name := job.Files[0]
+	defer func() {
+		c.thumbnailMu.Lock()
+		if c.thumbnailJobs[name] == job {
+			delete(c.thumbnailJobs, name)
+		}
+		c.thumbnailMu.Unlock()
+	}()
+	video := filepath.Join(c.config.OutputDir, name)
+	if _, err := os.Stat(trimVideoExt(video) + thumbnailSuffix); err == nil {
+		return nil
+	}
+
+	meta, err := readVideoMeta(video)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.log.WarnContext(ctx, "fail to read video metadata", "err", err, "video", name)
+	}
+	var duration time.Duration
+	if meta != nil {
+		duration = videoDuration(meta.Frames, meta.FPS)
+	}
+	thumb, err := c.writeThumbnail(ctx, video, duration)
+	if err != nil {
+		return err
+	}
+	c.log.InfoContext(ctx, "thumbnail created", "video", name)
+	if meta != nil {
+		meta.Thumbnail = thumb
+		if err := writeVideoMeta(video, meta); err != nil {
+			c.log.WarnContext(ctx, "fail to write video metadata", "err", err)
+		}
+	}
+	return nil
+}
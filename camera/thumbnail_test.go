@@ -0,0 +1,101 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestThumbnail(t *testing.T) {
+	runner := useFakeRunner(t)
+	dir := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: dir}, withJobs(nil))
+
+	// video built before thumbnails, with metadata
+	video := filepath.Join(dir, "t1700000000-benchy.gcode-42.mp4")
+	writeFile(t, video, []byte("video"))
+	if err := writeVideoMeta(video, &videoMeta{JobID: 42, Frames: 600, FPS: 12}); err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := ts.Thumbnail(t.Context(), filepath.Base(video))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "t1700000000-benchy.gcode-42.jpg"); thumb != want || !exists(thumb) {
+		t.Errorf("expected thumbnail %s, got %s", want, thumb)
+	}
+	args := runner.Calls("ffmpeg")[0]
+	if i := slices.Index(args, "-ss"); i < 0 || args[i+1] != "40.000" {
+		t.Errorf("expected poster at 80%% of 50s video, got %q", args)
+	}
+	meta, err := readVideoMeta(video)
+	if err != nil || meta.Thumbnail != thumb {
+		t.Errorf("expected thumbnail in metadata, got %+v, %v", meta, err)
+	}
+
+	// existing one is reused
+	if _, err := ts.Thumbnail(t.Context(), filepath.Base(video)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runner.Calls("ffmpeg")); n != 1 {
+		t.Errorf("expected thumbnail to be created once, got %d ffmpeg runs", n)
+	}
+
+	// no metadata, duration is unknown
+	writeFile(t, filepath.Join(dir, "manual.webm"), []byte("video"))
+	if _, err := ts.Thumbnail(t.Context(), "manual.webm"); err != nil {
+		t.Fatal(err)
+	}
+	if args := runner.Calls("ffmpeg")[1]; !slices.Contains(args, "-sseof") {
+		t.Errorf("expected poster from the end, got %q", args)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manual.json")); err == nil {
+		t.Error("metadata was created for video without it")
+	}
+	if st := ts.builds.Status(); len(st.Done) != 0 || len(ts.thumbnailJobs) != 0 {
+		t.Errorf("thumbnail jobs mustn't be kept, got %+v, %v", st, ts.thumbnailJobs)
+	}
+
+	ts.encoding.Store("t1700000001-cube.gcode-7", true)
+	if _, err := ts.Thumbnail(t.Context(), "t1700000001-cube.gcode-7.mp4"); !errors.Is(err, ErrVideoBusy) {
+		t.Errorf("expected ErrVideoBusy, got %v", err)
+	}
+	for name, want := range map[string]error{"missing.mp4": ErrVideoNotFound, "../x.mp4": ErrInvalidVideoName} {
+		if _, err := ts.Thumbnail(t.Context(), name); !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, err)
+		}
+	}
+}
+
+func TestThumbnailWaitsForBuild(t *testing.T) {
+	runner := useFakeRunner(t)
+	dir := t.TempDir()
+	release := make(chan struct{})
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: dir}, withJobs(release))
+	writeFile(t, filepath.Join(dir, "manual.mp4"), []byte("video"))
+	if err := ts.builds.Enqueue(&BuildJob{Dir: t.TempDir(), JobName: "benchy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the only worker builds video, thumbnail waits for it
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ts.Thumbnail(ctx, "manual.mp4"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected thumbnail to wait for video build, got %v", err)
+	}
+	if calls := runner.Calls("ffmpeg"); len(calls) != 0 {
+		t.Fatalf("thumbnail was created next to video build: %q", calls)
+	}
+
+	close(release)
+	if _, err := ts.Thumbnail(t.Context(), "manual.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(runner.Calls("ffmpeg")); n != 1 {
+		t.Errorf("expected the queued thumbnail to be reused, got %d runs", n)
+	}
+}
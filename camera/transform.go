@@ -0,0 +1,150 @@
+package camera
+
+import (
+	"image"
+	"image/color"
+)
+
+// frameTransform is software rotation and flip of usb camera frames.
+// Flips are applied first, rotation is clockwise
+type frameTransform struct {
+	rotation     int
+	hflip, vflip bool
+}
+
+func newFrameTransform(cfg *CameraConfig) frameTransform {
+	return frameTransform{rotation: cfg.Rotation, hflip: cfg.HFlip, vflip: cfg.VFlip}
+}
+
+func (t frameTransform) identity() bool {
+	return t.rotation == 0 && !t.hflip && !t.vflip
+}
+
+// size returns output size of w x h frame
+func (t frameTransform) size(w, h int) (int, int) {
+	if t.rotation == 90 || t.rotation == 270 {
+		return h, w
+	}
+	return w, h
+}
+
+// point maps pixel of w x h frame to output pixel
+func (t frameTransform) point(x, y, w, h int) (int, int) {
+	if t.hflip {
+		x = w - 1 - x
+	}
+	if t.vflip {
+		y = h - 1 - y
+	}
+	switch t.rotation {
+	case 90:
+		return h - 1 - y, x
+	case 180:
+		return w - 1 - x, h - 1 - y
+	case 270:
+		return y, w - 1 - x
+	}
+	return x, y
+}
+
+// yuyvImage converts YUYV frame to image, transforming it in the same pass.
+// Transformed image is 4:4:4, as chroma pairs don't stay horizontal when rotated
+func (t frameTransform) yuyvImage(frame []byte, w, h int) *image.YCbCr {
+	if t.identity() {
+		img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio422)
+		for i := range img.Cb {
+			ii := i * 4
+			img.Y[i*2] = frame[ii]
+			img.Y[i*2+1] = frame[ii+2]
+			img.Cb[i] = frame[ii+1]
+			img.Cr[i] = frame[ii+3]
+		}
+		return img
+	}
+
+	ow, oh := t.size(w, h)
+	img := image.NewYCbCr(image.Rect(0, 0, ow, oh), image.YCbCrSubsampleRatio444)
+	for i := range w * h / 2 {
+		ii := i * 4
+		x, y := (i*2)%w, (i*2)/w
+		cb, cr := frame[ii+1], frame[ii+3]
+		for j, luma := range [2]byte{frame[ii], frame[ii+2]} {
+			dx, dy := t.point(x+j, y, w, h)
+			off := dy*img.YStride + dx
+			img.Y[off] = luma
+			img.Cb[off] = cb
+			img.Cr[off] = cr
+		}
+	}
+	return img
+}
+
+// yuv420Image converts planar 4:2:0 frame to image, transforming it in the same pass.
+// Chroma of YU12 is U plane followed by V plane, NV12 has single plane of UV pairs
+func (t frameTransform) yuv420Image(frame []byte, w, h int, interleaved bool) *image.YCbCr {
+	cw, ch := (w+1)/2, (h+1)/2
+	luma, chroma := frame[:w*h], frame[w*h:]
+	// chroma of pixel x, y
+	cb := func(x, y int) byte {
+		if interleaved {
+			return chroma[(y/2)*cw*2+(x/2)*2]
+		}
+		return chroma[(y/2)*cw+x/2]
+	}
+	cr := func(x, y int) byte {
+		if interleaved {
+			return chroma[(y/2)*cw*2+(x/2)*2+1]
+		}
+		return chroma[cw*ch+(y/2)*cw+x/2]
+	}
+
+	if t.identity() {
+		img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+		copy(img.Y, luma)
+		for y := 0; y < h; y += 2 {
+			for x := 0; x < w; x += 2 {
+				ci := img.COffset(x, y)
+				img.Cb[ci], img.Cr[ci] = cb(x, y), cr(x, y)
+			}
+		}
+		return img
+	}
+
+	ow, oh := t.size(w, h)
+	img := image.NewYCbCr(image.Rect(0, 0, ow, oh), image.YCbCrSubsampleRatio444)
+	for y := range h {
+		for x := range w {
+			dx, dy := t.point(x, y, w, h)
+			off := dy*img.YStride + dx
+			img.Y[off], img.Cb[off], img.Cr[off] = luma[y*w+x], cb(x, y), cr(x, y)
+		}
+	}
+	return img
+}
+
+// apply returns transformed 4:4:4 copy of decoded frame, img itself if transform is identity
+func (t frameTransform) apply(img image.Image) *image.YCbCr {
+	src, isYCbCr := img.(*image.YCbCr)
+	if t.identity() && isYCbCr {
+		return src
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	ow, oh := t.size(w, h)
+	dst := image.NewYCbCr(image.Rect(0, 0, ow, oh), image.YCbCrSubsampleRatio444)
+	for y := range h {
+		for x := range w {
+			dx, dy := t.point(x, y, w, h)
+			off := dy*dst.YStride + dx
+			if isYCbCr {
+				yi, ci := src.YOffset(b.Min.X+x, b.Min.Y+y), src.COffset(b.Min.X+x, b.Min.Y+y)
+				dst.Y[off], dst.Cb[off], dst.Cr[off] = src.Y[yi], src.Cb[ci], src.Cr[ci]
+				continue
+			}
+			c := color.YCbCrModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.YCbCr)
+			dst.Y[off], dst.Cb[off], dst.Cr[off] = c.Y, c.Cb, c.Cr
+		}
+	}
+	return dst
+}
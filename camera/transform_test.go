@@ -0,0 +1,155 @@
+package camera
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"slices"
+	"testing"
+)
+
+func TestYUYVTransform(t *testing.T) {
+	// 4x2 frame, luma is pixel index
+	// 0 1 2 3
+	// 4 5 6 7
+	frame := make([]byte, 4*2*2)
+	for i := range 8 {
+		frame[i*2] = byte(i)
+		frame[i*2+1] = 128
+	}
+
+	tests := []struct {
+		name  string
+		t     frameTransform
+		w, h  int
+		lumas []byte
+	}{
+		{"identity", frameTransform{}, 4, 2, []byte{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"90", frameTransform{rotation: 90}, 2, 4, []byte{4, 0, 5, 1, 6, 2, 7, 3}},
+		{"180", frameTransform{rotation: 180}, 4, 2, []byte{7, 6, 5, 4, 3, 2, 1, 0}},
+		{"270", frameTransform{rotation: 270}, 2, 4, []byte{3, 7, 2, 6, 1, 5, 0, 4}},
+		{"hflip", frameTransform{hflip: true}, 4, 2, []byte{3, 2, 1, 0, 7, 6, 5, 4}},
+		{"vflip", frameTransform{vflip: true}, 4, 2, []byte{4, 5, 6, 7, 0, 1, 2, 3}},
+		{"hflip 90", frameTransform{rotation: 90, hflip: true}, 2, 4, []byte{7, 3, 6, 2, 5, 1, 4, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.t.yuyvImage(frame, 4, 2)
+			if b := img.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.w, tt.h)
+			}
+			var lumas []byte
+			for y := range tt.h {
+				for x := range tt.w {
+					lumas = append(lumas, img.Y[img.YOffset(x, y)])
+				}
+			}
+			if !slices.Equal(lumas, tt.lumas) {
+				t.Errorf("lumas = %v, want %v", lumas, tt.lumas)
+			}
+		})
+	}
+}
+
+// yuv420Frame builds w x h frame: luma is pixel index, chroma of 2x2 block is
+// 10+block index for Cb and 20+block index for Cr
+func yuv420Frame(w, h int, interleaved bool) []byte {
+	cw, ch := (w+1)/2, (h+1)/2
+	frame := make([]byte, w*h+2*cw*ch)
+	for i := range w * h {
+		frame[i] = byte(i)
+	}
+	chroma := frame[w*h:]
+	for i := range cw * ch {
+		if interleaved {
+			chroma[i*2], chroma[i*2+1] = byte(10+i), byte(20+i)
+		} else {
+			chroma[i], chroma[cw*ch+i] = byte(10+i), byte(20+i)
+		}
+	}
+	return frame
+}
+
+func TestYUV420Image(t *testing.T) {
+	// pixels as luma/Cb/Cr of source frame
+	type pixel [3]byte
+	tests := []struct {
+		name   string
+		t      frameTransform
+		w, h   int
+		pixels []pixel
+	}{
+		{"4x2", frameTransform{}, 4, 2, []pixel{
+			{0, 10, 20}, {1, 10, 20}, {2, 11, 21}, {3, 11, 21},
+			{4, 10, 20}, {5, 10, 20}, {6, 11, 21}, {7, 11, 21},
+		}},
+		{"odd 3x3", frameTransform{}, 3, 3, []pixel{
+			{0, 10, 20}, {1, 10, 20}, {2, 11, 21},
+			{3, 10, 20}, {4, 10, 20}, {5, 11, 21},
+			{6, 12, 22}, {7, 12, 22}, {8, 13, 23},
+		}},
+		{"4x2 rotated 90", frameTransform{rotation: 90}, 4, 2, []pixel{
+			{4, 10, 20}, {0, 10, 20},
+			{5, 10, 20}, {1, 10, 20},
+			{6, 11, 21}, {2, 11, 21},
+			{7, 11, 21}, {3, 11, 21},
+		}},
+	}
+	for _, tt := range tests {
+		for _, interleaved := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s nv12=%v", tt.name, interleaved), func(t *testing.T) {
+				img := tt.t.yuv420Image(yuv420Frame(tt.w, tt.h, interleaved), tt.w, tt.h, interleaved)
+				ow, oh := tt.t.size(tt.w, tt.h)
+				if b := img.Bounds(); b.Dx() != ow || b.Dy() != oh {
+					t.Fatalf("size = %s, want %dx%d", b, ow, oh)
+				}
+				var pixels []pixel
+				for y := range oh {
+					for x := range ow {
+						yi, ci := img.YOffset(x, y), img.COffset(x, y)
+						pixels = append(pixels, pixel{img.Y[yi], img.Cb[ci], img.Cr[ci]})
+					}
+				}
+				if !slices.Equal(pixels, tt.pixels) {
+					t.Errorf("pixels = %v, want %v", pixels, tt.pixels)
+				}
+			})
+		}
+	}
+}
+
+func TestTransformJPEG(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 64, 32))
+	for x := range 16 {
+		for y := range 32 {
+			src.Pix[y*src.Stride+x] = 255 // bright left stripe
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := transformJPEG(buf.Bytes(), frameTransform{rotation: 90}, "")
+	if err != nil {
+		t.Fatalf("transformJPEG: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Fatalf("size = %dx%d, want 32x64", b.Dx(), b.Dy())
+	}
+	// left stripe ends up on top after clockwise rotation
+	top, _, _, _ := img.At(16, 4).RGBA()
+	bottom, _, _, _ := img.At(16, 60).RGBA()
+	if top < 0xc000 || bottom > 0x4000 {
+		t.Errorf("top = %#x, bottom = %#x, stripe isn't rotated", top, bottom)
+	}
+
+	if _, err := transformJPEG([]byte("not a jpeg"), frameTransform{rotation: 90}, ""); err == nil {
+		t.Error("expected error for invalid frame")
+	}
+}
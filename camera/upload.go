@@ -0,0 +1,191 @@
+package camera
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	UploadS3     = "s3"
+	UploadRclone = "rclone"
+)
+
+// UploadConfig ships built videos off the box, uploads are off if Type is empty
+type UploadConfig struct {
+	// s3 or rclone
+	Type string
+	// s3 bucket, or rclone remote like "gdrive:" or "gdrive:timelapses"
+	Bucket string
+	Remote string
+	// key prefix of uploaded files
+	Prefix string
+	// video and its sidecars are removed after upload is verified
+	DeleteAfterUpload bool
+
+	// rclone binary, looked up in PATH if empty
+	Rclone string
+
+	// s3 region, AWS_REGION or profile one if empty. Endpoint of S3 compatible storage, AWS one if empty.
+	// Credentials come from default AWS chain (env, shared config and profile, instance role) if AccessKey is empty
+	Region    string
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+}
+
+func (cfg *UploadConfig) validate() error {
+	switch cfg.Type {
+	case "":
+	case UploadS3:
+		if cfg.Bucket == "" {
+			return errors.New("timelapse.upload.bucket is required for s3 upload")
+		}
+	case UploadRclone:
+		if cfg.Remote == "" {
+			return errors.New("timelapse.upload.remote is required for rclone upload")
+		}
+	default:
+		return fmt.Errorf("invalid timelapse.upload.type %q, expected %s or %s", cfg.Type, UploadS3, UploadRclone)
+	}
+	return nil
+}
+
+// uploader transfers file to key and verifies it's there
+type uploader interface {
+	upload(ctx context.Context, file, key string) error
+}
+
+func newUploader(ctx context.Context, cfg *UploadConfig) (uploader, error) {
+	switch cfg.Type {
+	case UploadS3:
+		return newS3Uploader(ctx, cfg)
+	case UploadRclone:
+		return &rcloneUploader{cfg: cfg}, nil
+	}
+	return nil, nil
+}
+
+// runJob is worker of build queue, it builds video, uploads built one, builds preview or thumbnail
+func (c *timelapseSvc) runJob(ctx context.Context, job *BuildJob) error {
+	switch job.Kind {
+	case JobUpload:
+		return c.uploadVideo(ctx, job)
+	case JobPreview:
+		return c.runPreview(ctx, job)
+	case JobThumbnail:
+		return c.runThumbnail(ctx, job)
+	}
+	return c.buildVideo(ctx, job)
+}
+
+// queueUpload queues upload of files of built video, if uploads are configured
+func (c *timelapseSvc) queueUpload(ctx context.Context, job *BuildJob, files []string) {
+	if c.config.Upload.Type == "" {
+		return
+	}
+	err := c.builds.Enqueue(&BuildJob{
+		Kind:       JobUpload,
+		Files:      files,
+		JobID:      job.JobID,
+		JobName:    job.JobName,
+		Frames:     job.Frames,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	})
+	if err != nil {
+		c.log.ErrorContext(ctx, "fail to queue video upload", "err", err, "files", files)
+	}
+}
+
+// uploadVideo uploads files of OutputDir listed by job and removes them with DeleteAfterUpload.
+// Files are removed only after all of them are there, upload is retried by queue otherwise
+func (c *timelapseSvc) uploadVideo(ctx context.Context, job *BuildJob) error {
+	cfg := &c.config.Upload
+	up, err := newUploader(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNoRetry, err)
+	}
+	if up == nil {
+		return fmt.Errorf("%w: uploads aren't configured", errNoRetry)
+	}
+
+	var uploaded []string
+	for _, name := range job.Files {
+		file := filepath.Join(c.config.OutputDir, name)
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+			c.log.WarnContext(ctx, "upload skipped, file is gone", "file", file)
+			continue
+		}
+		if err := up.upload(ctx, file, path.Join(cfg.Prefix, name)); err != nil {
+			return err
+		}
+		c.log.InfoContext(ctx, "video file uploaded", "type", cfg.Type, "file", name)
+		uploaded = append(uploaded, file)
+	}
+
+	if !cfg.DeleteAfterUpload {
+		return nil
+	}
+	var errs []error
+	for _, file := range uploaded {
+		if err := os.Remove(file); err != nil {
+			errs = append(errs, fmt.Errorf("fail to remove uploaded file: %w", err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		// files are there remotely, upload isn't repeated for that
+		return fmt.Errorf("%w: %w", errNoRetry, err)
+	}
+	return nil
+}
+
+// rcloneUploader copies files by rclone copyto, remote is configured in rclone itself
+type rcloneUploader struct {
+	cfg *UploadConfig
+}
+
+func (u *rcloneUploader) upload(ctx context.Context, file, key string) error {
+	rclone := u.cfg.Rclone
+	if rclone == "" {
+		var err error
+		if rclone, err = Runner.LookPath("rclone"); err != nil {
+			return fmt.Errorf("%w: rclone upload needs rclone, install it or set timelapse.upload.rclone: %w", errNoRetry, err)
+		}
+	}
+	dst := u.cfg.Remote
+	if !strings.HasSuffix(dst, ":") {
+		dst = strings.TrimSuffix(dst, "/") + "/"
+	}
+	dst += key
+
+	if output, err := Runner.Run(ctx, rclone, "copyto", file, dst); err != nil {
+		return fmt.Errorf("fail to copy %s by rclone: %w: %s", key, err, output)
+	}
+
+	// copyto checks hashes where remote has them, size is checked for the rest
+	output, err := Runner.Run(ctx, rclone, "lsjson", "--files-only", dst)
+	if err != nil {
+		return fmt.Errorf("fail to check %s by rclone: %w: %s", key, err, output)
+	}
+	var entries []struct {
+		Size int64
+	}
+	if err := json.Unmarshal(output, &entries); err != nil {
+		return fmt.Errorf("fail to parse rclone lsjson: %w", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("fail to stat upload: %w", err)
+	}
+	if len(entries) != 1 || entries[0].Size != info.Size() {
+		return fmt.Errorf("uploaded %s doesn't match local file of %d bytes: %s", key, info.Size(), output)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package camera
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestS3Upload(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case http.MethodPut:
+			objects[req.URL.Path], _ = io.ReadAll(req.Body)
+		case http.MethodHead:
+			data, ok := objects[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+	}))
+	defer srv.Close()
+
+	out := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: out, Upload: UploadConfig{
+		Type: UploadS3, Bucket: "timelapses", Prefix: "pi", DeleteAfterUpload: true,
+		Region: "eu-central-1", Endpoint: srv.URL, AccessKey: "key", SecretKey: "secret",
+	}})
+	writeFile(t, filepath.Join(out, "t1-benchy-42.mp4"), []byte("video"))
+	writeFile(t, filepath.Join(out, "t1-benchy-42.json"), []byte("{}"))
+
+	job := &BuildJob{Kind: JobUpload, Files: []string{"t1-benchy-42.mp4", "t1-benchy-42.json", "gone.jpg"}}
+	if err := ts.runJob(t.Context(), job); err != nil {
+		t.Fatal(err)
+	}
+	if string(objects["/timelapses/pi/t1-benchy-42.mp4"]) != "video" || len(objects) != 2 {
+		t.Errorf("unexpected uploaded objects %v", objects)
+	}
+	if exists(filepath.Join(out, "t1-benchy-42.mp4")) {
+		t.Error("uploaded video wasn't removed")
+	}
+
+	// without accessKey credentials and region come from default chain, here profile of shared config
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config"), []byte("[profile nas]\nregion = eu-central-1\n"))
+	writeFile(t, filepath.Join(dir, "credentials"), []byte("[nas]\naws_access_key_id = key\naws_secret_access_key = secret\n"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "nas")
+	ts.config.Upload.Region, ts.config.Upload.AccessKey, ts.config.Upload.SecretKey = "", "", ""
+	writeFile(t, filepath.Join(out, "t2-cube-43.mp4"), []byte("cube"))
+	if err := ts.runJob(t.Context(), &BuildJob{Kind: JobUpload, Files: []string{"t2-cube-43.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if string(objects["/timelapses/pi/t2-cube-43.mp4"]) != "cube" {
+		t.Errorf("unexpected uploaded objects %v", objects)
+	}
+}
+
+func TestRcloneUpload(t *testing.T) {
+	runner := useFakeRunner(t)
+	out := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: out, Upload: UploadConfig{Type: UploadRclone, Remote: "gdrive:", Prefix: "pi"}})
+	video := filepath.Join(out, "t1-benchy-42.mp4")
+	writeFile(t, video, []byte("video"))
+
+	if err := ts.uploadVideo(t.Context(), &BuildJob{Kind: JobUpload, Files: []string{"t1-benchy-42.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+	calls := runner.Calls("rclone")
+	if len(calls) != 2 || strings.Join(calls[0], " ") != "copyto "+video+" gdrive:pi/t1-benchy-42.mp4" {
+		t.Errorf("unexpected rclone runs %q", calls)
+	}
+	if !exists(video) {
+		t.Error("video was removed without deleteAfterUpload")
+	}
+
+	// transfer which isn't verified fails, so queue retries it
+	runner.fail = func(name string, args []string) bool { return name == "rclone" && args[0] == "copyto" }
+	if err := ts.uploadVideo(t.Context(), &BuildJob{Kind: JobUpload, Files: []string{"t1-benchy-42.mp4"}}); err == nil {
+		t.Error("expected failed upload")
+	}
+}
+
+func TestBuildQueuesUpload(t *testing.T) {
+	useFakeRunner(t)
+	out := t.TempDir()
+	ts := newTestTimelapse(t, &TimelapseConfig{VideoLenght: 7, MinFPS: 12, OutputDir: out, Upload: UploadConfig{Type: UploadRclone, Remote: "nas:"}})
+	if err := ts.buildVideo(t.Context(), &BuildJob{Dir: t.TempDir(), JobID: 42, JobName: "benchy.gcode", Frames: 10}); err != nil {
+		t.Fatal(err)
+	}
+	pending := ts.builds.Status().Pending
+	if len(pending) != 1 || pending[0].Kind != JobUpload || len(pending[0].Files) != 3 {
+		t.Fatalf("expected upload of video, metadata and thumbnail, got %+v", pending)
+	}
+	for _, name := range pending[0].Files {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("uploaded file: %v", err)
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"image"
 	"image/jpeg"
 	"log/slog"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,158 +18,481 @@ import (
 )
 
 const (
-	V4L2_PIX_FMT_PJPG = 0x47504A50
-	V4L2_PIX_FMT_YUYV = 0x56595559
+	V4L2_PIX_FMT_PJPG  = 0x47504A50
+	V4L2_PIX_FMT_YUYV  = 0x56595559
+	V4L2_PIX_FMT_MJPEG = 0x47504A4D
+	V4L2_PIX_FMT_JPEG  = 0x4745504A
+	// planar 4:2:0, YU12 has separate U and V planes, NV12 has them interleaved
+	V4L2_PIX_FMT_YUV420 = 0x32315559
+	V4L2_PIX_FMT_NV12   = 0x3231564E
 )
 
-var supportedFormats = map[webcam.PixelFormat]bool{
-	V4L2_PIX_FMT_PJPG: false,
-	V4L2_PIX_FMT_YUYV: true,
+// supportedFormats in preference order: compressed frames are passed through as is,
+// YUYV and 4:2:0 ones are encoded in software. PJPG is vendor specific JPEG, it's not supported
+var supportedFormats = []struct {
+	name   string
+	format webcam.PixelFormat
+}{
+	{"mjpeg", V4L2_PIX_FMT_MJPEG},
+	{"jpeg", V4L2_PIX_FMT_JPEG},
+	{"yuyv", V4L2_PIX_FMT_YUYV},
+	{"yu12", V4L2_PIX_FMT_YUV420},
+	{"nv12", V4L2_PIX_FMT_NV12},
+}
+
+// formatName is config name of supported format
+func formatName(format webcam.PixelFormat) string {
+	for _, f := range supportedFormats {
+		if f.format == format {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// pickFormat returns the most preferred format camera offers, or forced one
+func pickFormat(offered map[webcam.PixelFormat]string, force string) (webcam.PixelFormat, error) {
+	for _, f := range supportedFormats {
+		if force != "" && f.name != strings.ToLower(force) {
+			continue
+		}
+		if _, ok := offered[f.format]; ok {
+			return f.format, nil
+		}
+	}
+	if force != "" {
+		return 0, fmt.Errorf("camera doesn't offer pixel format %q", force)
+	}
+	return 0, errors.New("found no supported formats")
+}
+
+func isJPEGFormat(format webcam.PixelFormat) bool {
+	return format == V4L2_PIX_FMT_MJPEG || format == V4L2_PIX_FMT_JPEG
+}
+
+// rawFrameSize is byte size of uncompressed w x h frame, lines aren't padded
+func rawFrameSize(format webcam.PixelFormat, w, h int) int {
+	if format == V4L2_PIX_FMT_YUV420 || format == V4L2_PIX_FMT_NV12 {
+		cw, ch := (w+1)/2, (h+1)/2
+		return w*h + 2*cw*ch
+	}
+	return w * h * 2
+}
+
+const (
+	// consecutive read failures after which device is reopened
+	usbMaxFailures    = 5
+	usbReopenMaxDelay = 30 * time.Second
+)
+
+// webcamDevice is V4L2 device used by usbcamera, replaced in tests
+type webcamDevice interface {
+	GetSupportedFormats() map[webcam.PixelFormat]string
+	GetSupportedFrameSizes(format webcam.PixelFormat) []webcam.FrameSize
+	SetImageFormat(format webcam.PixelFormat, width, height uint32) (webcam.PixelFormat, uint32, uint32, error)
+	GetControls() map[webcam.ControlID]webcam.Control
+	GetControl(id webcam.ControlID) (int32, error)
+	SetControl(id webcam.ControlID, value int32) error
+	StartStreaming() error
+	WaitForFrame(timeout uint32) error
+	ReadFrame() ([]byte, error)
+	Close() error
+}
+
+var openWebcam = func(path string) (webcamDevice, error) {
+	return webcam.Open(path)
 }
 
 type usbcamera struct {
 	log *slog.Logger
+	cfg *CameraConfig
 
-	cam         *webcam.Webcam
-	imageWidth  int
-	imageHeight int
+	device    string
+	transform frameTransform
+	life      *lifecycle
+	stats     frameStats
 
 	sync.RWMutex
-	frame []byte
+	cam         webcamDevice
+	format      webcam.PixelFormat
+	imageWidth  int
+	imageHeight int
+	// node in use, differs from device when camera is selected by name or USB id
+	path string
+	// the latest frame, readers retain it while they encode it
+	frame     *sharedFrame
+	frames    framePool
+	frameTime time.Time
+	// device is lost, reopen is in progress
+	unavailable bool
+
+	// replaced in tests
+	now        func() time.Time
+	retryDelay time.Duration
 }
 
-func NewUSBCamera(log *slog.Logger) (Camera, error) {
-	cam, err := webcam.Open("/dev/video0")
-	if err != nil {
-		return nil, fmt.Errorf("fail to open camera: %w", err)
+func NewUSBCamera(log *slog.Logger, cfg *CameraConfig) (Camera, error) {
+	if devices, err := listVideoDevices(); err == nil {
+		log.Debug("Video devices", "devices", devices)
 	}
-	formatDesc := cam.GetSupportedFormats()
-	log.Debug("Supported formats", "formats", formatDesc)
 
-	var format webcam.PixelFormat
-	for f, desc := range formatDesc {
-		if supportedFormats[f] {
-			log.Debug("Picked format", "format", desc)
-			format = f
-			break
-		}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
 
-	if format == 0 {
-		return nil, fmt.Errorf("found no supported formats")
+	c := &usbcamera{
+		log:        log.With("svc", "camera"),
+		cfg:        cfg,
+		device:     resolveDevice(cfg.Device),
+		transform:  newFrameTransform(cfg),
+		life:       newLifecycle(),
+		now:        time.Now,
+		retryDelay: time.Second,
+	}
+	if err := c.open(); err != nil {
+		return nil, err
 	}
 
-	sizes := FrameSizes(cam.GetSupportedFrameSizes(format))
-	sort.Sort(sizes)
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
 
-	size := sizes[len(sizes)-1]
-	log.Debug("Picked size", "size", size)
+	return c, nil
+}
 
-	f, w, h, err := cam.SetImageFormat(format, size.MaxWidth, size.MaxHeight)
+// open opens device and negotiates format and size
+func (c *usbcamera) open() error {
+	path := c.device
+	if isDeviceSelector(c.device) {
+		d, err := selectVideoDevice(c.device)
+		if err != nil {
+			return err
+		}
+		c.log.Info("Selected camera", "device", c.device, "path", d.Path, "name", d.Name, "usbID", d.USBID)
+		path = d.Path
+	}
+	cam, err := openWebcam(path)
 	if err != nil {
-		return nil, fmt.Errorf("fail to set image format: %w", err)
+		return fmt.Errorf("fail to open camera %s: %w, set camera.device to one of %s", c.device, err, describeDevices())
 	}
+	formatDesc := cam.GetSupportedFormats()
+	c.log.Debug("Supported formats", "formats", formatDesc)
 
-	log.Info("Set image format", "format", f, "width", w, "height", h)
+	format, err := pickFormat(formatDesc, c.cfg.PixelFormat)
+	if err != nil {
+		cam.Close()
+		return fmt.Errorf("%s: %w", c.device, err)
+	}
+	c.log.Debug("Picked format", "format", formatDesc[format])
 
-	err = cam.StartStreaming()
+	sizes := FrameSizes(cam.GetSupportedFrameSizes(format))
+	width, height, err := pickFrameSize(sizes, c.cfg.Width, c.cfg.Height)
 	if err != nil {
-		return nil, fmt.Errorf("fail to start streaming: %w", err)
+		cam.Close()
+		return fmt.Errorf("%s: %w", c.device, err)
 	}
+	c.log.Debug("Picked size", "width", width, "height", height)
 
-	svc := &usbcamera{
-		log:         log.With("svc", "camera"),
-		cam:         cam,
-		imageWidth:  int(w),
-		imageHeight: int(h),
+	f, w, h, err := cam.SetImageFormat(format, width, height)
+	if err != nil {
+		cam.Close()
+		return fmt.Errorf("fail to set image format: %w", err)
 	}
 
-	go svc.handleCamera()
+	c.log.Info("Set image format", "format", formatDesc[f], "width", w, "height", h)
+	c.applyControls(cam)
+
+	err = cam.StartStreaming()
+	if err != nil {
+		cam.Close()
+		return fmt.Errorf("fail to start streaming: %w", err)
+	}
 
-	return svc, nil
+	c.RWMutex.Lock()
+	c.cam = cam
+	c.path = path
+	c.format = f
+	c.imageWidth = int(w)
+	c.imageHeight = int(h)
+	c.unavailable = false
+	c.RWMutex.Unlock()
+	return nil
 }
 
-func (c *usbcamera) Snapshot(ctx context.Context) ([]byte, error) {
-	c.RWMutex.RLock()
-	frame := c.frame
-	c.RWMutex.RUnlock()
+func (c *usbcamera) Snapshot(ctx context.Context) (*Frame, error) {
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	frame, frameTime, unavailable := c.latestFrame()
+	if frame != nil {
+		defer frame.release()
+	}
 
+	if unavailable || (frame != nil && c.now().Sub(frameTime) > c.cfg.maxFrameAge()) {
+		return nil, fmt.Errorf("%s: %w", c.device, ErrCameraUnavailable)
+	}
 	if frame == nil {
 		return nil, errors.New("frame not yet available")
 	}
 
-	return c.encodeToImage(frame)
+	format := FormatOf(ctx)
+	var data []byte
+	var err error
+	if format == FormatPNG {
+		data, err = c.encodePNG(frame.data)
+	} else {
+		data, err = c.encodeToImage(frame.data, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Frame{
+		Data:       data,
+		Source:     SourceFresh,
+		CapturedAt: frameTime,
+		Format:     format,
+	}, nil
 }
 
 func (c *usbcamera) Stream(ctx context.Context) (chan []byte, error) {
-	stream := make(chan []byte, 10)
+	if err := c.life.check(); err != nil {
+		return nil, err
+	}
+	ctx = c.life.bind(ctx)
+	// single slot, stale frames are dropped instead of queued
+	stream := make(chan []byte, 1)
 
 	go func() {
-		after := time.After(0)
+		defer close(stream)
+		// ticker drops ticks while encoding is slower than configured rate
+		ticker := time.NewTicker(c.cfg.streamInterval())
+		defer ticker.Stop()
+		meter := newFPSMeter(c.log, c.cfg.streamFPS())
+
+		var badge CaptureSource
+		if c.cfg.SourceBadge {
+			badge = SourceFresh
+		}
 		for {
+			// nothing to send while camera is reopened or frozen
+			if frame, frameTime, _ := c.latestFrame(); frame != nil {
+				if c.now().Sub(frameTime) <= c.cfg.maxFrameAge() {
+					c.sendFrame(ctx, stream, frame.data, badge, meter)
+				}
+				frame.release()
+			}
+
 			select {
 			case <-ctx.Done():
-				close(stream)
 				return
-			case <-after:
-			}
-			c.RWMutex.RLock()
-			frame := c.frame
-			c.RWMutex.RUnlock()
-
-			image, err := c.encodeToImage(frame)
-			if err != nil {
-				c.log.Warn("fail to encode image", "err", err)
-				continue
-			}
-			select {
-			case stream <- image:
-			default:
-				c.log.Warn("buffer overflow")
-				// just in case. to not block channel
+			case <-ticker.C:
 			}
-			after = time.After(2 * time.Second)
 		}
 	}()
 
 	return stream, nil
 }
 
-func (c *usbcamera) handleCamera() {
-	for {
+// latestFrame returns retained frame, nil if there is none yet
+func (c *usbcamera) latestFrame() (*sharedFrame, time.Time, bool) {
+	c.RWMutex.RLock()
+	defer c.RWMutex.RUnlock()
+	if c.frame == nil {
+		return nil, c.frameTime, c.unavailable
+	}
+	return c.frame.retain(), c.frameTime, c.unavailable
+}
+
+// setFrame replaces the latest frame, nil drops it
+func (c *usbcamera) setFrame(frame *sharedFrame, at time.Time) {
+	c.RWMutex.Lock()
+	old := c.frame
+	c.frame = frame
+	if frame != nil {
+		c.frameTime = at
+	}
+	c.RWMutex.Unlock()
+	if old != nil {
+		old.release()
+	}
+}
+
+// sendFrame encodes frame and drops it if client doesn't keep up
+func (c *usbcamera) sendFrame(ctx context.Context, stream chan<- []byte, frame []byte, badge CaptureSource, meter *fpsMeter) {
+	image, err := c.encodeToImage(frame, badge)
+	if err != nil {
+		c.log.Warn("fail to encode image", "err", err)
+		return
+	}
+	select {
+	case stream <- image:
+		meter.frame(ctx, true)
+	default:
+		meter.frame(ctx, false)
+	}
+}
+
+// Close stops reading frames and closes device
+func (c *usbcamera) Close(ctx context.Context) error {
+	if err := c.life.close(ctx); err != nil {
+		return err
+	}
+
+	c.setFrame(nil, time.Time{})
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+	if c.unavailable || c.cam == nil {
+		// lost device is closed already
+		return nil
+	}
+	c.unavailable = true
+	if err := c.cam.Close(); err != nil {
+		return fmt.Errorf("fail to close camera %s: %w", c.device, err)
+	}
+	return nil
+}
+
+func (c *usbcamera) Info(ctx context.Context) (*Info, error) {
+	info := &Info{Backend: "usb"}
+	c.RWMutex.RLock()
+	info.Device = c.path
+	if !c.frameTime.IsZero() {
+		at := c.frameTime
+		info.LastFrameAt = &at
+	}
+	c.RWMutex.RUnlock()
+	return info, nil
+}
+
+func (c *usbcamera) Health(ctx context.Context) (*Health, error) {
+	h := &Health{Backend: TypeUSB}
+	c.RWMutex.RLock()
+	h.Device = c.path
+	h.Width, h.Height, h.Format = c.imageWidth, c.imageHeight, formatName(c.format)
+	c.RWMutex.RUnlock()
+	c.stats.fill(h)
+	return h, nil
+}
+
+// handleCamera reads frames till ctx is done
+func (c *usbcamera) handleCamera(ctx context.Context) {
+	failures := 0
+	lastFrame := c.now()
+	warm := c.startWarmUp()
+	for ctx.Err() == nil {
+		if age := c.now().Sub(lastFrame); failures >= usbMaxFailures || age > c.cfg.maxFrameAge() {
+			c.log.Warn("camera stopped giving frames, reopening", "device", c.device, "failures", failures, "age", age)
+			if !c.reopen(ctx) {
+				return
+			}
+			failures = 0
+			lastFrame = c.now()
+			warm = c.startWarmUp()
+		}
+
 		err := c.cam.WaitForFrame(5)
+		var timeout *webcam.Timeout
+		if errors.As(err, &timeout) {
+			continue
+		}
 		if err != nil {
 			c.log.Warn("fail to wait for frame", "err", err)
+			c.stats.fail(err)
+			failures++
 			continue
 		}
 
 		frame, err := c.cam.ReadFrame()
 		if err != nil {
 			c.log.Warn("fail to read frame", "err", err)
+			c.stats.fail(err)
+			failures++
+			continue
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		failures = 0
+		lastFrame = c.now()
+		if !warm(lastFrame) {
 			continue
 		}
 
-		c.RWMutex.Lock()
-		c.frame = frame
-		c.RWMutex.Unlock()
+		// driver reuses its buffers and unmaps them when device is reopened
+		c.setFrame(c.frames.copy(frame), lastFrame)
+		c.stats.frame(lastFrame)
+	}
+}
+
+// startWarmUp returns func telling whether frame got at given time is past warm-up,
+// frames before are dropped so snapshots don't serve them
+func (c *usbcamera) startWarmUp() func(at time.Time) bool {
+	skip := c.cfg.WarmUpFrames
+	until := c.now().Add(c.cfg.WarmUpTime)
+	if skip == 0 && c.cfg.WarmUpTime == 0 {
+		return func(time.Time) bool { return true }
+	}
+	warm := false
+	return func(at time.Time) bool {
+		if warm {
+			return true
+		}
+		if skip > 0 || at.Before(until) {
+			skip--
+			return false
+		}
+		warm = true
+		c.log.Debug("camera warmed up", "device", c.device)
+		return true
+	}
+}
+
+// reopen closes lost device and opens it again until it succeeds, false if ctx is done first
+func (c *usbcamera) reopen(ctx context.Context) bool {
+	c.RWMutex.Lock()
+	c.unavailable = true
+	c.RWMutex.Unlock()
+	c.setFrame(nil, time.Time{})
+
+	if err := c.cam.Close(); err != nil {
+		c.log.Debug("fail to close camera", "err", err)
+	}
+
+	delay := c.retryDelay
+	for {
+		sleepCtx(ctx, delay)
+		if ctx.Err() != nil {
+			return false
+		}
+		err := c.open()
+		if err == nil {
+			c.log.Info("camera reopened", "device", c.device)
+			return true
+		}
+		c.log.Warn("fail to reopen camera", "err", err, "retryIn", delay)
+		delay = min(delay*2, usbReopenMaxDelay)
 	}
 }
 
-func (c *usbcamera) encodeToImage(frame []byte) ([]byte, error) {
-	var (
-		img image.Image
-	)
+// encodeToImage converts frame to jpeg, badge is drawn unless empty.
+// JPEG frames are passed through unless badge has to be drawn
+func (c *usbcamera) encodeToImage(frame []byte, badge CaptureSource) ([]byte, error) {
+	c.RWMutex.RLock()
+	format, width, height := c.format, c.imageWidth, c.imageHeight
+	c.RWMutex.RUnlock()
 
-	yuyv := image.NewYCbCr(image.Rect(0, 0, c.imageWidth, c.imageHeight), image.YCbCrSubsampleRatio422)
-	for i := range yuyv.Cb {
-		ii := i * 4
-		yuyv.Y[i*2] = frame[ii]
-		yuyv.Y[i*2+1] = frame[ii+2]
-		yuyv.Cb[i] = frame[ii+1]
-		yuyv.Cr[i] = frame[ii+3]
+	if isJPEGFormat(format) {
+		if c.transform.identity() {
+			return passJPEG(frame, badge)
+		}
+		return transformJPEG(frame, c.transform, badge)
+	}
 
+	img, err := c.rawImage(frame, format, width, height)
+	if err != nil {
+		return nil, err
+	}
+	if badge != "" {
+		drawBadge(img, badge)
 	}
-	img = yuyv
 	//convert to jpeg
 	buf := &bytes.Buffer{}
 	if err := jpeg.Encode(buf, img, nil); err != nil {
@@ -177,6 +502,48 @@ func (c *usbcamera) encodeToImage(frame []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// rawImage converts uncompressed frame, applying rotation and flips
+func (c *usbcamera) rawImage(frame []byte, format webcam.PixelFormat, width, height int) (*image.YCbCr, error) {
+	if size := rawFrameSize(format, width, height); len(frame) < size {
+		return nil, fmt.Errorf("short %s frame: %d bytes for %dx%d, expected %d", formatName(format), len(frame), width, height, size)
+	}
+	switch format {
+	case V4L2_PIX_FMT_YUV420, V4L2_PIX_FMT_NV12:
+		return c.transform.yuv420Image(frame, width, height, format == V4L2_PIX_FMT_NV12), nil
+	}
+	return c.transform.yuyvImage(frame, width, height), nil
+}
+
+// encodePNG converts frame to png, uncompressed frames lose nothing on the way
+func (c *usbcamera) encodePNG(frame []byte) ([]byte, error) {
+	c.RWMutex.RLock()
+	format, width, height := c.format, c.imageWidth, c.imageHeight
+	c.RWMutex.RUnlock()
+
+	var img image.Image
+	if isJPEGFormat(format) {
+		frame, err := passJPEG(frame, "")
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode jpeg frame: %w", err)
+		}
+		img = decoded
+		if !c.transform.identity() {
+			img = c.transform.apply(decoded)
+		}
+	} else {
+		raw, err := c.rawImage(frame, format, width, height)
+		if err != nil {
+			return nil, err
+		}
+		img = raw
+	}
+	return encodeImage(img, FormatPNG)
+}
+
 type FrameSizes []webcam.FrameSize
 
 func (slice FrameSizes) Len() int {
@@ -194,3 +561,107 @@ func (slice FrameSizes) Less(i, j int) bool {
 func (slice FrameSizes) Swap(i, j int) {
 	slice[i], slice[j] = slice[j], slice[i]
 }
+
+// pickFrameSize returns the largest size not exceeding width and height, zero means no limit.
+// Stepwise sizes are rounded down to their step
+func pickFrameSize(sizes FrameSizes, width, height int) (uint32, uint32, error) {
+	sizes = slices.Clone(sizes)
+	sort.Sort(sizes)
+
+	var bestW, bestH uint32
+	for _, size := range sizes {
+		w, ok := fitDimension(size.MinWidth, size.MaxWidth, size.StepWidth, width)
+		if !ok {
+			continue
+		}
+		h, ok := fitDimension(size.MinHeight, size.MaxHeight, size.StepHeight, height)
+		if !ok {
+			continue
+		}
+		if w*h > bestW*bestH {
+			bestW, bestH = w, h
+		}
+	}
+	if bestW == 0 {
+		return 0, 0, fmt.Errorf("camera doesn't offer size within %dx%d, supported sizes: %s", width, height, sizes)
+	}
+	return bestW, bestH, nil
+}
+
+// fitDimension returns the largest value within min..max range not exceeding limit
+func fitDimension(minV, maxV, step uint32, limit int) (uint32, bool) {
+	if limit <= 0 || int(maxV) <= limit {
+		return maxV, true
+	}
+	if int(minV) > limit {
+		return 0, false
+	}
+	if step == 0 {
+		return minV, true
+	}
+	return minV + (uint32(limit)-minV)/step*step, true
+}
+
+func (slice FrameSizes) String() string {
+	names := make([]string, 0, len(slice))
+	for _, size := range slice {
+		name := fmt.Sprintf("%dx%d", size.MaxWidth, size.MaxHeight)
+		if size.MinWidth != size.MaxWidth || size.MinHeight != size.MaxHeight {
+			name = fmt.Sprintf("%dx%d-%s", size.MinWidth, size.MinHeight, name)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// transformJPEG rotates and flips camera JPEG frame, badge is drawn unless empty
+func transformJPEG(frame []byte, t frameTransform, badge CaptureSource) ([]byte, error) {
+	frame, err := passJPEG(frame, "")
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode jpeg frame: %w", err)
+	}
+	out := t.apply(img)
+	if badge != "" {
+		drawBadge(out, badge)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, out, nil); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// passJPEG validates camera JPEG frame and returns its copy, frame buffer is reused by driver.
+// Badge needs decoding, so it's drawn only when asked for
+func passJPEG(frame []byte, badge CaptureSource) ([]byte, error) {
+	// cameras pad frames with zeroes up to buffer size
+	frame = bytes.TrimRight(frame, "\x00")
+	if !bytes.HasPrefix(frame, []byte{0xff, 0xd8}) || !bytes.HasSuffix(frame, []byte{0xff, 0xd9}) {
+		return nil, errors.New("corrupted jpeg frame, no SOI/EOI marker")
+	}
+	if badge == "" {
+		return bytes.Clone(frame), nil
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode jpeg frame: %w", err)
+	}
+	ycbcr, ok := img.(*image.YCbCr)
+	if !ok {
+		// grayscale camera, badge has no color to show
+		return bytes.Clone(frame), nil
+	}
+	drawBadge(ycbcr, badge)
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, ycbcr, nil); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,139 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/blackjack/webcam"
+)
+
+func TestPickFormat(t *testing.T) {
+	c920 := map[webcam.PixelFormat]string{
+		V4L2_PIX_FMT_YUYV:  "YUYV 4:2:2",
+		V4L2_PIX_FMT_MJPEG: "Motion-JPEG",
+	}
+	tests := []struct {
+		name    string
+		offered map[webcam.PixelFormat]string
+		force   string
+		want    webcam.PixelFormat
+	}{
+		{"mjpeg preferred", c920, "", V4L2_PIX_FMT_MJPEG},
+		{"forced yuyv", c920, "YUYV", V4L2_PIX_FMT_YUYV},
+		{"yuyv only", map[webcam.PixelFormat]string{V4L2_PIX_FMT_YUYV: "YUYV 4:2:2"}, "", V4L2_PIX_FMT_YUYV},
+		{"jpeg", map[webcam.PixelFormat]string{V4L2_PIX_FMT_JPEG: "JFIF JPEG", V4L2_PIX_FMT_PJPG: "GSPCA PJPG"}, "", V4L2_PIX_FMT_JPEG},
+		{"yu12 before nv12", map[webcam.PixelFormat]string{V4L2_PIX_FMT_NV12: "Y/CbCr 4:2:0", V4L2_PIX_FMT_YUV420: "Planar YUV 4:2:0"}, "", V4L2_PIX_FMT_YUV420},
+		{"forced nv12", map[webcam.PixelFormat]string{V4L2_PIX_FMT_NV12: "Y/CbCr 4:2:0", V4L2_PIX_FMT_YUV420: "Planar YUV 4:2:0"}, "nv12", V4L2_PIX_FMT_NV12},
+	}
+	for _, tt := range tests {
+		got, err := pickFormat(tt.offered, tt.force)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %x, got %x", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := pickFormat(map[webcam.PixelFormat]string{V4L2_PIX_FMT_PJPG: "GSPCA PJPG"}, ""); err == nil {
+		t.Error("expected error for unsupported formats")
+	}
+	if _, err := pickFormat(c920, "jpeg"); err == nil {
+		t.Error("expected error for forced format camera doesn't offer")
+	}
+}
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	img := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPassJPEG(t *testing.T) {
+	frame := testJPEG(t)
+
+	// padded frame from driver buffer
+	padded := append(bytes.Clone(frame), 0, 0, 0, 0)
+	got, err := passJPEG(padded, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, frame) {
+		t.Error("frame must be passed through without re-encoding")
+	}
+	padded[0] = 0
+	if got[0] != 0xff {
+		t.Error("passed frame must not share driver buffer")
+	}
+
+	if _, err := passJPEG(frame[:len(frame)/2], ""); err == nil {
+		t.Error("expected error for truncated frame")
+	}
+	if _, err := passJPEG(nil, ""); err == nil {
+		t.Error("expected error for empty frame")
+	}
+
+	badged, err := passJPEG(frame, SourceFresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(badged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, g, _, _ := img.At(2, 2).RGBA(); g>>8 < 0x90 {
+		t.Errorf("expected green badge in the corner, got %v", img.At(2, 2))
+	}
+}
+
+func TestPickFrameSize(t *testing.T) {
+	discrete := FrameSizes{
+		{MinWidth: 640, MaxWidth: 640, MinHeight: 480, MaxHeight: 480},
+		{MinWidth: 3840, MaxWidth: 3840, MinHeight: 2160, MaxHeight: 2160},
+		{MinWidth: 1280, MaxWidth: 1280, MinHeight: 720, MaxHeight: 720},
+		{MinWidth: 1920, MaxWidth: 1920, MinHeight: 1080, MaxHeight: 1080},
+	}
+	stepwise := FrameSizes{
+		{MinWidth: 320, MaxWidth: 2592, StepWidth: 16, MinHeight: 240, MaxHeight: 1944, StepHeight: 8},
+	}
+	tests := []struct {
+		name          string
+		sizes         FrameSizes
+		width, height int
+		wantW, wantH  uint32
+	}{
+		{"largest by default", discrete, 0, 0, 3840, 2160},
+		{"exact", discrete, 1280, 720, 1280, 720},
+		{"closest below", discrete, 1900, 1200, 1280, 720},
+		{"width only", discrete, 2000, 0, 1920, 1080},
+		{"height only", discrete, 0, 500, 640, 480},
+		{"stepwise largest", stepwise, 0, 0, 2592, 1944},
+		{"stepwise rounded to step", stepwise, 1000, 750, 992, 744},
+	}
+	for _, tt := range tests {
+		w, h, err := pickFrameSize(tt.sizes, tt.width, tt.height)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("%s: expected %dx%d, got %dx%d", tt.name, tt.wantW, tt.wantH, w, h)
+		}
+	}
+
+	_, _, err := pickFrameSize(discrete, 320, 240)
+	if err == nil {
+		t.Fatal("expected error for size camera can't satisfy")
+	}
+	if !strings.Contains(err.Error(), "640x480, 1280x720, 1920x1080, 3840x2160") {
+		t.Errorf("error doesn't list supported sizes: %v", err)
+	}
+}
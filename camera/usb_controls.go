@@ -0,0 +1,87 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blackjack/webcam"
+)
+
+// controlName is config key of V4L2 control, as v4l2-ctl names it: "Power Line Frequency" is power_line_frequency
+func controlName(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			sep = false
+			b.WriteRune(r)
+			continue
+		}
+		sep = true
+	}
+	return b.String()
+}
+
+// deviceControls returns controls device supports by config key
+func deviceControls(cam webcamDevice) map[string]webcam.ControlID {
+	ids := make(map[string]webcam.ControlID)
+	for id, ctrl := range cam.GetControls() {
+		ids[controlName(ctrl.Name)] = id
+	}
+	return ids
+}
+
+// applyControls sets configured controls, unsupported or rejected ones are only reported
+func (c *usbcamera) applyControls(cam webcamDevice) {
+	ids := deviceControls(cam)
+	names := make([]string, 0, len(ids))
+	for name := range ids {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	c.log.Debug("Supported controls", "controls", names)
+
+	for name, value := range c.cfg.Controls {
+		id, ok := ids[controlName(name)]
+		if !ok {
+			c.log.Warn("camera doesn't support control, skipping it", "device", c.device, "control", name)
+			continue
+		}
+		if err := cam.SetControl(id, value); err != nil {
+			c.log.Warn("fail to set control", "device", c.device, "control", name, "value", value, "err", err)
+			continue
+		}
+		c.log.Info("Set control", "control", name, "value", value)
+	}
+}
+
+// Controls returns current values of device controls sorted by name
+func (c *usbcamera) Controls(ctx context.Context) ([]Control, error) {
+	c.RWMutex.RLock()
+	defer c.RWMutex.RUnlock()
+	if c.unavailable || c.cam == nil {
+		return nil, fmt.Errorf("%s: %w", c.device, ErrCameraUnavailable)
+	}
+
+	var controls []Control
+	for id, ctrl := range c.cam.GetControls() {
+		value, err := c.cam.GetControl(id)
+		if err != nil {
+			return nil, fmt.Errorf("fail to get control %s: %w", ctrl.Name, err)
+		}
+		controls = append(controls, Control{
+			Name:  controlName(ctrl.Name),
+			Value: value,
+			Min:   ctrl.Min,
+			Max:   ctrl.Max,
+			Step:  ctrl.Step,
+		})
+	}
+	slices.SortFunc(controls, func(a, b Control) int { return strings.Compare(a.Name, b.Name) })
+	return controls, nil
+}
@@ -0,0 +1,53 @@
+package camera
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestControlName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Brightness":                      "brightness",
+		"Power Line Frequency":            "power_line_frequency",
+		"White Balance Temperature, Auto": "white_balance_temperature_auto",
+		"power_line_frequency":            "power_line_frequency",
+	} {
+		if got := controlName(name); got != want {
+			t.Errorf("%q: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestUSBControls(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.cfg.Controls = map[string]int32{
+		"brightness":           140,
+		"power_line_frequency": 1,
+		// unsupported and out of range ones are skipped
+		"sharpness":  3,
+		"Brightness": 300,
+	}
+	// controls are applied on open
+	if err := c.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	controls, err := c.Controls(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Control{
+		{Name: "brightness", Value: 140, Min: 0, Max: 255, Step: 1},
+		{Name: "power_line_frequency", Value: 1, Min: 0, Max: 2, Step: 1},
+	}
+	if !slices.Equal(controls, want) {
+		t.Errorf("expected controls %+v, got %+v", want, controls)
+	}
+
+	c.unavailable = true
+	if _, err := c.Controls(t.Context()); !errors.Is(err, ErrCameraUnavailable) {
+		t.Errorf("expected ErrCameraUnavailable for lost device, got %v", err)
+	}
+}
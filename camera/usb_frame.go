@@ -0,0 +1,60 @@
+package camera
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// keeps current frame, the one being written and a couple still encoded by readers
+const framePoolSize = 4
+
+// sharedFrame is owned copy of driver frame, readers retain it while encoding,
+// buffer goes back to pool once the last of them releases it
+type sharedFrame struct {
+	data []byte
+	refs atomic.Int32
+	pool *framePool
+}
+
+func (f *sharedFrame) retain() *sharedFrame {
+	f.refs.Add(1)
+	return f
+}
+
+func (f *sharedFrame) release() {
+	if f.refs.Add(-1) == 0 {
+		f.pool.put(f)
+	}
+}
+
+// framePool reuses frame buffers, so frame copy doesn't allocate megabytes on every read
+type framePool struct {
+	mu   sync.Mutex
+	free []*sharedFrame
+}
+
+// copy returns frame with data copied into reused buffer, it's retained once by caller
+func (p *framePool) copy(data []byte) *sharedFrame {
+	p.mu.Lock()
+	var f *sharedFrame
+	if n := len(p.free); n > 0 {
+		f = p.free[n-1]
+		p.free = p.free[:n-1]
+	}
+	p.mu.Unlock()
+
+	if f == nil {
+		f = &sharedFrame{pool: p}
+	}
+	f.data = append(f.data[:0], data...)
+	f.refs.Store(1)
+	return f
+}
+
+func (p *framePool) put(f *sharedFrame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) < framePoolSize {
+		p.free = append(p.free, f)
+	}
+}
@@ -0,0 +1,97 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"sync"
+	"testing"
+)
+
+// reusingWebcam overwrites single buffer on every read, as driver does with mapped buffers
+type reusingWebcam struct {
+	*fakeWebcam
+	frames [][]byte
+	buf    []byte
+	n      int
+}
+
+func (w *reusingWebcam) ReadFrame() ([]byte, error) {
+	frame := w.frames[w.n%len(w.frames)]
+	w.n++
+	clear(w.buf)
+	copy(w.buf, frame)
+	return w.buf, nil
+}
+
+func whiteJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = 0xff
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUSBCameraFrameRace(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	black, white := testJPEG(t), whiteJPEG(t)
+	c.cam = &reusingWebcam{
+		fakeWebcam: cams.opened[0],
+		frames:     [][]byte{black, white},
+		buf:        make([]byte, max(len(black), len(white))+16),
+	}
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
+	t.Cleanup(func() { c.Close(t.Context()) })
+	waitSnapshot(t, c, nil)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				frame, err := c.Snapshot(t.Context())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(frame.Data, black) && !bytes.Equal(frame.Data, white) {
+					t.Error("torn frame")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFramePoolReuse(t *testing.T) {
+	var pool framePool
+	data := testJPEG(t)
+
+	first := pool.copy(data)
+	reader := first.retain()
+	first.release()
+	second := pool.copy(data)
+	if &second.data[0] == &first.data[0] {
+		t.Fatal("frame retained by reader is reused")
+	}
+	reader.release()
+	second.release()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		pool.copy(data).release()
+	})
+	if allocs != 0 {
+		t.Errorf("expected frame copy without allocations, got %v", allocs)
+	}
+	if f := pool.copy(data); !bytes.Equal(f.data, data) {
+		t.Error("reused buffer has stale data")
+	}
+}
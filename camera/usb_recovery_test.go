@@ -0,0 +1,301 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blackjack/webcam"
+)
+
+// fakeWebcam gives test JPEG frames until it's unplugged, frozen one times out waiting for frame
+type fakeWebcam struct {
+	frame []byte
+	// metadata node has no capture formats
+	metadata  bool
+	unplugged atomic.Bool
+	frozen    atomic.Bool
+	closed    atomic.Bool
+	reads     atomic.Int32
+
+	mu     sync.Mutex
+	values map[webcam.ControlID]int32
+}
+
+var fakeControls = map[webcam.ControlID]webcam.Control{
+	1: {Name: "Brightness", Min: 0, Max: 255, Step: 1},
+	2: {Name: "Power Line Frequency", Min: 0, Max: 2, Step: 1},
+}
+
+func (w *fakeWebcam) GetSupportedFormats() map[webcam.PixelFormat]string {
+	if w.metadata {
+		return nil
+	}
+	return map[webcam.PixelFormat]string{V4L2_PIX_FMT_MJPEG: "Motion-JPEG"}
+}
+
+func (w *fakeWebcam) GetSupportedFrameSizes(format webcam.PixelFormat) []webcam.FrameSize {
+	return []webcam.FrameSize{{MinWidth: 64, MaxWidth: 64, MinHeight: 48, MaxHeight: 48}}
+}
+
+func (w *fakeWebcam) SetImageFormat(format webcam.PixelFormat, width, height uint32) (webcam.PixelFormat, uint32, uint32, error) {
+	return format, width, height, nil
+}
+
+func (w *fakeWebcam) GetControls() map[webcam.ControlID]webcam.Control {
+	return fakeControls
+}
+
+func (w *fakeWebcam) GetControl(id webcam.ControlID) (int32, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.values[id], nil
+}
+
+func (w *fakeWebcam) SetControl(id webcam.ControlID, value int32) error {
+	ctrl, ok := fakeControls[id]
+	if !ok || value < ctrl.Min || value > ctrl.Max {
+		return errors.New("invalid argument")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.values == nil {
+		w.values = make(map[webcam.ControlID]int32)
+	}
+	w.values[id] = value
+	return nil
+}
+
+func (w *fakeWebcam) StartStreaming() error { return nil }
+
+func (w *fakeWebcam) WaitForFrame(timeout uint32) error {
+	time.Sleep(time.Millisecond)
+	if w.unplugged.Load() {
+		return errors.New("no such device")
+	}
+	if w.frozen.Load() {
+		return new(webcam.Timeout)
+	}
+	return nil
+}
+
+func (w *fakeWebcam) ReadFrame() ([]byte, error) {
+	w.reads.Add(1)
+	return w.frame, nil
+}
+
+func (w *fakeWebcam) Close() error {
+	w.closed.Store(true)
+	return nil
+}
+
+// fakeWebcams hands out new fake device on every open while plugged
+type fakeWebcams struct {
+	t       *testing.T
+	mu      sync.Mutex
+	plugged bool
+	opened  []*fakeWebcam
+}
+
+func (f *fakeWebcams) open(path string) (webcamDevice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.plugged {
+		return nil, errors.New("no such file or directory")
+	}
+	cam := &fakeWebcam{frame: testJPEG(f.t)}
+	f.opened = append(f.opened, cam)
+	return cam, nil
+}
+
+func (f *fakeWebcams) setPlugged(plugged bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.plugged = plugged
+	if !plugged {
+		for _, cam := range f.opened {
+			cam.unplugged.Store(true)
+		}
+	}
+}
+
+func (f *fakeWebcams) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.opened)
+}
+
+func newFakeUSBCamera(t *testing.T, cams *fakeWebcams) *usbcamera {
+	t.Helper()
+	orig := openWebcam
+	openWebcam = cams.open
+	t.Cleanup(func() { openWebcam = orig })
+
+	c := &usbcamera{
+		log:        slog.Default(),
+		cfg:        &CameraConfig{},
+		device:     "/dev/video0",
+		life:       newLifecycle(),
+		now:        time.Now,
+		retryDelay: 10 * time.Millisecond,
+	}
+	if err := c.open(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func waitSnapshot(t *testing.T, c *usbcamera, wantErr error) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := c.Snapshot(context.Background())
+		if (wantErr == nil && err == nil) || (wantErr != nil && errors.Is(err, wantErr)) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected snapshot error %v, got %v", wantErr, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUSBCameraReopen(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	go c.handleCamera(t.Context())
+
+	waitSnapshot(t, c, nil)
+
+	cams.setPlugged(false)
+	waitSnapshot(t, c, ErrCameraUnavailable)
+	if !cams.opened[0].closed.Load() {
+		t.Error("lost device isn't closed")
+	}
+
+	cams.setPlugged(true)
+	waitSnapshot(t, c, nil)
+	if n := cams.count(); n != 2 {
+		t.Errorf("expected device opened twice, got %d", n)
+	}
+}
+
+func TestUSBCameraClose(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
+	waitSnapshot(t, c, nil)
+
+	if err := c.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !cams.opened[0].closed.Load() {
+		t.Error("device isn't closed")
+	}
+	if _, err := c.Snapshot(t.Context()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestUSBCameraFrozen(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.cfg.MaxFrameAge = 50 * time.Millisecond
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
+	t.Cleanup(func() { c.Close(context.Background()) })
+	waitSnapshot(t, c, nil)
+
+	info, err := c.Info(t.Context())
+	if err != nil || info.LastFrameAt == nil {
+		t.Fatalf("expected last frame time, got %+v, %v", info, err)
+	}
+
+	cams.opened[0].frozen.Store(true)
+	waitSnapshot(t, c, ErrCameraUnavailable)
+	waitSnapshot(t, c, nil)
+	if !cams.opened[0].closed.Load() {
+		t.Error("frozen device isn't closed")
+	}
+	if n := cams.count(); n != 2 {
+		t.Errorf("expected frozen device reopened, got %d opens", n)
+	}
+}
+
+func TestUSBCameraHealth(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
+	t.Cleanup(func() { c.Close(context.Background()) })
+	waitSnapshot(t, c, nil)
+
+	h, err := c.Health(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Backend != TypeUSB || h.Format != "mjpeg" || h.Width != 64 || h.Height != 48 {
+		t.Errorf("unexpected health %+v", h)
+	}
+	if h.FramesCaptured == 0 || h.LastFrameAt.IsZero() || h.LastError != "" {
+		t.Errorf("expected captured frames and no error, got %+v", h)
+	}
+
+	cams.setPlugged(false)
+	waitSnapshot(t, c, ErrCameraUnavailable)
+	if h, _ := c.Health(t.Context()); h.LastError == "" {
+		t.Error("lost device error isn't reported")
+	}
+}
+
+func TestUSBCameraWarmUp(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.cfg.WarmUpFrames = 5
+	c.cfg.WarmUpTime = 20 * time.Millisecond
+	if _, err := c.Snapshot(t.Context()); err == nil {
+		t.Fatal("expected no frame before warm-up")
+	}
+	started := time.Now()
+	c.life.goRun(func() { c.handleCamera(c.life.ctx) })
+	t.Cleanup(func() { c.Close(context.Background()) })
+
+	waitSnapshot(t, c, nil)
+	if elapsed := time.Since(started); elapsed < c.cfg.WarmUpTime {
+		t.Errorf("expected frame after warm-up time, got it in %s", elapsed)
+	}
+	h, _ := c.Health(t.Context())
+	if reads := cams.opened[0].reads.Load(); int64(reads)-int64(h.FramesCaptured) < 5 {
+		t.Errorf("expected 5 frames dropped, read %d and captured %d", reads, h.FramesCaptured)
+	}
+
+	// reopened device warms up again
+	cams.setPlugged(false)
+	waitSnapshot(t, c, ErrCameraUnavailable)
+	cams.setPlugged(true)
+	waitSnapshot(t, c, nil)
+	if reads := cams.opened[1].reads.Load(); reads <= 5 {
+		t.Errorf("expected frames dropped after reopen, read %d", reads)
+	}
+}
+
+func TestUSBCameraStaleFrame(t *testing.T) {
+	cams := &fakeWebcams{t: t, plugged: true}
+	c := newFakeUSBCamera(t, cams)
+	c.cfg.MaxFrameAge = time.Minute
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.setFrame(c.frames.copy(testJPEG(t)), now.Add(-30*time.Second))
+
+	if _, err := c.Snapshot(context.Background()); err != nil {
+		t.Fatalf("frame within max age: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.Snapshot(context.Background()); !errors.Is(err, ErrCameraUnavailable) {
+		t.Fatalf("expected ErrCameraUnavailable for stale frame, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package camera
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultVideoDevice = "/dev/video0"
+
+// sysfs lists V4L2 devices with card names without opening them, replaced in tests
+var v4l2SysfsDir = "/sys/class/video4linux"
+
+// camera.device of that form selects USB camera by vendor and product id, e.g. 046d:082d
+var usbIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{4}:[0-9a-fA-F]{4}$`)
+
+// VideoDevice is V4L2 device node with card name, e.g. /dev/video0 "HD Pro Webcam C920"
+type VideoDevice struct {
+	Path string
+	Name string
+	// USB vendor:product, empty for devices not on USB
+	USBID string
+}
+
+func (d VideoDevice) String() string {
+	if d.USBID != "" {
+		return fmt.Sprintf("%s (%s, %s)", d.Path, d.Name, d.USBID)
+	}
+	return fmt.Sprintf("%s (%s)", d.Path, d.Name)
+}
+
+// matches reports whether device is selected by USB id or card name substring
+func (d VideoDevice) matches(selector string) bool {
+	if usbIDPattern.MatchString(selector) {
+		return strings.EqualFold(d.USBID, selector)
+	}
+	return strings.Contains(strings.ToLower(d.Name), strings.ToLower(selector))
+}
+
+// listVideoDevices returns /dev/video* nodes sorted by index. ISP and codec nodes are listed too,
+// card name tells them apart
+func listVideoDevices() ([]VideoDevice, error) {
+	entries, err := os.ReadDir(v4l2SysfsDir)
+	if err != nil {
+		return nil, fmt.Errorf("fail to list video devices: %w", err)
+	}
+
+	var devices []VideoDevice
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "video") {
+			continue
+		}
+		name, err := os.ReadFile(filepath.Join(v4l2SysfsDir, entry.Name(), "name"))
+		if err != nil {
+			name = []byte("unknown")
+		}
+		devices = append(devices, VideoDevice{
+			Path:  "/dev/" + entry.Name(),
+			Name:  strings.TrimSpace(string(name)),
+			USBID: usbID(filepath.Join(v4l2SysfsDir, entry.Name(), "device")),
+		})
+	}
+	slices.SortFunc(devices, func(a, b VideoDevice) int {
+		return videoIndex(a.Path) - videoIndex(b.Path)
+	})
+	return devices, nil
+}
+
+// usbID reads vendor and product of USB device, node's device links to its interface
+// and ids are in interface's parent
+func usbID(deviceLink string) string {
+	iface, err := filepath.EvalSymlinks(deviceLink)
+	if err != nil {
+		return ""
+	}
+	vendor, err := os.ReadFile(filepath.Join(filepath.Dir(iface), "idVendor"))
+	if err != nil {
+		return ""
+	}
+	product, err := os.ReadFile(filepath.Join(filepath.Dir(iface), "idProduct"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(vendor)) + ":" + strings.TrimSpace(string(product))
+}
+
+func videoIndex(path string) int {
+	i, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "video"))
+	return i
+}
+
+// isDeviceSelector reports whether camera.device is card name or USB id rather than path or index
+func isDeviceSelector(device string) bool {
+	if device == "" || strings.HasPrefix(device, "/") {
+		return false
+	}
+	_, err := strconv.Atoi(device)
+	return err != nil
+}
+
+// selectVideoDevice returns the first capture node matching selector. Metadata and ISP nodes
+// of the same card are skipped as they have no capture formats
+func selectVideoDevice(selector string) (VideoDevice, error) {
+	devices, err := listVideoDevices()
+	if err != nil {
+		return VideoDevice{}, err
+	}
+	for _, d := range devices {
+		if d.matches(selector) && capturesVideo(d.Path) {
+			return d, nil
+		}
+	}
+	return VideoDevice{}, fmt.Errorf("no capture device matches %q, %s", selector, describeDevices())
+}
+
+func capturesVideo(path string) bool {
+	cam, err := openWebcam(path)
+	if err != nil {
+		return false
+	}
+	defer cam.Close()
+	return len(cam.GetSupportedFormats()) > 0
+}
+
+// resolveDevice turns camera.device into device path: empty is /dev/video0, number N is /dev/videoN.
+// Card name or USB id is kept as is, it's selected on every open as numbering changes
+func resolveDevice(device string) string {
+	if device == "" {
+		return defaultVideoDevice
+	}
+	if i, err := strconv.Atoi(device); err == nil && i >= 0 {
+		return fmt.Sprintf("/dev/video%d", i)
+	}
+	return device
+}
+
+// describeDevices is list of available devices for error messages
+func describeDevices() string {
+	devices, err := listVideoDevices()
+	if err != nil {
+		return err.Error()
+	}
+	if len(devices) == 0 {
+		return "no video devices found"
+	}
+	names := make([]string, 0, len(devices))
+	for _, d := range devices {
+		names = append(names, d.String())
+	}
+	return "available devices: " + strings.Join(names, ", ")
+}
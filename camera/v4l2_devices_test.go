@@ -0,0 +1,157 @@
+package camera
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeSysfs(t *testing.T, devices map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for node, name := range devices {
+		if err := os.MkdirAll(filepath.Join(dir, node), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, node, "name"), []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := v4l2SysfsDir
+	v4l2SysfsDir = dir
+	t.Cleanup(func() { v4l2SysfsDir = prev })
+}
+
+func TestListVideoDevices(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"video10":     "bcm2835-codec-decode",
+		"video2":      "HD Pro Webcam C920",
+		"video0":      "unicam-image",
+		"v4l-subdev0": "imx708",
+	})
+	fakeUSBDevice(t, "video2", "046d", "082d")
+
+	devices, err := listVideoDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []VideoDevice{
+		{"/dev/video0", "unicam-image", ""},
+		{"/dev/video2", "HD Pro Webcam C920", "046d:082d"},
+		{"/dev/video10", "bcm2835-codec-decode", ""},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("expected %v, got %v", want, devices)
+	}
+	for i := range want {
+		if devices[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], devices[i])
+		}
+	}
+
+	if got := describeDevices(); got != "available devices: /dev/video0 (unicam-image), /dev/video2 (HD Pro Webcam C920, 046d:082d), /dev/video10 (bcm2835-codec-decode)" {
+		t.Errorf("unexpected description %q", got)
+	}
+}
+
+// fakeUSBDevice links node of fake sysfs to USB interface of device with given ids
+func fakeUSBDevice(t *testing.T, node, vendor, product string) {
+	t.Helper()
+	dev := filepath.Join(v4l2SysfsDir, "usb1", vendor+product)
+	iface := filepath.Join(dev, "1.0")
+	if err := os.MkdirAll(iface, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"idVendor": vendor, "idProduct": product} {
+		if err := os.WriteFile(filepath.Join(dev, name), []byte(value+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(iface, filepath.Join(v4l2SysfsDir, node, "device")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectVideoDevice(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"video0": "unicam-image",
+		"video2": "HD Pro Webcam C920",
+		"video3": "HD Pro Webcam C920",
+		"video4": "USB Camera",
+	})
+	fakeUSBDevice(t, "video2", "046d", "082d")
+	fakeUSBDevice(t, "video3", "046d", "082d")
+	fakeUSBDevice(t, "video4", "32e4", "9230")
+
+	// video2 is UVC metadata node, capture one comes after it
+	orig := openWebcam
+	openWebcam = func(path string) (webcamDevice, error) {
+		return &fakeWebcam{metadata: path == "/dev/video2"}, nil
+	}
+	t.Cleanup(func() { openWebcam = orig })
+
+	tests := map[string]string{
+		"c920":      "/dev/video3",
+		"USB Cam":   "/dev/video4",
+		"046D:082D": "/dev/video3",
+		"32e4:9230": "/dev/video4",
+	}
+	for selector, want := range tests {
+		d, err := selectVideoDevice(selector)
+		if err != nil {
+			t.Errorf("%q: %v", selector, err)
+			continue
+		}
+		if d.Path != want {
+			t.Errorf("%q: expected %s, got %s", selector, want, d.Path)
+		}
+	}
+
+	_, err := selectVideoDevice("1234:5678")
+	if err == nil || !strings.Contains(err.Error(), "/dev/video4 (USB Camera, 32e4:9230)") {
+		t.Errorf("expected error listing devices, got %v", err)
+	}
+}
+
+func TestIsDeviceSelector(t *testing.T) {
+	for device, want := range map[string]bool{
+		"":                   false,
+		"2":                  false,
+		"/dev/video2":        false,
+		"C920":               true,
+		"046d:082d":          true,
+		"HD Pro Webcam C920": true,
+	} {
+		if got := isDeviceSelector(device); got != want {
+			t.Errorf("%q: expected %v, got %v", device, want, got)
+		}
+	}
+}
+
+func TestResolveDevice(t *testing.T) {
+	tests := map[string]string{
+		"":                                    "/dev/video0",
+		"2":                                   "/dev/video2",
+		"/dev/video3":                         "/dev/video3",
+		"/dev/v4l/by-id/usb-cam-video-index0": "/dev/v4l/by-id/usb-cam-video-index0",
+	}
+	for device, want := range tests {
+		if got := resolveDevice(device); got != want {
+			t.Errorf("%q: expected %s, got %s", device, want, got)
+		}
+	}
+}
+
+func TestNewUSBCameraMissingDevice(t *testing.T) {
+	fakeSysfs(t, map[string]string{"video0": "unicam-image"})
+
+	_, err := NewUSBCamera(slog.Default(), &CameraConfig{Device: filepath.Join(t.TempDir(), "video7")})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "/dev/video0 (unicam-image)") {
+		t.Errorf("expected available devices in error, got %v", err)
+	}
+}
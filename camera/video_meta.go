@@ -0,0 +1,244 @@
+package camera
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// video containers of timelapse.format
+const (
+	VideoMP4  = "mp4"
+	VideoWebM = "webm"
+	VideoGIF  = "gif"
+)
+
+var videoFormats = []string{VideoMP4, VideoWebM, VideoGIF}
+
+// video encoders of timelapse.encoder
+const (
+	EncoderX264    = "libx264"
+	EncoderV4L2M2M = "h264_v4l2m2m"
+)
+
+const (
+	x264CRF = 23
+	// hardware encoder quality is set by bitrate, enough for 768x720
+	hwBitrate = "4M"
+
+	encoderVP9 = "libvpx-vp9"
+	vp9CRF     = 32
+	encoderGIF = "gif"
+	// GIF has no inter-frame compression, so it's kept small and slow
+	gifMaxWidth = 480
+	gifMaxFPS   = 15
+)
+
+// videos are scaled to fit that width if output size isn't configured
+const defaultVideoWidth = 1920
+
+var bitratePattern = regexp.MustCompile(`^[1-9][0-9]*[kKmM]?$`)
+
+// VideoOutput is encoding of timelapse video, zero fields are defaults
+type VideoOutput struct {
+	// frames are scaled to that size, aspect is kept if only one is set.
+	// libx264 needs them even
+	Width  int
+	Height int
+	// libx264 quality, 0-51, lower is better
+	CRF int
+	// like 4M, for hardware encoder or libx264 without CRF
+	Bitrate string
+	// upper limit of frame rate derived from frames count
+	FPSCap int
+}
+
+func (out *VideoOutput) validate() error {
+	for _, dim := range []struct {
+		name  string
+		value int
+	}{{"width", out.Width}, {"height", out.Height}} {
+		if dim.value < 0 || dim.value%2 != 0 {
+			return fmt.Errorf("invalid timelapse.output.%s %d, it has to be even and positive, libx264 can't encode odd sizes", dim.name, dim.value)
+		}
+	}
+	if out.CRF < 0 || out.CRF > 51 {
+		return fmt.Errorf("invalid timelapse.output.crf %d, expected 0-51", out.CRF)
+	}
+	if out.Bitrate != "" && !bitratePattern.MatchString(out.Bitrate) {
+		return fmt.Errorf("invalid timelapse.output.bitrate %q, expected number with optional k or M suffix", out.Bitrate)
+	}
+	if out.FPSCap < 0 {
+		return fmt.Errorf("invalid timelapse.output.fpsCap %d", out.FPSCap)
+	}
+	return nil
+}
+
+// scaleFilter returns ffmpeg scale filter, -2 keeps aspect with even size
+func (out *VideoOutput) scaleFilter() string {
+	switch {
+	case out.Width > 0 && out.Height > 0:
+		return fmt.Sprintf("scale=%d:%d", out.Width, out.Height)
+	case out.Width > 0:
+		return fmt.Sprintf("scale=%d:-2", out.Width)
+	case out.Height > 0:
+		return fmt.Sprintf("scale=-2:%d", out.Height)
+	}
+	// smaller frames aren't upscaled, odd width is rounded down as yuv420p needs even one
+	return fmt.Sprintf("scale='trunc(min(%d,iw)/2)*2':-2", defaultVideoWidth)
+}
+
+// deflickerFilter evens brightness of a frame out with 10 around it, auto exposure
+// makes it pulse otherwise
+const deflickerFilter = "deflicker=mode=pm:size=10"
+
+// gifPaletteFilter encodes GIF with palette generated from the frames, default palette bands gradients
+const gifPaletteFilter = "split[a][b];[a]palettegen[p];[b][p]paletteuse"
+
+// videoFilters are applied to frames besides scaling
+type videoFilters struct {
+	// brightness is smoothed between frames
+	deflicker bool
+	// the last frame is repeated that long
+	hold time.Duration
+	// filters drawing capture times after scaling, empty without them
+	timestamps string
+}
+
+// chain returns -vf filter graph of format. Brightness is evened out on captured frames,
+// before the last one is held, text is drawn after scaling to keep its size
+func (f videoFilters) chain(format string, fps int, out *VideoOutput) string {
+	var chain []string
+	if f.deflicker {
+		chain = append(chain, deflickerFilter)
+	}
+	if f.hold > 0 {
+		chain = append(chain, holdFilter(f.hold))
+	}
+	if format == VideoGIF {
+		chain = append(chain, out.gifScaleFilter(fps))
+	} else {
+		chain = append(chain, out.scaleFilter())
+	}
+	if f.timestamps != "" {
+		chain = append(chain, f.timestamps)
+	}
+	if format == VideoGIF {
+		chain = append(chain, gifPaletteFilter)
+	}
+	return strings.Join(chain, ",")
+}
+
+// holdFilter repeats the last frame, finished print, for hold
+func holdFilter(hold time.Duration) string {
+	return "tpad=stop_mode=clone:stop_duration=" + strconv.FormatFloat(hold.Seconds(), 'f', -1, 64)
+}
+
+// gifScaleFilter caps GIF size and frame rate
+func (out *VideoOutput) gifScaleFilter(fps int) string {
+	width := gifMaxWidth
+	if out.Width > 0 {
+		width = min(width, out.Width)
+	}
+	return fmt.Sprintf("fps=%d,scale='min(%d,iw)':-2:flags=lanczos", min(fps, gifMaxFPS), width)
+}
+
+// endHold is how long video shows finished print
+func (cfg *TimelapseConfig) endHold() time.Duration {
+	return time.Duration(cfg.EndHoldSeconds * float64(time.Second))
+}
+
+func (cfg *TimelapseConfig) formats() []string {
+	if len(cfg.Formats) == 0 {
+		return []string{VideoMP4}
+	}
+	return cfg.Formats
+}
+
+func (cfg *TimelapseConfig) validateFormats() error {
+	for i, format := range cfg.Formats {
+		if !slices.Contains(videoFormats, format) {
+			return fmt.Errorf("invalid timelapse.format %q, expected %s", format, strings.Join(videoFormats, ", "))
+		}
+		if slices.Contains(cfg.Formats[:i], format) {
+			return fmt.Errorf("timelapse.format %s is listed twice", format)
+		}
+	}
+	return nil
+}
+
+// videoFormat returns format of file name by its extension, ok is false for other files
+func videoFormat(name string) (format string, ok bool) {
+	format = strings.TrimPrefix(filepath.Ext(name), ".")
+	return format, slices.Contains(videoFormats, format)
+}
+
+// trimVideoExt returns name without video extension, formats of the same build share it
+func trimVideoExt(name string) string {
+	if _, ok := videoFormat(name); ok {
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+func (cfg *TimelapseConfig) encoder() string {
+	if cfg.Encoder == "" {
+		return EncoderX264
+	}
+	return cfg.Encoder
+}
+
+// videoMeta is sidecar of built videos, written next to them as <video w/o extension>.json.
+// It's a contract for gallery and external tools, fields are only added
+type videoMeta struct {
+	JobID   int    `json:"jobId"`
+	JobName string `json:"jobName"`
+	// capture of the print and its wall-clock duration, unknown for interrupted ones
+	StartedAt       time.Time   `json:"startedAt,omitzero"`
+	FinishedAt      time.Time   `json:"finishedAt,omitzero"`
+	PrintSeconds    float64     `json:"printSeconds,omitempty"`
+	Frames          int         `json:"frames"`
+	FPS             int         `json:"fps"`
+	IntervalSeconds float64     `json:"intervalSeconds,omitempty"`
+	Mode            CaptureMode `json:"mode,omitempty"`
+	// encoder of mp4
+	Encoder string   `json:"encoder,omitempty"`
+	Formats []string `json:"formats"`
+	// file size by format
+	SizeBytes map[string]int64 `json:"sizeBytes"`
+	// poster image, empty if it failed
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// photo of finished print taken with camera.beautyShot arguments
+	FinalShot string    `json:"finalShot,omitempty"`
+	BuiltAt   time.Time `json:"builtAt"`
+}
+
+func videoMetaFile(video string) string {
+	return trimVideoExt(video) + ".json"
+}
+
+func writeVideoMeta(video string, meta *videoMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("fail to marshal video metadata: %w", err)
+	}
+	return writeFileAtomic(videoMetaFile(video), data)
+}
+
+func readVideoMeta(video string) (*videoMeta, error) {
+	data, err := os.ReadFile(videoMetaFile(video))
+	if err != nil {
+		return nil, err
+	}
+	var meta videoMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("fail to parse video metadata: %w", err)
+	}
+	return &meta, nil
+}
@@ -0,0 +1,120 @@
+package camera
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultTimestampFormat   = "2006-01-02 15:04:05"
+	defaultTimestampFontSize = 24
+	defaultTimestampFont     = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+	// drawtext commands of frame times, written to frame dir. Not a frame by extension
+	timestampsFile   = "timestamps.cmd"
+	timestampsMargin = 10
+)
+
+// TimestampsConfig burns capture time of frames into timelapse video
+type TimestampsConfig struct {
+	Enabled bool
+	// Go time layout, "2006-01-02 15:04:05" if empty
+	Format string
+	// top-left, top-right, bottom-left or bottom-right, bottom-left if empty
+	Corner string
+	// in pixels of video, 24 if zero
+	FontSize int
+	// TrueType font, DejaVu Sans if empty. Video is built without timestamps if it's missing
+	FontFile string
+}
+
+func (cfg *TimestampsConfig) validate() error {
+	overlay := OverlayConfig{Corner: cfg.Corner}
+	if err := overlay.validate(); err != nil {
+		return fmt.Errorf("invalid timelapse.timestamps: %w", err)
+	}
+	if cfg.FontSize < 0 {
+		return fmt.Errorf("invalid timelapse.timestamps.fontSize %d", cfg.FontSize)
+	}
+	return nil
+}
+
+// timestampsFilter writes drawtext commands with capture time of every frame of dir,
+// taken from its modification time, and returns filters drawing them. Frame i is shown at i/fps.
+// It's empty if timestamps are off or can't be drawn, video is built without them then
+func (c *timelapseSvc) timestampsFilter(ctx context.Context, dir string, fps int) string {
+	cfg := &c.config.Timestamps
+	if !cfg.Enabled {
+		return ""
+	}
+	font := cmp.Or(cfg.FontFile, defaultTimestampFont)
+	if _, err := os.Stat(font); err != nil {
+		c.log.WarnContext(ctx, "timestamps font is missing, video is built without them", "err", err)
+		return ""
+	}
+	cmds := filepath.Join(dir, timestampsFile)
+	// filter option values are quoted, quote itself can't be escaped there
+	if strings.ContainsRune(font+cmds, '\'') {
+		c.log.WarnContext(ctx, "timestamps font or frame dir has quote in path, video is built without them", "font", font, "dir", dir)
+		return ""
+	}
+	if err := writeTimestamps(cmds, dir, fps, cmp.Or(cfg.Format, defaultTimestampFormat)); err != nil {
+		c.log.WarnContext(ctx, "fail to write frame timestamps, video is built without them", "err", err)
+		return ""
+	}
+
+	var x, y string
+	switch cmp.Or(cfg.Corner, OverlayBottomLeft) {
+	case OverlayTopLeft:
+		x, y = fmt.Sprint(timestampsMargin), fmt.Sprint(timestampsMargin)
+	case OverlayTopRight:
+		x, y = fmt.Sprintf("w-tw-%d", timestampsMargin), fmt.Sprint(timestampsMargin)
+	case OverlayBottomRight:
+		x, y = fmt.Sprintf("w-tw-%d", timestampsMargin), fmt.Sprintf("h-th-%d", timestampsMargin)
+	default:
+		x, y = fmt.Sprint(timestampsMargin), fmt.Sprintf("h-th-%d", timestampsMargin)
+	}
+	return fmt.Sprintf("sendcmd=f='%s',drawtext=fontfile='%s':expansion=none:text=' ':fontsize=%d:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=6:x=%s:y=%s",
+		cmds, font, cmp.Or(cfg.FontSize, defaultTimestampFontSize), x, y)
+}
+
+// writeTimestamps writes sendcmd file switching drawtext text to capture time of every frame
+func writeTimestamps(name, dir string, fps int, layout string) error {
+	frames, err := frameFiles(dir)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("fail to create timestamps file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for i, frame := range frames {
+		info, err := os.Stat(filepath.Join(dir, frame))
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("fail to stat frame: %w", err)
+		}
+		at := float64(i) / float64(fps)
+		fmt.Fprintf(w, "%.6f drawtext reinit 'text=%s';\n", at, drawtextEscape(info.ModTime().Format(layout)))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("fail to write timestamps file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("fail to write timestamps file: %w", err)
+	}
+	return nil
+}
+
+// drawtextEscape escapes text for drawtext option inside quoted sendcmd argument,
+// quotes and command separators are dropped
+func drawtextEscape(text string) string {
+	text = strings.NewReplacer("'", "", ";", "", ",", "").Replace(text)
+	return strings.NewReplacer(`\`, `\\`, ":", `\:`).Replace(text)
+}
@@ -0,0 +1,64 @@
+package camera
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampsFilter(t *testing.T) {
+	dir := t.TempDir()
+	font := filepath.Join(t.TempDir(), "font.ttf")
+	ts := newTestTimelapse(t, &TimelapseConfig{
+		OutputDir:  t.TempDir(),
+		Timestamps: TimestampsConfig{Enabled: true, Format: "15:04:05", Corner: OverlayTopRight, FontFile: font},
+	})
+	at := time.Date(2026, 1, 2, 10, 20, 30, 0, time.Local)
+	for i := range 3 {
+		writeFile(t, shotFilename(dir, i), fakeTimelapseFrame)
+		if err := os.Chtimes(shotFilename(dir, i), at, at.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// missing font doesn't fail the build
+	if filter := ts.timestampsFilter(t.Context(), dir, 2); filter != "" {
+		t.Errorf("expected no filter without font, got %q", filter)
+	}
+
+	writeFile(t, font, []byte("font"))
+	filter := ts.timestampsFilter(t.Context(), dir, 2)
+	cmds := filepath.Join(dir, timestampsFile)
+	if !strings.HasPrefix(filter, "sendcmd=f='"+cmds+"',drawtext=fontfile='"+font+"'") || !strings.Contains(filter, ":x=w-tw-10:y=10") {
+		t.Errorf("unexpected filter %q", filter)
+	}
+	content, err := os.ReadFile(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0.000000 drawtext reinit 'text=10\\:20\\:30';\n" +
+		"0.500000 drawtext reinit 'text=10\\:21\\:30';\n" +
+		"1.000000 drawtext reinit 'text=10\\:22\\:30';\n"
+	if string(content) != want {
+		t.Errorf("unexpected timestamps:\n%s", content)
+	}
+
+	ts.config.Timestamps.Enabled = false
+	if filter := ts.timestampsFilter(t.Context(), dir, 2); filter != "" {
+		t.Errorf("expected no filter while disabled, got %q", filter)
+	}
+}
+
+func TestFFmpegArgsTimestamps(t *testing.T) {
+	args := ffmpegArgs(VideoMP4, 12, "/tmp/frames", "/out/v.mp4", EncoderX264, videoFilters{timestamps: "drawtext"}, &VideoOutput{Width: 1280})
+	if vf := args[slices.Index(args, "-vf")+1]; !strings.HasSuffix(vf, ",drawtext") {
+		t.Errorf("timestamps must be drawn after scaling, got %q", vf)
+	}
+	args = ffmpegArgs(VideoGIF, 12, "/tmp/frames", "/out/v.gif", encoderGIF, videoFilters{timestamps: "drawtext"}, &VideoOutput{})
+	if vf := args[slices.Index(args, "-vf")+1]; !strings.Contains(vf, "flags=lanczos,drawtext,split") {
+		t.Errorf("timestamps must be drawn before palette, got %q", vf)
+	}
+}
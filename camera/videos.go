@@ -0,0 +1,200 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrVideoNotFound    = errors.New("video not found")
+	ErrInvalidVideoName = errors.New("invalid video name")
+	// ErrVideoBusy is returned for video ffmpeg is still writing
+	ErrVideoBusy = errors.New("video is being built")
+)
+
+// TimelapseVideo is finished video in OutputDir
+type TimelapseVideo struct {
+	Name string `json:"name"`
+	// mp4, webm or gif, formats of one build share name w/o extension
+	Format string `json:"format"`
+	// parsed from file name, empty for files named otherwise
+	JobName string `json:"jobName,omitempty"`
+	JobID   int    `json:"jobId,omitempty"`
+	// build time from file name, modification time if it isn't there
+	CreatedAt time.Time `json:"createdAt"`
+	SizeBytes int64     `json:"sizeBytes"`
+	Path      string    `json:"path"`
+	// from metadata sidecar, videos built before it have none
+	PrintStartedAt  time.Time `json:"printStartedAt,omitzero"`
+	PrintFinishedAt time.Time `json:"printFinishedAt,omitzero"`
+	Frames          int       `json:"frames,omitempty"`
+	FPS             int       `json:"fps,omitempty"`
+	// path of photo of finished print, empty without beauty shot
+	FinalShot string `json:"finalShot,omitempty"`
+}
+
+// parseVideoName parses t<unix>-<job>-<id>.<format> of buildVideo. Job name may contain dashes,
+// so it's everything between the first and the last one. ok is false if name doesn't fit
+func parseVideoName(name string) (created time.Time, jobName string, jobID int, ok bool) {
+	rest, found := strings.CutPrefix(trimVideoExt(name), "t")
+	if !found {
+		return time.Time{}, "", 0, false
+	}
+	first, last := strings.Index(rest, "-"), strings.LastIndex(rest, "-")
+	if first < 0 || first == last {
+		return time.Time{}, "", 0, false
+	}
+	unix, err := strconv.ParseInt(rest[:first], 10, 64)
+	if err != nil {
+		return time.Time{}, "", 0, false
+	}
+	id, err := strconv.Atoi(rest[last+1:])
+	if err != nil {
+		return time.Time{}, "", 0, false
+	}
+	return time.Unix(unix, 0), rest[first+1 : last], id, true
+}
+
+// listVideos returns videos of dir newest first, missing dir has no videos. Metadata sidecar
+// is preferred over file name
+func listVideos(dir string) ([]TimelapseVideo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TimelapseVideo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fail to read output dir: %w", err)
+	}
+
+	videos := []TimelapseVideo{}
+	// formats of a build share sidecar
+	metas := map[string]*videoMeta{}
+	for _, e := range entries {
+		format, ok := videoFormat(e.Name())
+		if e.IsDir() || !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// removed while listing
+			continue
+		}
+		video := TimelapseVideo{
+			Name:      e.Name(),
+			Format:    format,
+			CreatedAt: info.ModTime(),
+			SizeBytes: info.Size(),
+			Path:      filepath.Join(dir, e.Name()),
+		}
+		stem := trimVideoExt(e.Name())
+		meta, ok := metas[stem]
+		if !ok {
+			// old videos have no sidecar, broken one is as good as none
+			meta, _ = readVideoMeta(video.Path)
+			metas[stem] = meta
+		}
+		switch created, jobName, jobID, ok := parseVideoName(e.Name()); {
+		case meta != nil:
+			video.CreatedAt, video.JobName, video.JobID = meta.BuiltAt, meta.JobName, meta.JobID
+			video.PrintStartedAt, video.PrintFinishedAt = meta.StartedAt, meta.FinishedAt
+			video.Frames, video.FPS = meta.Frames, meta.FPS
+			video.FinalShot = meta.FinalShot
+		case ok:
+			video.CreatedAt, video.JobName, video.JobID = created, jobName, jobID
+		}
+		videos = append(videos, video)
+	}
+	slices.SortStableFunc(videos, func(a, b TimelapseVideo) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return videos, nil
+}
+
+func isVideo(name string) bool {
+	_, ok := videoFormat(name)
+	return ok
+}
+
+// videoPath returns path of video name in dir. Name has to be plain video file name,
+// symlinks are followed only while they stay within dir
+func videoPath(dir, name string) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\`) ||
+		!isVideo(name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidVideoName, name)
+	}
+	path := filepath.Join(dir, name)
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrVideoNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fail to stat video: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%w: %s is a directory", ErrInvalidVideoName, name)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return path, nil
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("fail to resolve output dir: %w", err)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s is a dangling link", ErrVideoNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fail to resolve video: %w", err)
+	}
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s links outside of output dir", ErrInvalidVideoName, name)
+	}
+	return path, nil
+}
+
+// deleteVideo removes video name of dir. Its sidecars, files and directories with extension
+// added to video name or put in place of video one, like kept frames, are removed with the
+// last format of the build
+func deleteVideo(dir, name string) error {
+	path, err := videoPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("fail to remove video: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("fail to read output dir: %w", err)
+	}
+	stem := trimVideoExt(name)
+	// sidecars of the build stay while other formats of it are there
+	last := true
+	for _, format := range videoFormats {
+		if _, err := os.Lstat(filepath.Join(dir, stem+"."+format)); err == nil {
+			last = false
+			break
+		}
+	}
+	var errs []error
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		if base != name && (!last || base != stem && base != stem+framesSuffix && base != stem+finalShotSuffix) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			errs = append(errs, fmt.Errorf("fail to remove sidecar: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,155 @@
+package camera
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListVideos(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "t1700000000-benchy.gcode-42.mp4"), []byte("old"))
+	writeFile(t, filepath.Join(dir, "t1700003600-my-cube-v2.gcode-7.mp4"), []byte("newer"))
+	writeFile(t, filepath.Join(dir, "t1700003600-my-cube-v2.gcode-7.webm"), []byte("webm"))
+	writeFile(t, filepath.Join(dir, "manual.mp4"), []byte("renamed"))
+	// sidecar wins over file name
+	writeFile(t, filepath.Join(dir, "t1600000000-renamed-1.mp4"), []byte("sidecar"))
+	started := time.Unix(1700010000, 0)
+	meta := &videoMeta{JobID: 9, JobName: "cube.gcode", StartedAt: started, Frames: 120, FPS: 12, BuiltAt: time.Unix(1700020000, 0)}
+	if err := writeVideoMeta(filepath.Join(dir, "t1600000000-renamed-1.mp4"), meta); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "t1700007200-broken-1.mp4.tmp"), nil)
+	writeFile(t, filepath.Join(dir, buildQueueFile), []byte("{}"))
+	// unparseable name is ordered by modification time
+	manualAt := time.Unix(1700001800, 0)
+	if err := os.Chtimes(filepath.Join(dir, "manual.mp4"), manualAt, manualAt); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: dir})
+	videos, err := ts.List(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TimelapseVideo{
+		{Name: "t1600000000-renamed-1.mp4", Format: VideoMP4, JobName: "cube.gcode", JobID: 9, CreatedAt: time.Unix(1700020000, 0), SizeBytes: 7,
+			PrintStartedAt: started, Frames: 120, FPS: 12},
+		{Name: "t1700003600-my-cube-v2.gcode-7.mp4", Format: VideoMP4, JobName: "my-cube-v2.gcode", JobID: 7, CreatedAt: time.Unix(1700003600, 0), SizeBytes: 5},
+		{Name: "t1700003600-my-cube-v2.gcode-7.webm", Format: VideoWebM, JobName: "my-cube-v2.gcode", JobID: 7, CreatedAt: time.Unix(1700003600, 0), SizeBytes: 4},
+		{Name: "manual.mp4", Format: VideoMP4, CreatedAt: manualAt, SizeBytes: 7},
+		{Name: "t1700000000-benchy.gcode-42.mp4", Format: VideoMP4, JobName: "benchy.gcode", JobID: 42, CreatedAt: time.Unix(1700000000, 0), SizeBytes: 3},
+	}
+	if len(videos) != len(want) {
+		t.Fatalf("expected %d videos, got %+v", len(want), videos)
+	}
+	for i, w := range want {
+		w.Path = filepath.Join(dir, w.Name)
+		got := videos[i]
+		if got.Name != w.Name || got.Format != w.Format || got.JobName != w.JobName || got.JobID != w.JobID ||
+			!got.CreatedAt.Equal(w.CreatedAt) || got.SizeBytes != w.SizeBytes || got.Path != w.Path ||
+			!got.PrintStartedAt.Equal(w.PrintStartedAt) || got.Frames != w.Frames || got.FPS != w.FPS {
+			t.Errorf("video %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+
+	// no videos built yet
+	ts.config.OutputDir = filepath.Join(dir, "missing")
+	if videos, err := ts.List(t.Context()); err != nil || len(videos) != 0 {
+		t.Errorf("expected empty list for missing dir, got %+v, %v", videos, err)
+	}
+}
+
+func TestParseVideoName(t *testing.T) {
+	for _, name := range []string{"benchy.mp4", "t-benchy-1.mp4", "t123-benchy.mp4", "tabc-benchy-1.mp4", "t123-benchy-x.mp4"} {
+		if _, _, _, ok := parseVideoName(name); ok {
+			t.Errorf("%s: expected parse failure", name)
+		}
+	}
+}
+
+func TestDeleteVideo(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	video := "t1700000000-benchy.gcode-42.mp4"
+	writeFile(t, filepath.Join(dir, video), []byte("video"))
+	writeFile(t, filepath.Join(dir, "t1700000000-benchy.gcode-42.gif"), []byte("gif"))
+	writeFile(t, filepath.Join(dir, video+".jpg"), []byte("thumb"))
+	writeFile(t, filepath.Join(dir, "t1700000000-benchy.gcode-42.json"), []byte("{}"))
+	writeFile(t, filepath.Join(dir, "t1700000000-benchy.gcode-42.frames.zip"), []byte("zip"))
+	writeFile(t, filepath.Join(dir, "t1700000000-benchy.gcode-42.frames", "image000000.jpg"), []byte("frame"))
+	writeFile(t, filepath.Join(dir, "t1700000000-benchy.gcode-420.mp4"), []byte("other"))
+	writeFile(t, filepath.Join(outside, "secret.mp4"), []byte("keep"))
+	if err := os.Symlink(filepath.Join(outside, "secret.mp4"), filepath.Join(dir, "escape.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "t1700000000-benchy.gcode-420.mp4"), filepath.Join(dir, "alias.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "folder.mp4"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: dir})
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"../" + filepath.Base(outside) + "/secret.mp4", ErrInvalidVideoName},
+		{"..", ErrInvalidVideoName},
+		{filepath.Join(outside, "secret.mp4"), ErrInvalidVideoName},
+		{`..\secret.mp4`, ErrInvalidVideoName},
+		{"escape.mp4", ErrInvalidVideoName},
+		{"folder.mp4", ErrInvalidVideoName},
+		{buildQueueFile, ErrInvalidVideoName},
+		{"missing.mp4", ErrVideoNotFound},
+	}
+	for _, tt := range tests {
+		if err := ts.Delete(t.Context(), tt.name); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+	if !exists(filepath.Join(outside, "secret.mp4")) {
+		t.Fatal("file outside of output dir was removed")
+	}
+
+	// video ffmpeg writes is kept
+	ts.encoding.Store("t1700000000-benchy.gcode-42", true)
+	if err := ts.Delete(t.Context(), video); !errors.Is(err, ErrVideoBusy) {
+		t.Errorf("expected ErrVideoBusy, got %v", err)
+	}
+	ts.encoding.Delete("t1700000000-benchy.gcode-42")
+
+	if err := ts.Delete(t.Context(), video); err != nil {
+		t.Fatal(err)
+	}
+	// sidecars are shared with gif of the same build
+	if exists(filepath.Join(dir, video)) || !exists(filepath.Join(dir, "t1700000000-benchy.gcode-42.json")) {
+		t.Error("expected only mp4 to be removed")
+	}
+	if err := ts.Delete(t.Context(), "t1700000000-benchy.gcode-42.gif"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"t1700000000-benchy.gcode-42.gif", video + ".jpg", "t1700000000-benchy.gcode-42.json",
+		"t1700000000-benchy.gcode-42.frames.zip", "t1700000000-benchy.gcode-42.frames"} {
+		if exists(filepath.Join(dir, name)) {
+			t.Errorf("%s wasn't removed", name)
+		}
+	}
+	if !exists(filepath.Join(dir, "t1700000000-benchy.gcode-420.mp4")) {
+		t.Error("video of other job was removed")
+	}
+	if err := ts.Delete(t.Context(), video); !errors.Is(err, ErrVideoNotFound) {
+		t.Errorf("expected ErrVideoNotFound for deleted video, got %v", err)
+	}
+
+	// link within output dir is removed, video it points to stays
+	if err := ts.Delete(t.Context(), "alias.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if exists(filepath.Join(dir, "alias.mp4")) || !exists(filepath.Join(dir, "t1700000000-benchy.gcode-420.mp4")) {
+		t.Error("expected only link to be removed")
+	}
+}
@@ -0,0 +1,60 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// frameRoot returns directory frame dirs are created in, timelapse.workDir or system temp dir
+func (c *timelapseSvc) frameRoot() string {
+	if c.workDir != "" {
+		return c.workDir
+	}
+	return os.TempDir()
+}
+
+// prepareWorkDir creates WorkDir and checks frames can be written there. Frames go to
+// system temp dir if it's not set or not usable
+func (c *timelapseSvc) prepareWorkDir(ctx context.Context) {
+	if c.config.WorkDir == "" {
+		return
+	}
+	dir, err := filepath.Abs(c.config.WorkDir)
+	if err == nil {
+		err = checkWritableDir(dir)
+	}
+	if err != nil {
+		c.log.WarnContext(ctx, "timelapse work dir isn't usable, frames go to system temp dir",
+			"err", err, "workDir", c.config.WorkDir, "tmpDir", os.TempDir())
+		return
+	}
+	c.workDir = dir
+	c.log.InfoContext(ctx, "timelapse frames go to work dir", "dir", dir)
+}
+
+// prepareOutputDir creates OutputDir, so build queue can save its state before the first video
+func (c *timelapseSvc) prepareOutputDir(ctx context.Context) {
+	if c.config.OutputDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.config.OutputDir, 0o755); err != nil {
+		c.log.ErrorContext(ctx, "fail to create timelapse output dir", "err", err, "dir", c.config.OutputDir)
+	}
+}
+
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("fail to create work dir: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".writecheck*")
+	if err != nil {
+		return fmt.Errorf("work dir isn't writable: %w", err)
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("fail to clean up work dir check: %w", err)
+	}
+	return nil
+}
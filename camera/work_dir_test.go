@@ -0,0 +1,49 @@
+package camera
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkDir(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	useFakeRunner(t)
+	workDir := filepath.Join(t.TempDir(), "ssd", "frames")
+	ts := newTestTimelapse(t, &TimelapseConfig{Enabled: true, Interval: 20, OutputDir: t.TempDir(), WorkDir: workDir}, withRpicam())
+
+	ts.prepareWorkDir(t.Context())
+	if ts.frameRoot() != workDir {
+		t.Fatalf("expected frames in %s, got %s", workDir, ts.frameRoot())
+	}
+	if err := ts.StartManual(t.Context(), "ssd"); err != nil {
+		t.Fatal(err)
+	}
+	defer ts.StopManual(t.Context())
+	if dir := ts.current.Load().currentDir; filepath.Dir(dir) != workDir || !strings.HasPrefix(filepath.Base(dir), frameDirPrefix) {
+		t.Errorf("expected frame dir in work dir, got %s", dir)
+	}
+
+	// file in place of dir
+	notDir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"", notDir} {
+		ts := newTestTimelapse(t, &TimelapseConfig{WorkDir: dir})
+		ts.prepareWorkDir(t.Context())
+		if ts.frameRoot() != os.TempDir() {
+			t.Errorf("%q: expected fallback to system temp dir, got %s", dir, ts.frameRoot())
+		}
+	}
+}
+
+func TestPrepareOutputDir(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "timelapses", "pi")
+	ts := newTestTimelapse(t, &TimelapseConfig{OutputDir: out})
+	ts.prepareOutputDir(t.Context())
+	if info, err := os.Stat(out); err != nil || !info.IsDir() {
+		t.Fatalf("output dir wasn't created: %v", err)
+	}
+}
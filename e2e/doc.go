@@ -0,0 +1,3 @@
+// Package e2e runs the whole server against a fake printer, fake PrusaConnect
+// and recorded camera/ffmpeg commands. It has no code besides tests.
+package e2e
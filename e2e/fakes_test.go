@@ -0,0 +1,254 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/tuzkov/prusaCam/camera"
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// fakePrinter is PrusaLink API serving whatever job state test sets
+type fakePrinter struct {
+	*httptest.Server
+
+	sync.Mutex
+	state    string
+	jobID    int
+	fileName string
+	progress float64
+	requests int
+}
+
+func newFakePrinter() *fakePrinter {
+	p := &fakePrinter{state: prusalinkclient.StatusIdle}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serveJob))
+	return p
+}
+
+func (p *fakePrinter) Set(state string, jobID int, fileName string, progress float64) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.state = state
+	p.jobID = jobID
+	p.fileName = fileName
+	p.progress = progress
+}
+
+// Address is host:port, as it goes to printer.address config
+func (p *fakePrinter) Address() string {
+	return p.Listener.Addr().String()
+}
+
+func (p *fakePrinter) serveJob(w http.ResponseWriter, req *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+	p.requests++
+
+	if req.URL.Path != "/api/v1/job" {
+		http.NotFound(w, req)
+		return
+	}
+	if p.state == prusalinkclient.StatusIdle {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":       p.jobID,
+		"state":    p.state,
+		"progress": p.progress,
+		"file": map[string]any{
+			"name":         p.fileName,
+			"display_name": p.fileName,
+		},
+	})
+}
+
+type upload struct {
+	token       string
+	fingerprint string
+	body        []byte
+}
+
+// fakeConnect records snapshots uploaded to PrusaConnect
+type fakeConnect struct {
+	*httptest.Server
+
+	sync.Mutex
+	uploads []upload
+}
+
+func newFakeConnect() *fakeConnect {
+	c := &fakeConnect{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || req.URL.Path != "/c/snapshot" {
+			http.NotFound(w, req)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+
+		c.Lock()
+		c.uploads = append(c.uploads, upload{
+			token:       req.Header.Get("Token"),
+			fingerprint: req.Header.Get("Fingerprint"),
+			body:        body,
+		})
+		c.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return c
+}
+
+func (c *fakeConnect) Uploads() []upload {
+	c.Lock()
+	defer c.Unlock()
+	return slices.Clone(c.uploads)
+}
+
+type invocation struct {
+	name string
+	args []string
+}
+
+// fakeRunner records commands instead of executing them. rpicam invocations
+// write deterministic frames, so the rest of pipeline sees real files
+type fakeRunner struct {
+	sync.Mutex
+	calls []invocation
+}
+
+var fakeBinaries = map[string]bool{
+	"rpicam-still": true,
+	"rpicam-vid":   true,
+	"ffmpeg":       true,
+}
+
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	if !fakeBinaries[file] {
+		return "", exec.ErrNotFound
+	}
+	return "/fake/bin/" + file, nil
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	r.record(name, args)
+
+	switch filepath.Base(name) {
+	case "rpicam-still":
+		if slices.Contains(args, "--version") {
+			return []byte("rpicam-apps build: v1.5.0-fake\nlibcamera build: v0.3.0-fake\n"), nil
+		}
+		return nil, os.WriteFile(outputArg(args), testFrame(0), 0o644)
+	}
+	return nil, nil
+}
+
+// Start emulates rpicam-still --timelapse: writes few frames and runs till cancelled
+func (r *fakeRunner) Start(ctx context.Context, output io.Writer, name string, args ...string) (camera.Process, error) {
+	r.record(name, args)
+
+	pattern := outputArg(args)
+	if slices.Contains(args, "--signal") {
+		return &fakeProcess{ctx: ctx, pattern: pattern}, nil
+	}
+	for i := range 3 {
+		if err := os.WriteFile(fmt.Sprintf(pattern, i), testFrame(i), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return &fakeProcess{ctx: ctx}, nil
+}
+
+// Pipe emulates rpicam-vid MJPEG output: streams test frames till cancelled
+func (r *fakeRunner) Pipe(ctx context.Context, name string, args ...string) (io.ReadCloser, camera.Process, error) {
+	r.record(name, args)
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		for i := 0; ctx.Err() == nil; i++ {
+			if _, err := pw.Write(testFrame(i)); err != nil {
+				return
+			}
+		}
+	}()
+	return pr, &fakeProcess{ctx: ctx}, nil
+}
+
+func (r *fakeRunner) record(name string, args []string) {
+	r.Lock()
+	defer r.Unlock()
+	r.calls = append(r.calls, invocation{name: name, args: slices.Clone(args)})
+}
+
+// Calls returns invocations of binary with given base name
+func (r *fakeRunner) Calls(name string) []invocation {
+	r.Lock()
+	defer r.Unlock()
+
+	var calls []invocation
+	for _, c := range r.calls {
+		if filepath.Base(c.name) == name {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+type fakeProcess struct {
+	ctx context.Context
+	// rpicam-still --signal output, frame is written per signal
+	pattern string
+	shots   int
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.ctx.Done()
+	return p.ctx.Err()
+}
+
+func (p *fakeProcess) Signal(sig os.Signal) error {
+	if p.pattern == "" {
+		return nil
+	}
+	p.shots++
+	return os.WriteFile(fmt.Sprintf(p.pattern, p.shots-1), testFrame(0), 0o644)
+}
+
+func outputArg(args []string) string {
+	i := slices.Index(args, "-o")
+	if i < 0 || i+1 >= len(args) {
+		return ""
+	}
+	return args[i+1]
+}
+
+// testFrame is small deterministic jpeg, different for every i
+func testFrame(i int) []byte {
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := range 48 {
+		for x := range 64 {
+			img.SetGray(x, y, color.Gray{Y: uint8(x*4 + y + i*40)})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	jpeg.Encode(buf, img, nil)
+	return buf.Bytes()
+}
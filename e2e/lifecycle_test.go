@@ -0,0 +1,399 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tuzkov/prusaCam/camera"
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/server"
+	"github.com/tuzkov/prusaCam/service"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+type harness struct {
+	t *testing.T
+
+	printer   *fakePrinter
+	connect   *fakeConnect
+	runner    *fakeRunner
+	outputDir string
+	baseURL   string
+
+	opts []func(cfg *service.Config)
+	srv  server.Server
+}
+
+// newHarness boots the full server on random port against fakes, opts adjust config
+// of rpi camera capturing timelapse
+func newHarness(t *testing.T, opts ...func(cfg *service.Config)) *harness {
+	// frame dirs are created in system temp dir, keep them away from real leftovers
+	t.Setenv("TMPDIR", t.TempDir())
+
+	h := &harness{
+		t:         t,
+		printer:   newFakePrinter(),
+		connect:   newFakeConnect(),
+		runner:    &fakeRunner{},
+		outputDir: t.TempDir(),
+	}
+	t.Cleanup(h.printer.Close)
+	t.Cleanup(h.connect.Close)
+
+	prevRunner := camera.Runner
+	camera.Runner = h.runner
+	t.Cleanup(func() { camera.Runner = prevRunner })
+
+	h.opts = opts
+	h.start()
+	t.Cleanup(func() {
+		if h.srv != nil {
+			h.shutdown(context.Background())
+		}
+	})
+	return h
+}
+
+// start boots the server, state of the previous one is kept in output and temp dirs
+func (h *harness) start() {
+	h.t.Helper()
+
+	cfg := &server.Config{
+		LogLevel: "info",
+		Config: service.Config{
+			PrinterConfig: prusalinkclient.PrinterConfig{
+				Address:  h.printer.Address(),
+				Username: "maker",
+				ApiKey:   "apikey",
+				CacheTTL: 10 * time.Millisecond,
+			},
+			TimelapseConfig: camera.TimelapseConfig{
+				Enabled:     true,
+				Interval:    20,
+				Loglevel:    "info",
+				VideoLenght: 7,
+				OutputDir:   h.outputDir,
+				MinFPS:      12,
+			},
+			Enabled:                true,
+			PrusaCameraToken:       "token",
+			PrusaCameraFingerprint: "fingerprint",
+			PrusaConnectEndpoint:   h.connect.URL + "/c/snapshot",
+			SendInterval:           100 * time.Millisecond,
+			PollInterval:           50 * time.Millisecond,
+		},
+	}
+	for _, opt := range h.opts {
+		opt(&cfg.Config)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := server.NewServer(log, cfg)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	h.srv = srv
+	h.baseURL = "http://" + ln.Addr().String()
+}
+
+// shutdown stops the server the way SIGTERM does
+func (h *harness) shutdown(ctx context.Context) {
+	h.t.Helper()
+
+	if err := h.srv.Shutdown(ctx); err != nil {
+		h.t.Error(err)
+	}
+	h.srv = nil
+}
+
+func (h *harness) get(path string) (*http.Response, []byte) {
+	h.t.Helper()
+
+	resp, err := http.Get(h.baseURL + path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return resp, body
+}
+
+// eventually polls cond till it's true or timeout is reached
+func (h *harness) eventually(what string, cond func() bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// golden compares body with testdata/<name>.golden, -update rewrites it
+func (h *harness) golden(name string, body []byte) {
+	h.t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if !bytes.Equal(body, want) {
+		h.t.Errorf("%s mismatch\ngot:  %s\nwant: %s", name, body, want)
+	}
+}
+
+// streamFrame reads the first frame of MJPEG stream of path
+func (h *harness) streamFrame(path string) []byte {
+	h.t.Helper()
+
+	ctx, cancel := context.WithTimeout(h.t.Context(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+path, nil)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" {
+		h.t.Fatalf("expected multipart stream, got %q %v", resp.Header.Get("Content-Type"), err)
+	}
+	part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+	if err != nil {
+		h.t.Fatalf("fail to read stream part: %v", err)
+	}
+	if ct := part.Header.Get("Content-Type"); ct != "image/jpeg" {
+		h.t.Errorf("expected jpeg stream part, got %q", ct)
+	}
+	frame, err := io.ReadAll(part)
+	if err != nil {
+		h.t.Fatalf("fail to read stream frame: %v", err)
+	}
+	return frame
+}
+
+func (h *harness) cameraBusy() bool {
+	_, body := h.get("/status")
+	return bytes.Contains(body, []byte(`"cameraBusy":true`))
+}
+
+func TestPrintLifecycle(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get("/api/camera/info")
+	h.golden("camera_info", body)
+	_, body = h.get("/status")
+	h.golden("status_idle", body)
+
+	// idle printer, snapshot is captured on demand
+	resp, body := h.get("/snapshot")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("snapshot status %d: %s", resp.StatusCode, body)
+	}
+	if src := resp.Header.Get("X-Capture-Source"); src != string(camera.SourceFresh) {
+		t.Errorf("expected fresh snapshot, got %q", src)
+	}
+	if !bytes.Equal(body, testFrame(0)) {
+		t.Error("snapshot doesn't match captured frame")
+	}
+	// rpicam-vid writes test frames one after another
+	if frame := h.streamFrame("/stream"); !isTestFrame(frame, 3) {
+		t.Error("stream frame doesn't match rpicam-vid output")
+	}
+
+	// printer is online, so snapshots are uploaded
+	h.eventually("PrusaConnect upload", func() bool { return len(h.connect.Uploads()) > 0 })
+	for _, u := range h.connect.Uploads() {
+		if u.token != "token" || u.fingerprint != "fingerprint" {
+			t.Errorf("unexpected upload credentials %q/%q", u.token, u.fingerprint)
+		}
+		if !bytes.Equal(u.body, testFrame(0)) {
+			t.Error("uploaded snapshot doesn't match captured frame")
+		}
+	}
+
+	// print starts, timelapse takes the camera
+	h.printer.Set(prusalinkclient.StatusPrinting, 42, "benchy.gcode", 3)
+	h.eventually("timelapse start", h.cameraBusy)
+
+	resp, body = h.get("/snapshot")
+	if src := resp.Header.Get("X-Capture-Source"); src != string(camera.SourceTimelapse) {
+		t.Errorf("expected timelapse frame, got %q", src)
+	}
+	if !bytes.Equal(body, testFrame(2)) {
+		t.Error("snapshot should be the latest timelapse frame")
+	}
+
+	_, body = h.get("/api/timelapse")
+	var tl camera.TimelapseStatus
+	if err := json.Unmarshal(body, &tl); err != nil {
+		t.Fatalf("fail to decode timelapse status %q: %v", body, err)
+	}
+	if !tl.Running || tl.JobID != 42 || tl.JobName != "benchy.gcode" || tl.Frames != 3 {
+		t.Errorf("unexpected timelapse status %+v", tl)
+	}
+
+	// print finishes, video is built from captured frames
+	h.printer.Set(prusalinkclient.StatusFinished, 42, "benchy.gcode", 100)
+	h.eventually("timelapse finish", func() bool { return !h.cameraBusy() })
+	h.eventually("ffmpeg run", func() bool { return len(h.runner.Calls("ffmpeg")) > 0 })
+
+	timelapses := h.runner.Calls("rpicam-still")
+	var frameDir string
+	for _, c := range timelapses {
+		if strings.Contains(strings.Join(c.args, " "), "--timelapse") {
+			frameDir = filepath.Dir(outputArg(c.args))
+		}
+	}
+	if frameDir == "" {
+		t.Fatal("timelapse capture was not started")
+	}
+
+	h.eventually("build done", func() bool {
+		_, body := h.get("/api/builds")
+		return !bytes.Contains(body, []byte(`"active"`))
+	})
+	_, body = h.get("/api/builds")
+	var builds camera.BuildsStatus
+	if err := json.Unmarshal(body, &builds); err != nil {
+		t.Fatalf("fail to decode builds %q: %v", body, err)
+	}
+	// times and frame dir differ every run
+	for i := range builds.Done {
+		done := &builds.Done[i]
+		if done.QueuedAt.IsZero() || done.BuildStartedAt.IsZero() || done.DoneAt.IsZero() {
+			t.Errorf("build times are missing %+v", done)
+		}
+		done.Dir, done.QueuedAt, done.StartedAt, done.FinishedAt = "", time.Time{}, time.Time{}, time.Time{}
+		done.BuildStartedAt, done.DoneAt = time.Time{}, time.Time{}
+	}
+	body, _ = json.Marshal(builds)
+	h.golden("builds_done", body)
+
+	// video and its thumbnail
+	ffmpeg := h.runner.Calls("ffmpeg")
+	if len(ffmpeg) != 2 {
+		t.Fatalf("expected exactly two ffmpeg runs, got %d", len(ffmpeg))
+	}
+	args := ffmpeg[0].args
+	cmd := strings.Join(args, " ")
+	for _, part := range []string{
+		"-r 12 ",
+		"-i " + filepath.Join(frameDir, "*.jpg") + " ",
+	} {
+		if !strings.Contains(cmd, part) {
+			t.Errorf("ffmpeg command %q doesn't contain %q", cmd, part)
+		}
+	}
+	if output := args[len(args)-1]; !strings.HasPrefix(output, filepath.Join(h.outputDir, "t")) ||
+		!strings.HasSuffix(output, "-benchy-42.mp4") {
+		t.Errorf("unexpected ffmpeg output %q", output)
+	}
+	thumb := ffmpeg[1].args
+	if output := thumb[len(thumb)-1]; !strings.HasSuffix(output, "-benchy-42.jpg") || thumb[slices.Index(thumb, "-i")+1] != args[len(args)-1] {
+		t.Errorf("unexpected thumbnail command %q", thumb)
+	}
+
+	// video metadata is listed, state files of output dir aren't
+	_, body = h.get("/list/")
+	if !bytes.Contains(body, []byte("-benchy-42.json")) || bytes.Contains(body, []byte(".buildqueue.json")) {
+		t.Errorf("unexpected output dir listing %s", body)
+	}
+	if resp, _ := h.get("/list/.buildqueue.json"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("build queue state is served with status %d", resp.StatusCode)
+	}
+}
+
+// TestShutdownMidPrint restarts the server in the middle of print, timelapse video is built
+// either before exit or after restart
+func TestShutdownMidPrint(t *testing.T) {
+	for _, onShutdown := range []string{camera.ShutdownResume, camera.ShutdownFinish} {
+		t.Run(onShutdown, func(t *testing.T) {
+			h := newHarness(t, func(cfg *service.Config) {
+				cfg.TimelapseConfig.OnShutdown = onShutdown
+			})
+			h.printer.Set(prusalinkclient.StatusPrinting, 42, "benchy.gcode", 3)
+			h.eventually("timelapse start", h.cameraBusy)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			h.shutdown(ctx)
+			session := filepath.Join(h.outputDir, ".timelapse.json")
+			if _, err := os.Stat(session); onShutdown == camera.ShutdownResume && err != nil {
+				t.Fatalf("session isn't kept for resume: %v", err)
+			}
+			if calls := h.runner.Calls("ffmpeg"); len(calls) > 0 {
+				t.Errorf("video is built while shutting down: %v", calls)
+			}
+
+			// print finishes while the server is down
+			h.printer.Set(prusalinkclient.StatusFinished, 42, "benchy.gcode", 100)
+			h.start()
+			h.eventually("video build of interrupted timelapse", func() bool {
+				_, body := h.get("/api/builds")
+				var builds camera.BuildsStatus
+				if err := json.Unmarshal(body, &builds); err != nil {
+					t.Fatalf("fail to decode builds %q: %v", body, err)
+				}
+				return len(builds.Active) == 0 && len(builds.Pending) == 0 &&
+					slices.ContainsFunc(builds.Done, func(job camera.BuildJob) bool { return job.JobID == 42 })
+			})
+			if !slices.ContainsFunc(h.runner.Calls("ffmpeg"), func(c invocation) bool {
+				return strings.HasSuffix(c.args[len(c.args)-1], "-benchy-42.mp4")
+			}) {
+				t.Error("video isn't encoded")
+			}
+			if _, err := os.Stat(session); !os.IsNotExist(err) {
+				t.Errorf("session of built timelapse is kept: %v", err)
+			}
+		})
+	}
+}
+
+// isTestFrame reports whether frame is one of first n test frames
+func isTestFrame(frame []byte, n int) bool {
+	for i := range n {
+		if bytes.Equal(frame, testFrame(i)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tuzkov/prusaCam/camera"
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/service"
+)
+
+func TestMockCameraLifecycle(t *testing.T) {
+	mockDir := t.TempDir()
+	for i := range 3 {
+		if err := os.WriteFile(filepath.Join(mockDir, fmt.Sprintf("frame%d.jpg", i)), testFrame(i), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newHarness(t, func(cfg *service.Config) {
+		cfg.CameraConfig = camera.CameraConfig{Type: camera.TypeMock, MockDir: mockDir}
+		// mock camera doesn't capture timelapse
+		cfg.TimelapseConfig.Enabled = false
+	})
+
+	_, body := h.get("/api/camera/info")
+	h.golden("camera_info_mock", body)
+
+	// sender takes frames too, so which of them comes next varies
+	resp, body := h.get("/snapshot")
+	if resp.StatusCode != http.StatusOK || !isTestFrame(body, 3) {
+		t.Fatalf("expected mock frame, got status %d", resp.StatusCode)
+	}
+	if src := resp.Header.Get("X-Capture-Source"); src != string(camera.SourceFresh) {
+		t.Errorf("expected fresh snapshot, got %q", src)
+	}
+	if frame := h.streamFrame("/stream"); !isTestFrame(frame, 3) {
+		t.Error("stream frame isn't mock frame")
+	}
+	_, body = h.get("/status")
+	if !bytes.Contains(body, []byte(`"backend":"mock"`)) || !bytes.Contains(body, []byte(`"cameraBusy":false`)) {
+		t.Errorf("unexpected status %s", body)
+	}
+
+	h.eventually("PrusaConnect upload", func() bool { return len(h.connect.Uploads()) > 0 })
+	for _, u := range h.connect.Uploads() {
+		if !isTestFrame(u.body, 3) {
+			t.Error("uploaded snapshot isn't mock frame")
+		}
+	}
+
+	// print doesn't take the camera without timelapse
+	h.printer.Set(prusalinkclient.StatusPrinting, 42, "benchy.gcode", 3)
+	uploads := len(h.connect.Uploads())
+	h.eventually("PrusaConnect upload while printing", func() bool { return len(h.connect.Uploads()) > uploads })
+	if h.cameraBusy() {
+		t.Error("camera is busy without timelapse")
+	}
+	_, body = h.get("/api/timelapse")
+	var tl camera.TimelapseStatus
+	if err := json.Unmarshal(body, &tl); err != nil || tl.Running {
+		t.Errorf("expected no timelapse, got %s, %v", body, err)
+	}
+	if frame := h.streamFrame("/stream"); !isTestFrame(frame, 3) {
+		t.Error("stream frame isn't mock frame while printing")
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -14,7 +21,10 @@ import (
 	"github.com/tuzkov/prusaCam/service"
 )
 
-var loglevel = new(slog.LevelVar)
+var (
+	loglevel = new(slog.LevelVar)
+	demo     bool
+)
 
 var serverCmd = &cobra.Command{
 	Use: "prusacam",
@@ -26,14 +36,83 @@ var serverCmd = &cobra.Command{
 	},
 }
 
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check environment and configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !doctor() {
+			os.Exit(1)
+		}
+	},
+}
+
+var timelapseCmd = &cobra.Command{
+	Use:   "timelapse",
+	Short: "Timelapse tools",
+}
+
+var timelapseBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build video of frame directory left by failed or interrupted timelapse",
+	Long: "Build video of frame directory like timelapse build does, with timelapse config: encoder, " +
+		"output, filters, thumbnail and metadata sidecar. Frames are left in place, progress is printed while ffmpeg runs",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return buildTimelapse(cmd.Context())
+	},
+}
+
+var dirBuild camera.DirBuild
+
+// buildTimelapse builds video of dirBuild, progress is logged to terminal
+func buildTimelapse(ctx context.Context) error {
+	cfg := getConfig()
+	setLogLevel(cfg.LogLevel)
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: loglevel,
+	}))
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	dirBuild.Progress = os.Stdout
+	err := camera.BuildDir(ctx, log, &cfg.TimelapseConfig, dirBuild)
+	if errors.Is(err, camera.ErrVideoExists) {
+		return fmt.Errorf("%w, use --force to overwrite it", err)
+	}
+	return err
+}
+
 func initConfig() {
 	viper.SetDefault("username", "maker")
 	viper.SetDefault("port", 8080)
 	viper.SetDefault("loglevel", "info")
+	viper.SetDefault("shutdownTimeout", 30*time.Second)
 	viper.SetDefault("timelapse.interval", 20)
 	viper.SetDefault("timelapse.videoLenght", 7)
 	viper.SetDefault("timelapse.outputDir", "~/timelapses/")
 	viper.SetDefault("timelapse.minFPS", 12)
+	viper.SetDefault("timelapse.orphanFrames", camera.OrphansRebuild)
+	viper.SetDefault("timelapse.partialOutputs", camera.PartialQuarantine)
+	viper.SetDefault("timelapse.onShutdown", camera.ShutdownResume)
+	viper.SetDefault("timelapse.minFreeSpace", 500)
+	viper.SetDefault("timelapse.keepFrames", camera.KeepFramesNone)
+	viper.SetDefault("timelapse.encoder", camera.EncoderX264)
+	viper.SetDefault("timelapse.mode", camera.ModeTime)
+	viper.SetDefault("timelapse.maxFramesAction", camera.MaxFramesStop)
+	viper.SetDefault("timelapse.captureRestarts", 3)
+	viper.SetDefault("timelapse.stopGrace", 30*time.Second)
+	viper.SetDefault("timelapse.pollInterval", time.Minute)
+	viper.SetDefault("timelapse.startAt", camera.StartProgress)
+	viper.SetDefault("timelapse.startTimeout", 30*time.Minute)
+	viper.SetDefault("timelapse.format", []string{camera.VideoMP4})
+	viper.SetDefault("timelapse.endHoldSeconds", 2)
+	viper.SetDefault("timelapse.buildConcurrency", 1)
+	viper.SetDefault("timelapse.formatTimeout", 10*time.Minute)
+	viper.SetDefault("timelapse.hooks.timeout", 10*time.Second)
+	viper.SetDefault("timelapse.hooks.retries", 2)
+	viper.SetDefault("timelapse.buildRetries", 2)
+	viper.SetDefault("timelapse.buildRetryDelay", 30*time.Second)
 
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
@@ -55,11 +134,30 @@ func entrypoint() error {
 		return fmt.Errorf("fail to create server: %w", err)
 	}
 
-	if err := srv.Start(); err != nil {
-		return fmt.Errorf("fail to listen: %w", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Start()
+	}()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			return fmt.Errorf("fail to listen: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
 	}
 
-	return nil
+	log.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("fail to shutdown: %w", err)
+	}
+	return <-served
 }
 
 func getConfig() *server.Config {
@@ -67,27 +165,322 @@ func getConfig() *server.Config {
 		Addr:     fmt.Sprintf(":%d", viper.GetInt("port")),
 		LogLevel: viper.GetString("loglevel"),
 
+		ShutdownTimeout: viper.GetDuration("shutdownTimeout"),
+
 		Config: service.Config{
-			PrinterConfig: prusalinkclient.PrinterConfig{
-				Address:  viper.GetString("printer.address"),
-				Username: viper.GetString("printer.username"),
-				ApiKey:   viper.GetString("printer.apikey"),
-			},
+			PrinterConfig: printerConfig(viper.Sub("printer")),
+			Printers:      printersConfig(),
+			Printer:       viper.GetString("camera.printer"),
+			PollInterval:  viper.GetDuration("timelapse.pollInterval"),
+			CameraConfig:  cameraConfig(viper.Sub("camera")),
+			Cameras:       camerasConfig(),
+			DefaultCamera: viper.GetString("defaultCamera"),
 			TimelapseConfig: camera.TimelapseConfig{
 				Enabled:     viper.GetBool("timelapse.enabled"),
 				Interval:    viper.GetInt("timelapse.interval"),
 				Loglevel:    viper.GetString("loglevel"),
 				VideoLenght: viper.GetInt("timelapse.videoLenght"),
-				OutputDir:   viper.GetString("timelapse.outputDir"),
+				OutputDir:   expandHome(viper.GetString("timelapse.outputDir")),
 				MinFPS:      viper.GetInt("timelapse.minFPS"),
+				WorkDir:     expandHome(viper.GetString("timelapse.workDir")),
+
+				AdaptiveInterval: viper.GetBool("timelapse.adaptiveInterval"),
+				MinInterval:      viper.GetInt("timelapse.minInterval"),
+				MaxInterval:      viper.GetInt("timelapse.maxInterval"),
+				StopGrace:        viper.GetDuration("timelapse.stopGrace"),
+				StartAt:          viper.GetString("timelapse.startAt"),
+				StartTimeout:     viper.GetDuration("timelapse.startTimeout"),
+
+				Mode:          camera.CaptureMode(viper.GetString("timelapse.mode")),
+				ProgressDelta: viper.GetFloat64("timelapse.progressDelta"),
+				ProgressPoll:  viper.GetDuration("timelapse.progressPoll"),
+
+				OrphanFrames:   viper.GetString("timelapse.orphanFrames"),
+				PartialOutputs: viper.GetString("timelapse.partialOutputs"),
+				OnShutdown:     viper.GetString("timelapse.onShutdown"),
+
+				FFmpeg:  viper.GetString("timelapse.ffmpeg"),
+				Encoder: viper.GetString("timelapse.encoder"),
+				Output: camera.VideoOutput{
+					Width:   viper.GetInt("timelapse.output.width"),
+					Height:  viper.GetInt("timelapse.output.height"),
+					CRF:     viper.GetInt("timelapse.output.crf"),
+					Bitrate: viper.GetString("timelapse.output.bitrate"),
+					FPSCap:  viper.GetInt("timelapse.output.fpsCap"),
+				},
+				Formats:          viper.GetStringSlice("timelapse.format"),
+				EndHoldSeconds:   viper.GetFloat64("timelapse.endHoldSeconds"),
+				Deflicker:        viper.GetBool("timelapse.deflicker"),
+				BuildConcurrency: viper.GetInt("timelapse.buildConcurrency"),
+				FormatTimeout:    viper.GetDuration("timelapse.formatTimeout"),
+				BuildRetries:     viper.GetInt("timelapse.buildRetries"),
+				BuildRetryDelay:  viper.GetDuration("timelapse.buildRetryDelay"),
+				KeepFrames:       viper.GetString("timelapse.keepFrames"),
+				MaxFrames:        viper.GetInt("timelapse.maxFrames"),
+				MaxFramesAction:  viper.GetString("timelapse.maxFramesAction"),
+				CaptureRestarts:  viper.GetInt("timelapse.captureRestarts"),
+				MinFreeSpace:     viper.GetInt("timelapse.minFreeSpace"),
+
+				Timestamps: camera.TimestampsConfig{
+					Enabled:  viper.GetBool("timelapse.timestamps.enabled"),
+					Format:   viper.GetString("timelapse.timestamps.format"),
+					Corner:   viper.GetString("timelapse.timestamps.corner"),
+					FontSize: viper.GetInt("timelapse.timestamps.fontSize"),
+					FontFile: viper.GetString("timelapse.timestamps.fontFile"),
+				},
+				Hooks: camera.HooksConfig{
+					OnStart:         viper.GetString("timelapse.hooks.onStart"),
+					OnFinish:        viper.GetString("timelapse.hooks.onFinish"),
+					OnBuildComplete: viper.GetString("timelapse.hooks.onBuildComplete"),
+					BaseURL:         viper.GetString("timelapse.hooks.baseURL"),
+					Timeout:         viper.GetDuration("timelapse.hooks.timeout"),
+					Retries:         viper.GetInt("timelapse.hooks.retries"),
+				},
+				Upload: camera.UploadConfig{
+					Type:              viper.GetString("timelapse.upload.type"),
+					Bucket:            viper.GetString("timelapse.upload.bucket"),
+					Remote:            viper.GetString("timelapse.upload.remote"),
+					Prefix:            viper.GetString("timelapse.upload.prefix"),
+					DeleteAfterUpload: viper.GetBool("timelapse.upload.deleteAfterUpload"),
+					Rclone:            viper.GetString("timelapse.upload.rclone"),
+					Region:            viper.GetString("timelapse.upload.region"),
+					Endpoint:          viper.GetString("timelapse.upload.endpoint"),
+					AccessKey:         viper.GetString("timelapse.upload.accessKey"),
+					SecretKey:         viper.GetString("timelapse.upload.secretKey"),
+				},
 			},
 			Enabled:                viper.GetBool("prusaConnect.enabled"),
 			PrusaCameraToken:       viper.GetString("prusaConnect.cameraToken"),
 			PrusaCameraFingerprint: viper.GetString("prusaConnect.fingerprint"),
+			Demo:                   demo,
 		},
 	}
 }
 
+// expandHome replaces leading ~ of path with home dir of the user, like shell does
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~")
+	if !ok || rest != "" && rest[0] != '/' {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
+
+// optionalFloat returns nil if key isn't set, zero is a valid value
+func optionalFloat(v *viper.Viper, key string) *float64 {
+	if !v.IsSet(key) {
+		return nil
+	}
+	f := v.GetFloat64(key)
+	return &f
+}
+
+// cameraConfig reads single camera section, v may be nil
+func cameraConfig(v *viper.Viper) camera.CameraConfig {
+	if v == nil {
+		v = viper.New()
+	}
+	return camera.CameraConfig{
+		Name:        v.GetString("name"),
+		Type:        v.GetString("type"),
+		Device:      v.GetString("device"),
+		PixelFormat: v.GetString("pixelFormat"),
+		Controls:    controlsConfig(v),
+		Binary:      v.GetString("binary"),
+		SourceBadge: v.GetBool("sourceBadge"),
+		Overlay: camera.OverlayConfig{
+			Enabled: v.GetBool("overlay.enabled"),
+			Corner:  v.GetString("overlay.corner"),
+			Scale:   v.GetInt("overlay.scale"),
+		},
+		Motion: camera.MotionConfig{
+			Enabled:   v.GetBool("motion.enabled"),
+			Threshold: v.GetInt("motion.threshold"),
+			MinRatio:  v.GetFloat64("motion.minRatio"),
+			Interval:  v.GetDuration("motion.interval"),
+			StopAfter: v.GetDuration("motion.stopAfter"),
+		},
+		Light: camera.LightConfig{
+			Enabled:       v.GetBool("light.enabled"),
+			Pin:           v.GetInt("light.pin"),
+			ActiveLow:     v.GetBool("light.activeLow"),
+			WarmUp:        v.GetDuration("light.warmUp"),
+			WhilePrinting: v.GetBool("light.whilePrinting"),
+		},
+		Exif:           v.GetBool("exif"),
+		StreamFPS:      v.GetFloat64("streamFPS"),
+		MaxFrameAge:    v.GetDuration("maxFrameAge"),
+		WarmUpFrames:   v.GetInt("warmUpFrames"),
+		WarmUpTime:     v.GetDuration("warmUpTime"),
+		SnapshotMaxAge: v.GetDuration("snapshotMaxAge"),
+		MockDir:        v.GetString("mockDir"),
+
+		SnapshotURL:  v.GetString("snapshotURL"),
+		StreamURL:    v.GetString("streamURL"),
+		HTTPUsername: v.GetString("username"),
+		HTTPPassword: v.GetString("password"),
+
+		RTSPURL:       v.GetString("rtspURL"),
+		RTSPTransport: v.GetString("rtspTransport"),
+
+		Rotation:     v.GetInt("rotation"),
+		HFlip:        v.GetBool("hflip"),
+		VFlip:        v.GetBool("vflip"),
+		ROI:          v.GetString("roi"),
+		Width:        v.GetInt("width"),
+		Height:       v.GetInt("height"),
+		FocusMode:    v.GetString("focusMode"),
+		FocusRegion:  v.GetString("focusRegion"),
+		LensPosition: optionalFloat(v, "lensPosition"),
+		Exposure: camera.ExposureConfig{
+			Shutter: v.GetDuration("exposure.shutter"),
+			Gain:    optionalFloat(v, "exposure.gain"),
+			AWB:     v.GetString("exposure.awb"),
+			EV:      optionalFloat(v, "exposure.ev"),
+		},
+		ExtraArgs: v.GetStringSlice("extraArgs"),
+
+		OneShotCapture: v.GetBool("oneShotCapture"),
+		Profiles:       profilesConfig(v),
+		BeautyShot:     v.GetStringSlice("beautyShot"),
+	}
+}
+
+// controlsConfig reads usb camera controls, viper lowercases keys as control names are
+func controlsConfig(v *viper.Viper) map[string]int32 {
+	section := v.GetStringMap("controls")
+	if len(section) == 0 {
+		return nil
+	}
+	controls := make(map[string]int32, len(section))
+	for name := range section {
+		controls[name] = v.GetInt32("controls." + name)
+	}
+	return controls
+}
+
+// profilesConfig reads camera capture profiles list
+func profilesConfig(v *viper.Viper) []camera.CaptureProfile {
+	var sections []map[string]any
+	if err := v.UnmarshalKey("profiles", &sections); err != nil {
+		slog.Warn("fail to read camera profiles config", "err", err)
+		return nil
+	}
+
+	profiles := make([]camera.CaptureProfile, 0, len(sections))
+	for _, section := range sections {
+		p := viper.New()
+		p.MergeConfigMap(section)
+		profiles = append(profiles, camera.CaptureProfile{
+			Name: p.GetString("name"),
+			From: p.GetString("from"),
+			To:   p.GetString("to"),
+			Args: p.GetStringSlice("args"),
+		})
+	}
+	return profiles
+}
+
+// camerasConfig reads optional cameras list, used instead of camera section
+func camerasConfig() []service.CameraEntry {
+	var sections []map[string]any
+	if err := viper.UnmarshalKey("cameras", &sections); err != nil {
+		slog.Warn("fail to read cameras config", "err", err)
+		return nil
+	}
+
+	cameras := make([]service.CameraEntry, 0, len(sections))
+	for _, section := range sections {
+		v := viper.New()
+		v.MergeConfigMap(section)
+		cameras = append(cameras, service.CameraEntry{
+			CameraConfig:           cameraConfig(v),
+			PrusaCameraToken:       v.GetString("cameraToken"),
+			PrusaCameraFingerprint: v.GetString("fingerprint"),
+		})
+	}
+	return cameras
+}
+
+// printerConfig reads single printer section, v may be nil
+func printerConfig(v *viper.Viper) prusalinkclient.PrinterConfig {
+	if v == nil {
+		v = viper.New()
+	}
+	return prusalinkclient.PrinterConfig{
+		Name:     v.GetString("name"),
+		Type:     v.GetString("type"),
+		Address:  v.GetString("address"),
+		Username: v.GetString("username"),
+		ApiKey:   v.GetString("apikey"),
+		AuthMode: v.GetString("auth"),
+		CacheTTL: v.GetDuration("cacheTTL"),
+		Retries:  v.GetInt("retries"),
+
+		DiscoveryTimeout:   v.GetDuration("discoveryTimeout"),
+		RetryMaxDelay:      v.GetDuration("retryMaxDelay"),
+		RequestTimeout:     v.GetDuration("requestTimeout"),
+		OfflineAfter:       v.GetDuration("offlineAfter"),
+		InsecureSkipVerify: v.GetBool("insecureSkipVerify"),
+		DebugHTTP:          v.GetBool("debugHTTP"),
+	}
+}
+
+// printersConfig reads optional printers list, used instead of printer section
+func printersConfig() []prusalinkclient.PrinterConfig {
+	var sections []map[string]any
+	if err := viper.UnmarshalKey("printers", &sections); err != nil {
+		slog.Warn("fail to read printers config", "err", err)
+		return nil
+	}
+
+	printers := make([]prusalinkclient.PrinterConfig, 0, len(sections))
+	for _, section := range sections {
+		v := viper.New()
+		v.MergeConfigMap(section)
+		printers = append(printers, printerConfig(v))
+	}
+	return printers
+}
+
+// doctor prints environment checks, returns false if any check failed
+func doctor() bool {
+	ctx := context.Background()
+	cfg := getConfig()
+	ok := true
+
+	switch cfg.CameraConfig.Type {
+	case "", camera.TypeRPI:
+		info, err := camera.DetectRPICamera(ctx, &cfg.CameraConfig)
+		if err != nil {
+			fmt.Printf("[FAIL] camera binary: %s\n", err)
+			ok = false
+		} else {
+			fmt.Printf("[ OK ] camera binary: %s (%s)\n", info.Binary, info.Version)
+		}
+	default:
+		fmt.Printf("[ OK ] camera type: %s\n", cfg.CameraConfig.Type)
+	}
+
+	path, err := camera.FFmpegPath(&cfg.TimelapseConfig)
+	if err == nil {
+		// configured one isn't looked up, it has to be executable too
+		path, err = exec.LookPath(path)
+	}
+	if err != nil {
+		fmt.Printf("[FAIL] ffmpeg: %s\n", err)
+		ok = false
+	} else {
+		fmt.Printf("[ OK ] ffmpeg: %s\n", path)
+	}
+
+	return ok
+}
+
 func setLogLevel(level string) {
 	level = strings.ToLower(level)
 	switch level {
@@ -107,6 +500,16 @@ func setLogLevel(level string) {
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	serverCmd.AddCommand(doctorCmd)
+	serverCmd.AddCommand(timelapseCmd)
+	timelapseCmd.AddCommand(timelapseBuildCmd)
+
+	timelapseBuildCmd.Flags().StringVar(&dirBuild.Dir, "dir", "", "Frame directory")
+	timelapseBuildCmd.Flags().StringVar(&dirBuild.Output, "out", "", "Output video, its extension (mp4, webm or gif) picks the format")
+	timelapseBuildCmd.Flags().IntVar(&dirBuild.FPS, "fps", 0, "Frames per second, picked from timelapse config if not set")
+	timelapseBuildCmd.Flags().BoolVar(&dirBuild.Force, "force", false, "Overwrite existing output")
+	timelapseBuildCmd.MarkFlagRequired("dir")
+	timelapseBuildCmd.MarkFlagRequired("out")
 
 	serverCmd.Flags().IntP("port", "p", 8080, "Listen port")
 	viper.BindPFlag("port", serverCmd.Flags().Lookup("port"))
@@ -114,8 +517,11 @@ func init() {
 	viper.BindPFlag("prusaConnect.enabled", serverCmd.Flags().Lookup("prusaconnect"))
 	serverCmd.Flags().Bool("timelapse", false, "Enable timelapse")
 	viper.BindPFlag("timelapse.enabled", serverCmd.Flags().Lookup("timelapse"))
+	serverCmd.Flags().BoolVar(&demo, "demo", false, "Use fake printer walking through print, no PrusaLink needed")
 }
 
 func main() {
-	serverCmd.Execute()
+	if err := serverCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
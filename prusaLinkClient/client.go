@@ -2,14 +2,22 @@ package prusalinkclient
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/icholy/digest"
 )
@@ -26,8 +34,27 @@ const (
 	StatusReady     = "READY"
 )
 
+// Client methods return ErrPrinterOffline, ErrUnauthorized or ErrBadResponse
+// (possibly wrapped) for printer side failures
 type Client interface {
 	JobStatus(ctx context.Context) (*Status, error)
+	PrinterInfo(ctx context.Context) (*PrinterInfo, error)
+	// StatusFull is JobStatus with printer telemetry, it's not cached
+	StatusFull(ctx context.Context) (*FullStatus, error)
+	// JobThumbnail returns image sliced into current job file, ErrNoThumbnail if there is none
+	JobThumbnail(ctx context.Context) ([]byte, error)
+	// JobMeta returns slicer metadata of current job file, ErrNoMeta if printer doesn't have it
+	JobMeta(ctx context.Context) (*JobMeta, error)
+
+	// job control, ErrJobNotFound or ErrJobState is returned if job can't be controlled
+	PauseJob(ctx context.Context, jobID int) error
+	ResumeJob(ctx context.Context, jobID int) error
+	StopJob(ctx context.Context, jobID int) error
+	// Health reports how printer connection is doing, it makes no requests
+	Health() Health
+
+	// ListFiles lists printer storage, ErrStorageNotFound if there is no such storage
+	ListFiles(ctx context.Context, storage string) ([]File, error)
 }
 
 type Status struct {
@@ -36,153 +63,558 @@ type Status struct {
 	FileName string
 	State    string
 	Progress float64
+	// path of gcode on printer storage, empty for serial prints
+	FilePath string
+	// zero if printer doesn't report it
+	TimePrinting  time.Duration
+	TimeRemaining time.Duration
+	// derived from TimePrinting with second precision, zero if it's unknown
+	StartedAt time.Time
 }
 
+const (
+	AuthDigest = "digest"
+	AuthApiKey = "apikey"
+)
+
+const (
+	TypePrusaLink = "prusalink"
+	TypeMoonraker = "moonraker"
+)
+
+var (
+	ErrUnauthorized   = errors.New("printer rejected credentials, check printer username and apikey")
+	ErrPrinterOffline = errors.New("printer is offline")
+	// unexpected status code or malformed body
+	ErrBadResponse = errors.New("bad printer response")
+	ErrNoThumbnail = errors.New("no job thumbnail")
+)
+
 type PrinterConfig struct {
-	Address  string
+	// identifies printer when several are configured, see Registry
+	Name string
+	// prusalink or moonraker, prusalink if empty
+	Type    string
+	Address string
+	// mDNS browse time when Address is empty, 3 seconds if zero, disabled if negative
+	DiscoveryTimeout time.Duration
+
 	Username string
 	ApiKey   string
+	// digest or apikey (X-Api-Key header). If empty, apikey is used when Username is empty
+	// and always for moonraker, where ApiKey is optional
+	AuthMode string
+	// skip TLS certificate verification, for self-signed https proxies
+	InsecureSkipVerify bool
+
+	// how long job status is served from cache, 10 seconds if zero, disabled if negative
+	CacheTTL time.Duration
+
+	// how many times failed request is retried, 2 if zero, disabled if negative
+	Retries int
+	// upper bound of delay between retries, 2 seconds if zero
+	RetryMaxDelay time.Duration
+
+	// timeout of single request attempt, 3 seconds if zero
+	RequestTimeout time.Duration
+	// printer is reported offline if it doesn't answer in time, retries included. 10 seconds if zero
+	OfflineAfter time.Duration
+
+	// log HTTP traffic with credentials redacted even if log level isn't debug
+	DebugHTTP bool
 }
 
+const (
+	defaultCacheTTL       = 10 * time.Second
+	defaultRetries        = 2
+	defaultRetryMaxDelay  = 2 * time.Second
+	retryBaseDelay        = 100 * time.Millisecond
+	defaultRequestTimeout = 3 * time.Second
+	defaultOfflineAfter   = 10 * time.Second
+)
+
 type client struct {
 	log    *slog.Logger
 	config *PrinterConfig
 
 	httpClient *http.Client
+	baseURL    *url.URL
+	cacheTTL   time.Duration
+	retries    int
+	retryDelay time.Duration
+	// per attempt and total request timeouts
+	requestTimeout time.Duration
+	offlineAfter   time.Duration
+	// replaced in tests
+	now func() time.Time
 
 	sync.Mutex
 	cachedStatus *Status
 	cachedTime   time.Time
+	// job status request in progress, concurrent callers wait for it
+	inflight *statusFlight
+
+	// printer has no v1 API, OctoPrint compatible one is used
+	legacyAPI atomic.Bool
+
+	// guarded by mutex
+	health Health
+}
+
+type statusFlight struct {
+	done   chan struct{}
+	status *Status
+	err    error
 }
 
 func NewClient(log *slog.Logger, config *PrinterConfig) (Client, error) {
 	if config == nil {
 		return nil, errors.New("config is nil")
 	}
-	if config.Address == "" {
-		return nil, errors.New("config address is empty")
-	}
 	if log == nil {
 		log = slog.Default()
 	}
 
-	cli := &http.Client{
-		Timeout: time.Second,
-		Transport: &digest.Transport{
-			Username: config.Username,
-			Password: config.ApiKey,
-		},
+	address := config.Address
+	if address == "" {
+		if config.DiscoveryTimeout < 0 || config.Type == TypeMoonraker {
+			return nil, errors.New("config address is empty")
+		}
+		timeout := config.DiscoveryTimeout
+		if timeout == 0 {
+			timeout = defaultDiscover
+		}
+
+		log.Info("Printer address is empty, looking for PrusaLink with mDNS", "timeout", timeout)
+		var err error
+		address, err = discoverAddress(context.Background(), timeout)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Discovered printer", "address", address)
 	}
 
-	return &client{
-		log:        log.With("svc", "prusaLinkClient"),
+	baseURL, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	log = log.With("svc", "prusaLinkClient")
+	level := slog.LevelDebug
+	if config.DebugHTTP {
+		level = slog.LevelInfo
+	}
+	transport, err := authTransport(config, &debugTransport{
+		log:    log,
+		level:  level,
+		apiKey: config.ApiKey,
+		base:   baseTransport(config),
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Transport: transport,
+	}
+
+	cacheTTL := config.CacheTTL
+	if cacheTTL == 0 {
+		cacheTTL = defaultCacheTTL
+	}
+	retries := config.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+	retryDelay := config.RetryMaxDelay
+	if retryDelay <= 0 {
+		retryDelay = defaultRetryMaxDelay
+	}
+	requestTimeout := config.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	offlineAfter := config.OfflineAfter
+	if offlineAfter <= 0 {
+		offlineAfter = defaultOfflineAfter
+	}
+
+	cli := &client{
+		log:        log,
 		config:     config,
-		httpClient: cli,
-	}, nil
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		cacheTTL:   cacheTTL,
+		retries:    retries,
+		retryDelay: retryDelay,
+		now:        time.Now,
+
+		requestTimeout: requestTimeout,
+		offlineAfter:   offlineAfter,
+	}
+
+	switch config.Type {
+	case "", TypePrusaLink:
+		return cli, nil
+	case TypeMoonraker:
+		return &moonrakerClient{cli}, nil
+	default:
+		return nil, fmt.Errorf("unknown printer type %q", config.Type)
+	}
+}
+
+// parseAddress accepts bare host, host:port or scheme-qualified URL. http is used if scheme is missing.
+// Path is allowed only with scheme, for printer behind reverse proxy
+func parseAddress(address string) (*url.URL, error) {
+	if strings.ContainsFunc(address, unicode.IsSpace) {
+		return nil, fmt.Errorf("invalid printer address %q: contains spaces", address)
+	}
+	bare := !strings.Contains(address, "://")
+	if bare {
+		address = "http://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid printer address: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid printer address scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid printer address %q: empty host", address)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid printer address %q: only host, port and path are allowed", address)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	if bare && u.Path != "" {
+		return nil, fmt.Errorf("invalid printer address %q: unexpected path %q, use host or host:port", address, u.Path)
+	}
+
+	return u, nil
+}
+
+// endpoint joins API path, optionally with query, to printer base URL
+func (c *client) endpoint(path string) (string, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", path, err)
+	}
+	u := c.baseURL.JoinPath(ref.Path)
+	u.RawQuery = ref.RawQuery
+	return u.String(), nil
+}
+
+func baseTransport(config *PrinterConfig) http.RoundTripper {
+	if !config.InsecureSkipVerify {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return transport
+}
+
+func authTransport(config *PrinterConfig, base http.RoundTripper) (http.RoundTripper, error) {
+	mode := config.AuthMode
+	if mode == "" {
+		mode = AuthDigest
+		if config.Username == "" || config.Type == TypeMoonraker {
+			mode = AuthApiKey
+		}
+	}
+
+	switch mode {
+	case AuthDigest:
+		return &digest.Transport{
+			Username:  config.Username,
+			Password:  config.ApiKey,
+			Transport: base,
+		}, nil
+	case AuthApiKey:
+		return &apiKeyTransport{
+			apiKey: config.ApiKey,
+			base:   base,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", mode)
+	}
+}
+
+// apiKeyTransport authenticates requests with PrusaLink X-Api-Key header
+type apiKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.apiKey == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Api-Key", t.apiKey)
+	return t.base.RoundTrip(req)
 }
 
 func (c *client) JobStatus(ctx context.Context) (*Status, error) {
-	if st, ok := c.jobStatusFromCache(); ok {
+	return c.sharedJobStatus(ctx, c.jobStatus)
+}
+
+type freshKey struct{}
+
+// WithFresh marks JobStatus call which mustn't be served from cache. Fetched status
+// still refreshes cache for other callers
+func WithFresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+// IsFresh reports whether ctx was marked by WithFresh
+func IsFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+// sharedJobStatus returns cached status or fetches it. Concurrent callers
+// share single request, so printer sees one request however many consumers ask
+func (c *client) sharedJobStatus(ctx context.Context, fetch func(context.Context) (*Status, error)) (*Status, error) {
+	c.Mutex.Lock()
+	if st, ok := c.jobStatusFromCacheLocked(); ok && !IsFresh(ctx) {
+		c.Mutex.Unlock()
 		c.log.Debug("Returning from cache")
 		return st, nil
 	}
+	if f := c.inflight; f != nil {
+		c.Mutex.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+		st := *f.status
+		return &st, nil
+	}
+	f := &statusFlight{done: make(chan struct{})}
+	c.inflight = f
+	c.Mutex.Unlock()
+
+	// result is shared, so it must not fail because of this caller's cancellation.
+	// get is bounded with offlineAfter anyway
+	f.status, f.err = fetch(context.WithoutCancel(ctx))
+
+	c.Mutex.Lock()
+	if f.err == nil {
+		c.jobStatusToCacheLocked(f.status)
+	}
+	c.inflight = nil
+	c.Mutex.Unlock()
+	close(f.done)
 
-	st, err := c.jobStatus(ctx)
+	if f.err != nil {
+		return nil, f.err
+	}
+	st := *f.status
+	return &st, nil
+}
+
+func (c *client) jobStatus(ctx context.Context) (*Status, error) {
+	c.log.Debug("Job status request started", "legacyAPI", c.legacyAPI.Load())
+	if c.legacyAPI.Load() {
+		return c.legacyJobStatus(ctx)
+	}
+
+	code, data, err := c.get(ctx, "/api/v1/job")
 	if err != nil {
 		return nil, err
 	}
 
-	c.jobStatusToCache(st)
-	return st, nil
+	switch code {
+	case 200:
+		return parseJobResponse(data, c.now())
+	// nothing in progress
+	case 204:
+		return &Status{
+			Online: true,
+			State:  StatusFinished,
+		}, nil
+	// old firmware
+	case 404:
+		c.useLegacyAPI()
+		return c.legacyJobStatus(ctx)
+	default:
+		return nil, fmt.Errorf("%w: response status code %d", ErrBadResponse, code)
+	}
 }
 
-func (c *client) jobStatus(ctx context.Context) (*Status, error) {
-	c.log.Debug("Job status request started")
+// get makes GET request to printer API and returns status code and body.
+// Transient failures are retried with backoff.
+// ErrPrinterOffline is returned if printer doesn't answer in time
+func (c *client) get(ctx context.Context, path string) (int, []byte, error) {
+	code, data, err := c.getWithRetries(ctx, path)
+	c.recordHealth(code, err)
+	return code, data, err
+}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+func (c *client) getWithRetries(ctx context.Context, path string) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.offlineAfter)
 	defer cancel()
 
-	// TODO do URL properly
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/api/v1/job", c.config.Address), nil)
+	for attempt := 0; ; attempt++ {
+		code, data, err := c.do(ctx, http.MethodGet, path)
+		if attempt >= c.retries || !retryable(code, err) {
+			return code, data, err
+		}
+
+		delay := backoff(attempt, c.retryDelay)
+		c.log.Debug("Retrying request", "path", path, "attempt", attempt+1, "delay", delay, "code", code, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return code, data, err
+		}
+	}
+}
+
+// do makes single request without retries
+func (c *client) do(ctx context.Context, method, path string) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint, err := c.endpoint(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("fail to create request: %w", err)
+		return 0, nil, fmt.Errorf("fail to create request: %w", err)
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			// printer offline (or misconfigured)
-			return &Status{Online: false}, nil
+			return 0, nil, ErrPrinterOffline
 		}
-		return nil, fmt.Errorf("fail to make request: %w", err)
+		if connectionError(err) {
+			return 0, nil, fmt.Errorf("%w: %w", ErrPrinterOffline, err)
+		}
+		return 0, nil, fmt.Errorf("fail to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return 0, nil, ErrPrinterOffline
+	}
+	if connectionError(err) {
+		return 0, nil, fmt.Errorf("%w: %w", ErrPrinterOffline, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("fail to read resp body: %w", err)
+		return 0, nil, fmt.Errorf("fail to read resp body: %w", err)
 	}
 
-	c.log.Debug("Resp", "code", resp.StatusCode, "body", string(data))
+	if resp.StatusCode == http.StatusUnauthorized {
+		return 0, nil, ErrUnauthorized
+	}
+	return resp.StatusCode, data, nil
+}
 
-	switch resp.StatusCode {
-	case 200:
-		return parseJobResponse(data)
-	// nothing in progress
-	case 204:
-		return &Status{
-			Online: true,
-			State:  StatusFinished,
-		}, nil
-	default:
-		return nil, fmt.Errorf("response status code %d", resp.StatusCode)
+// retryable reports whether request failed for transient reason:
+// timeout, refused or dropped connection, or 5xx from printer. 4xx are final
+func retryable(code int, err error) bool {
+	if err == nil {
+		return code >= 500
 	}
+
+	var netErr net.Error
+	return errors.Is(err, ErrPrinterOffline) ||
+		connectionError(err) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
 }
 
-func (c *client) jobStatusToCache(status *Status) {
-	c.Mutex.Lock()
-	defer c.Mutex.Unlock()
+// connectionError reports whether printer refused or dropped connection, or its host
+// can't be reached. Printer is offline when retries of it are exhausted
+func connectionError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH)
+}
 
-	// thread insure, need to make a copy, but who cares?
-	c.cachedStatus = status
-	c.cachedTime = time.Now()
+// backoff returns exponential delay with jitter for given attempt, capped by maxDelay
+func backoff(attempt int, maxDelay time.Duration) time.Duration {
+	delay := min(retryBaseDelay<<attempt, maxDelay)
+	return delay/2 + rand.N(delay/2+1)
 }
 
-func (c *client) jobStatusFromCache() (*Status, bool) {
-	c.Mutex.Lock()
-	defer c.Mutex.Unlock()
+// jobStatusToCacheLocked and jobStatusFromCacheLocked are called with c.Mutex held
+
+func (c *client) jobStatusToCacheLocked(status *Status) {
+	// callers may modify returned status, so cache keeps own copy
+	st := *status
+	c.cachedStatus = &st
+	c.cachedTime = c.now()
+}
 
-	// cache 10 seconds
-	if c.cachedTime.Before(time.Now().Add(10 * time.Second)) {
-		c.cachedStatus = nil
+func (c *client) jobStatusFromCacheLocked() (*Status, bool) {
+	if c.cachedStatus == nil || c.now().Sub(c.cachedTime) >= c.cacheTTL {
+		return nil, false
 	}
 
-	return c.cachedStatus, c.cachedStatus != nil
+	st := *c.cachedStatus
+	return &st, true
+}
+
+func (c *client) dropCache() {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	c.cachedStatus = nil
 }
 
 type jobResponse struct {
 	ID       int     `json:"id,omitempty"`
 	State    string  `json:"state,omitempty"`
 	Progress float64 `json:"progress,omitempty"`
-	File     struct {
+	// seconds
+	TimePrinting  int `json:"time_printing,omitempty"`
+	TimeRemaining int `json:"time_remaining,omitempty"`
+	File          struct {
 		Name        string `json:"name,omitempty"`
 		DisplayName string `json:"display_name,omitempty"`
 		Path        string `json:"path,omitempty"`
+		Refs        struct {
+			Thumbnail string `json:"thumbnail,omitempty"`
+		} `json:"refs,omitempty"`
 	} `json:"file,omitempty"`
 }
 
-func parseJobResponse(body []byte) (*Status, error) {
+func parseJobResponse(body []byte, now time.Time) (*Status, error) {
 	var resp jobResponse
 	err := json.Unmarshal(body, &resp)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: fail to parse job: %w", ErrBadResponse, err)
 	}
 
 	return &Status{
 		Online:   true,
 		JobID:    resp.ID,
 		FileName: resp.File.DisplayName,
+		FilePath: resp.File.Path,
 		State:    resp.State,
 		Progress: resp.Progress,
+
+		TimePrinting:  time.Duration(resp.TimePrinting) * time.Second,
+		TimeRemaining: time.Duration(resp.TimeRemaining) * time.Second,
+		StartedAt:     startedAt(now, time.Duration(resp.TimePrinting)*time.Second),
 	}, nil
 }
+
+func startedAt(now time.Time, printing time.Duration) time.Time {
+	if printing <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-printing).Truncate(time.Second)
+}
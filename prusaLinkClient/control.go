@@ -0,0 +1,88 @@
+package prusalinkclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrJobNotFound = errors.New("no such job")
+	// job can't be paused, resumed or stopped in its current state
+	ErrJobState = errors.New("job is in wrong state")
+)
+
+func (c *client) PauseJob(ctx context.Context, jobID int) error {
+	return c.control(ctx, http.MethodPut, fmt.Sprintf("/api/v1/job/%d/pause", jobID))
+}
+
+func (c *client) ResumeJob(ctx context.Context, jobID int) error {
+	return c.control(ctx, http.MethodPut, fmt.Sprintf("/api/v1/job/%d/resume", jobID))
+}
+
+func (c *client) StopJob(ctx context.Context, jobID int) error {
+	return c.control(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/job/%d", jobID))
+}
+
+// control sends job command, it's never retried as printer may have executed it already
+func (c *client) control(ctx context.Context, method, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.offlineAfter)
+	defer cancel()
+
+	code, _, err := c.do(ctx, method, path)
+	c.recordHealth(code, err)
+	if err != nil {
+		return err
+	}
+
+	// job state changed, cached one is outdated
+	c.dropCache()
+
+	switch code {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrJobNotFound
+	case http.StatusConflict:
+		return ErrJobState
+	default:
+		return fmt.Errorf("%w: %s %s status code %d", ErrBadResponse, method, path, code)
+	}
+}
+
+// moonraker has single current job, so jobID is ignored
+
+func (c *moonrakerClient) PauseJob(ctx context.Context, jobID int) error {
+	return c.moonrakerControl(ctx, "/printer/print/pause")
+}
+
+func (c *moonrakerClient) ResumeJob(ctx context.Context, jobID int) error {
+	return c.moonrakerControl(ctx, "/printer/print/resume")
+}
+
+func (c *moonrakerClient) StopJob(ctx context.Context, jobID int) error {
+	return c.moonrakerControl(ctx, "/printer/print/cancel")
+}
+
+func (c *moonrakerClient) moonrakerControl(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.offlineAfter)
+	defer cancel()
+
+	code, _, err := c.do(ctx, http.MethodPost, path)
+	c.recordHealth(code, err)
+	if err != nil {
+		return err
+	}
+	c.dropCache()
+
+	switch code {
+	case http.StatusOK:
+		return nil
+	// klipper refuses command, e.g. pause without print in progress
+	case http.StatusBadRequest:
+		return ErrJobState
+	default:
+		return fmt.Errorf("%w: POST %s status code %d", ErrBadResponse, path, code)
+	}
+}
@@ -0,0 +1,125 @@
+package prusalinkclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingHandler records "METHOD path" of requests and answers with code
+type recordingHandler struct {
+	code int
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (h *recordingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	h.requests = append(h.requests, req.Method+" "+req.URL.Path)
+	h.mu.Unlock()
+	w.WriteHeader(h.code)
+}
+
+func TestJobControl(t *testing.T) {
+	h := &recordingHandler{code: http.StatusNoContent}
+	cli, _ := newTestClient(t, PrinterConfig{ApiKey: "secret"}, h.ServeHTTP)
+
+	for _, call := range []func(context.Context, int) error{cli.PauseJob, cli.ResumeJob, cli.StopJob} {
+		if err := call(t.Context(), 7); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"PUT /api/v1/job/7/pause",
+		"PUT /api/v1/job/7/resume",
+		"DELETE /api/v1/job/7",
+	}
+	if !slices.Equal(h.requests, want) {
+		t.Errorf("expected %v, got %v", want, h.requests)
+	}
+}
+
+func TestJobControlErrors(t *testing.T) {
+	tests := []struct {
+		code int
+		want error
+	}{
+		{http.StatusNotFound, ErrJobNotFound},
+		{http.StatusConflict, ErrJobState},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusServiceUnavailable, ErrBadResponse},
+	}
+	for _, tt := range tests {
+		h := &recordingHandler{code: tt.code}
+		cli, requests := newTestClient(t, PrinterConfig{ApiKey: "secret", RetryMaxDelay: time.Millisecond}, h.ServeHTTP)
+
+		if err := cli.PauseJob(t.Context(), 7); !errors.Is(err, tt.want) {
+			t.Errorf("%d: expected %v, got %v", tt.code, tt.want, err)
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("%d: job commands must not be retried, got %d requests", tt.code, n)
+		}
+	}
+}
+
+func TestJobControlDropsCache(t *testing.T) {
+	var paused atomic.Bool
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPut {
+			paused.Store(true)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if paused.Load() {
+			w.Write([]byte(`{"id":7,"state":"PAUSED","progress":42}`))
+			return
+		}
+		printingHandler(w, req)
+	}
+	cli, _ := newTestClient(t, PrinterConfig{ApiKey: "secret", CacheTTL: time.Hour}, handler)
+
+	if _, err := cli.JobStatus(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.PauseJob(t.Context(), 7); err != nil {
+		t.Fatal(err)
+	}
+	st, err := cli.JobStatus(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != StatusPaused {
+		t.Errorf("expected fresh status after pause, got %s", st.State)
+	}
+}
+
+func TestMoonrakerJobControl(t *testing.T) {
+	h := &recordingHandler{code: http.StatusOK}
+	cli, _ := newTestBackend(t, PrinterConfig{Type: TypeMoonraker}, h.ServeHTTP)
+
+	for _, call := range []func(context.Context, int) error{cli.PauseJob, cli.ResumeJob, cli.StopJob} {
+		if err := call(t.Context(), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"POST /printer/print/pause",
+		"POST /printer/print/resume",
+		"POST /printer/print/cancel",
+	}
+	if !slices.Equal(h.requests, want) {
+		t.Errorf("expected %v, got %v", want, h.requests)
+	}
+
+	h.code = http.StatusBadRequest
+	if err := cli.PauseJob(t.Context(), 0); !errors.Is(err, ErrJobState) {
+		t.Errorf("expected ErrJobState, got %v", err)
+	}
+}
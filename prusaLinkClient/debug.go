@@ -0,0 +1,106 @@
+package prusalinkclient
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// debugBodyLimit is how much of request and response body is logged
+const debugBodyLimit = 512
+
+const redacted = "***"
+
+// debugTransport logs requests and responses as they are sent to printer.
+// It sits under auth transport, so auth headers and digest challenges are seen (redacted)
+type debugTransport struct {
+	log *slog.Logger
+	// Debug normally, Info when forced with config DebugHTTP
+	level  slog.Level
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !t.log.Enabled(ctx, t.level) {
+		return t.base.RoundTrip(req)
+	}
+
+	attrs := []any{
+		"method", req.Method,
+		"url", t.redact(req.URL.String()),
+		"headers", t.headers(req.Header),
+	}
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, debugBodyLimit+1))
+			body.Close()
+			attrs = append(attrs, "body", t.body(data))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	attrs = append(attrs, "duration", time.Since(start))
+	if err != nil {
+		t.log.Log(ctx, t.level, "HTTP request failed", append(attrs, "err", err)...)
+		return nil, err
+	}
+
+	// peek body start, caller still reads the whole body
+	head := make([]byte, debugBodyLimit+1)
+	n, _ := io.ReadFull(resp.Body, head)
+	head = head[:n]
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	attrs = append(attrs,
+		"code", resp.StatusCode,
+		"respHeaders", t.headers(resp.Header),
+		"respBody", t.body(head),
+	)
+	t.log.Log(ctx, t.level, "HTTP request", attrs...)
+	return resp, nil
+}
+
+// redact hides API key wherever it appears
+func (t *debugTransport) redact(s string) string {
+	if t.apiKey == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, t.apiKey, redacted)
+}
+
+func (t *debugTransport) headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		switch http.CanonicalHeaderKey(name) {
+		case "Authorization", "X-Api-Key", "Cookie", "Set-Cookie":
+			out[name] = redacted
+		default:
+			out[name] = t.redact(strings.Join(values, ", "))
+		}
+	}
+	return out
+}
+
+func (t *debugTransport) body(data []byte) string {
+	truncated := len(data) > debugBodyLimit
+	if truncated {
+		data = data[:debugBodyLimit]
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "text/") {
+		return "<binary>"
+	}
+	s := t.redact(strings.ToValidUTF8(string(data), ""))
+	if truncated {
+		s += "...(truncated)"
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package prusalinkclient
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// debugLogClient returns client logging into returned buffer at given level
+func debugLogClient(t *testing.T, cfg PrinterConfig, level slog.Level, handler http.HandlerFunc) (Client, *bytes.Buffer) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	buf := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: level}))
+	cfg.Address = srv.Listener.Addr().String()
+	cli, err := NewClient(log, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli, buf
+}
+
+func TestDebugTransportRedacts(t *testing.T) {
+	const key = "s3cr3t-key"
+	// misbehaving printer echoing the key back
+	echo := func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") == "" && req.Header.Get("X-Api-Key") == "" {
+			w.Header().Set("WWW-Authenticate", `Digest realm="Printer API", nonce="abc", algorithm=MD5, qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":7,"state":"PRINTING","progress":42,"file":{"display_name":"` + key + `.gcode"}}`))
+	}
+
+	tests := map[string]PrinterConfig{
+		"apikey": {ApiKey: key},
+		"digest": {Username: "maker", ApiKey: key},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			cli, buf := debugLogClient(t, cfg, slog.LevelDebug, echo)
+			if _, err := cli.JobStatus(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+
+			out := buf.String()
+			if strings.Contains(out, key) {
+				t.Errorf("api key leaked into log:\n%s", out)
+			}
+			for _, want := range []string{"method=GET", "/api/v1/job", "code=200", "duration=", redacted + ".gcode"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in log:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugTransportLevel(t *testing.T) {
+	cli, buf := debugLogClient(t, PrinterConfig{}, slog.LevelInfo, printingHandler)
+	if _, err := cli.JobStatus(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "HTTP request") {
+		t.Errorf("traffic logged without debug:\n%s", buf)
+	}
+
+	cli, buf = debugLogClient(t, PrinterConfig{DebugHTTP: true}, slog.LevelInfo, printingHandler)
+	if _, err := cli.JobStatus(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "HTTP request") {
+		t.Errorf("debugHTTP didn't log traffic:\n%s", buf)
+	}
+}
+
+func TestDebugBody(t *testing.T) {
+	tr := &debugTransport{apiKey: "key"}
+	if got := tr.body([]byte("\x89PNG\r\n\x1a\n\x00\x00")); got != "<binary>" {
+		t.Errorf("expected binary body, got %q", got)
+	}
+	long := strings.Repeat("a", debugBodyLimit+10)
+	if got := tr.body([]byte(long)); got != long[:debugBodyLimit]+"...(truncated)" {
+		t.Errorf("unexpected truncated body %q", got)
+	}
+}
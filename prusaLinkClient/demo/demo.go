@@ -0,0 +1,90 @@
+// Package demo provides printer of --demo mode, it prints the same job over and over
+package demo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+const (
+	jobID    = 1
+	fileName = "demo.gcode"
+)
+
+// Printer is prusalinkclient.Client looping through idle state, print of steps states with
+// rising progress and finished state. Every JobStatus call moves it to the next state
+type Printer struct {
+	mu    sync.Mutex
+	steps []prusalinkclient.Status
+	pos   int
+}
+
+var _ prusalinkclient.Client = (*Printer)(nil)
+
+// NewPrinter returns printer which job takes steps JobStatus calls
+func NewPrinter(steps int) *Printer {
+	p := &Printer{steps: []prusalinkclient.Status{{Online: true, State: prusalinkclient.StatusIdle}}}
+	for i := 1; i <= steps; i++ {
+		p.steps = append(p.steps, p.job(prusalinkclient.StatusPrinting, float64(i*100/(steps+1))))
+	}
+	p.steps = append(p.steps, p.job(prusalinkclient.StatusFinished, 100))
+	return p
+}
+
+func (p *Printer) job(state string, progress float64) prusalinkclient.Status {
+	return prusalinkclient.Status{Online: true, JobID: jobID, FileName: fileName, State: state, Progress: progress}
+}
+
+func (p *Printer) JobStatus(ctx context.Context) (*prusalinkclient.Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.steps[p.pos]
+	p.pos = (p.pos + 1) % len(p.steps)
+	return &st, nil
+}
+
+// StatusFull returns current state without moving print forward
+func (p *Printer) StatusFull(ctx context.Context) (*prusalinkclient.FullStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &prusalinkclient.FullStatus{Status: p.steps[p.pos]}, nil
+}
+
+func (p *Printer) PrinterInfo(ctx context.Context) (*prusalinkclient.PrinterInfo, error) {
+	return &prusalinkclient.PrinterInfo{Hostname: "prusa-demo", Name: "Demo printer", Model: "DEMO"}, nil
+}
+
+func (p *Printer) JobThumbnail(ctx context.Context) ([]byte, error) {
+	return nil, prusalinkclient.ErrNoThumbnail
+}
+
+func (p *Printer) JobMeta(ctx context.Context) (*prusalinkclient.JobMeta, error) {
+	return nil, prusalinkclient.ErrNoMeta
+}
+
+func (p *Printer) ListFiles(ctx context.Context, storage string) ([]prusalinkclient.File, error) {
+	return []prusalinkclient.File{}, nil
+}
+
+// Health reports printer seen just now, it's never offline
+func (p *Printer) Health() prusalinkclient.Health {
+	return prusalinkclient.Health{LastSeen: time.Now()}
+}
+
+// job control isn't supported, demo print can't be paused or stopped
+func (p *Printer) PauseJob(ctx context.Context, jobID int) error {
+	return prusalinkclient.ErrJobState
+}
+
+func (p *Printer) ResumeJob(ctx context.Context, jobID int) error {
+	return prusalinkclient.ErrJobState
+}
+
+func (p *Printer) StopJob(ctx context.Context, jobID int) error {
+	return prusalinkclient.ErrJobState
+}
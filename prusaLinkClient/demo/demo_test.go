@@ -0,0 +1,34 @@
+package demo
+
+import (
+	"testing"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+func TestPrinterLoop(t *testing.T) {
+	p := NewPrinter(2)
+
+	want := []string{
+		prusalinkclient.StatusIdle,
+		prusalinkclient.StatusPrinting,
+		prusalinkclient.StatusPrinting,
+		prusalinkclient.StatusFinished,
+		prusalinkclient.StatusIdle,
+		prusalinkclient.StatusPrinting,
+	}
+	progress := 0.0
+	for i, state := range want {
+		st, err := p.JobStatus(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.State != state {
+			t.Fatalf("step %d: expected %s, got %s", i, state, st.State)
+		}
+		if state == prusalinkclient.StatusPrinting && (st.JobID != jobID || st.Progress <= progress) {
+			t.Errorf("step %d: unexpected print state %+v", i, st)
+		}
+		progress = st.Progress
+	}
+}
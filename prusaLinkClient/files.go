@@ -0,0 +1,168 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrStorageNotFound = errors.New("no such storage")
+
+const (
+	// PrusaLink storage of Prusa printers with USB drive
+	defaultStorage = "usb"
+	// moonraker root with printable files
+	moonrakerStorage = "gcodes"
+)
+
+type File struct {
+	// long name shown to user
+	Name string
+	// path usable to print file, in the form Status.FilePath has
+	Path     string
+	Size     int64
+	Folder   bool
+	Modified time.Time
+}
+
+type filesResponse struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Children []struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		Type        string `json:"type"`
+		Size        int64  `json:"size"`
+		MTimestamp  int64  `json:"m_timestamp"`
+	} `json:"children"`
+}
+
+// ListFiles lists top level of PrusaLink storage, "usb" if storage is empty.
+// PrusaLink has neither pagination nor recursive listing, folders are returned as entries
+func (c *client) ListFiles(ctx context.Context, storage string) ([]File, error) {
+	if storage == "" {
+		storage = defaultStorage
+	}
+	code, data, err := c.get(ctx, "/api/v1/files/"+url.PathEscape(storage))
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrStorageNotFound, storage)
+	default:
+		return nil, fmt.Errorf("%w: files response status code %d", ErrBadResponse, code)
+	}
+	return parseFilesResponse(data, storage)
+}
+
+func parseFilesResponse(body []byte, storage string) ([]File, error) {
+	var resp filesResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse files: %w", ErrBadResponse, err)
+	}
+
+	files := make([]File, 0, len(resp.Children))
+	for _, child := range resp.Children {
+		name := child.DisplayName
+		if name == "" {
+			name = child.Name
+		}
+		file := File{
+			Name:   name,
+			Path:   path.Join("/", storage, child.Name),
+			Size:   child.Size,
+			Folder: child.Type == "FOLDER",
+		}
+		if child.MTimestamp > 0 {
+			file.Modified = time.Unix(child.MTimestamp, 0)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+type moonrakerDirectoryResponse struct {
+	Result struct {
+		Dirs []struct {
+			Dirname  string  `json:"dirname"`
+			Size     int64   `json:"size"`
+			Modified float64 `json:"modified"`
+		} `json:"dirs"`
+		Files []struct {
+			Filename string  `json:"filename"`
+			Size     int64   `json:"size"`
+			Modified float64 `json:"modified"`
+		} `json:"files"`
+	} `json:"result"`
+}
+
+// ListFiles lists moonraker directory, "gcodes" root if storage is empty
+func (c *moonrakerClient) ListFiles(ctx context.Context, storage string) ([]File, error) {
+	if storage == "" {
+		storage = moonrakerStorage
+	}
+	code, data, err := c.get(ctx, "/server/files/directory?extended=false&path="+url.QueryEscape(storage))
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+	// 400 for unknown root, 404 for missing directory
+	case http.StatusBadRequest, http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrStorageNotFound, storage)
+	default:
+		return nil, fmt.Errorf("%w: files response status code %d", ErrBadResponse, code)
+	}
+	return parseMoonrakerDirectory(data, storage)
+}
+
+func parseMoonrakerDirectory(body []byte, storage string) ([]File, error) {
+	var resp moonrakerDirectoryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse directory: %w", ErrBadResponse, err)
+	}
+
+	// print_stats filename is relative to gcodes root
+	relative := func(name string) string {
+		p := path.Join(storage, name)
+		return strings.TrimPrefix(p, moonrakerStorage+"/")
+	}
+
+	files := make([]File, 0, len(resp.Result.Dirs)+len(resp.Result.Files))
+	for _, dir := range resp.Result.Dirs {
+		files = append(files, File{
+			Name:     dir.Dirname,
+			Path:     relative(dir.Dirname),
+			Size:     dir.Size,
+			Folder:   true,
+			Modified: moonrakerTime(dir.Modified),
+		})
+	}
+	for _, file := range resp.Result.Files {
+		files = append(files, File{
+			Name:     file.Filename,
+			Path:     relative(file.Filename),
+			Size:     file.Size,
+			Modified: moonrakerTime(file.Modified),
+		})
+	}
+	return files, nil
+}
+
+// moonrakerTime converts unix time in fractional seconds
+func moonrakerTime(ts float64) time.Time {
+	if ts <= 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
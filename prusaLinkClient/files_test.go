@@ -0,0 +1,110 @@
+package prusalinkclient
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseFilesResponse(t *testing.T) {
+	files, err := parseFilesResponse(readFixture(t, "files_mk4_usb.json"), "usb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []File{
+		{Name: "Shape-Box_0.4n_0.2mm_PLA_MK4_1h11m.bgcode", Path: "/usb/SHAPE-~1.BGC", Size: 1180328,
+			Modified: time.Unix(1697365845, 0)},
+		{Name: "Prusa Mk4 examples", Path: "/usb/PRUSAM~1", Folder: true, Modified: time.Unix(1695811546, 0)},
+		{Name: "MK4_firmware_5.1.0.bbf", Path: "/usb/FW.BBF", Size: 2102784, Modified: time.Unix(1695811600, 0)},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], files[i])
+		}
+	}
+
+	if _, err := parseFilesResponse([]byte(`{"children":`), "usb"); !errors.Is(err, ErrBadResponse) {
+		t.Errorf("expected ErrBadResponse, got %v", err)
+	}
+}
+
+func TestParseMoonrakerDirectory(t *testing.T) {
+	files, err := parseMoonrakerDirectory(readFixture(t, "moonraker_directory.json"), "gcodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", files)
+	}
+	if dir := files[0]; !dir.Folder || dir.Path != "calibration" {
+		t.Errorf("unexpected dir %+v", dir)
+	}
+	if file := files[1]; file.Folder || file.Path != "benchy.gcode" || file.Size != 7300692 ||
+		file.Modified.Unix() != 1615578004 {
+		t.Errorf("unexpected file %+v", file)
+	}
+
+	files, err = parseMoonrakerDirectory(readFixture(t, "moonraker_directory.json"), "gcodes/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[1].Path != "sub/benchy.gcode" {
+		t.Errorf("expected path relative to gcodes, got %q", files[1].Path)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	fixture := readFixture(t, "files_mk4_usb.json")
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/files/usb" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(fixture)
+	}
+	cli, _ := newTestClient(t, PrinterConfig{}, handler)
+
+	files, err := cli.ListFiles(t.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("expected 3 files, got %+v", files)
+	}
+
+	if _, err := cli.ListFiles(t.Context(), "sdcard"); !errors.Is(err, ErrStorageNotFound) {
+		t.Errorf("expected ErrStorageNotFound, got %v", err)
+	}
+}
+
+func TestMoonrakerListFiles(t *testing.T) {
+	fixture := readFixture(t, "moonraker_directory.json")
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/server/files/directory" {
+			http.NotFound(w, req)
+			return
+		}
+		if req.URL.Query().Get("path") != "gcodes" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write(fixture)
+	}
+	cli, _ := newTestBackend(t, PrinterConfig{Type: TypeMoonraker}, handler)
+
+	files, err := cli.ListFiles(t.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 entries, got %+v", files)
+	}
+
+	if _, err := cli.ListFiles(t.Context(), "gcodes/missing"); !errors.Is(err, ErrStorageNotFound) {
+		t.Errorf("expected ErrStorageNotFound, got %v", err)
+	}
+}
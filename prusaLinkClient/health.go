@@ -0,0 +1,47 @@
+package prusalinkclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Health tells short printer reboot from printer that is gone for days
+type Health struct {
+	// zero if printer never answered
+	LastSeen            time.Time `json:"lastSeen"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	// empty after successful request
+	LastError string `json:"lastError,omitempty"`
+}
+
+func (c *client) Health() Health {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.health
+}
+
+// recordHealth notes result of request to printer. Printer answering with 5xx
+// or rejecting credentials counts as failure, cancellation by caller is ignored
+func (c *client) recordHealth(code int, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil && code >= http.StatusInternalServerError {
+		err = fmt.Errorf("%w: status code %d", ErrBadResponse, code)
+	}
+
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	if err != nil {
+		c.health.ConsecutiveFailures++
+		c.health.LastError = err.Error()
+		return
+	}
+	c.health.LastSeen = c.now()
+	c.health.ConsecutiveFailures = 0
+	c.health.LastError = ""
+}
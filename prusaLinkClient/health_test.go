@@ -0,0 +1,121 @@
+package prusalinkclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeTransport answers with queued results, connection refused when queue is empty
+type fakeTransport struct {
+	results []func(*http.Request) (*http.Response, error)
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.results) == 0 {
+		return nil, syscall.ECONNREFUSED
+	}
+	res := t.results[0]
+	t.results = t.results[1:]
+	return res(req)
+}
+
+func respond(code int, body string) func(*http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: code,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{},
+			Request:    req,
+		}, nil
+	}
+}
+
+func TestHealth(t *testing.T) {
+	cli, _ := newTestClient(t, PrinterConfig{CacheTTL: -1, Retries: -1}, printingHandler)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	cli.now = clock.Now
+	transport := &fakeTransport{}
+	cli.httpClient.Transport = transport
+
+	if h := cli.Health(); !h.LastSeen.IsZero() || h.ConsecutiveFailures != 0 {
+		t.Fatalf("unexpected initial health %+v", h)
+	}
+
+	transport.results = append(transport.results, respond(http.StatusOK, `{"id":7,"state":"PRINTING"}`))
+	if _, err := cli.JobStatus(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	seen := clock.now
+	if h := cli.Health(); !h.LastSeen.Equal(seen) || h.ConsecutiveFailures != 0 || h.LastError != "" {
+		t.Fatalf("unexpected health after success %+v", h)
+	}
+
+	// printer reboots: refused connections, then 503 while PrusaLink starts
+	clock.now = clock.now.Add(30 * time.Second)
+	transport.results = append(transport.results,
+		func(*http.Request) (*http.Response, error) { return nil, syscall.ECONNREFUSED },
+		func(*http.Request) (*http.Response, error) { return nil, syscall.ECONNREFUSED },
+		respond(http.StatusServiceUnavailable, ""),
+	)
+	for range 3 {
+		if _, err := cli.JobStatus(t.Context()); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	h := cli.Health()
+	if h.ConsecutiveFailures != 3 || !h.LastSeen.Equal(seen) || !strings.Contains(h.LastError, "503") {
+		t.Fatalf("unexpected health after failures %+v", h)
+	}
+
+	// unknown endpoint is still an answer
+	transport.results = append(transport.results, respond(http.StatusNotFound, ""))
+	if _, err := cli.PrinterInfo(t.Context()); err == nil {
+		t.Fatal("expected error")
+	}
+	if h := cli.Health(); h.ConsecutiveFailures != 0 || h.LastError != "" || !h.LastSeen.Equal(clock.now) {
+		t.Fatalf("expected reset after printer answered, got %+v", h)
+	}
+}
+
+func TestHealthIgnoresCancel(t *testing.T) {
+	cli, _ := newTestClient(t, PrinterConfig{Retries: -1}, printingHandler)
+	cli.httpClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := cli.PrinterInfo(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancel, got %v", err)
+	}
+	if h := cli.Health(); h.ConsecutiveFailures != 0 {
+		t.Errorf("cancelled request counted as failure %+v", h)
+	}
+}
+
+func TestHealthUnauthorized(t *testing.T) {
+	cli, _ := newTestClient(t, PrinterConfig{Retries: -1}, printingHandler)
+	cli.httpClient.Transport = &fakeTransport{results: []func(*http.Request) (*http.Response, error){
+		respond(http.StatusUnauthorized, ""),
+	}}
+
+	if err := cli.PauseJob(t.Context(), 7); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	if h := cli.Health(); h.ConsecutiveFailures != 1 || h.LastError != ErrUnauthorized.Error() {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
@@ -0,0 +1,89 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PrinterInfo identifies printer prusaCam is attached to
+type PrinterInfo struct {
+	Hostname string `json:"hostname"`
+	Serial   string `json:"serial"`
+	// name given in PrusaLink settings
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	Firmware string `json:"firmware"`
+	// PrusaLink server version
+	LinkVersion string `json:"linkVersion"`
+}
+
+type infoResponse struct {
+	Hostname string `json:"hostname,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+type versionResponse struct {
+	API      string `json:"api,omitempty"`
+	Server   string `json:"server,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// PrinterInfo combines /api/v1/info (identity) and /api/version (versions)
+func (c *client) PrinterInfo(ctx context.Context) (*PrinterInfo, error) {
+	code, info, err := c.get(ctx, "/api/v1/info")
+	if err != nil {
+		return nil, err
+	}
+	if code != 200 {
+		return nil, fmt.Errorf("%w: info response status code %d", ErrBadResponse, code)
+	}
+
+	code, version, err := c.get(ctx, "/api/version")
+	if err != nil {
+		return nil, err
+	}
+	if code != 200 {
+		return nil, fmt.Errorf("%w: version response status code %d", ErrBadResponse, code)
+	}
+
+	return parsePrinterInfo(info, version)
+}
+
+func parsePrinterInfo(infoBody, versionBody []byte) (*PrinterInfo, error) {
+	var info infoResponse
+	if err := json.Unmarshal(infoBody, &info); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse info: %w", ErrBadResponse, err)
+	}
+	var version versionResponse
+	if err := json.Unmarshal(versionBody, &version); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse version: %w", ErrBadResponse, err)
+	}
+
+	pi := &PrinterInfo{
+		Hostname:    info.Hostname,
+		Serial:      info.Serial,
+		Name:        info.Name,
+		Firmware:    version.Firmware,
+		LinkVersion: version.Server,
+	}
+	if pi.Hostname == "" {
+		pi.Hostname = version.Hostname
+	}
+	pi.Model = printerModel(pi.Hostname)
+	return pi, nil
+}
+
+// printerModel guesses model from default hostname (PrusaMK4, prusa-mini, ...),
+// PrusaLink doesn't report model explicitly
+func printerModel(hostname string) string {
+	model, ok := strings.CutPrefix(strings.ToLower(hostname), "prusa")
+	if !ok {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimLeft(model, "-_"))
+}
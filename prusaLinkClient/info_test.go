@@ -0,0 +1,71 @@
+package prusalinkclient
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParsePrinterInfo(t *testing.T) {
+	tests := []struct {
+		printer string
+		want    PrinterInfo
+	}{
+		{"mk4", PrinterInfo{
+			Hostname:    "PrusaMK4",
+			Serial:      "10589-3742441633025894",
+			Name:        "Workshop MK4",
+			Model:       "MK4",
+			Firmware:    "6.1.3+7898",
+			LinkVersion: "2.1.2",
+		}},
+		{"mini", PrinterInfo{
+			Hostname:    "prusa-mini",
+			Serial:      "CZPX4720X004XC98765",
+			Model:       "MINI",
+			Firmware:    "6.0.3+14902",
+			LinkVersion: "2.1.2",
+		}},
+	}
+
+	for _, tt := range tests {
+		info, err := parsePrinterInfo(readFixture(t, "info_"+tt.printer+".json"), readFixture(t, "version_"+tt.printer+".json"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.printer, err)
+		}
+		if *info != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.printer, tt.want, *info)
+		}
+	}
+}
+
+func TestPrinterInfo(t *testing.T) {
+	cli, _ := newTestClient(t, PrinterConfig{ApiKey: "secret"}, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v1/info":
+			w.Write(readFixture(t, "info_mk4.json"))
+		case "/api/version":
+			w.Write(readFixture(t, "version_mk4.json"))
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	info, err := cli.PrinterInfo(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Model != "MK4" || info.Firmware != "6.1.3+7898" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+}
@@ -0,0 +1,193 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// old PrusaLink (MK3 with Einsy) serves only OctoPrint compatible API
+const (
+	legacyPrinterPath = "/api/printer"
+	legacyJobPath     = "/api/job"
+)
+
+type legacyPrinterResponse struct {
+	Temperature struct {
+		Tool0 *legacyTemperature `json:"tool0,omitempty"`
+		Bed   *legacyTemperature `json:"bed,omitempty"`
+	} `json:"temperature"`
+	Telemetry struct {
+		ZHeight *float64 `json:"z-height,omitempty"`
+	} `json:"telemetry"`
+	State struct {
+		Text  string `json:"text"`
+		Flags struct {
+			Operational bool `json:"operational"`
+			Paused      bool `json:"paused"`
+			Pausing     bool `json:"pausing"`
+			Printing    bool `json:"printing"`
+			Cancelling  bool `json:"cancelling"`
+			Error       bool `json:"error"`
+			Ready       bool `json:"ready"`
+			Finished    bool `json:"finished"`
+			// PrusaLink own state, matches v1 API states when present
+			LinkState string `json:"link_state,omitempty"`
+		} `json:"flags"`
+	} `json:"state"`
+}
+
+type legacyTemperature struct {
+	Actual *float64 `json:"actual,omitempty"`
+	Target *float64 `json:"target,omitempty"`
+}
+
+type legacyJobResponse struct {
+	Job *struct {
+		File struct {
+			Name    string `json:"name"`
+			Display string `json:"display"`
+			Path    string `json:"path"`
+		} `json:"file"`
+	} `json:"job"`
+	Progress *struct {
+		// 0..1
+		Completion float64 `json:"completion"`
+		// seconds
+		PrintTime     int `json:"printTime"`
+		PrintTimeLeft int `json:"printTimeLeft"`
+	} `json:"progress"`
+}
+
+// useLegacyAPI switches client to OctoPrint compatible API for the rest of its life.
+// It's detected by 404 from /api/v1/job only, other v1 endpoints may be missing on new firmware too
+func (c *client) useLegacyAPI() {
+	if !c.legacyAPI.Swap(true) {
+		c.log.Debug("v1 API not found, using legacy API", "api", legacyJobPath)
+	}
+}
+
+// legacyStatus is job status with telemetry from /api/printer and /api/job.
+// Legacy API has no job ID, so it's zero
+func (c *client) legacyStatus(ctx context.Context) (*FullStatus, error) {
+	printer, err := c.legacyGet(ctx, legacyPrinterPath)
+	if err != nil {
+		return nil, err
+	}
+	job, err := c.legacyGet(ctx, legacyJobPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseLegacyStatus(printer, job, c.now())
+}
+
+func (c *client) legacyJobStatus(ctx context.Context) (*Status, error) {
+	st, err := c.legacyStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &st.Status, nil
+}
+
+// legacyStatusFull keeps StatusFull offline convention
+func (c *client) legacyStatusFull(ctx context.Context) (*FullStatus, error) {
+	st, err := c.legacyStatus(ctx)
+	if errors.Is(err, ErrPrinterOffline) {
+		return &FullStatus{Status: Status{Online: false}}, nil
+	}
+	return st, err
+}
+
+func (c *client) legacyGet(ctx context.Context, path string) ([]byte, error) {
+	code, data, err := c.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s response status code %d", ErrBadResponse, path, code)
+	}
+	return data, nil
+}
+
+func parseLegacyStatus(printerBody, jobBody []byte, now time.Time) (*FullStatus, error) {
+	var printer legacyPrinterResponse
+	if err := json.Unmarshal(printerBody, &printer); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse printer: %w", ErrBadResponse, err)
+	}
+	var job legacyJobResponse
+	if err := json.Unmarshal(jobBody, &job); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse job: %w", ErrBadResponse, err)
+	}
+
+	st := &FullStatus{
+		Status: Status{
+			Online: true,
+			State:  legacyState(&printer),
+		},
+		Telemetry: Telemetry{
+			AxisZ: printer.Telemetry.ZHeight,
+		},
+	}
+	if t := printer.Temperature.Tool0; t != nil {
+		st.Telemetry.TempNozzle, st.Telemetry.TargetNozzle = t.Actual, t.Target
+	}
+	if t := printer.Temperature.Bed; t != nil {
+		st.Telemetry.TempBed, st.Telemetry.TargetBed = t.Actual, t.Target
+	}
+
+	if job.Job != nil {
+		st.Status.FileName = job.Job.File.Display
+		if st.Status.FileName == "" {
+			st.Status.FileName = job.Job.File.Name
+		}
+		st.Status.FilePath = job.Job.File.Path
+	}
+	if p := job.Progress; p != nil {
+		printing := time.Duration(p.PrintTime) * time.Second
+		st.Status.Progress = p.Completion * 100
+		st.Status.TimePrinting = printing
+		st.Status.TimeRemaining = time.Duration(p.PrintTimeLeft) * time.Second
+		st.Status.StartedAt = startedAt(now, printing)
+	}
+	return st, nil
+}
+
+// legacyState maps OctoPrint state flags to v1 API states
+func legacyState(printer *legacyPrinterResponse) string {
+	flags := printer.State.Flags
+	switch {
+	case flags.LinkState != "":
+		return flags.LinkState
+	case flags.Error:
+		return StatusError
+	case flags.Paused || flags.Pausing:
+		return StatusPaused
+	case flags.Cancelling:
+		return StatusBusy
+	case flags.Printing:
+		return StatusPrinting
+	case flags.Finished:
+		return StatusFinished
+	case flags.Ready:
+		return StatusReady
+	case flags.Operational:
+		return StatusIdle
+	}
+
+	// flags missing, the text is all we have
+	switch printer.State.Text {
+	case "Printing":
+		return StatusPrinting
+	case "Paused", "Pausing":
+		return StatusPaused
+	case "Error":
+		return StatusError
+	case "Operational":
+		return StatusIdle
+	default:
+		return StatusBusy
+	}
+}
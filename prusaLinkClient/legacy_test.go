@@ -0,0 +1,101 @@
+package prusalinkclient
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseLegacyStatus(t *testing.T) {
+	now := time.Unix(10000, 0)
+	st, err := parseLegacyStatus(readFixture(t, "legacy_printer_printing.json"), readFixture(t, "legacy_job_printing.json"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Status{Online: true, FileName: "benchy.gcode", FilePath: "/local/benchy.gcode", State: StatusPrinting, Progress: 42,
+		TimePrinting: 1480 * time.Second, TimeRemaining: 3940 * time.Second, StartedAt: now.Add(-1480 * time.Second)}
+	if st.Status != want {
+		t.Errorf("expected %+v, got %+v", want, st.Status)
+	}
+	tm := st.Telemetry
+	if tm.TempNozzle == nil || *tm.TempNozzle != 214.9 || tm.TargetBed == nil || *tm.TargetBed != 60 || tm.AxisZ == nil || *tm.AxisZ != 5.2 {
+		t.Errorf("unexpected telemetry %+v", tm)
+	}
+
+	// no link_state, flags only
+	st, err = parseLegacyStatus(readFixture(t, "legacy_printer_paused.json"), readFixture(t, "legacy_job_idle.json"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status.State != StatusPaused || st.Status.FileName != "" || st.Status.Progress != 0 {
+		t.Errorf("unexpected status %+v", st.Status)
+	}
+}
+
+func TestLegacyState(t *testing.T) {
+	tests := []struct {
+		printer string
+		want    string
+	}{
+		{`{"state":{"text":"Operational","flags":{"operational":true}}}`, StatusIdle},
+		{`{"state":{"text":"Printing","flags":{"operational":true,"printing":true}}}`, StatusPrinting},
+		{`{"state":{"text":"Cancelling","flags":{"operational":true,"printing":true,"cancelling":true}}}`, StatusBusy},
+		{`{"state":{"text":"Error","flags":{"error":true,"closedOrError":true}}}`, StatusError},
+		{`{"state":{"text":"Finished","flags":{"operational":true,"finished":true}}}`, StatusFinished},
+		{`{"state":{"text":"Printing","flags":{"printing":true,"link_state":"ATTENTION"}}}`, StatusAttention},
+		{`{"state":{"text":"Printing"}}`, StatusPrinting},
+	}
+	for _, tt := range tests {
+		st, err := parseLegacyStatus([]byte(tt.printer), []byte(`{}`), time.Now())
+		if err != nil {
+			t.Errorf("%s: %v", tt.printer, err)
+			continue
+		}
+		if st.Status.State != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.printer, tt.want, st.Status.State)
+		}
+	}
+}
+
+func TestLegacyFallback(t *testing.T) {
+	printer := readFixture(t, "legacy_printer_printing.json")
+	job := readFixture(t, "legacy_job_printing.json")
+	v1Requests := &atomic.Int32{}
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/printer":
+			w.Write(printer)
+		case "/api/job":
+			w.Write(job)
+		default:
+			v1Requests.Add(1)
+			http.NotFound(w, req)
+		}
+	}
+	cli, _ := newTestClient(t, PrinterConfig{CacheTTL: -1}, handler)
+
+	for range 3 {
+		st, err := cli.JobStatus(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.State != StatusPrinting || st.Progress != 42 {
+			t.Fatalf("unexpected status %+v", st)
+		}
+	}
+	if n := v1Requests.Load(); n != 1 {
+		t.Errorf("expected single v1 probe, got %d", n)
+	}
+
+	full, err := cli.StatusFull(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Telemetry.TempBed == nil || *full.Telemetry.TempBed != 60.1 {
+		t.Errorf("unexpected telemetry %+v", full.Telemetry)
+	}
+	if n := v1Requests.Load(); n != 1 {
+		t.Errorf("StatusFull went to v1 API after fallback, %d requests", n)
+	}
+}
@@ -0,0 +1,294 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mdnsAddr        = "224.0.0.251:5353"
+	mdnsService     = "_http._tcp.local."
+	defaultDiscover = 3 * time.Second
+
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsClassIN = 1
+)
+
+// DiscoveredPrinter is PrusaLink instance found with mDNS
+type DiscoveredPrinter struct {
+	// service instance name, e.g. "PrusaLink MK4"
+	Name string
+	// host:port, usable as printer address
+	Address string
+}
+
+// Discover browses mDNS for PrusaLink instances for timeout
+// (or till ctx is done). Networks blocking multicast just give empty result
+func Discover(ctx context.Context, timeout time.Duration) ([]DiscoveredPrinter, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	group, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+	// querying from ephemeral port makes responders answer with unicast (RFC 6762 6.7)
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open mdns socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteToUDP(mdnsQuery(mdnsService, dnsTypePTR), group); err != nil {
+		return nil, fmt.Errorf("fail to send mdns query: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	go func() {
+		<-ctx.Done()
+		// unblocks read when ctx is cancelled before timeout
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	records := &mdnsRecords{}
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("fail to read mdns response: %w", err)
+		}
+		// foreign garbage on the port is ignored
+		records.parse(buf[:n])
+	}
+	return records.printers(), nil
+}
+
+// discoverAddress returns address of the only PrusaLink found in network
+func discoverAddress(ctx context.Context, timeout time.Duration) (string, error) {
+	found, err := Discover(ctx, timeout)
+	if err != nil {
+		return "", err
+	}
+	return pickAddress(found)
+}
+
+func pickAddress(found []DiscoveredPrinter) (string, error) {
+	switch len(found) {
+	case 0:
+		return "", errors.New("printer address is empty and no PrusaLink found with mDNS, set printer address")
+	case 1:
+		return found[0].Address, nil
+	default:
+		candidates := make([]string, 0, len(found))
+		for _, p := range found {
+			candidates = append(candidates, fmt.Sprintf("%s (%s)", p.Address, p.Name))
+		}
+		return "", fmt.Errorf("several printers found with mDNS, set printer address to one of: %s",
+			strings.Join(candidates, ", "))
+	}
+}
+
+// mdnsQuery builds DNS query with single question
+func mdnsQuery(name string, typ uint16) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], 1) // questions count
+	msg = appendName(msg, name)
+	msg = binary.BigEndian.AppendUint16(msg, typ)
+	return binary.BigEndian.AppendUint16(msg, dnsClassIN)
+}
+
+func appendName(msg []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0)
+}
+
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+// mdnsRecords collects answers from all responses, services may announce
+// PTR, SRV and A records in separate packets
+type mdnsRecords struct {
+	instances []string
+	srv       map[string]srvRecord
+	txt       map[string][]string
+	ips       map[string]net.IP
+}
+
+func (r *mdnsRecords) parse(msg []byte) error {
+	if len(msg) < 12 {
+		return errors.New("short dns message")
+	}
+	if r.srv == nil {
+		r.srv = make(map[string]srvRecord)
+		r.txt = make(map[string][]string)
+		r.ips = make(map[string]net.IP)
+	}
+
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:])) +
+		int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for range questions {
+		var err error
+		if _, off, err = readName(msg, off); err != nil {
+			return err
+		}
+		off += 4
+	}
+
+	for range records {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return err
+		}
+		if next+10 > len(msg) {
+			return errors.New("truncated dns record")
+		}
+		typ := binary.BigEndian.Uint16(msg[next:])
+		rdLen := int(binary.BigEndian.Uint16(msg[next+8:]))
+		rdStart := next + 10
+		if rdStart+rdLen > len(msg) {
+			return errors.New("truncated dns record data")
+		}
+		rdata := msg[rdStart : rdStart+rdLen]
+
+		switch typ {
+		case dnsTypePTR:
+			if !strings.EqualFold(name, mdnsService) {
+				break
+			}
+			instance, _, err := readName(msg, rdStart)
+			if err != nil {
+				return err
+			}
+			r.instances = append(r.instances, instance)
+		case dnsTypeSRV:
+			if len(rdata) < 7 {
+				return errors.New("short srv record")
+			}
+			target, _, err := readName(msg, rdStart+6)
+			if err != nil {
+				return err
+			}
+			r.srv[strings.ToLower(name)] = srvRecord{target: target, port: binary.BigEndian.Uint16(rdata[4:])}
+		case dnsTypeTXT:
+			r.txt[strings.ToLower(name)] = readTXT(rdata)
+		case dnsTypeA:
+			if len(rdata) == 4 {
+				r.ips[strings.ToLower(name)] = net.IP(rdata)
+			}
+		}
+		off = rdStart + rdLen
+	}
+	return nil
+}
+
+// printers returns PrusaLink instances, other http services are skipped
+func (r *mdnsRecords) printers() []DiscoveredPrinter {
+	var found []DiscoveredPrinter
+	seen := make(map[string]bool)
+	for _, instance := range r.instances {
+		key := strings.ToLower(instance)
+		if seen[key] || !r.isPrusaLink(key) {
+			continue
+		}
+		seen[key] = true
+
+		label := strings.TrimSuffix(instance, "."+mdnsService)
+		srv, ok := r.srv[key]
+		if !ok {
+			continue
+		}
+		host := strings.TrimSuffix(srv.target, ".")
+		if ip, ok := r.ips[strings.ToLower(srv.target)]; ok {
+			host = ip.String()
+		}
+		found = append(found, DiscoveredPrinter{
+			Name:    label,
+			Address: net.JoinHostPort(host, strconv.Itoa(int(srv.port))),
+		})
+	}
+	return found
+}
+
+func (r *mdnsRecords) isPrusaLink(instance string) bool {
+	if strings.Contains(instance, "prusa") {
+		return true
+	}
+	for _, kv := range r.txt[instance] {
+		if strings.Contains(strings.ToLower(kv), "prusa") {
+			return true
+		}
+	}
+	return false
+}
+
+// readName reads possibly compressed name at off, returns it with trailing dot and offset after it
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("dns name out of message")
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("truncated dns name pointer")
+			}
+			if jumps++; jumps > 10 {
+				return "", 0, errors.New("dns name pointer loop")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errors.New("dns label out of message")
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+func readTXT(rdata []byte) []string {
+	var values []string
+	for len(rdata) > 0 {
+		l := int(rdata[0])
+		if 1+l > len(rdata) {
+			break
+		}
+		values = append(values, string(rdata[1:1+l]))
+		rdata = rdata[1+l:]
+	}
+	return values
+}
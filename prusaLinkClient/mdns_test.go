@@ -0,0 +1,152 @@
+package prusalinkclient
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// dnsResponse builds mDNS response, record names after the first one
+// are compressed with pointer to service name where possible
+type dnsResponse struct {
+	msg   []byte
+	count uint16
+}
+
+func newDNSResponse() *dnsResponse {
+	r := &dnsResponse{msg: make([]byte, 12)}
+	binary.BigEndian.PutUint16(r.msg[2:], 0x8400) // response, authoritative
+	return r
+}
+
+func (r *dnsResponse) record(name string, typ uint16, rdata []byte) *dnsResponse {
+	r.msg = appendName(r.msg, name)
+	r.msg = binary.BigEndian.AppendUint16(r.msg, typ)
+	r.msg = binary.BigEndian.AppendUint16(r.msg, dnsClassIN)
+	r.msg = binary.BigEndian.AppendUint32(r.msg, 120)
+	r.msg = binary.BigEndian.AppendUint16(r.msg, uint16(len(rdata)))
+	r.msg = append(r.msg, rdata...)
+	r.count++
+	binary.BigEndian.PutUint16(r.msg[6:], r.count)
+	return r
+}
+
+// ptr returns PTR rdata with instance label followed by pointer to service name at offset 12
+func ptr(label string) []byte {
+	return append([]byte{byte(len(label))}, append([]byte(label), 0xC0, 12)...)
+}
+
+func srv(port uint16, target string) []byte {
+	rdata := make([]byte, 6)
+	binary.BigEndian.PutUint16(rdata[4:], port)
+	return appendName(rdata, target)
+}
+
+func txt(values ...string) []byte {
+	var rdata []byte
+	for _, v := range values {
+		rdata = append(rdata, byte(len(v)))
+		rdata = append(rdata, v...)
+	}
+	return rdata
+}
+
+func TestMDNSRecords(t *testing.T) {
+	records := &mdnsRecords{}
+
+	// PrusaLink answers with PTR, SRV, TXT and A in one packet
+	first := newDNSResponse().
+		record(mdnsService, dnsTypePTR, ptr("PrusaLink MK4")).
+		record("PrusaLink MK4."+mdnsService, dnsTypeSRV, srv(80, "prusa-mk4.local.")).
+		record("prusa-mk4.local.", dnsTypeA, []byte{192, 168, 1, 10})
+	if err := records.parse(first.msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// printer named without "prusa", recognized by TXT
+	second := newDNSResponse().
+		record(mdnsService, dnsTypePTR, ptr("Garage")).
+		record("Garage."+mdnsService, dnsTypeSRV, srv(8080, "garage.local.")).
+		record("Garage."+mdnsService, dnsTypeTXT, txt("path=/", "model=PrusaLink MINI"))
+	if err := records.parse(second.msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// unrelated http service
+	other := newDNSResponse().
+		record(mdnsService, dnsTypePTR, ptr("NAS")).
+		record("NAS."+mdnsService, dnsTypeSRV, srv(5000, "nas.local.")).
+		record("nas.local.", dnsTypeA, []byte{192, 168, 1, 2})
+	if err := records.parse(other.msg); err != nil {
+		t.Fatal(err)
+	}
+
+	found := records.printers()
+	want := []DiscoveredPrinter{
+		{Name: "PrusaLink MK4", Address: "192.168.1.10:80"},
+		{Name: "Garage", Address: "garage.local:8080"},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, found)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], found[i])
+		}
+	}
+}
+
+func TestMDNSMalformed(t *testing.T) {
+	valid := newDNSResponse().record(mdnsService, dnsTypePTR, ptr("PrusaLink MK4")).msg
+
+	for _, msg := range [][]byte{
+		nil,
+		valid[:20],
+		valid[:len(valid)-3],
+		// pointer to itself
+		append(append([]byte(nil), valid[:12]...), 0xC0, 12, 0, 12, 0, 1, 0, 0, 0, 120, 0, 0),
+	} {
+		if err := (&mdnsRecords{}).parse(msg); err == nil {
+			t.Errorf("expected error for %v", msg)
+		}
+	}
+}
+
+func TestMDNSQuery(t *testing.T) {
+	q := mdnsQuery(mdnsService, dnsTypePTR)
+	if binary.BigEndian.Uint16(q[4:]) != 1 {
+		t.Error("expected single question")
+	}
+	name, off, err := readName(q, 12)
+	if err != nil || name != mdnsService {
+		t.Fatalf("unexpected question name %q: %v", name, err)
+	}
+	if typ := binary.BigEndian.Uint16(q[off:]); typ != dnsTypePTR {
+		t.Errorf("unexpected question type %d", typ)
+	}
+}
+
+func TestPickAddress(t *testing.T) {
+	if _, err := pickAddress(nil); err == nil {
+		t.Error("expected error when nothing found")
+	}
+
+	addr, err := pickAddress([]DiscoveredPrinter{{Name: "PrusaLink MK4", Address: "192.168.1.10:80"}})
+	if err != nil || addr != "192.168.1.10:80" {
+		t.Errorf("unexpected address %q: %v", addr, err)
+	}
+
+	_, err = pickAddress([]DiscoveredPrinter{
+		{Name: "PrusaLink MK4", Address: "192.168.1.10:80"},
+		{Name: "PrusaLink MINI", Address: "192.168.1.11:80"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "192.168.1.10:80 (PrusaLink MK4)") || !strings.Contains(err.Error(), "192.168.1.11:80") {
+		t.Errorf("error should list candidates, got %v", err)
+	}
+}
+
+func TestNoDiscovery(t *testing.T) {
+	if _, err := NewClient(nil, &PrinterConfig{DiscoveryTimeout: -1}); err == nil {
+		t.Error("expected error for empty address with discovery disabled")
+	}
+}
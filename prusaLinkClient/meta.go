@@ -0,0 +1,171 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoMeta = errors.New("no job file metadata")
+
+// JobMeta is slicer metadata of the file being printed, zero fields are unknown
+type JobMeta struct {
+	// slicer estimate of the whole print
+	EstimatedTime time.Duration
+	LayerHeight   float64
+	LayerCount    int
+}
+
+type fileMetaResponse struct {
+	Meta map[string]json.RawMessage `json:"meta"`
+}
+
+// JobMeta reads metadata of current job file from PrusaLink storage
+func (c *client) JobMeta(ctx context.Context) (*JobMeta, error) {
+	st, err := c.JobStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if st.FilePath == "" {
+		return nil, ErrNoMeta
+	}
+
+	code, data, err := c.get(ctx, "/api/v1/files"+(&url.URL{Path: st.FilePath}).EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNoMeta
+	default:
+		return nil, fmt.Errorf("%w: file response status code %d", ErrBadResponse, code)
+	}
+	return parseFileMeta(data)
+}
+
+// parseFileMeta handles both .gcode and .bgcode meta, keys are the ones slicer writes
+func parseFileMeta(body []byte) (*JobMeta, error) {
+	var resp fileMetaResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse file: %w", ErrBadResponse, err)
+	}
+	if len(resp.Meta) == 0 {
+		return nil, ErrNoMeta
+	}
+
+	meta := &JobMeta{
+		LayerHeight: metaNumber(resp.Meta["layer_height"]),
+	}
+	if raw, ok := resp.Meta["estimated printing time (normal mode)"]; ok {
+		meta.EstimatedTime = metaDuration(raw)
+	}
+	if maxZ := metaNumber(resp.Meta["max_layer_z"]); maxZ > 0 && meta.LayerHeight > 0 {
+		meta.LayerCount = int(math.Round(maxZ / meta.LayerHeight))
+	}
+	return meta, nil
+}
+
+// metaNumber reads number or numeric string, zero if it isn't one
+func metaNumber(raw json.RawMessage) float64 {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		raw = json.RawMessage(s)
+	}
+	var f float64
+	if json.Unmarshal(raw, &f) != nil {
+		return 0
+	}
+	return f
+}
+
+// metaDuration reads slicer time like "1d 2h 3m 4s" or number of seconds
+func metaDuration(raw json.RawMessage) time.Duration {
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return time.Duration(metaNumber(raw) * float64(time.Second))
+	}
+
+	var total time.Duration
+	for field := range strings.FieldsSeq(s) {
+		if len(field) < 2 {
+			return 0
+		}
+		n, err := strconv.Atoi(field[:len(field)-1])
+		if err != nil {
+			return 0
+		}
+		unit := time.Second
+		switch field[len(field)-1] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'h':
+			unit = time.Hour
+		case 'm':
+			unit = time.Minute
+		case 's':
+		default:
+			return 0
+		}
+		total += time.Duration(n) * unit
+	}
+	return total
+}
+
+type moonrakerMetadataResponse struct {
+	Result struct {
+		EstimatedTime float64 `json:"estimated_time"`
+		LayerHeight   float64 `json:"layer_height"`
+		LayerCount    int     `json:"layer_count"`
+		ObjectHeight  float64 `json:"object_height"`
+	} `json:"result"`
+}
+
+// JobMeta reads metadata moonraker extracted from current job file
+func (c *moonrakerClient) JobMeta(ctx context.Context) (*JobMeta, error) {
+	st, err := c.JobStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if st.FilePath == "" {
+		return nil, ErrNoMeta
+	}
+
+	code, data, err := c.get(ctx, "/server/files/metadata?filename="+url.QueryEscape(st.FilePath))
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNoMeta
+	default:
+		return nil, fmt.Errorf("%w: metadata response status code %d", ErrBadResponse, code)
+	}
+	return parseMoonrakerMetadata(data)
+}
+
+func parseMoonrakerMetadata(body []byte) (*JobMeta, error) {
+	var resp moonrakerMetadataResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse metadata: %w", ErrBadResponse, err)
+	}
+	res := resp.Result
+	meta := &JobMeta{
+		EstimatedTime: time.Duration(res.EstimatedTime * float64(time.Second)),
+		LayerHeight:   res.LayerHeight,
+		LayerCount:    res.LayerCount,
+	}
+	// older slicers don't write layer count
+	if meta.LayerCount == 0 && res.ObjectHeight > 0 && res.LayerHeight > 0 {
+		meta.LayerCount = int(math.Round(res.ObjectHeight / res.LayerHeight))
+	}
+	return meta, nil
+}
@@ -0,0 +1,97 @@
+package prusalinkclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseFileMeta(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    JobMeta
+	}{
+		{"file_meta_gcode.json", JobMeta{EstimatedTime: time.Hour + 32*time.Minute + 10*time.Second, LayerHeight: 0.2}},
+		{"file_meta_bgcode.json", JobMeta{EstimatedTime: 25*time.Hour + 11*time.Minute, LayerHeight: 0.2, LayerCount: 151}},
+	}
+	for _, tt := range tests {
+		meta, err := parseFileMeta(readFixture(t, tt.fixture))
+		if err != nil {
+			t.Errorf("%s: %v", tt.fixture, err)
+			continue
+		}
+		if *meta != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.fixture, tt.want, *meta)
+		}
+	}
+
+	if _, err := parseFileMeta([]byte(`{"name":"FW.BBF"}`)); !errors.Is(err, ErrNoMeta) {
+		t.Errorf("expected ErrNoMeta for file without meta, got %v", err)
+	}
+}
+
+func TestMetaDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		`"2h 5m"`:       2*time.Hour + 5*time.Minute,
+		`"45s"`:         45 * time.Second,
+		`"1d 0h 1m 2s"`: 24*time.Hour + time.Minute + 2*time.Second,
+		`3600`:          time.Hour,
+		`"soon"`:        0,
+		`"5x"`:          0,
+		`null`:          0,
+	}
+	for raw, want := range tests {
+		if got := metaDuration(json.RawMessage(raw)); got != want {
+			t.Errorf("%s: expected %s, got %s", raw, want, got)
+		}
+	}
+}
+
+func TestParseMoonrakerMetadata(t *testing.T) {
+	meta, err := parseMoonrakerMetadata(readFixture(t, "moonraker_metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := JobMeta{EstimatedTime: 5162500 * time.Millisecond, LayerHeight: 0.2, LayerCount: 240}
+	if *meta != want {
+		t.Errorf("expected %+v, got %+v", want, *meta)
+	}
+
+	meta, err = parseMoonrakerMetadata([]byte(`{"result":{"layer_height":0.2,"object_height":48}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.LayerCount != 240 {
+		t.Errorf("expected layer count from object height, got %d", meta.LayerCount)
+	}
+}
+
+func TestJobMeta(t *testing.T) {
+	fixture := readFixture(t, "file_meta_bgcode.json")
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v1/job":
+			w.Write([]byte(`{"id":7,"state":"PRINTING","progress":42,"file":{"display_name":"box.bgcode","path":"/usb/SHAPE-~1.BGC"}}`))
+		case "/api/v1/files/usb/SHAPE-~1.BGC":
+			w.Write(fixture)
+		default:
+			http.NotFound(w, req)
+		}
+	}
+	cli, _ := newTestClient(t, PrinterConfig{}, handler)
+	meta, err := cli.JobMeta(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.LayerCount != 151 {
+		t.Errorf("unexpected meta %+v", meta)
+	}
+
+	// serial print without file
+	cli, _ = newTestClient(t, PrinterConfig{}, printingHandler)
+	if _, err := cli.JobMeta(t.Context()); !errors.Is(err, ErrNoMeta) {
+		t.Errorf("expected ErrNoMeta, got %v", err)
+	}
+}
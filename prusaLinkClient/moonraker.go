@@ -0,0 +1,253 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+const (
+	moonrakerJobQuery    = "/printer/objects/query?print_stats&display_status"
+	moonrakerStatusQuery = moonrakerJobQuery + "&extruder&heater_bed&toolhead"
+	// the latest job, the running one is added when print starts
+	moonrakerHistoryQuery = "/server/history/list?limit=1&order=desc"
+)
+
+// moonrakerClient talks to Klipper printers through Moonraker API.
+// Transport, retries and cache are shared with PrusaLink client
+type moonrakerClient struct {
+	*client
+}
+
+type moonrakerQueryResponse struct {
+	Result struct {
+		Status struct {
+			PrintStats *struct {
+				Filename      string  `json:"filename,omitempty"`
+				State         string  `json:"state,omitempty"`
+				PrintDuration float64 `json:"print_duration,omitempty"`
+				// print duration with pauses
+				TotalDuration float64 `json:"total_duration,omitempty"`
+			} `json:"print_stats,omitempty"`
+			DisplayStatus *struct {
+				// 0..1
+				Progress float64 `json:"progress,omitempty"`
+			} `json:"display_status,omitempty"`
+			Extruder *struct {
+				Temperature *float64 `json:"temperature,omitempty"`
+				Target      *float64 `json:"target,omitempty"`
+			} `json:"extruder,omitempty"`
+			HeaterBed *struct {
+				Temperature *float64 `json:"temperature,omitempty"`
+				Target      *float64 `json:"target,omitempty"`
+			} `json:"heater_bed,omitempty"`
+			Toolhead *struct {
+				// x, y, z, e
+				Position []float64 `json:"position,omitempty"`
+			} `json:"toolhead,omitempty"`
+		} `json:"status"`
+	} `json:"result"`
+}
+
+type moonrakerHistoryResponse struct {
+	Result struct {
+		Jobs []struct {
+			// hex number
+			JobID    string `json:"job_id"`
+			Filename string `json:"filename"`
+		} `json:"jobs"`
+	} `json:"result"`
+}
+
+type moonrakerInfoResponse struct {
+	Result struct {
+		Hostname        string `json:"hostname,omitempty"`
+		SoftwareVersion string `json:"software_version,omitempty"`
+	} `json:"result"`
+}
+
+type moonrakerServerResponse struct {
+	Result struct {
+		MoonrakerVersion string `json:"moonraker_version,omitempty"`
+	} `json:"result"`
+}
+
+// moonrakerStates maps print_stats.state to PrusaLink states
+var moonrakerStates = map[string]string{
+	"standby":   StatusIdle,
+	"printing":  StatusPrinting,
+	"paused":    StatusPaused,
+	"complete":  StatusFinished,
+	"cancelled": StatusStopped,
+	"error":     StatusError,
+}
+
+func (c *moonrakerClient) JobStatus(ctx context.Context) (*Status, error) {
+	return c.sharedJobStatus(ctx, c.jobStatus)
+}
+
+func (c *moonrakerClient) jobStatus(ctx context.Context) (*Status, error) {
+	full, err := c.query(ctx, moonrakerJobQuery)
+	if err != nil {
+		return nil, err
+	}
+	if !full.Status.Online {
+		return nil, ErrPrinterOffline
+	}
+	return &full.Status, nil
+}
+
+func (c *moonrakerClient) StatusFull(ctx context.Context) (*FullStatus, error) {
+	return c.query(ctx, moonrakerStatusQuery)
+}
+
+func (c *moonrakerClient) query(ctx context.Context, path string) (*FullStatus, error) {
+	code, data, err := c.get(ctx, path)
+	if errors.Is(err, ErrPrinterOffline) {
+		return &FullStatus{Status: Status{Online: false}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code != 200 {
+		return nil, fmt.Errorf("%w: response status code %d", ErrBadResponse, code)
+	}
+
+	st, err := parseMoonrakerQuery(data, c.now())
+	if err != nil {
+		return nil, err
+	}
+	if st.Status.FileName != "" {
+		if st.Status.JobID, err = c.jobID(ctx, st.Status.FileName); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// jobID identifies print of filename by its job history entry, print_stats has no id.
+// Without history component id is derived from filename, so reprints of a file share it
+func (c *moonrakerClient) jobID(ctx context.Context, filename string) (int, error) {
+	code, data, err := c.get(ctx, moonrakerHistoryQuery)
+	if err != nil {
+		return 0, err
+	}
+	switch code {
+	case 200:
+		if id, ok, err := parseMoonrakerHistory(data, filename); err != nil || ok {
+			return id, err
+		}
+	case 404:
+	default:
+		return 0, fmt.Errorf("%w: history response status code %d", ErrBadResponse, code)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(filename))
+	return int(h.Sum32() & 0x7fffffff), nil
+}
+
+// parseMoonrakerHistory returns id of the latest job if it's the one of filename
+func parseMoonrakerHistory(body []byte, filename string) (int, bool, error) {
+	var resp moonrakerHistoryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, false, fmt.Errorf("%w: fail to parse history: %w", ErrBadResponse, err)
+	}
+	if len(resp.Result.Jobs) == 0 || resp.Result.Jobs[0].Filename != filename {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(resp.Result.Jobs[0].JobID, 16, 32)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: invalid job_id %q: %w", ErrBadResponse, resp.Result.Jobs[0].JobID, err)
+	}
+	return int(id), true, nil
+}
+
+func parseMoonrakerQuery(body []byte, now time.Time) (*FullStatus, error) {
+	var resp moonrakerQueryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse query: %w", ErrBadResponse, err)
+	}
+
+	objects := resp.Result.Status
+	if objects.PrintStats == nil {
+		return nil, fmt.Errorf("%w: print_stats is missing", ErrBadResponse)
+	}
+
+	state, ok := moonrakerStates[objects.PrintStats.State]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown moonraker state %q", ErrBadResponse, objects.PrintStats.State)
+	}
+
+	stats := objects.PrintStats
+	st := &FullStatus{
+		Status: Status{
+			Online: true,
+			// filename is relative to gcodes root, so it's path too
+			FileName:     stats.Filename,
+			FilePath:     stats.Filename,
+			State:        state,
+			TimePrinting: time.Duration(stats.PrintDuration * float64(time.Second)),
+			StartedAt:    startedAt(now, time.Duration(stats.TotalDuration*float64(time.Second))),
+		},
+	}
+	if objects.DisplayStatus != nil {
+		st.Status.Progress = objects.DisplayStatus.Progress * 100
+	}
+	if objects.Extruder != nil {
+		st.Telemetry.TempNozzle = objects.Extruder.Temperature
+		st.Telemetry.TargetNozzle = objects.Extruder.Target
+	}
+	if objects.HeaterBed != nil {
+		st.Telemetry.TempBed = objects.HeaterBed.Temperature
+		st.Telemetry.TargetBed = objects.HeaterBed.Target
+	}
+	if objects.Toolhead != nil && len(objects.Toolhead.Position) >= 3 {
+		pos := objects.Toolhead.Position
+		st.Telemetry.AxisX, st.Telemetry.AxisY, st.Telemetry.AxisZ = &pos[0], &pos[1], &pos[2]
+	}
+	return st, nil
+}
+
+// PrinterInfo combines /printer/info (klipper) and /server/info (moonraker)
+func (c *moonrakerClient) PrinterInfo(ctx context.Context) (*PrinterInfo, error) {
+	code, info, err := c.get(ctx, "/printer/info")
+	if err != nil {
+		return nil, err
+	}
+	if code != 200 {
+		return nil, fmt.Errorf("%w: info response status code %d", ErrBadResponse, code)
+	}
+
+	code, server, err := c.get(ctx, "/server/info")
+	if err != nil {
+		return nil, err
+	}
+	if code != 200 {
+		return nil, fmt.Errorf("%w: server info response status code %d", ErrBadResponse, code)
+	}
+
+	return parseMoonrakerInfo(info, server)
+}
+
+func parseMoonrakerInfo(infoBody, serverBody []byte) (*PrinterInfo, error) {
+	var info moonrakerInfoResponse
+	if err := json.Unmarshal(infoBody, &info); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse info: %w", ErrBadResponse, err)
+	}
+	var server moonrakerServerResponse
+	if err := json.Unmarshal(serverBody, &server); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse server info: %w", ErrBadResponse, err)
+	}
+
+	return &PrinterInfo{
+		Hostname:    info.Result.Hostname,
+		Name:        info.Result.Hostname,
+		Model:       "Klipper",
+		Firmware:    info.Result.SoftwareVersion,
+		LinkVersion: server.Result.MoonrakerVersion,
+	}, nil
+}
@@ -0,0 +1,176 @@
+package prusalinkclient
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseMoonrakerQuery(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		state    string
+		progress float64
+		printing time.Duration
+	}{
+		{"moonraker_printing.json", StatusPrinting, 42.13, 1480200 * time.Millisecond},
+		{"moonraker_paused.json", StatusPaused, 47, 1601700 * time.Millisecond},
+		{"moonraker_complete.json", StatusFinished, 100, 3402 * time.Second},
+		{"moonraker_error.json", StatusError, 3, 250500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		st, err := parseMoonrakerQuery(readFixture(t, tt.fixture), time.Now())
+		if err != nil {
+			t.Errorf("%s: %v", tt.fixture, err)
+			continue
+		}
+		if !st.Status.Online || st.Status.State != tt.state || st.Status.FileName != "benchy.gcode" {
+			t.Errorf("%s: unexpected status %+v", tt.fixture, st.Status)
+		}
+		if diff := st.Status.Progress - tt.progress; diff > 0.001 || diff < -0.001 {
+			t.Errorf("%s: expected progress %v, got %v", tt.fixture, tt.progress, st.Status.Progress)
+		}
+		if st.Status.TimePrinting != tt.printing {
+			t.Errorf("%s: expected time printing %s, got %s", tt.fixture, tt.printing, st.Status.TimePrinting)
+		}
+	}
+}
+
+func TestParseMoonrakerTelemetry(t *testing.T) {
+	st, err := parseMoonrakerQuery(readFixture(t, "moonraker_printing.json"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status.FilePath != "benchy.gcode" {
+		t.Errorf("unexpected file path %q", st.Status.FilePath)
+	}
+	if want := time.Now().Add(-1523 * time.Second); st.Status.StartedAt.Sub(want).Abs() > 2*time.Second {
+		t.Errorf("expected start around %s, got %s", want, st.Status.StartedAt)
+	}
+	tel := st.Telemetry
+	if tel.TempNozzle == nil || *tel.TempNozzle != 214.8 || tel.TargetBed == nil || *tel.TargetBed != 60 {
+		t.Errorf("unexpected temperatures %+v", tel)
+	}
+	if tel.AxisZ == nil || *tel.AxisZ != 19.6 {
+		t.Errorf("unexpected position %+v", tel)
+	}
+
+	st, err = parseMoonrakerQuery(readFixture(t, "moonraker_paused.json"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Telemetry != (Telemetry{}) {
+		t.Errorf("missing objects should give empty telemetry, got %+v", st.Telemetry)
+	}
+}
+
+func TestParseMoonrakerQueryInvalid(t *testing.T) {
+	for _, body := range []string{
+		`{"result":{"status":{}}}`,
+		`{"result":{"status":{"print_stats":{"state":"exploded"}}}}`,
+	} {
+		if _, err := parseMoonrakerQuery([]byte(body), time.Now()); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+}
+
+func TestMoonrakerClient(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/printer/objects/query":
+			if !req.URL.Query().Has("print_stats") || !req.URL.Query().Has("display_status") {
+				t.Errorf("unexpected query %s", req.URL.RawQuery)
+			}
+			w.Write(readFixture(t, "moonraker_printing.json"))
+		case "/printer/info":
+			w.Write(readFixture(t, "moonraker_printer_info.json"))
+		case "/server/info":
+			w.Write(readFixture(t, "moonraker_server_info.json"))
+		default:
+			http.NotFound(w, req)
+		}
+	}
+
+	// username is ignored, moonraker knows only api keys
+	cli, _ := newTestBackend(t, PrinterConfig{Type: TypeMoonraker, Username: "maker", ApiKey: "secret"}, handler)
+	st, err := cli.JobStatus(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != StatusPrinting {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	info, err := cli.PrinterInfo(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Hostname != "voron" || info.Firmware != "v0.12.0-85-gd785b396" || info.LinkVersion != "v0.9.3-5-g7a2d6f0" {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestMoonrakerJobID(t *testing.T) {
+	var history atomic.Value
+	history.Store("moonraker_history.json")
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/printer/objects/query":
+			w.Write(readFixture(t, "moonraker_printing.json"))
+		case "/server/history/list":
+			if name := history.Load().(string); name != "" {
+				w.Write(readFixture(t, name))
+				return
+			}
+			http.NotFound(w, req)
+		}
+	}
+	cli, _ := newTestBackend(t, PrinterConfig{Type: TypeMoonraker, CacheTTL: -1}, handler)
+	jobID := func() int {
+		st, err := cli.JobStatus(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st.JobID
+	}
+
+	first := jobID()
+	if first != 0xA2 || jobID() != first {
+		t.Errorf("expected stable id of history job 0000A2, got %d", first)
+	}
+	// the same file printed again is another job
+	history.Store("moonraker_history_reprint.json")
+	if reprint := jobID(); reprint != 0xA3 {
+		t.Errorf("expected id of reprint 0000A3, got %d", reprint)
+	}
+
+	// without history component id comes from filename
+	history.Store("")
+	if id := jobID(); id == 0 || id == first || jobID() != id {
+		t.Errorf("expected stable non-zero fallback id, got %d", id)
+	}
+}
+
+func TestMoonrakerWithoutApiKey(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Header["X-Api-Key"]; ok {
+			t.Error("api key header should not be sent when key is empty")
+		}
+		w.Write(readFixture(t, "moonraker_complete.json"))
+	}
+
+	cli, _ := newTestBackend(t, PrinterConfig{Type: TypeMoonraker}, handler)
+	st, err := cli.StatusFull(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status.State != StatusFinished {
+		t.Errorf("unexpected status %+v", st.Status)
+	}
+}
@@ -0,0 +1,188 @@
+// Package prusalinktest provides fake PrusaLink client for tests
+package prusalinktest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+// FakeClient is prusalinkclient.Client walking through scripted states.
+// Every JobStatus call returns current state and moves to the next one,
+// the last state is repeated unless Loop is set. Offline states are
+// returned as ErrPrinterOffline, like real client does
+type FakeClient struct {
+	// restart script after the last state
+	Loop bool
+	// returned by JobStatus instead of scripted state when set
+	Err       error
+	Info      prusalinkclient.PrinterInfo
+	Telemetry prusalinkclient.Telemetry
+	// returned by JobThumbnail, ErrNoThumbnail if nil
+	Thumbnail []byte
+	// returned by JobMeta, ErrNoMeta if nil
+	Meta *prusalinkclient.JobMeta
+	// returned by ListFiles for any storage
+	Files []prusalinkclient.File
+
+	mu      sync.Mutex
+	steps   []prusalinkclient.Status
+	pos     int
+	calls   int
+	actions []string
+}
+
+var _ prusalinkclient.Client = (*FakeClient)(nil)
+
+func NewFakeClient(steps ...prusalinkclient.Status) *FakeClient {
+	if len(steps) == 0 {
+		steps = []prusalinkclient.Status{Idle()}
+	}
+	return &FakeClient{
+		Info: prusalinkclient.PrinterInfo{
+			Hostname: "prusa-fake",
+			Name:     "Fake printer",
+			Model:    "FAKE",
+		},
+		steps: steps,
+	}
+}
+
+// Idle is state of online printer without job
+func Idle() prusalinkclient.Status {
+	return prusalinkclient.Status{Online: true, State: prusalinkclient.StatusIdle}
+}
+
+// PrintScript returns idle state, n printing states with rising progress
+// and finished state
+func PrintScript(jobID int, fileName string, n int) []prusalinkclient.Status {
+	steps := []prusalinkclient.Status{Idle()}
+	for i := 1; i <= n; i++ {
+		steps = append(steps, prusalinkclient.Status{
+			Online:   true,
+			JobID:    jobID,
+			FileName: fileName,
+			State:    prusalinkclient.StatusPrinting,
+			Progress: float64(i * 100 / (n + 1)),
+		})
+	}
+	return append(steps, prusalinkclient.Status{
+		Online:   true,
+		JobID:    jobID,
+		FileName: fileName,
+		State:    prusalinkclient.StatusFinished,
+		Progress: 100,
+	})
+}
+
+// Set replaces script with single state
+func (f *FakeClient) Set(st prusalinkclient.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.steps = []prusalinkclient.Status{st}
+	f.pos = 0
+}
+
+// Calls returns number of JobStatus calls
+func (f *FakeClient) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *FakeClient) JobStatus(ctx context.Context) (*prusalinkclient.Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	st := f.steps[f.pos]
+	switch {
+	case f.pos < len(f.steps)-1:
+		f.pos++
+	case f.Loop:
+		f.pos = 0
+	}
+	if !st.Online {
+		return nil, prusalinkclient.ErrPrinterOffline
+	}
+	return &st, nil
+}
+
+// StatusFull returns current state without moving script forward
+func (f *FakeClient) StatusFull(ctx context.Context) (*prusalinkclient.FullStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &prusalinkclient.FullStatus{
+		Status:    f.steps[f.pos],
+		Telemetry: f.Telemetry,
+	}, nil
+}
+
+func (f *FakeClient) PrinterInfo(ctx context.Context) (*prusalinkclient.PrinterInfo, error) {
+	info := f.Info
+	return &info, nil
+}
+
+func (f *FakeClient) JobThumbnail(ctx context.Context) ([]byte, error) {
+	if f.Thumbnail == nil {
+		return nil, prusalinkclient.ErrNoThumbnail
+	}
+	return f.Thumbnail, nil
+}
+
+func (f *FakeClient) JobMeta(ctx context.Context) (*prusalinkclient.JobMeta, error) {
+	if f.Meta == nil {
+		return nil, prusalinkclient.ErrNoMeta
+	}
+	meta := *f.Meta
+	return &meta, nil
+}
+
+func (f *FakeClient) ListFiles(ctx context.Context, storage string) ([]prusalinkclient.File, error) {
+	return slices.Clone(f.Files), nil
+}
+
+// Health reports printer seen just now unless Err is set
+func (f *FakeClient) Health() prusalinkclient.Health {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return prusalinkclient.Health{ConsecutiveFailures: 1, LastError: f.Err.Error()}
+	}
+	return prusalinkclient.Health{LastSeen: time.Now()}
+}
+
+func (f *FakeClient) PauseJob(ctx context.Context, jobID int) error {
+	return f.control(fmt.Sprintf("pause %d", jobID))
+}
+
+func (f *FakeClient) ResumeJob(ctx context.Context, jobID int) error {
+	return f.control(fmt.Sprintf("resume %d", jobID))
+}
+
+func (f *FakeClient) StopJob(ctx context.Context, jobID int) error {
+	return f.control(fmt.Sprintf("stop %d", jobID))
+}
+
+func (f *FakeClient) control(action string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, action)
+	return nil
+}
+
+// Actions returns job control calls like "pause 7" in call order
+func (f *FakeClient) Actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.actions)
+}
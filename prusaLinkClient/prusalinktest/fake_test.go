@@ -0,0 +1,49 @@
+package prusalinktest
+
+import (
+	"testing"
+
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+)
+
+func TestFakeClientScript(t *testing.T) {
+	f := NewFakeClient(PrintScript(7, "benchy.gcode", 2)...)
+
+	want := []string{
+		prusalinkclient.StatusIdle,
+		prusalinkclient.StatusPrinting,
+		prusalinkclient.StatusPrinting,
+		prusalinkclient.StatusFinished,
+		prusalinkclient.StatusFinished,
+	}
+	progress := 0.0
+	for i, state := range want {
+		st, err := f.JobStatus(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.State != state {
+			t.Fatalf("step %d: expected %s, got %s", i, state, st.State)
+		}
+		if st.Progress < progress {
+			t.Errorf("step %d: progress went back to %v", i, st.Progress)
+		}
+		progress = st.Progress
+	}
+	if f.Calls() != len(want) {
+		t.Errorf("expected %d calls, got %d", len(want), f.Calls())
+	}
+}
+
+func TestFakeClientLoop(t *testing.T) {
+	f := NewFakeClient(PrintScript(7, "benchy.gcode", 1)...)
+	f.Loop = true
+
+	for range 3 {
+		f.JobStatus(t.Context())
+	}
+	st, _ := f.JobStatus(t.Context())
+	if st.State != prusalinkclient.StatusIdle {
+		t.Errorf("expected script to restart, got %s", st.State)
+	}
+}
@@ -0,0 +1,80 @@
+package prusalinkclient
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// DefaultPrinter is name of the printer configured without name
+const DefaultPrinter = "default"
+
+var ErrUnknownPrinter = errors.New("unknown printer")
+
+// Registry holds client per configured printer. Every client has own cache
+// and logs with printer=<name> tag
+type Registry struct {
+	names   []string
+	clients map[string]Client
+}
+
+// NewRegistry creates clients for configs. Names must be unique,
+// name may be omitted only when single printer is configured
+func NewRegistry(log *slog.Logger, configs []PrinterConfig) (*Registry, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no printers configured")
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+
+	r := &Registry{
+		clients: make(map[string]Client, len(configs)),
+	}
+	for i := range configs {
+		cfg := &configs[i]
+		name := cfg.Name
+		if name == "" {
+			if len(configs) > 1 {
+				return nil, fmt.Errorf("printer #%d: name is required when several printers are configured", i+1)
+			}
+			name = DefaultPrinter
+		}
+		if _, ok := r.clients[name]; ok {
+			return nil, fmt.Errorf("duplicate printer name %q", name)
+		}
+
+		cli, err := NewClient(log.With("printer", name), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("printer %q: %w", name, err)
+		}
+		r.names = append(r.names, name)
+		r.clients[name] = cli
+	}
+	return r, nil
+}
+
+// NewRegistryFor returns registry of single prebuilt client, e.g. fake one in demo mode
+func NewRegistryFor(name string, cli Client) *Registry {
+	return &Registry{
+		names:   []string{name},
+		clients: map[string]Client{name: cli},
+	}
+}
+
+// Get returns client by printer name, empty name means the first configured printer
+func (r *Registry) Get(name string) (Client, error) {
+	if name == "" {
+		name = r.names[0]
+	}
+	cli, ok := r.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownPrinter, name)
+	}
+	return cli, nil
+}
+
+// Names returns printer names in configuration order
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.names...)
+}
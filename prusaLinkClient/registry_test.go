@@ -0,0 +1,63 @@
+package prusalinkclient
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(slog.Default(), []PrinterConfig{
+		{Name: "mk4", Address: "10.0.0.1"},
+		{Name: "mini", Address: "10.0.0.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := r.Names(); !slices.Equal(names, []string{"mk4", "mini"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	first, err := r.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mk4, _ := r.Get("mk4")
+	mini, _ := r.Get("mini")
+	if first != mk4 || mk4 == mini {
+		t.Error("every printer should have own client, first one is default")
+	}
+	if mini.(*client).baseURL.Host != "10.0.0.2" {
+		t.Errorf("client built from wrong config %s", mini.(*client).baseURL)
+	}
+
+	if _, err := r.Get("xl"); !errors.Is(err, ErrUnknownPrinter) {
+		t.Errorf("expected ErrUnknownPrinter, got %v", err)
+	}
+}
+
+func TestRegistrySinglePrinter(t *testing.T) {
+	r, err := NewRegistry(slog.Default(), []PrinterConfig{{Address: "10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get(DefaultPrinter); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegistryInvalid(t *testing.T) {
+	tests := map[string][]PrinterConfig{
+		"empty":        nil,
+		"missing name": {{Name: "mk4", Address: "10.0.0.1"}, {Address: "10.0.0.2"}},
+		"duplicate":    {{Name: "mk4", Address: "10.0.0.1"}, {Name: "mk4", Address: "10.0.0.2"}},
+		"bad address":  {{Name: "mk4", Address: "ftp://10.0.0.1"}},
+		"unknown type": {{Name: "mk4", Address: "10.0.0.1", Type: "octoprint"}},
+	}
+	for name, configs := range tests {
+		if _, err := NewRegistry(slog.Default(), configs); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// FullStatus is job status with printer telemetry from /api/v1/status
+type FullStatus struct {
+	Status    Status
+	Telemetry Telemetry
+}
+
+// Telemetry fields are nil when firmware doesn't report them
+type Telemetry struct {
+	TempNozzle   *float64 `json:"tempNozzle,omitempty"`
+	TargetNozzle *float64 `json:"targetNozzle,omitempty"`
+	TempBed      *float64 `json:"tempBed,omitempty"`
+	TargetBed    *float64 `json:"targetBed,omitempty"`
+	FanHotend    *int     `json:"fanHotend,omitempty"`
+	FanPrint     *int     `json:"fanPrint,omitempty"`
+	AxisX        *float64 `json:"axisX,omitempty"`
+	AxisY        *float64 `json:"axisY,omitempty"`
+	AxisZ        *float64 `json:"axisZ,omitempty"`
+}
+
+type statusResponse struct {
+	Printer struct {
+		State        string   `json:"state,omitempty"`
+		TempNozzle   *float64 `json:"temp_nozzle,omitempty"`
+		TargetNozzle *float64 `json:"target_nozzle,omitempty"`
+		TempBed      *float64 `json:"temp_bed,omitempty"`
+		TargetBed    *float64 `json:"target_bed,omitempty"`
+		FanHotend    *int     `json:"fan_hotend,omitempty"`
+		FanPrint     *int     `json:"fan_print,omitempty"`
+		AxisX        *float64 `json:"axis_x,omitempty"`
+		AxisY        *float64 `json:"axis_y,omitempty"`
+		AxisZ        *float64 `json:"axis_z,omitempty"`
+	} `json:"printer"`
+	Job *struct {
+		ID       int     `json:"id,omitempty"`
+		Progress float64 `json:"progress,omitempty"`
+	} `json:"job,omitempty"`
+}
+
+func (c *client) StatusFull(ctx context.Context) (*FullStatus, error) {
+	if c.legacyAPI.Load() {
+		return c.legacyStatusFull(ctx)
+	}
+
+	code, data, err := c.get(ctx, "/api/v1/status")
+	if errors.Is(err, ErrPrinterOffline) {
+		return &FullStatus{Status: Status{Online: false}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code != 200 {
+		return nil, fmt.Errorf("%w: response status code %d", ErrBadResponse, code)
+	}
+
+	return parseStatusResponse(data)
+}
+
+func parseStatusResponse(body []byte) (*FullStatus, error) {
+	var resp statusResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse status: %w", ErrBadResponse, err)
+	}
+
+	p := resp.Printer
+	st := &FullStatus{
+		Status: Status{
+			Online: true,
+			State:  p.State,
+		},
+		Telemetry: Telemetry{
+			TempNozzle:   p.TempNozzle,
+			TargetNozzle: p.TargetNozzle,
+			TempBed:      p.TempBed,
+			TargetBed:    p.TargetBed,
+			FanHotend:    p.FanHotend,
+			FanPrint:     p.FanPrint,
+			AxisX:        p.AxisX,
+			AxisY:        p.AxisY,
+			AxisZ:        p.AxisZ,
+		},
+	}
+	if resp.Job != nil {
+		st.Status.JobID = resp.Job.ID
+		st.Status.Progress = resp.Job.Progress
+	}
+	return st, nil
+}
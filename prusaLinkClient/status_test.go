@@ -0,0 +1,39 @@
+package prusalinkclient
+
+import (
+	"testing"
+)
+
+func TestParseStatusResponse(t *testing.T) {
+	st, err := parseStatusResponse(readFixture(t, "status_mk4.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status.State != StatusPrinting || st.Status.JobID != 297 || st.Status.Progress != 91 {
+		t.Errorf("unexpected status %+v", st.Status)
+	}
+	tm := st.Telemetry
+	if tm.TempNozzle == nil || *tm.TempNozzle != 214.8 || tm.TargetBed == nil || *tm.TargetBed != 60 {
+		t.Errorf("unexpected temperatures %+v", tm)
+	}
+	if tm.FanPrint == nil || *tm.FanPrint != 5230 || tm.AxisZ == nil || *tm.AxisZ != 12.4 {
+		t.Errorf("unexpected fans/axis %+v", tm)
+	}
+}
+
+func TestParseStatusResponseOldFirmware(t *testing.T) {
+	st, err := parseStatusResponse(readFixture(t, "status_old.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status.State != StatusIdle || st.Status.JobID != 0 {
+		t.Errorf("unexpected status %+v", st.Status)
+	}
+	tm := st.Telemetry
+	if tm.TempNozzle == nil || *tm.TempNozzle != 24.1 {
+		t.Errorf("expected nozzle temperature, got %+v", tm)
+	}
+	if tm.TargetNozzle != nil || tm.FanHotend != nil || tm.AxisX != nil {
+		t.Errorf("missing fields should stay nil, got %+v", tm)
+	}
+}
@@ -0,0 +1,99 @@
+package prusalinkclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// JobThumbnail downloads thumbnail referenced by /api/v1/job
+func (c *client) JobThumbnail(ctx context.Context) ([]byte, error) {
+	code, data, err := c.get(ctx, "/api/v1/job")
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, ErrNoThumbnail
+	default:
+		return nil, fmt.Errorf("%w: response status code %d", ErrBadResponse, code)
+	}
+
+	var resp jobResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse job: %w", ErrBadResponse, err)
+	}
+	if resp.File.Refs.Thumbnail == "" {
+		return nil, ErrNoThumbnail
+	}
+
+	return c.getThumbnail(ctx, resp.File.Refs.Thumbnail)
+}
+
+func (c *client) getThumbnail(ctx context.Context, ref string) ([]byte, error) {
+	code, data, err := c.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, ErrNoThumbnail
+	default:
+		return nil, fmt.Errorf("%w: thumbnail response status code %d", ErrBadResponse, code)
+	}
+}
+
+type moonrakerThumbnailsResponse struct {
+	Result []struct {
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+		ThumbnailPath string `json:"thumbnail_path"`
+	} `json:"result"`
+}
+
+// JobThumbnail downloads the largest thumbnail of the file being printed
+func (c *moonrakerClient) JobThumbnail(ctx context.Context) ([]byte, error) {
+	st, err := c.JobStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if st.FileName == "" {
+		return nil, ErrNoThumbnail
+	}
+
+	code, data, err := c.get(ctx, "/server/files/thumbnails?filename="+url.QueryEscape(st.FileName))
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNoThumbnail
+	default:
+		return nil, fmt.Errorf("%w: thumbnails response status code %d", ErrBadResponse, code)
+	}
+
+	var resp moonrakerThumbnailsResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("%w: fail to parse thumbnails: %w", ErrBadResponse, err)
+	}
+	best := -1
+	for i, th := range resp.Result {
+		if best < 0 || th.Width > resp.Result[best].Width {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, ErrNoThumbnail
+	}
+
+	// thumbnail path is relative to gcode file directory
+	thumb := path.Join(path.Dir(st.FileName), resp.Result[best].ThumbnailPath)
+	return c.getThumbnail(ctx, "/server/files/gcodes/"+(&url.URL{Path: thumb}).EscapedPath())
+}
@@ -0,0 +1,101 @@
+package prusalinkclient
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+func fakePNG(t *testing.T) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJobThumbnail(t *testing.T) {
+	thumb := fakePNG(t)
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/api/v1/job":
+			w.Write([]byte(`{"id":7,"state":"PRINTING","progress":42,"file":{"display_name":"benchy.gcode",` +
+				`"refs":{"thumbnail":"/thumb/l/usb/BENCHY~1.BGC"}}}`))
+		case "/thumb/l/usb/BENCHY~1.BGC":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(thumb)
+		default:
+			http.NotFound(w, req)
+		}
+	}
+
+	cli, _ := newTestClient(t, PrinterConfig{ApiKey: "secret"}, handler)
+	data, err := cli.JobThumbnail(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, thumb) {
+		t.Error("thumbnail doesn't match served png")
+	}
+}
+
+func TestJobThumbnailMissing(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"no job": func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		},
+		"no ref": printingHandler,
+		"not found": func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/api/v1/job" {
+				http.NotFound(w, req)
+				return
+			}
+			w.Write([]byte(`{"id":7,"state":"PRINTING","file":{"refs":{"thumbnail":"/thumb/l/usb/GONE.BGC"}}}`))
+		},
+	}
+	for name, handler := range tests {
+		cli, _ := newTestClient(t, PrinterConfig{ApiKey: "secret"}, handler)
+		if _, err := cli.JobThumbnail(t.Context()); !errors.Is(err, ErrNoThumbnail) {
+			t.Errorf("%s: expected ErrNoThumbnail, got %v", name, err)
+		}
+	}
+}
+
+func TestMoonrakerJobThumbnail(t *testing.T) {
+	small, large := []byte("small"), fakePNG(t)
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/printer/objects/query":
+			w.Write([]byte(`{"result":{"status":{"print_stats":{"filename":"parts/benchy 2.gcode","state":"printing"}}}}`))
+		case "/server/files/thumbnails":
+			if req.URL.Query().Get("filename") != "parts/benchy 2.gcode" {
+				t.Errorf("unexpected filename %q", req.URL.Query().Get("filename"))
+			}
+			w.Write([]byte(`{"result":[{"width":32,"height":32,"thumbnail_path":".thumbs/benchy 2-32x32.png"},` +
+				`{"width":300,"height":300,"thumbnail_path":".thumbs/benchy 2-300x300.png"}]}`))
+		case "/server/files/gcodes/parts/.thumbs/benchy 2-32x32.png":
+			w.Write(small)
+		case "/server/files/gcodes/parts/.thumbs/benchy 2-300x300.png":
+			w.Write(large)
+		default:
+			http.NotFound(w, req)
+		}
+	}
+
+	cli, _ := newTestBackend(t, PrinterConfig{Type: TypeMoonraker}, handler)
+	data, err := cli.JobThumbnail(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, large) {
+		t.Error("expected the largest thumbnail")
+	}
+}
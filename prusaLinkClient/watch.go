@@ -0,0 +1,182 @@
+package prusalinkclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultPollInterval = time.Minute
+
+// StatusEvent is printer state transition. Status is nil if poll failed with Err
+type StatusEvent struct {
+	Status *Status
+	Err    error
+}
+
+// Watcher shares single polling loop between consumers
+type Watcher interface {
+	// Watch returns channel of state/job changes, the latest known state is sent first.
+	// Slow consumers get the newest event, stale ones are dropped.
+	// Channel is closed when ctx is cancelled
+	Watch(ctx context.Context) (<-chan StatusEvent, error)
+	// Last returns result of the latest poll
+	Last() (*Status, error)
+}
+
+// Poller polls JobStatus on interval and notifies watchers when state, job or error kind changes
+type Poller struct {
+	log      *slog.Logger
+	client   Client
+	interval time.Duration
+
+	mu       sync.Mutex
+	last     *StatusEvent
+	watchers map[chan StatusEvent]struct{}
+}
+
+var _ Watcher = (*Poller)(nil)
+
+// NewPoller creates poller, interval is a minute if zero. Polling starts with Run
+func NewPoller(log *slog.Logger, client Client, interval time.Duration) *Poller {
+	if log == nil {
+		log = slog.Default()
+	}
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	return &Poller{
+		log:      log.With("svc", "poller"),
+		client:   client,
+		interval: interval,
+		watchers: make(map[chan StatusEvent]struct{}),
+	}
+}
+
+// Run polls printer till ctx is cancelled
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll bypasses status cache, with cacheTTL above interval every other poll would get
+// status of the previous one
+func (p *Poller) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(WithFresh(ctx), p.interval)
+	st, err := p.client.JobStatus(ctx)
+	cancel()
+
+	ev := StatusEvent{Status: st, Err: err}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := eventKey(ev)
+	changed := p.last == nil || eventKey(*p.last) != key
+	p.last = &ev
+	if !changed {
+		return
+	}
+	p.log.Debug("printer state changed", "state", key.state, "jobID", key.jobID, "err", err)
+	for ch := range p.watchers {
+		notify(ch, ev.clone())
+	}
+}
+
+// clone gives every watcher own copy of status
+func (ev StatusEvent) clone() StatusEvent {
+	if ev.Status != nil {
+		st := *ev.Status
+		ev.Status = &st
+	}
+	return ev
+}
+
+type stateKey struct {
+	state string
+	jobID int
+	err   error
+}
+
+func eventKey(ev StatusEvent) stateKey {
+	if ev.Err != nil {
+		return stateKey{err: errorKind(ev.Err)}
+	}
+	return stateKey{state: ev.Status.State, jobID: ev.Status.JobID}
+}
+
+var errOther = errors.New("other error")
+
+// errorKind groups errors, so changing error details don't produce events
+func errorKind(err error) error {
+	for _, kind := range []error{ErrPrinterOffline, ErrUnauthorized, ErrBadResponse} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return errOther
+}
+
+// notify never blocks: pending event not read yet is replaced with the new one
+func notify(ch chan StatusEvent, ev StatusEvent) {
+	for {
+		select {
+		case ch <- ev:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+func (p *Poller) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan StatusEvent, 1)
+
+	p.mu.Lock()
+	p.watchers[ch] = struct{}{}
+	if p.last != nil {
+		ch <- p.last.clone()
+	}
+	p.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.watchers, ch)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (p *Poller) Last() (*Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last == nil {
+		return nil, errors.New("printer wasn't polled yet")
+	}
+	if p.last.Err != nil {
+		return nil, p.last.Err
+	}
+	st := *p.last.Status
+	return &st, nil
+}
@@ -0,0 +1,184 @@
+package prusalinkclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptClient returns scripted results of JobStatus, the last one is repeated
+type scriptClient struct {
+	Client
+
+	mu    sync.Mutex
+	steps []StatusEvent
+}
+
+func (c *scriptClient) JobStatus(ctx context.Context) (*Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ev := c.steps[0]
+	if len(c.steps) > 1 {
+		c.steps = c.steps[1:]
+	}
+	return ev.clone().Status, ev.Err
+}
+
+func status(state string, jobID int) StatusEvent {
+	return StatusEvent{Status: &Status{Online: true, State: state, JobID: jobID}}
+}
+
+func TestPollerEmitsChangesOnly(t *testing.T) {
+	cli := &scriptClient{steps: []StatusEvent{
+		status(StatusIdle, 0),
+		status(StatusIdle, 0),
+		status(StatusPrinting, 7),
+		status(StatusPrinting, 7),
+		{Err: ErrPrinterOffline},
+		{Err: errors.Join(errors.New("timeout"), ErrPrinterOffline)},
+		status(StatusPrinting, 7),
+		status(StatusFinished, 7),
+		status(StatusPrinting, 8),
+	}}
+	p := NewPoller(slog.Default(), cli, time.Second)
+
+	ch, err := p.Watch(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []stateKey
+	for range len(cli.steps) {
+		p.poll(t.Context())
+		select {
+		case ev := <-ch:
+			got = append(got, eventKey(ev))
+		default:
+		}
+	}
+
+	want := []stateKey{
+		{state: StatusIdle},
+		{state: StatusPrinting, jobID: 7},
+		{err: ErrPrinterOffline},
+		{state: StatusPrinting, jobID: 7},
+		{state: StatusFinished, jobID: 7},
+		{state: StatusPrinting, jobID: 8},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestPollerSlowWatcher(t *testing.T) {
+	cli := &scriptClient{steps: []StatusEvent{
+		status(StatusIdle, 0),
+		status(StatusPrinting, 7),
+		status(StatusFinished, 7),
+	}}
+	p := NewPoller(slog.Default(), cli, time.Second)
+	ch, _ := p.Watch(t.Context())
+
+	// nobody reads, poll must not block
+	for range 3 {
+		p.poll(t.Context())
+	}
+
+	ev := <-ch
+	if ev.Status.State != StatusFinished {
+		t.Errorf("slow watcher should get the newest event, got %+v", ev.Status)
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestPollerLateWatcherAndClose(t *testing.T) {
+	cli := &scriptClient{steps: []StatusEvent{status(StatusPrinting, 7)}}
+	p := NewPoller(slog.Default(), cli, time.Second)
+
+	if _, err := p.Last(); err == nil {
+		t.Error("expected error before first poll")
+	}
+	p.poll(t.Context())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	ch, err := p.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-ch; ev.Status.JobID != 7 {
+		t.Errorf("late watcher should get current state first, got %+v", ev.Status)
+	}
+	if st, err := p.Last(); err != nil || st.State != StatusPrinting {
+		t.Errorf("unexpected last %+v: %v", st, err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("expected channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel wasn't closed after cancel")
+	}
+	if _, err := p.Watch(ctx); err == nil {
+		t.Error("watch with cancelled context should fail")
+	}
+}
+
+func TestPollerRun(t *testing.T) {
+	cli := &scriptClient{steps: []StatusEvent{status(StatusIdle, 0), status(StatusPrinting, 7)}}
+	p := NewPoller(slog.Default(), cli, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	ch, _ := p.Watch(ctx)
+	go p.Run(ctx)
+
+	for _, state := range []string{StatusIdle, StatusPrinting} {
+		select {
+		case ev := <-ch:
+			if ev.Status.State != state {
+				t.Fatalf("expected %s, got %+v", state, ev.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %s", state)
+		}
+	}
+}
+
+func TestPollerSkipsCache(t *testing.T) {
+	var state atomic.Value
+	state.Store(StatusIdle)
+	cli, requests := newTestClient(t, PrinterConfig{CacheTTL: time.Hour}, func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"id":7,"state":%q,"progress":1,"file":{"display_name":"benchy.gcode"}}`, state.Load())
+	})
+	p := NewPoller(slog.Default(), cli, time.Second)
+
+	p.poll(t.Context())
+	state.Store(StatusPrinting)
+	p.poll(t.Context())
+	if st, err := p.Last(); err != nil || st.State != StatusPrinting {
+		t.Errorf("poll got cached status %+v: %v", st, err)
+	}
+	// other callers are served with status of the last poll
+	if st, err := cli.JobStatus(t.Context()); err != nil || st.State != StatusPrinting || requests.Load() != 2 {
+		t.Errorf("expected cached status of poll, got %+v after %d requests: %v", st, requests.Load(), err)
+	}
+}
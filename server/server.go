@@ -1,26 +1,42 @@
 package server
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/textproto"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/tuzkov/prusaCam/camera"
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
 	"github.com/tuzkov/prusaCam/service"
 )
 
 type Server interface {
 	Start() error
+	// Serve accepts connections on ln, used when listener is created elsewhere
+	Serve(ln net.Listener) error
+	// Shutdown stops accepting connections, closes cameras and waits for handlers till ctx is done
+	Shutdown(ctx context.Context) error
 }
 
 type server struct {
 	log *slog.Logger
 	cfg *Config
 
-	addr string
-	svc  service.SendService
+	addr       string
+	svc        service.SendService
+	httpServer *http.Server
 }
 
 type Config struct {
@@ -28,6 +44,8 @@ type Config struct {
 
 	Addr     string
 	LogLevel string
+	// how long shutdown waits for handlers, cameras and timelapse finish
+	ShutdownTimeout time.Duration
 }
 
 func NewServer(log *slog.Logger, cfg *Config) (Server, error) {
@@ -38,39 +56,136 @@ func NewServer(log *slog.Logger, cfg *Config) (Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("fail to create service: %w", err)
 	}
-	return &server{
+	srv := &server{
 		log: log.With("svc", "server"),
 		cfg: cfg,
 
 		addr: cfg.Addr,
 		svc:  svc,
-	}, nil
+	}
+	srv.httpServer = &http.Server{Handler: srv.routes()}
+	return srv, nil
 }
 
 func (srv *server) Start() error {
+	ln, err := net.Listen("tcp", srv.addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// Serve returns nil once server is shut down
+func (srv *server) Serve(ln net.Listener) error {
+	if err := srv.httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown closes cameras while http server waits for handlers, so streams are ended instead of waited for
+func (srv *server) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.httpServer.Shutdown(ctx)
+	}()
+	svcErr := srv.svc.Close(ctx)
+	if svcErr != nil {
+		svcErr = fmt.Errorf("fail to close service: %w", svcErr)
+	}
+	httpErr := <-done
+	if httpErr != nil {
+		httpErr = fmt.Errorf("fail to shutdown http server: %w", httpErr)
+	}
+	return errors.Join(httpErr, svcErr)
+}
+
+func (srv *server) routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/snapshot", srv.Snapshot)
 	mux.HandleFunc("/stream", srv.Stream)
 	mux.HandleFunc("/forcesend", srv.ForceSend)
+	mux.HandleFunc("/status", srv.Status)
+	mux.HandleFunc("/api/camera/info", srv.CameraInfo)
+	mux.HandleFunc("GET /cameras/{name}/snapshot", srv.Snapshot)
+	mux.HandleFunc("GET /cameras/{name}/stream", srv.Stream)
+	mux.HandleFunc("GET /cameras/{name}/info", srv.CameraInfo)
+	mux.HandleFunc("POST /api/camera/autofocus", srv.Autofocus)
+	mux.HandleFunc("POST /cameras/{name}/autofocus", srv.Autofocus)
+	mux.HandleFunc("GET /api/camera/focus", srv.Focus)
+	mux.HandleFunc("GET /cameras/{name}/focus", srv.Focus)
+	mux.HandleFunc("GET /api/camera/controls", srv.Controls)
+	mux.HandleFunc("GET /cameras/{name}/controls", srv.Controls)
+	mux.HandleFunc("GET /api/burst", srv.Burst)
+	mux.HandleFunc("GET /cameras/{name}/burst", srv.Burst)
+	mux.HandleFunc("GET /api/job/thumbnail", srv.JobThumbnail)
+	mux.HandleFunc("GET /api/timelapse", srv.Timelapse)
+	mux.HandleFunc("POST /api/timelapse/start", srv.StartTimelapse)
+	mux.HandleFunc("POST /api/timelapse/stop", srv.StopTimelapse)
+	mux.HandleFunc("GET /api/timelapse/preview", srv.TimelapsePreview)
+	mux.HandleFunc("GET /api/timelapses", srv.Videos)
+	mux.HandleFunc("DELETE /api/timelapses/{name}", srv.DeleteVideo)
+	mux.HandleFunc("GET /api/timelapses/{name}/thumbnail", srv.VideoThumbnail)
+	mux.HandleFunc("GET /api/builds", srv.Builds)
+	mux.HandleFunc("DELETE /api/builds/{id}", srv.CancelBuild)
 	mux.Handle("/list/",
 		http.StripPrefix("/list/",
-			http.FileServer(http.Dir(srv.cfg.TimelapseConfig.OutputDir))))
+			http.FileServer(noDotFiles{http.Dir(srv.cfg.TimelapseConfig.OutputDir)})))
+	return mux
+}
+
+// noDotFiles hides dot files of output dir like build queue state and quarantined
+// videos, they aren't listed and can't be opened
+type noDotFiles struct {
+	http.FileSystem
+}
+
+func (fsys noDotFiles) Open(name string) (http.File, error) {
+	if slices.ContainsFunc(strings.Split(name, "/"), isDotFile) {
+		return nil, fs.ErrNotExist
+	}
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noDotFile{f}, nil
+}
+
+type noDotFile struct {
+	http.File
+}
+
+func (f noDotFile) Readdir(count int) ([]fs.FileInfo, error) {
+	files, err := f.File.Readdir(count)
+	return slices.DeleteFunc(files, func(info fs.FileInfo) bool { return isDotFile(info.Name()) }), err
+}
 
-	return http.ListenAndServe(srv.addr, mux)
+func isDotFile(name string) bool {
+	return strings.HasPrefix(name, ".")
 }
 
 func (srv *server) Snapshot(w http.ResponseWriter, req *http.Request) {
 	srv.log.Debug("Snapshot call")
-	frame, err := srv.svc.Snapshot(req.Context())
+	ctx := req.Context()
+	if fresh, _ := strconv.ParseBool(req.URL.Query().Get("fresh")); fresh {
+		ctx = camera.WithFresh(ctx)
+	}
+	format, err := camera.ParseFormat(req.URL.Query().Get("format"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	frame, err := srv.svc.Snapshot(camera.WithFormat(ctx, format), req.PathValue("name"))
+	if err != nil {
+		cameraError(w, err)
 		return
 	}
 
-	// TODO configure
-	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Type", camera.ContentType(format))
+	w.Header().Set("X-Capture-Source", string(frame.Source))
+	w.Header().Set("X-Captured-At", frame.CapturedAt.UTC().Format(time.RFC3339))
 
-	_, err = w.Write(frame)
+	_, err = w.Write(frame.Data)
 	if err != nil {
 		srv.log.Error("Snapshot write error", "err", err)
 	}
@@ -85,9 +200,10 @@ func (srv *server) Stream(w http.ResponseWriter, req *http.Request) {
 	mpWriter.SetBoundary(boundary)
 
 	ctx := req.Context()
-	stream, err := srv.svc.Stream(ctx)
+	stream, err := srv.svc.Stream(ctx, req.PathValue("name"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		cameraError(w, err)
+		return
 	}
 	defer func() {
 		srv.log.Info("Finished stream")
@@ -126,6 +242,106 @@ func (srv *server) Stream(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Autofocus focuses camera and answers with frame taken after it, to check focus remotely
+func (srv *server) Autofocus(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("autofocus call")
+	frame, err := srv.svc.Autofocus(req.Context(), req.PathValue("name"))
+	if err != nil {
+		cameraError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("X-Capture-Source", string(frame.Source))
+	w.Header().Set("X-Captured-At", frame.CapturedAt.UTC().Format(time.RFC3339))
+	if _, err := w.Write(frame.Data); err != nil {
+		srv.log.Error("Autofocus write error", "err", err)
+	}
+}
+
+// Focus answers with fresh snapshot, its sharpness is in X-Sharpness header
+func (srv *server) Focus(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("focus call")
+	frame, err := srv.svc.Focus(req.Context(), req.PathValue("name"))
+	if err != nil {
+		cameraError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("X-Sharpness", strconv.FormatFloat(frame.Sharpness, 'f', 1, 64))
+	w.Header().Set("X-Capture-Source", string(frame.Source))
+	w.Header().Set("X-Captured-At", frame.CapturedAt.UTC().Format(time.RFC3339))
+	if _, err := w.Write(frame.Data); err != nil {
+		srv.log.Error("Focus write error", "err", err)
+	}
+}
+
+func (srv *server) Controls(w http.ResponseWriter, req *http.Request) {
+	controls, err := srv.svc.Controls(req.Context(), req.PathValue("name"))
+	if err != nil {
+		cameraError(w, err)
+		return
+	}
+	srv.writeJSON(w, controls)
+}
+
+// burst defaults, limits are checked by camera
+const (
+	defaultBurstFrames   = 5
+	defaultBurstInterval = time.Second
+)
+
+// Burst answers with zip of frames taken n=5 times interval=1s apart
+func (srv *server) Burst(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("burst call")
+	n, interval := defaultBurstFrames, defaultBurstInterval
+	query := req.URL.Query()
+	if v := query.Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid frame count", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("interval"); v != "" {
+		var err error
+		if interval, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "invalid interval", http.StatusBadRequest)
+			return
+		}
+	}
+
+	frames, err := srv.svc.Burst(req.Context(), req.PathValue("name"), n, interval)
+	if err != nil {
+		cameraError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="burst-%s.zip"`,
+		frames[0].CapturedAt.UTC().Format("20060102-150405")))
+	zw := zip.NewWriter(w)
+	for i, frame := range frames {
+		// jpeg doesn't compress further
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("frame%02d.jpg", i+1),
+			Method:   zip.Store,
+			Modified: frame.CapturedAt,
+		})
+		if err == nil {
+			_, err = fw.Write(frame.Data)
+		}
+		if err != nil {
+			srv.log.Error("Burst write error", "err", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		srv.log.Error("Burst write error", "err", err)
+	}
+}
+
 func (srv *server) ForceSend(w http.ResponseWriter, req *http.Request) {
 	srv.log.Debug("forcesend call")
 	err := srv.svc.ForceSend(req.Context())
@@ -136,3 +352,217 @@ func (srv *server) ForceSend(w http.ResponseWriter, req *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (srv *server) Status(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("status call")
+	status, err := srv.svc.Status(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	srv.writeJSON(w, status)
+}
+
+func (srv *server) CameraInfo(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("camera info call")
+	info, err := srv.svc.CameraInfo(req.Context(), req.PathValue("name"))
+	if err != nil {
+		cameraError(w, err)
+		return
+	}
+
+	srv.writeJSON(w, info)
+}
+
+func (srv *server) JobThumbnail(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("job thumbnail call")
+	thumbnail, err := srv.svc.JobThumbnail(req.Context())
+	if errors.Is(err, prusalinkclient.ErrNoThumbnail) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(thumbnail))
+	if _, err := w.Write(thumbnail); err != nil {
+		srv.log.Error("Thumbnail write error", "err", err)
+	}
+}
+
+func (srv *server) Timelapse(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("timelapse call")
+	status, err := srv.svc.Timelapse(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	srv.writeJSON(w, status)
+}
+
+func (srv *server) StartTimelapse(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("start timelapse call")
+	if err := srv.svc.StartTimelapse(req.Context(), req.URL.Query().Get("name")); err != nil {
+		timelapseError(w, err)
+		return
+	}
+	srv.Timelapse(w, req)
+}
+
+func (srv *server) StopTimelapse(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("stop timelapse call")
+	if err := srv.svc.StopTimelapse(req.Context()); err != nil {
+		timelapseError(w, err)
+		return
+	}
+	srv.Timelapse(w, req)
+}
+
+// timelapseError writes manual timelapse call error
+func timelapseError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, camera.ErrTimelapseRunning), errors.Is(err, camera.ErrTimelapseNotRunning):
+		status = http.StatusConflict
+	case errors.Is(err, camera.ErrNoTimelapse):
+		status = http.StatusNotImplemented
+	case errors.Is(err, camera.ErrLowDiskSpace):
+		status = http.StatusInsufficientStorage
+	case errors.Is(err, camera.ErrBuildQueueFull):
+		// preview is queued with builds
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (srv *server) TimelapsePreview(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("timelapse preview call")
+	preview, err := srv.svc.TimelapsePreview(req.Context())
+	switch {
+	case errors.Is(err, camera.ErrNoPreview):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		timelapseError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, req, preview)
+}
+
+func (srv *server) Videos(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("videos call")
+	videos, err := srv.svc.Videos(req.Context())
+	if err != nil {
+		videoError(w, err)
+		return
+	}
+
+	srv.writeJSON(w, videos)
+}
+
+func (srv *server) DeleteVideo(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("delete video call")
+	err := srv.svc.DeleteVideo(req.Context(), req.PathValue("name"))
+	if err != nil {
+		videoError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *server) VideoThumbnail(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("video thumbnail call")
+	thumb, err := srv.svc.VideoThumbnail(req.Context(), req.PathValue("name"))
+	if err != nil {
+		videoError(w, err)
+		return
+	}
+	http.ServeFile(w, req, thumb)
+}
+
+func videoError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, camera.ErrVideoNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, camera.ErrInvalidVideoName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, camera.ErrVideoBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, camera.ErrNoTimelapse):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (srv *server) Builds(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("builds call")
+	builds, err := srv.svc.Builds(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	srv.writeJSON(w, builds)
+}
+
+func (srv *server) CancelBuild(w http.ResponseWriter, req *http.Request) {
+	srv.log.Debug("cancel build call")
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid build id", http.StatusBadRequest)
+		return
+	}
+
+	err = srv.svc.CancelBuild(req.Context(), id)
+	if errors.Is(err, camera.ErrBuildNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// seconds busy camera asks client to wait, rpicam shot takes about that long
+const busyRetryAfter = 2
+
+// cameraError writes camera call error, busy camera is reported as retryable
+func cameraError(w http.ResponseWriter, err error) {
+	if errors.Is(err, camera.ErrCameraBusy) {
+		w.Header().Set("Retry-After", strconv.Itoa(busyRetryAfter))
+	}
+	http.Error(w, err.Error(), cameraErrorStatus(err))
+}
+
+// cameraErrorStatus is response code for camera call error
+func cameraErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCameraNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, camera.ErrCameraBusy):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, camera.ErrNoAutofocus), errors.Is(err, camera.ErrNoControls), errors.Is(err, camera.ErrNoBurst):
+		return http.StatusNotImplemented
+	case errors.Is(err, camera.ErrInvalidBurst):
+		return http.StatusBadRequest
+	case errors.Is(err, camera.ErrClosed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (srv *server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		srv.log.Error("json write error", "err", err)
+	}
+}
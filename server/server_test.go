@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tuzkov/prusaCam/camera"
+	"github.com/tuzkov/prusaCam/service"
+)
+
+// fakeService implements handlers under test, the rest of SendService panics
+type fakeService struct {
+	service.SendService
+
+	videos []camera.TimelapseVideo
+	err    error
+}
+
+func (f *fakeService) Videos(ctx context.Context) ([]camera.TimelapseVideo, error) {
+	return f.videos, f.err
+}
+
+func TestVideos(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	videos := []camera.TimelapseVideo{
+		{Name: "t1767322800-benchy-42.mp4", Format: "mp4", JobName: "benchy", JobID: 42, CreatedAt: created, SizeBytes: 1024},
+		{Name: "t1767322800-benchy-42.gif", Format: "gif", JobName: "benchy", JobID: 42, CreatedAt: created, SizeBytes: 512},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		svc    *fakeService
+		status int
+	}{
+		{"list", &fakeService{videos: videos}, http.StatusOK},
+		{"empty", &fakeService{videos: []camera.TimelapseVideo{}}, http.StatusOK},
+		{"no timelapse", &fakeService{err: camera.ErrNoTimelapse}, http.StatusNotImplemented},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &server{log: slog.Default(), cfg: &Config{}, svc: tc.svc}
+			rec := httptest.NewRecorder()
+			srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/timelapses", nil))
+
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rec.Code, rec.Body)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("unexpected content type %q", ct)
+			}
+			var got []camera.TimelapseVideo
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("fail to decode videos %q: %v", rec.Body, err)
+			}
+			if len(got) != len(tc.svc.videos) {
+				t.Fatalf("expected %d videos, got %+v", len(tc.svc.videos), got)
+			}
+			for i := range got {
+				if got[i] != tc.svc.videos[i] {
+					t.Errorf("video %d: expected %+v, got %+v", i, tc.svc.videos[i], got[i])
+				}
+			}
+		})
+	}
+}
@@ -3,51 +3,161 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/tuzkov/prusaCam/camera"
 	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/prusaLinkClient/demo"
 )
 
 const (
 	PrusaConnectSnapshotEndpoint = "https://connect.prusa3d.com/c/snapshot"
 )
 
+// ErrCameraNotFound is returned for camera name missing in config
+var ErrCameraNotFound = errors.New("camera not found")
+
 type SendService interface {
 	ForceSend(ctx context.Context) error
 	Status(ctx context.Context) (*Status, error)
-	Snapshot(ctx context.Context) (Snapshot, error)
-	Stream(ctx context.Context) (Stream, error)
+	// Snapshot, Stream and CameraInfo use default camera if name is empty
+	Snapshot(ctx context.Context, name string) (*Snapshot, error)
+	Stream(ctx context.Context, name string) (Stream, error)
+	CameraInfo(ctx context.Context, name string) (*camera.Info, error)
+	// Autofocus runs camera focus cycle and returns frame taken with it
+	Autofocus(ctx context.Context, name string) (*Snapshot, error)
+	// Controls returns current device control values of camera
+	Controls(ctx context.Context, name string) ([]camera.Control, error)
+	// Focus takes fresh snapshot and measures its sharpness, for focusing lens by hand
+	Focus(ctx context.Context, name string) (*FocusSnapshot, error)
+	// Burst captures n frames interval apart
+	Burst(ctx context.Context, name string, n int, interval time.Duration) ([]*Snapshot, error)
+	JobThumbnail(ctx context.Context) ([]byte, error)
+	// Timelapse returns state of timelapse capture of default camera
+	Timelapse(ctx context.Context) (*camera.TimelapseStatus, error)
+	// StartTimelapse starts manual timelapse of default camera, StopTimelapse finishes it
+	StartTimelapse(ctx context.Context, name string) error
+	StopTimelapse(ctx context.Context) error
+	// Videos lists finished timelapse videos newest first
+	Videos(ctx context.Context) ([]camera.TimelapseVideo, error)
+	// DeleteVideo removes finished timelapse video
+	DeleteVideo(ctx context.Context, name string) error
+	// VideoThumbnail returns path of poster image of timelapse video
+	VideoThumbnail(ctx context.Context, name string) (string, error)
+	// TimelapsePreview returns path of preview video of running timelapse
+	TimelapsePreview(ctx context.Context) (string, error)
+	Builds(ctx context.Context) (*camera.BuildsStatus, error)
+	CancelBuild(ctx context.Context, id int64) error
+	// Close stops sender and printer polling and closes cameras
+	Close(ctx context.Context) error
+}
+
+type Status struct {
+	// camera is committed to timelapse, snapshots are recycled timelapse frames
+	CameraBusy  bool           `json:"cameraBusy"`
+	LastCapture *CaptureStatus `json:"lastCapture,omitempty"`
+	// omitted when printer is offline or doesn't report it
+	Telemetry *prusalinkclient.Telemetry `json:"telemetry,omitempty"`
+	// health of configured cameras by name
+	Cameras map[string]*camera.Health `json:"cameras"`
+	// the latest motion event by camera name, cameras without motion detection or events are omitted
+	Motion map[string]*camera.MotionEvent `json:"motion,omitempty"`
+}
+
+type CaptureStatus struct {
+	Source     camera.CaptureSource `json:"source"`
+	CapturedAt time.Time            `json:"capturedAt"`
 }
 
-type Status struct{}
+type Snapshot = camera.Frame
 
-type Snapshot []byte
+type FocusSnapshot struct {
+	*Snapshot
+	// variance of Laplacian, the higher the sharper
+	Sharpness float64
+}
 
 type Stream chan []byte
 
 type service struct {
-	log        *slog.Logger
-	camera     camera.Camera
+	log *slog.Logger
+	// default camera, it captures timelapse
+	camera    camera.Camera
+	timelapse camera.Timelapse
+	// all cameras in config order, default one included
+	cameras    []*namedCamera
+	printers   *prusalinkclient.Registry
 	linkClient prusalinkclient.Client
+	watcher    prusalinkclient.Watcher
 
 	cfg          *Config
 	sendInterval time.Duration
 	httpClient   *http.Client
 	forceChan    chan struct{}
+	// stops sender and printer poller
+	stop func()
+
+	lastCapture atomic.Pointer[CaptureStatus]
+	// credentials error is already reported
+	authFailed atomic.Bool
+}
+
+// namedCamera is camera with PrusaConnect credentials it's uploaded with
+type namedCamera struct {
+	name        string
+	cam         camera.Camera
+	token       string
+	fingerprint string
+	motion      camera.MotionConfig
+	focusRegion string
+	// the latest motion event, nil if there was none
+	lastMotion atomic.Pointer[camera.MotionEvent]
+}
+
+// CameraEntry is one of several cameras
+type CameraEntry struct {
+	camera.CameraConfig
+	// camera snapshots aren't uploaded to PrusaConnect if token is empty
+	PrusaCameraToken       string
+	PrusaCameraFingerprint string
 }
 
+// DefaultCamera is name of camera configured without cameras list
+const DefaultCamera = "default"
+
 type Config struct {
+	// single printer setup, used when Printers is empty
 	prusalinkclient.PrinterConfig
+	Printers []prusalinkclient.PrinterConfig
+	// name of the printer camera and timelapse are attached to, the first one if empty
+	Printer string
+
+	// single camera setup, used with PrusaCameraToken and PrusaCameraFingerprint when Cameras is empty
+	CameraConfig camera.CameraConfig
+	Cameras      []CameraEntry
+	// camera of unnamed endpoints, timelapse is captured by it only. The first one if empty
+	DefaultCamera   string
 	TimelapseConfig camera.TimelapseConfig
 
 	Enabled                bool
 	PrusaCameraToken       string
 	PrusaCameraFingerprint string
+	// PrusaConnectSnapshotEndpoint if empty
+	PrusaConnectEndpoint string
+	// 30 seconds if zero
+	SendInterval time.Duration
+	// how often printer state is polled for timelapse and sender, a minute if zero
+	PollInterval time.Duration
+
+	// scripted fake printer instead of PrusaLink, to try the service without printer
+	Demo bool
 }
 
 func NewService(log *slog.Logger, cfg *Config) (SendService, error) {
@@ -55,99 +165,466 @@ func NewService(log *slog.Logger, cfg *Config) (SendService, error) {
 		log = slog.Default()
 	}
 
-	linkClient, err := prusalinkclient.NewClient(log, &cfg.PrinterConfig)
+	printers, err := newPrinters(log, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create link clients: %w", err)
+	}
+	linkClient, err := printers.Get(cfg.Printer)
 	if err != nil {
-		return nil, fmt.Errorf("fail to create link client: %w", err)
+		return nil, err
 	}
 
-	cam, err := camera.NewRPICamera(log, linkClient, &cfg.TimelapseConfig)
+	poller := prusalinkclient.NewPoller(log, linkClient, cfg.PollInterval)
+
+	cameras, def, err := newCameras(log, linkClient, poller, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("fail to create camera service: %w", err)
+		return nil, err
+	}
+
+	sendInterval := cfg.SendInterval
+	if sendInterval <= 0 {
+		sendInterval = 30 * time.Second
 	}
 
 	svc := &service{
 		log:        log.With("svc", "service"),
-		camera:     cam,
+		camera:     def,
+		timelapse:  def,
+		cameras:    cameras,
+		printers:   printers,
 		linkClient: linkClient,
+		watcher:    poller,
 
 		cfg:          cfg,
-		sendInterval: 30 * time.Second,
+		sendInterval: sendInterval,
 		httpClient:   &http.Client{},
 		forceChan:    make(chan struct{}),
 	}
 
+	ctx, stop := context.WithCancel(context.Background())
+	svc.stop = stop
+	go poller.Run(ctx)
+	for _, c := range cameras {
+		if c.motion.Enabled {
+			// overlay isn't drawn onto frames compared
+			events := camera.WatchMotion(ctx, log.With("camera", c.name), camera.Unwrap(c.cam), c.motion)
+			go svc.handleMotion(c, events)
+		}
+	}
+	go svc.logPrinterInfo()
+
 	if cfg.Enabled {
 		svc.log.Info("PrusaConnect enabled")
-		go svc.prusaConnectSender()
+		go svc.prusaConnectSender(ctx)
 	} else {
 		svc.log.Info("PrusaConnect disabled")
 	}
 	return svc, nil
 }
 
+// newCameras creates configured cameras, the default one captures timelapse
+func newCameras(log *slog.Logger, linkClient prusalinkclient.Client, watcher prusalinkclient.Watcher, cfg *Config) ([]*namedCamera, camera.CameraWithTL, error) {
+	entries := cfg.cameras()
+	defName := cfg.DefaultCamera
+	if defName == "" {
+		defName = entries[0].Name
+	}
+
+	var (
+		cameras []*namedCamera
+		def     camera.CameraWithTL
+	)
+	for i := range entries {
+		entry := &entries[i]
+		tlConfig := &camera.TimelapseConfig{}
+		if entry.Name == defName {
+			tlConfig = &cfg.TimelapseConfig
+		}
+		if slices.ContainsFunc(cameras, func(c *namedCamera) bool { return c.name == entry.Name }) {
+			return nil, nil, fmt.Errorf("duplicate camera name %q", entry.Name)
+		}
+
+		cam, err := camera.New(log.With("camera", entry.Name), linkClient, watcher, &entry.CameraConfig, tlConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fail to create camera %s: %w", entry.Name, err)
+		}
+		if entry.Name == defName {
+			def = cam
+		}
+		cameras = append(cameras, &namedCamera{
+			name:        entry.Name,
+			cam:         cam,
+			token:       entry.PrusaCameraToken,
+			fingerprint: entry.PrusaCameraFingerprint,
+			motion:      entry.Motion,
+			focusRegion: entry.FocusRegion,
+		})
+	}
+	if def == nil {
+		return nil, nil, fmt.Errorf("default camera %q: %w", defName, ErrCameraNotFound)
+	}
+	return cameras, def, nil
+}
+
+// cameras returns Cameras or the single camera setup, every camera is named
+func (cfg *Config) cameras() []CameraEntry {
+	if len(cfg.Cameras) == 0 {
+		entry := CameraEntry{
+			CameraConfig:           cfg.CameraConfig,
+			PrusaCameraToken:       cfg.PrusaCameraToken,
+			PrusaCameraFingerprint: cfg.PrusaCameraFingerprint,
+		}
+		if entry.Name == "" {
+			entry.Name = DefaultCamera
+		}
+		return []CameraEntry{entry}
+	}
+
+	entries := slices.Clone(cfg.Cameras)
+	for i := range entries {
+		if entries[i].Name == "" {
+			entries[i].Name = fmt.Sprintf("camera%d", i+1)
+		}
+	}
+	return entries
+}
+
+// getCamera returns camera by name, default one if name is empty
+func (svc *service) getCamera(name string) (camera.Camera, error) {
+	if name == "" {
+		return svc.camera, nil
+	}
+	c, err := svc.getNamedCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.cam, nil
+}
+
+// getNamedCamera returns camera with its config, default one if name is empty
+func (svc *service) getNamedCamera(name string) (*namedCamera, error) {
+	for _, c := range svc.cameras {
+		if c.name == name || (name == "" && c.cam == svc.camera) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%q: %w", name, ErrCameraNotFound)
+}
+
+func newPrinters(log *slog.Logger, cfg *Config) (*prusalinkclient.Registry, error) {
+	if !cfg.Demo {
+		return prusalinkclient.NewRegistry(log, cfg.printers())
+	}
+
+	log.Warn("Demo mode, using fake printer")
+	return prusalinkclient.NewRegistryFor(prusalinkclient.DefaultPrinter, demo.NewPrinter(20)), nil
+}
+
+func (cfg *Config) printers() []prusalinkclient.PrinterConfig {
+	if len(cfg.Printers) > 0 {
+		return cfg.Printers
+	}
+	return []prusalinkclient.PrinterConfig{cfg.PrinterConfig}
+}
+
+// ForceSend uploads snapshots of all cameras with PrusaConnect token
 func (svc *service) ForceSend(ctx context.Context) error {
-	return svc.sendSnapshot()
+	var errs []error
+	for _, c := range svc.cameras {
+		if c.token == "" {
+			continue
+		}
+		if err := svc.sendSnapshot(c, false); err != nil {
+			errs = append(errs, fmt.Errorf("camera %s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (svc *service) Status(ctx context.Context) (*Status, error) {
-	panic("not implemented") // TODO: Implement
+	st := &Status{
+		CameraBusy:  svc.timelapse.Capturing(),
+		LastCapture: svc.lastCapture.Load(),
+		Cameras:     make(map[string]*camera.Health, len(svc.cameras)),
+	}
+	for _, c := range svc.cameras {
+		health, err := c.cam.Health(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fail to get camera %s health: %w", c.name, err)
+		}
+		st.Cameras[c.name] = health
+		if ev := c.lastMotion.Load(); ev != nil {
+			if st.Motion == nil {
+				st.Motion = make(map[string]*camera.MotionEvent)
+			}
+			st.Motion[c.name] = ev
+		}
+	}
+
+	full, err := svc.linkClient.StatusFull(ctx)
+	if err != nil {
+		svc.log.Debug("fail to get printer telemetry", "err", err)
+	} else if full.Status.Online {
+		st.Telemetry = &full.Telemetry
+	}
+	return st, nil
+}
+
+func (svc *service) Snapshot(ctx context.Context, name string) (*Snapshot, error) {
+	cam, err := svc.getCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := cam.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	svc.noteCapture(cam, frame)
+	// backends unable to capture asked format give JPEG
+	return camera.ConvertFrame(frame, camera.FormatOf(ctx))
+}
+
+// noteCapture remembers capture of default camera for status
+func (svc *service) noteCapture(cam camera.Camera, frame *camera.Frame) {
+	if cam != svc.camera {
+		return
+	}
+	svc.lastCapture.Store(&CaptureStatus{
+		Source:     frame.Source,
+		CapturedAt: frame.CapturedAt,
+	})
 }
 
-func (svc *service) Snapshot(ctx context.Context) (Snapshot, error) {
-	return svc.camera.Snapshot(ctx)
+func (svc *service) Stream(ctx context.Context, name string) (Stream, error) {
+	cam, err := svc.getCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	return cam.Stream(ctx)
+}
+
+func (svc *service) CameraInfo(ctx context.Context, name string) (*camera.Info, error) {
+	cam, err := svc.getCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	return cam.Info(ctx)
+}
+
+func (svc *service) Autofocus(ctx context.Context, name string) (*Snapshot, error) {
+	cam, err := svc.getCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	focuser, ok := cam.(camera.Focuser)
+	if !ok {
+		return nil, camera.ErrNoAutofocus
+	}
+	frame, err := focuser.Autofocus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	svc.noteCapture(cam, frame)
+	return frame, nil
+}
+
+func (svc *service) Controls(ctx context.Context, name string) ([]camera.Control, error) {
+	cam, err := svc.getCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	controller, ok := cam.(camera.Controller)
+	if !ok {
+		return nil, camera.ErrNoControls
+	}
+	return controller.Controls(ctx)
+}
+
+func (svc *service) Focus(ctx context.Context, name string) (*FocusSnapshot, error) {
+	nc, err := svc.getNamedCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := nc.cam.Snapshot(camera.WithFresh(ctx))
+	if err != nil {
+		return nil, err
+	}
+	svc.noteCapture(nc.cam, frame)
+	sharpness, err := camera.Sharpness(frame.Data, nc.focusRegion)
+	if err != nil {
+		return nil, fmt.Errorf("fail to measure sharpness: %w", err)
+	}
+	return &FocusSnapshot{Snapshot: frame, Sharpness: sharpness}, nil
+}
+
+func (svc *service) Burst(ctx context.Context, name string, n int, interval time.Duration) ([]*Snapshot, error) {
+	cam, err := svc.getCamera(name)
+	if err != nil {
+		return nil, err
+	}
+	burster, ok := cam.(camera.Burster)
+	if !ok {
+		return nil, camera.ErrNoBurst
+	}
+	return burster.Burst(ctx, n, interval)
+}
+
+func (svc *service) JobThumbnail(ctx context.Context) ([]byte, error) {
+	return svc.linkClient.JobThumbnail(ctx)
+}
+
+func (svc *service) Timelapse(ctx context.Context) (*camera.TimelapseStatus, error) {
+	return svc.timelapse.Status(ctx)
 }
 
-func (svc *service) Stream(ctx context.Context) (Stream, error) {
-	return svc.camera.Stream(ctx)
+func (svc *service) StartTimelapse(ctx context.Context, name string) error {
+	return svc.timelapse.StartManual(ctx, name)
 }
 
-func (svc *service) prusaConnectSender() {
+func (svc *service) StopTimelapse(ctx context.Context) error {
+	return svc.timelapse.StopManual(ctx)
+}
+
+func (svc *service) Videos(ctx context.Context) ([]camera.TimelapseVideo, error) {
+	return svc.timelapse.List(ctx)
+}
+
+func (svc *service) DeleteVideo(ctx context.Context, name string) error {
+	return svc.timelapse.Delete(ctx, name)
+}
+
+func (svc *service) VideoThumbnail(ctx context.Context, name string) (string, error) {
+	return svc.timelapse.Thumbnail(ctx, name)
+}
+
+func (svc *service) TimelapsePreview(ctx context.Context) (string, error) {
+	return svc.timelapse.Preview(ctx)
+}
+
+func (svc *service) Builds(ctx context.Context) (*camera.BuildsStatus, error) {
+	return svc.timelapse.Builds(ctx)
+}
+
+func (svc *service) CancelBuild(ctx context.Context, id int64) error {
+	return svc.timelapse.CancelBuild(ctx, id)
+}
+
+func (svc *service) logPrinterInfo() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, name := range svc.printers.Names() {
+		cli, _ := svc.printers.Get(name)
+		info, err := cli.PrinterInfo(ctx)
+		if err != nil {
+			svc.log.Warn("fail to get printer info", "printer", name, "err", err)
+			continue
+		}
+		svc.log.Info("Attached to printer", "printer", name, "model", info.Model, "hostname", info.Hostname,
+			"serial", info.Serial, "firmware", info.Firmware, "prusaLink", info.LinkVersion)
+	}
+}
+
+func (svc *service) prusaConnectSender(ctx context.Context) {
 	after := time.After(time.Second)
 	for {
-		<-after
+		select {
+		case <-after:
+		case <-ctx.Done():
+			return
+		}
 		after = time.After(svc.sendInterval)
 
-		var (
-			job *prusalinkclient.Status
-			err error
-		)
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		job, err = svc.linkClient.JobStatus(ctx)
-		cancel()
-		if err != nil {
-			svc.log.Error("get printer status", "err", err)
+		svc.sendIfOnline()
+	}
+}
+
+// handleMotion logs motion events of camera and keeps the latest one for status
+func (svc *service) handleMotion(c *namedCamera, events <-chan camera.MotionEvent) {
+	for ev := range events {
+		svc.log.Info("Camera motion", "camera", c.name, "event", ev.Type, "ratio", ev.Ratio)
+		c.lastMotion.Store(&ev)
+	}
+}
+
+func (svc *service) Close(ctx context.Context) error {
+	if svc.stop != nil {
+		svc.stop()
+	}
+	var errs []error
+	for _, c := range svc.cameras {
+		if err := c.cam.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("camera %s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendIfOnline is single sender iteration: snapshot is uploaded only while printer is online
+func (svc *service) sendIfOnline() {
+	_, err := svc.watcher.Last()
+	switch {
+	case errors.Is(err, prusalinkclient.ErrPrinterOffline):
+		svc.log.Debug("Printer offline")
+		return
+	case errors.Is(err, prusalinkclient.ErrUnauthorized):
+		if !svc.authFailed.Swap(true) {
+			svc.log.Error("printer rejected credentials, check printer.username and printer.apikey in config", "err", err)
+		}
+		return
+	case err != nil:
+		svc.log.Error("get printer status", "err", err)
+		return
+	}
+	svc.authFailed.Store(false)
+
+	for _, c := range svc.cameras {
+		if c.token == "" {
 			continue
 		}
-		if !job.Online {
-			svc.log.Debug("Printer offline")
+		err = svc.sendSnapshot(c, true)
+		if errors.Is(err, errStaleFrame) {
+			svc.log.Debug("skipping stale frame upload", "camera", c.name)
 			continue
 		}
-
-		err = svc.sendSnapshot()
 		if err != nil {
-			svc.log.Error("send snapshot", "err", err)
+			svc.log.Error("send snapshot", "camera", c.name, "err", err)
 			continue
 		}
-		svc.log.Debug("snapshot sent")
+		svc.log.Debug("snapshot sent", "camera", c.name)
 	}
 }
 
-func (svc *service) sendSnapshot() error {
+var errStaleFrame = errors.New("frame is stale")
+
+// sendSnapshot uploads camera frame to PrusaConnect. With skipStale recycled frames
+// older than send interval are not uploaded (errStaleFrame returned)
+func (svc *service) sendSnapshot(c *namedCamera, skipStale bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	frame, err := svc.camera.Snapshot(ctx)
+	frame, err := c.cam.Snapshot(ctx)
 	if err != nil {
 		return fmt.Errorf("fail to get frame: %w", err)
 	}
+	svc.noteCapture(c.cam, frame)
+
+	if skipStale && frame.Source != camera.SourceFresh && time.Since(frame.CapturedAt) > svc.sendInterval {
+		return errStaleFrame
+	}
+
+	endpoint := svc.cfg.PrusaConnectEndpoint
+	if endpoint == "" {
+		endpoint = PrusaConnectSnapshotEndpoint
+	}
 
-	req, err := http.NewRequest(http.MethodPut, PrusaConnectSnapshotEndpoint, bytes.NewBuffer(frame))
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewBuffer(frame.Data))
 	if err != nil {
 		return fmt.Errorf("fail to create request: %w", err)
 	}
 
-	req.Header.Add("Token", svc.cfg.PrusaCameraToken)
-	req.Header.Add("Fingerprint", svc.cfg.PrusaCameraFingerprint)
+	req.Header.Add("Token", c.token)
+	req.Header.Add("Fingerprint", c.fingerprint)
 
 	resp, err := svc.httpClient.Do(req)
 	if err != nil {
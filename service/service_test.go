@@ -0,0 +1,251 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tuzkov/prusaCam/camera"
+	prusalinkclient "github.com/tuzkov/prusaCam/prusaLinkClient"
+	"github.com/tuzkov/prusaCam/prusaLinkClient/prusalinktest"
+)
+
+type fakeCamera struct {
+	frame  camera.Frame
+	closed atomic.Bool
+}
+
+func (c *fakeCamera) Snapshot(ctx context.Context) (*camera.Frame, error) {
+	frame := c.frame
+	return &frame, nil
+}
+
+func (c *fakeCamera) Stream(ctx context.Context) (chan []byte, error) {
+	return nil, nil
+}
+
+func (c *fakeCamera) Info(ctx context.Context) (*camera.Info, error) {
+	return &camera.Info{Backend: "fake"}, nil
+}
+
+func (c *fakeCamera) Health(ctx context.Context) (*camera.Health, error) {
+	return &camera.Health{Backend: "fake"}, nil
+}
+
+func (c *fakeCamera) Close(ctx context.Context) error {
+	c.closed.Store(true)
+	return nil
+}
+
+// polledWatcher returns fresh printer state on every Last call
+type polledWatcher struct {
+	client prusalinkclient.Client
+}
+
+func (w polledWatcher) Watch(ctx context.Context) (<-chan prusalinkclient.StatusEvent, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (w polledWatcher) Last() (*prusalinkclient.Status, error) {
+	return w.client.JobStatus(context.Background())
+}
+
+// newTestService returns service uploading to fake PrusaConnect and number of uploads it got
+func newTestService(t *testing.T, printer prusalinkclient.Client, cam *fakeCamera) (*service, *atomic.Int32) {
+	t.Helper()
+
+	uploads := &atomic.Int32{}
+	connect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || req.Header.Get("Token") != "token" {
+			t.Errorf("unexpected upload %s, token %q", req.Method, req.Header.Get("Token"))
+		}
+		uploads.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(connect.Close)
+
+	return &service{
+		log:        slog.Default(),
+		camera:     cam,
+		cameras:    []*namedCamera{{name: DefaultCamera, cam: cam, token: "token"}},
+		linkClient: printer,
+		watcher:    polledWatcher{printer},
+		cfg: &Config{
+			PrusaConnectEndpoint: connect.URL,
+		},
+		sendInterval: 30 * time.Second,
+		httpClient:   &http.Client{},
+	}, uploads
+}
+
+func TestSendIfOnline(t *testing.T) {
+	fresh := camera.Frame{Data: []byte("jpg"), Source: camera.SourceFresh, CapturedAt: time.Now()}
+	stale := camera.Frame{Data: []byte("jpg"), Source: camera.SourceTimelapse, CapturedAt: time.Now().Add(-time.Hour)}
+	printing := prusalinkclient.Status{Online: true, State: prusalinkclient.StatusPrinting, Progress: 10}
+
+	tests := []struct {
+		name    string
+		status  prusalinkclient.Status
+		frame   camera.Frame
+		uploads int32
+	}{
+		{"idle", prusalinktest.Idle(), fresh, 1},
+		{"offline", prusalinkclient.Status{}, fresh, 0},
+		{"printing", printing, fresh, 1},
+		{"stale timelapse frame", printing, stale, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, uploads := newTestService(t, prusalinktest.NewFakeClient(tt.status), &fakeCamera{frame: tt.frame})
+
+			svc.sendIfOnline()
+			if n := uploads.Load(); n != tt.uploads {
+				t.Errorf("expected %d uploads, got %d", tt.uploads, n)
+			}
+		})
+	}
+}
+
+func TestSendIfOnlineLastCapture(t *testing.T) {
+	frame := camera.Frame{Data: []byte("jpg"), Source: camera.SourceFresh, CapturedAt: time.Unix(1000, 0)}
+	svc, _ := newTestService(t, prusalinktest.NewFakeClient(), &fakeCamera{frame: frame})
+
+	svc.sendIfOnline()
+	last := svc.lastCapture.Load()
+	if last == nil || last.Source != camera.SourceFresh || !last.CapturedAt.Equal(frame.CapturedAt) {
+		t.Errorf("unexpected last capture %+v", last)
+	}
+}
+
+func TestSendIfOnlineAuthError(t *testing.T) {
+	logs := &bytes.Buffer{}
+	printer := prusalinktest.NewFakeClient()
+	printer.Err = prusalinkclient.ErrUnauthorized
+	svc, uploads := newTestService(t, printer, &fakeCamera{})
+	svc.log = slog.New(slog.NewTextHandler(logs, nil))
+
+	for range 3 {
+		svc.sendIfOnline()
+	}
+	if n := strings.Count(logs.String(), "level=ERROR"); n != 1 {
+		t.Errorf("auth error should be logged once, got %d times:\n%s", n, logs)
+	}
+	if uploads.Load() != 0 {
+		t.Error("nothing should be uploaded")
+	}
+}
+
+func TestSendIfOnlineCameras(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		tokens []string
+	)
+	connect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, req.Header.Get("Token")+"/"+req.Header.Get("Fingerprint"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer connect.Close()
+
+	frame := camera.Frame{Data: []byte("jpg"), Source: camera.SourceFresh, CapturedAt: time.Now()}
+	printer := prusalinktest.NewFakeClient()
+	toolhead, enclosure, local := &fakeCamera{frame: frame}, &fakeCamera{frame: frame}, &fakeCamera{frame: frame}
+	svc := &service{
+		log:    slog.Default(),
+		camera: toolhead,
+		cameras: []*namedCamera{
+			{name: "toolhead", cam: toolhead, token: "t1", fingerprint: "f1"},
+			{name: "enclosure", cam: enclosure, token: "t2", fingerprint: "f2"},
+			{name: "local", cam: local},
+		},
+		linkClient:   printer,
+		watcher:      polledWatcher{printer},
+		cfg:          &Config{PrusaConnectEndpoint: connect.URL},
+		sendInterval: 30 * time.Second,
+		httpClient:   &http.Client{},
+	}
+
+	svc.sendIfOnline()
+	if want := []string{"t1/f1", "t2/f2"}; !slices.Equal(tokens, want) {
+		t.Errorf("expected uploads %v, got %v", want, tokens)
+	}
+
+	for name, want := range map[string]camera.Camera{"": toolhead, "enclosure": enclosure, "local": local} {
+		if got, err := svc.getCamera(name); err != nil || got != want {
+			t.Errorf("camera %q: unexpected %v, %v", name, got, err)
+		}
+	}
+	if _, err := svc.Snapshot(t.Context(), "garage"); !errors.Is(err, ErrCameraNotFound) {
+		t.Errorf("expected ErrCameraNotFound, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	toolhead, enclosure := &fakeCamera{}, &fakeCamera{}
+	stopped := false
+	svc := &service{
+		log:     slog.Default(),
+		camera:  toolhead,
+		cameras: []*namedCamera{{name: "toolhead", cam: toolhead}, {name: "enclosure", cam: enclosure}},
+		stop:    func() { stopped = true },
+	}
+	if err := svc.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !stopped || !toolhead.closed.Load() || !enclosure.closed.Load() {
+		t.Errorf("expected sender stopped and cameras closed, got %v, %v, %v", stopped, toolhead.closed.Load(), enclosure.closed.Load())
+	}
+}
+
+func TestNewCameras(t *testing.T) {
+	cfg := &Config{
+		Cameras: []CameraEntry{
+			{CameraConfig: camera.CameraConfig{Name: "toolhead", Type: camera.TypeMock}},
+			{CameraConfig: camera.CameraConfig{Type: camera.TypeMock}, PrusaCameraToken: "token"},
+		},
+		DefaultCamera: "camera2",
+	}
+	cameras, def, err := newCameras(slog.Default(), nil, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 2 || cameras[0].name != "toolhead" || cameras[1].name != "camera2" || cameras[1].token != "token" {
+		t.Fatalf("unexpected cameras %+v", cameras)
+	}
+	if def != cameras[1].cam {
+		t.Error("default camera isn't the configured one")
+	}
+
+	cfg.DefaultCamera = "garage"
+	if _, _, err := newCameras(slog.Default(), nil, nil, cfg); !errors.Is(err, ErrCameraNotFound) {
+		t.Errorf("expected ErrCameraNotFound for missing default camera, got %v", err)
+	}
+	cfg.DefaultCamera = ""
+	cfg.Cameras[1].Name = "toolhead"
+	if _, _, err := newCameras(slog.Default(), nil, nil, cfg); err == nil {
+		t.Error("expected error for duplicate camera name")
+	}
+
+	single := &Config{
+		CameraConfig:           camera.CameraConfig{Type: camera.TypeMock},
+		PrusaCameraToken:       "token",
+		PrusaCameraFingerprint: "fingerprint",
+	}
+	cameras, _, err = newCameras(slog.Default(), nil, nil, single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cameras) != 1 || cameras[0].name != DefaultCamera || cameras[0].token != "token" || cameras[0].fingerprint != "fingerprint" {
+		t.Errorf("unexpected single camera %+v", cameras[0])
+	}
+}